@@ -200,6 +200,9 @@ func NewPeerFromChrony(s *chrony.ReplySourceData, p *chrony.ReplyNTPData) (*Peer
 		SRCAdr:       s.IPAddr.String(),
 		Reach:        uint8(s.Reachability),
 	}
+	if s.RefclockName != "" {
+		peer.SRCAdr = s.RefclockName
+	}
 	// populate data from ntpdata struct
 	if p != nil {
 		refID := chrony.RefidAsHEX(p.RefID)
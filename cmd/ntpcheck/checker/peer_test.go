@@ -106,6 +106,14 @@ func TestNewPeerFromChrony(t *testing.T) {
 	sourceData.State = chrony.SourceStateCandidate
 	sourceData.Flags = chrony.NTPFlagsTests
 
+	refclockData := &chrony.ReplySourceData{}
+	refclockData.Poll = 4
+	refclockData.Reachability = 255
+	refclockData.State = chrony.SourceStateSync
+	refclockData.Mode = chrony.SourceModeRef
+	refclockData.Flags = chrony.NTPFlagsTests
+	refclockData.RefclockName = "PPS"
+
 	ntpData := &chrony.ReplyNTPData{}
 	ntpData.Poll = 10
 	ntpData.RefID = 123456
@@ -165,6 +173,24 @@ func TestNewPeerFromChrony(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "refclock",
+			s:    refclockData,
+			p:    nil,
+			want: &Peer{
+				Offset:     -0,
+				HPoll:      4,
+				PPoll:      4,
+				Flashers:   []string{},
+				Configured: true,
+				Reachable:  true,
+				Selection:  control.SelSYSPeer,
+				Condition:  chrony.SourceStateDesc[chrony.SourceStateSync],
+				Reach:      255,
+				SRCAdr:     "PPS",
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
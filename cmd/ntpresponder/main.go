@@ -26,6 +26,7 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"time"
 
 	"github.com/facebook/time/ntp/responder/announce"
 	"github.com/facebook/time/ntp/responder/checker"
@@ -47,6 +48,7 @@ func main() {
 
 	flag.StringVar(&logLevel, "loglevel", "info", "Set a log level. Can be: debug, info, warning, error")
 	flag.StringVar(&s.ListenConfig.Iface, "interface", "lo", "Interface to add IPs to")
+	flag.StringVar(&s.PHCDevice, "phcdevice", "", "PHC device to use as a reference clock. System clock is used if empty")
 	flag.StringVar(&s.RefID, "refid", "OLEG", "Reference ID of the server")
 	flag.IntVar(&s.ListenConfig.Port, "port", 123, "Port to run service on")
 	flag.IntVar(&monitoringport, "monitoringport", 0, "Port to run monitoring server on")
@@ -56,6 +58,7 @@ func main() {
 	flag.BoolVar(&debugger, "pprof", false, "Enable pprof")
 	flag.BoolVar(&s.ListenConfig.ShouldAnnounce, "announce", false, "Advertize IPs")
 	flag.DurationVar(&s.ExtraOffset, "extraoffset", 0, "Extra offset to return to clients")
+	flag.DurationVar(&s.UTCOffset, "utcoffset", 37*time.Second, "TAI to UTC offset of the PHC reference clock")
 
 	flag.Parse()
 	s.ListenConfig.IPs.SetDefault()
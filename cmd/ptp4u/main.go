@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net"
@@ -24,6 +25,8 @@ import (
 	_ "net/http/pprof"
 	"time"
 
+	"github.com/facebook/time/phc"
+	ptp "github.com/facebook/time/ptp/protocol"
 	"github.com/facebook/time/ptp/ptp4u/drain"
 	"github.com/facebook/time/ptp/ptp4u/server"
 	"github.com/facebook/time/ptp/ptp4u/stats"
@@ -32,36 +35,59 @@ import (
 )
 
 func main() {
-	// Set reasonable defaults for Dynamic config
-	c := &server.Config{
-		DynamicConfig: server.DynamicConfig{
-			ClockAccuracy:  0x21,
-			ClockClass:     6,
-			DrainInterval:  30 * time.Second,
-			MaxSubDuration: 1 * time.Hour,
-			MetricInterval: 1 * time.Minute,
-			MinSubInterval: 1 * time.Second,
-			UTCOffset:      37 * time.Second,
-		},
-	}
+	// Dynamic config defaults are set by the profile
+	c := &server.Config{}
 
 	var ipaddr string
+	var prewarmIP string
+	var clockIdentity string
+	var cpuAffinity string
+	var eventPorts string
+	var generalPorts string
+	var profile string
+	var domainNumber int
+	var selfTest bool
 
+	flag.IntVar(&domainNumber, "domain", -1, "PTP domain number of sent messages, delay requests from other domains are dropped. Valid values depend on the profile, e.g. 0-127 for default. Defaults to the one of the profile")
 	flag.IntVar(&c.DSCP, "dscp", 0, "DSCP for PTP packets, valid values are between 0-63 (used by send workers)")
+	flag.IntVar(&c.HealthTXTSFailures, "healthtxtsfailures", 0, "Number of consecutive TX timestamp read failures of a send worker after which /health reports unhealthy. Not checked if 0")
+	flag.IntVar(&c.MaxSendWorkers, "maxworkers", 0, "Maximum number of send workers to scale up to under queue pressure. Scaling is disabled unless above -workers")
 	flag.IntVar(&c.MonitoringPort, "monitoringport", 8888, "Port to run monitoring server on")
+	flag.IntVar(&c.MTU, "mtu", 0, "MTU of the path to clients. Packets which don't fit are not sent. Interface MTU if 0")
+	flag.IntVar(&c.PortNumber, "portnumber", 1, "Port number of sourcePortIdentity of sent messages, valid values are between 1-65534. Distinct ones tell apart instances sharing -clockidentity")
 	flag.IntVar(&c.QueueSize, "queue", 0, "Size of the queue to send out packets")
+	flag.IntVar(&c.RecvBufferBytes, "rcvbuf", 0, "Socket receive buffer size of send workers in bytes. Kernel default if 0, clamped by net.core.rmem_max")
 	flag.IntVar(&c.RecvWorkers, "recvworkers", 10, "Set the number of receive workers")
+	flag.IntVar(&c.ScaleQueueThreshold, "scalequeue", 0, "Worker queue depth which triggers adding a send worker. Requires -queue")
+	flag.IntVar(&c.SendBufferBytes, "sndbuf", 0, "Socket send buffer size of send workers in bytes. Kernel default if 0, clamped by net.core.wmem_max")
 	flag.IntVar(&c.SendWorkers, "workers", 100, "Set the number of send workers")
+	flag.IntVar(&c.SyncBatch, "syncbatch", 0, "Maximum number of queued Syncs a send worker sends with one sendmmsg call, reading their TX timestamps at once. Disabled if 0 or 1")
+	flag.IntVar(&c.TransportSpecific, "transportspecific", 0, "transportSpecific (majorSdoId) of PTP messages, e.g. 1 for 802.1AS, valid values are between 0-15")
+	flag.StringVar(&clockIdentity, "clockidentity", "", "Clock identity override, e.g. 0c42a1.fffe.6d7ca6. Derived from the interface MAC by default")
 	flag.StringVar(&c.ConfigFile, "config", "", "Path to a config with dynamic settings")
+	flag.StringVar(&cpuAffinity, "cpuaffinity", "", "Comma separated CPUs and CPU ranges to pin send workers to, e.g. 0,2,4-7. Workers wrap around the list")
 	flag.StringVar(&c.DebugAddr, "pprofaddr", "", "host:port for the pprof to bind")
+	flag.StringVar(&eventPorts, "eventports", "", "Source port or port range of send worker event sockets, e.g. 32000-32099. Every worker takes a distinct port, rebinding after link loss needs a spare one. Ephemeral if empty")
+	flag.StringVar(&generalPorts, "generalports", "", "Source port or port range of send worker general sockets, e.g. 32100-32199. Every worker takes a distinct port, rebinding after link loss needs a spare one. Ephemeral if empty")
+	flag.StringVar(&c.DispatchPolicy, "dispatch", server.DispatchHash, fmt.Sprintf("Policy to pick a send worker for a new client. Can be: %s, %s", server.DispatchHash, server.DispatchLeastLoaded))
 	flag.StringVar(&c.Interface, "iface", "eth0", "Set the interface")
-	flag.StringVar(&c.LogLevel, "loglevel", "warning", "Set a log level. Can be: debug, info, warning, error")
+	flag.StringVar(&c.LeapSecondsFile, "leapsecondsfile", "", "Timezone file with leap seconds, e.g. /usr/share/zoneinfo/right/UTC. Announced UTC offset follows it instead of the config. Disabled if empty")
+	flag.StringVar(&c.LogLevel, "loglevel", "warning", "Set a log level. Can be: trace, debug, info, warning, error")
 	flag.StringVar(&c.PidFile, "pidfile", "/var/run/ptp4u.pid", "Pid file location")
+	flag.StringVar(&profile, "profile", string(server.ProfileDefault), fmt.Sprintf("PTP profile to set conformant defaults. Can be: %s, %s", server.ProfileDefault, server.ProfileG82752))
+	flag.StringVar(&c.QueuePolicy, "queuepolicy", server.QueuePolicyBlock, fmt.Sprintf("What to do when a send worker queue is full. Can be: %s, %s, %s. Dropping requires -queue", server.QueuePolicyBlock, server.QueuePolicyDropNewest, server.QueuePolicyDropOldest))
 	flag.StringVar(&c.TimestampType, "timestamptype", timestamp.HWTIMESTAMP, fmt.Sprintf("Timestamp type. Can be: %s, %s", timestamp.HWTIMESTAMP, timestamp.SWTIMESTAMP))
+	flag.StringVar(&c.Transport, "transport", "", fmt.Sprintf("PTP transport. Can be: %s. Defaults to the one of the profile", server.TransportUDP))
 	flag.StringVar(&ipaddr, "ip", "::", "IP to bind on")
+	flag.StringVar(&prewarmIP, "prewarmip", "", "IP to send a dummy Sync to (discard port) on worker start, so TX timestamping is warmed up before the first client. Disabled if empty")
+	flag.BoolVar(&c.TXTimestampFallback, "txtsfallback", false, "Send FollowUp with a less accurate userspace timestamp taken right after Sync is sent when TX timestamp can't be read, instead of not sending it")
+	flag.DurationVar(&c.HealthUnlocked, "healthunlocked", 0, "How long the clock class may stay other than 6 (locked) before /health reports unhealthy. Not checked if 0")
+	flag.BoolVar(&selfTest, "selftest", false, "Send Sync and FollowUp to a local client through the real send path with software timestamps, report the result and exit")
 	flag.Parse()
 
 	switch c.LogLevel {
+	case "trace":
+		log.SetLevel(log.TraceLevel)
 	case "debug":
 		log.SetLevel(log.DebugLevel)
 	case "info":
@@ -74,29 +100,109 @@ func main() {
 		log.Fatalf("Unrecognized log level: %v", c.LogLevel)
 	}
 
+	c.Profile = server.Profile(profile)
+	if err := c.ApplyProfile(); err != nil {
+		log.Fatal(err)
+	}
+	// explicit domain number overrides the profile default
+	if domainNumber != -1 {
+		c.DomainNumber = domainNumber
+	}
+
+	// config file overrides the profile defaults
 	if c.ConfigFile != "" {
-		dc, err := server.ReadDynamicConfig(c.ConfigFile)
+		dc, err := c.ReadDynamicConfig()
 		if err != nil {
 			log.Fatal(err)
 		}
 		c.DynamicConfig = *dc
 	}
 
+	if err := c.ValidateProfile(); err != nil {
+		log.Fatal(err)
+	}
+
 	if c.DSCP < 0 || c.DSCP > 63 {
 		log.Fatalf("Unsupported DSCP value %v", c.DSCP)
 	}
 
+	if c.PortNumber < 1 || c.PortNumber > 0xfffe {
+		log.Fatalf("Unsupported port number %v", c.PortNumber)
+	}
+
+	if c.TransportSpecific < 0 || c.TransportSpecific > 15 {
+		log.Fatalf("Unsupported transportSpecific value %v", c.TransportSpecific)
+	}
+
+	switch c.QueuePolicy {
+	case server.QueuePolicyBlock:
+	case server.QueuePolicyDropNewest, server.QueuePolicyDropOldest:
+		if c.QueueSize == 0 {
+			log.Fatalf("Queue policy %s requires -queue", c.QueuePolicy)
+		}
+	default:
+		log.Fatalf("Unsupported queue policy %s", c.QueuePolicy)
+	}
+
+	if c.SendBufferBytes < 0 || c.RecvBufferBytes < 0 {
+		log.Fatalf("Unsupported socket buffer sizes sndbuf=%d rcvbuf=%d", c.SendBufferBytes, c.RecvBufferBytes)
+	}
+
+	if c.SyncBatch < 0 {
+		log.Fatalf("Unsupported sync batch size %d", c.SyncBatch)
+	}
+
 	switch c.TimestampType {
 	case timestamp.SWTIMESTAMP:
 		log.Warning("Software timestamps greatly reduce the precision")
-		fallthrough
 	case timestamp.HWTIMESTAMP:
-		log.Debugf("Using %s timestamps", c.TimestampType)
+		// fail early rather than in every send worker
+		info, err := phc.IfaceTimestampingInfo(c.Interface)
+		if err != nil {
+			log.Fatalf("Failed to get timestamping capabilities of %s: %v", c.Interface, err)
+		}
+		if !info.HardwareTX() || !info.SupportsPTPv2() {
+			log.Fatalf("Interface %s can't timestamp PTP packets in hardware, use -timestamptype %s", c.Interface, timestamp.SWTIMESTAMP)
+		}
 	default:
 		log.Fatalf("Unrecognized timestamp type: %s", c.TimestampType)
 	}
+	log.Debugf("Using %s timestamps", c.TimestampType)
+
+	switch c.DispatchPolicy {
+	case server.DispatchHash, server.DispatchLeastLoaded:
+		log.Debugf("Using %s dispatch", c.DispatchPolicy)
+	default:
+		log.Fatalf("Unrecognized dispatch policy: %s", c.DispatchPolicy)
+	}
+
+	cpus, err := server.ParseCPUList(cpuAffinity)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.CPUAffinity = cpus
+
+	if c.EventPorts, err = server.ParsePortRange(eventPorts); err != nil {
+		log.Fatal(err)
+	}
+	if c.GeneralPorts, err = server.ParsePortRange(generalPorts); err != nil {
+		log.Fatal(err)
+	}
+
+	if clockIdentity != "" {
+		ci, err := ptp.ParseClockIdentity(clockIdentity)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.ClockIdentity = ci
+	}
 
 	c.IP = net.ParseIP(ipaddr)
+	if prewarmIP != "" {
+		if c.PrewarmIP = net.ParseIP(prewarmIP); c.PrewarmIP == nil {
+			log.Fatalf("Invalid pre-warm IP '%s'", prewarmIP)
+		}
+	}
 	found, err := c.IfaceHasIP()
 	if err != nil {
 		log.Fatal(err)
@@ -112,7 +218,24 @@ func main() {
 		}()
 	}
 
-	log.Infof("UTC offset is: %v", c.UTCOffset)
+	if c.LeapSecondsFile != "" {
+		if err := c.LoadLeapSeconds(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	utcOffset, _ := c.UTCOffsetAt(time.Now())
+	log.Infof("UTC offset is: %v", utcOffset)
+
+	if selfTest {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		res, err := (&server.Server{Config: c}).SelfTest(ctx)
+		if err != nil {
+			log.Fatalf("Self-test failed: %v", err)
+		}
+		fmt.Printf("Self-test passed: TX timestamp read in %v, preciseOriginTimestamp %v\n", res.TXTSLatency, res.PreciseOriginTimestamp)
+		return
+	}
 
 	// Monitoring
 	// Replace with your implementation of Stats
@@ -128,6 +251,8 @@ func main() {
 		Stats:  st,
 		Checks: checks,
 	}
+	st.HandleFunc("/subscriptions", s.SubscriptionsHandler)
+	st.HandleFunc("/health", s.HealthHandler)
 
 	if err := s.Start(); err != nil {
 		log.Fatalf("Server run failed: %v", err)
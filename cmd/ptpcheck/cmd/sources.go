@@ -95,7 +95,7 @@ func sourcesRun(server string, noDNS bool) error {
 		}
 		if entry.PortState != ptp.UnicastMasterStateWait {
 			val = append(val, []string{
-				fmt.Sprintf("%d:0x%x", entry.ClockQuality.ClockClass, entry.ClockQuality.ClockAccuracy),
+				fmt.Sprintf("%d:0x%x", entry.ClockQuality.ClockClass, uint8(entry.ClockQuality.ClockAccuracy)),
 				fmt.Sprintf("0x%x", entry.ClockQuality.OffsetScaledLogVariance),
 				fmt.Sprintf("%d:%d", entry.Priority1, entry.Priority2),
 			}...)
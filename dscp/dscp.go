@@ -0,0 +1,126 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package dscp implements helpers to set and read DSCP (Differentiated Services Code Point)
+on sockets regardless of their address family.
+*/
+package dscp
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Enable sets DSCP on a socket. DSCP value is shifted into the high 6 bits
+// of either IP_TOS (IPv4) or IPV6_TCLASS (IPv6) depending on localAddr
+func Enable(fd int, localAddr net.IP, dscp int) error {
+	if localAddr.To4() == nil {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, dscp<<2); err != nil {
+			return err
+		}
+	} else {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TOS, dscp<<2); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get reads DSCP back from a socket, from IP_TOS (IPv4) or IPV6_TCLASS (IPv6) depending on localAddr
+func Get(fd int, localAddr net.IP) (int, error) {
+	var tos int
+	var err error
+	if localAddr.To4() == nil {
+		tos, err = unix.GetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS)
+	} else {
+		tos, err = unix.GetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TOS)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return tos >> 2, nil
+}
+
+// SetDSCP sets DSCP on a connection. Address family is detected from the local address
+func SetDSCP(conn net.Conn, dscp int) error {
+	if dscp < 0 || dscp > 63 {
+		return fmt.Errorf("unsupported DSCP value %d, valid values are between 0-63", dscp)
+	}
+	var serr error
+	err := control(conn, func(fd int, localAddr net.IP) {
+		serr = Enable(fd, localAddr, dscp)
+	})
+	if err != nil {
+		return err
+	}
+	if serr != nil {
+		return fmt.Errorf("setting DSCP: %w", serr)
+	}
+	return nil
+}
+
+// GetDSCP reads DSCP back from a connection, as accepted by the kernel.
+// Address family is detected from the local address
+func GetDSCP(conn net.Conn) (int, error) {
+	var dscp int
+	var gerr error
+	err := control(conn, func(fd int, localAddr net.IP) {
+		dscp, gerr = Get(fd, localAddr)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if gerr != nil {
+		return 0, fmt.Errorf("getting DSCP: %w", gerr)
+	}
+	return dscp, nil
+}
+
+// control runs f on the connection file descriptor along with its local address
+func control(conn net.Conn, f func(fd int, localAddr net.IP)) error {
+	var localAddr net.IP
+	switch v := conn.LocalAddr().(type) {
+	case *net.UDPAddr:
+		localAddr = v.IP
+	case *net.TCPAddr:
+		localAddr = v.IP
+	case *net.IPAddr:
+		localAddr = v.IP
+	default:
+		return fmt.Errorf("unsupported socket type %T", v)
+	}
+
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return fmt.Errorf("unsupported connection type %T", conn)
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("getting raw connection: %w", err)
+	}
+
+	err = rc.Control(func(fd uintptr) {
+		f(int(fd), localAddr)
+	})
+	if err != nil {
+		return fmt.Errorf("accessing raw connection: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dscp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestEnable(t *testing.T) {
+	conn4, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer conn4.Close()
+	// get connection file descriptor
+	fd4, err := timestamp.ConnFd(conn4)
+	require.NoError(t, err)
+	err = Enable(fd4, net.ParseIP("127.0.0.1"), 42)
+	require.NoError(t, err)
+
+	conn6, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::"), Port: 0})
+	require.NoError(t, err)
+	defer conn6.Close()
+	// get connection file descriptor
+	fd6, err := timestamp.ConnFd(conn6)
+	require.NoError(t, err)
+	err = Enable(fd6, net.ParseIP("::"), 42)
+	require.NoError(t, err)
+}
+
+func TestSetDSCPv4(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	err = SetDSCP(conn, 42)
+	require.NoError(t, err)
+
+	fd, err := timestamp.ConnFd(conn)
+	require.NoError(t, err)
+	tos, err := unix.GetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TOS)
+	require.NoError(t, err)
+	require.Equal(t, 42<<2, tos)
+}
+
+func TestSetDSCPv6(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::1"), Port: 0})
+	if err != nil {
+		t.Skipf("IPv6 loopback is not available: %v", err)
+	}
+	defer conn.Close()
+
+	err = SetDSCP(conn, 42)
+	require.NoError(t, err)
+
+	fd, err := timestamp.ConnFd(conn)
+	require.NoError(t, err)
+	tclass, err := unix.GetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS)
+	require.NoError(t, err)
+	require.Equal(t, 42<<2, tclass)
+}
+
+func TestSetDSCPInvalid(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	err = SetDSCP(conn, 64)
+	require.Error(t, err)
+	err = SetDSCP(conn, -1)
+	require.Error(t, err)
+}
+
+func TestSetDSCPUnsupported(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	err := SetDSCP(c1, 42)
+	require.Error(t, err)
+}
+
+func TestGet(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer conn.Close()
+	fd, err := timestamp.ConnFd(conn)
+	require.NoError(t, err)
+
+	v, err := Get(fd, net.ParseIP("127.0.0.1"))
+	require.NoError(t, err)
+	require.Equal(t, 0, v)
+
+	require.NoError(t, Enable(fd, net.ParseIP("127.0.0.1"), 35))
+	v, err = Get(fd, net.ParseIP("127.0.0.1"))
+	require.NoError(t, err)
+	require.Equal(t, 35, v)
+}
+
+func TestGetDSCPv4(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, SetDSCP(conn, 42))
+	v, err := GetDSCP(conn)
+	require.NoError(t, err)
+	require.Equal(t, 42, v)
+}
+
+func TestGetDSCPv6(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::1"), Port: 0})
+	if err != nil {
+		t.Skipf("IPv6 loopback is not available: %v", err)
+	}
+	defer conn.Close()
+
+	require.NoError(t, SetDSCP(conn, 42))
+	v, err := GetDSCP(conn)
+	require.NoError(t, err)
+	require.Equal(t, 42, v)
+}
+
+func TestGetDSCPUnsupported(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	_, err := GetDSCP(c1)
+	require.Error(t, err)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package fbclock implements bounded time: current time of a disciplined clock
+together with a conservative estimate of its error.
+
+Instead of a single timestamp consumers get a window [t - errorBound, t + errorBound]
+which is guaranteed (as long as inputs are correct) to contain the true time.
+
+The error bound is calculated as:
+
+	errorBound = offsetError + staleness * driftPPB / 1e9
+
+where
+  - offsetError is the absolute error of the last offset measurement (as reported by the servo/PHC)
+  - staleness is time passed since the last successful sync
+  - driftPPB is the estimated frequency instability of the clock while in holdover
+*/
+package fbclock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ClockState is a state of the disciplined clock required to calculate the error bound
+type ClockState struct {
+	// LastSync is the time of the last successful sync
+	LastSync time.Time
+	// OffsetError is the absolute error of the last offset measurement
+	OffsetError time.Duration
+	// DriftPPB is the estimated drift rate of the clock in PPB
+	DriftPPB float64
+}
+
+// ErrorBound returns conservative error bound of the clock after staleness time without sync
+func (s *ClockState) ErrorBound(staleness time.Duration) time.Duration {
+	if staleness < 0 {
+		staleness = 0
+	}
+	offsetError := s.OffsetError
+	if offsetError < 0 {
+		offsetError = -offsetError
+	}
+	drift := s.DriftPPB
+	if drift < 0 {
+		drift = -drift
+	}
+	return offsetError + time.Duration(float64(staleness)*drift/1e9)
+}
+
+// BoundedClock provides time with the error bound
+type BoundedClock struct {
+	sync.Mutex
+
+	// Now returns current time of the disciplined clock. time.Now is used if not set
+	Now func() time.Time
+
+	state ClockState
+}
+
+// Update sets latest clock state
+func (c *BoundedClock) Update(state ClockState) {
+	c.Lock()
+	defer c.Unlock()
+	c.state = state
+}
+
+// State returns latest clock state
+func (c *BoundedClock) State() ClockState {
+	c.Lock()
+	defer c.Unlock()
+	return c.state
+}
+
+// Time returns current time and the conservative error bound
+func (c *BoundedClock) Time() (time.Time, time.Duration, error) {
+	state := c.State()
+	if state.LastSync.IsZero() {
+		return time.Time{}, 0, fmt.Errorf("clock was never synchronized")
+	}
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+	t := now()
+	return t, state.ErrorBound(t.Sub(state.LastSync)), nil
+}
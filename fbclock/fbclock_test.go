@@ -0,0 +1,80 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fbclock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorBound(t *testing.T) {
+	s := &ClockState{
+		OffsetError: 50 * time.Nanosecond,
+		DriftPPB:    100,
+	}
+	require.Equal(t, 50*time.Nanosecond, s.ErrorBound(0))
+	require.Equal(t, 150*time.Nanosecond, s.ErrorBound(time.Second))
+	require.Equal(t, 1050*time.Nanosecond, s.ErrorBound(10*time.Second))
+	// negative staleness is treated as no staleness
+	require.Equal(t, 50*time.Nanosecond, s.ErrorBound(-time.Second))
+}
+
+func TestErrorBoundNegativeInputs(t *testing.T) {
+	s := &ClockState{
+		OffsetError: -50 * time.Nanosecond,
+		DriftPPB:    -100,
+	}
+	require.Equal(t, 150*time.Nanosecond, s.ErrorBound(time.Second))
+}
+
+func TestErrorBoundMonotonic(t *testing.T) {
+	s := &ClockState{
+		OffsetError: 20 * time.Nanosecond,
+		DriftPPB:    3.5,
+	}
+	prev := s.ErrorBound(0)
+	for staleness := time.Millisecond; staleness < time.Hour; staleness *= 2 {
+		b := s.ErrorBound(staleness)
+		require.GreaterOrEqual(t, b, prev, "bound decreased at staleness %v", staleness)
+		prev = b
+	}
+}
+
+func TestBoundedClockTime(t *testing.T) {
+	lastSync := time.Unix(1653574589, 0)
+	now := lastSync
+	c := &BoundedClock{Now: func() time.Time { return now }}
+
+	_, _, err := c.Time()
+	require.Error(t, err)
+
+	c.Update(ClockState{LastSync: lastSync, OffsetError: 100 * time.Nanosecond, DriftPPB: 10})
+	require.Equal(t, lastSync, c.State().LastSync)
+
+	ts, bound, err := c.Time()
+	require.NoError(t, err)
+	require.Equal(t, now, ts)
+	require.Equal(t, 100*time.Nanosecond, bound)
+
+	now = lastSync.Add(10 * time.Second)
+	ts, bound, err = c.Time()
+	require.NoError(t, err)
+	require.Equal(t, now, ts)
+	require.Equal(t, 200*time.Nanosecond, bound)
+}
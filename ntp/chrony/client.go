@@ -17,32 +17,541 @@ limitations under the License.
 package chrony
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"net"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// defaults of reconnection with exponential backoff
+const (
+	defaultReconnectAttempts   = 5
+	defaultReconnectBackoff    = 100 * time.Millisecond
+	defaultMaxReconnectBackoff = 5 * time.Second
+)
+
 // Client talks to chronyd
 type Client struct {
 	Connection io.ReadWriter
 	Sequence   uint32
+
+	// Dial creates a new connection to chronyd, e.g. after chronyd restart.
+	// When set, connection broken by a read or write error is replaced by a new one
+	// with sequence starting over, and the request is sent again. Never reconnects if unset
+	Dial func() (io.ReadWriter, error)
+	// ReconnectAttempts is how many times Dial is tried before giving up, defaultReconnectAttempts if 0
+	ReconnectAttempts int
+	// ReconnectBackoff is the delay after the first failed Dial, doubled after each next one.
+	// defaultReconnectBackoff if 0
+	ReconnectBackoff time.Duration
+	// MaxReconnectBackoff caps the delay between Dial attempts, defaultMaxReconnectBackoff if 0
+	MaxReconnectBackoff time.Duration
+	// OnReconnect is called with the error which broke the connection once it's replaced
+	OnReconnect func(err error)
+	// Reconnects is the number of times the connection was replaced
+	Reconnects uint64
+
+	// sleep waits between Dial attempts, time.Sleep if nil
+	sleep func(time.Duration)
+}
+
+// connError is a read or write error after which the connection is not usable anymore
+type connError struct {
+	err error
+}
+
+func (e *connError) Error() string {
+	return e.err.Error()
+}
+
+func (e *connError) Unwrap() error {
+	return e.err
+}
+
+// send encodes the packet and writes it to the connection
+func (n *Client) send(packet RequestPacket) error {
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.BigEndian, packet); err != nil {
+		return err
+	}
+	if _, err := n.Connection.Write(buf.Bytes()); err != nil {
+		return &connError{err: err}
+	}
+	return nil
+}
+
+// receive reads a single reply packet from the connection
+func (n *Client) receive(response []uint8) (int, error) {
+	read, err := n.Connection.Read(response)
+	if err != nil {
+		return 0, &connError{err: err}
+	}
+	log.Debugf("Read %d bytes", read)
+	return read, nil
+}
+
+// reconnect replaces the connection broken by cause using Dial, backing off exponentially between attempts
+func (n *Client) reconnect(cause error) error {
+	if c, ok := n.Connection.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Debugf("closing broken connection: %v", err)
+		}
+	}
+	attempts := n.ReconnectAttempts
+	if attempts <= 0 {
+		attempts = defaultReconnectAttempts
+	}
+	backoff := n.ReconnectBackoff
+	if backoff <= 0 {
+		backoff = defaultReconnectBackoff
+	}
+	maxBackoff := n.MaxReconnectBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxReconnectBackoff
+	}
+	sleep := n.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			sleep(backoff)
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+		var conn io.ReadWriter
+		if conn, err = n.Dial(); err != nil {
+			log.Debugf("reconnecting to chronyd, attempt %d of %d: %v", i+1, attempts, err)
+			continue
+		}
+		n.Connection = conn
+		n.Sequence = 0
+		n.Reconnects++
+		log.Infof("reconnected to chronyd after: %v", cause)
+		if n.OnReconnect != nil {
+			n.OnReconnect(cause)
+		}
+		return nil
+	}
+	return err
+}
+
+// retry runs the transaction, running it once more over a new connection if the connection breaks
+func (n *Client) retry(transaction func() (ResponsePacket, error)) (ResponsePacket, error) {
+	response, err := transaction()
+	var cerr *connError
+	if !errors.As(err, &cerr) {
+		return response, err
+	}
+	if n.Dial == nil {
+		return nil, cerr.err
+	}
+	if rerr := n.reconnect(cerr.err); rerr != nil {
+		return nil, fmt.Errorf("%w, reconnecting failed: %v", cerr.err, rerr)
+	}
+	response, err = transaction()
+	if errors.As(err, &cerr) {
+		return nil, cerr.err
+	}
+	return response, err
 }
 
 // Communicate sends the packet to chronyd, parse response into something usable
 func (n *Client) Communicate(packet RequestPacket) (ResponsePacket, error) {
+	return n.retry(func() (ResponsePacket, error) {
+		n.Sequence++
+		packet.SetSequence(n.Sequence)
+		if err := n.send(packet); err != nil {
+			return nil, err
+		}
+		response := make([]uint8, 1024)
+		read, err := n.receive(response)
+		if err != nil {
+			return nil, err
+		}
+		return decodePacket(response[:read])
+	})
+}
+
+// Do sends the packet to chronyd and returns the reply with the matching sequence number.
+// Replies to earlier requests, e.g. ones given up on after a timeout, are skipped.
+// Any command can be sent this way, e.g. built with NewGenericPacket. Replies of types this package
+// doesn't support are decoded by decoders registered with RegisterReply.
+// Reply with status other than success is reported as *StatusError
+func (n *Client) Do(packet RequestPacket) (ResponsePacket, error) {
+	return n.retry(func() (ResponsePacket, error) {
+		return n.do(packet)
+	})
+}
+
+func (n *Client) do(packet RequestPacket) (ResponsePacket, error) {
 	n.Sequence++
-	var err error
-	packet.SetSequence(n.Sequence)
-	err = binary.Write(n.Connection, binary.BigEndian, packet)
-	if err != nil {
+	sequence := n.Sequence
+	packet.SetSequence(sequence)
+	if err := n.send(packet); err != nil {
 		return nil, err
 	}
 	response := make([]uint8, 1024)
-	read, err := n.Connection.Read(response)
+	for {
+		read, err := n.receive(response)
+		if err != nil {
+			return nil, err
+		}
+		head := new(ReplyHead)
+		if err := binary.Read(bytes.NewReader(response[:read]), binary.BigEndian, head); err != nil {
+			// decodePacket reports it along with the raw packet
+			return decodePacket(response[:read])
+		}
+		if head.Sequence != sequence {
+			log.Debugf("skipping stale reply with sequence %d, waiting for %d", head.Sequence, sequence)
+			continue
+		}
+		if head.Command != packet.GetCommand() {
+			return nil, fmt.Errorf("got reply to command %d with sequence %d of command %d", head.Command, sequence, packet.GetCommand())
+		}
+		return decodePacket(response[:read])
+	}
+}
+
+// communicateMany sends the packets to chronyd keeping at most window requests in flight.
+// Replies are matched to requests by sequence, so they may arrive in any order.
+// Responses and errors are returned in the order of packets.
+// If the connection breaks and gets replaced, requests not answered yet are sent again over the new one
+func (n *Client) communicateMany(packets []RequestPacket, window int) ([]ResponsePacket, []error) {
+	responses, errs, broken := n.pipeline(packets, window)
+	if broken == nil || n.Dial == nil {
+		return responses, errs
+	}
+	if err := n.reconnect(broken); err != nil {
+		log.Debugf("reconnecting failed: %v", err)
+		return responses, errs
+	}
+	var pending []int
+	for i := range packets {
+		if errs[i] == broken {
+			pending = append(pending, i)
+		}
+	}
+	retried := make([]RequestPacket, 0, len(pending))
+	for _, i := range pending {
+		retried = append(retried, packets[i])
+	}
+	retriedResponses, retriedErrs, _ := n.pipeline(retried, window)
+	for j, i := range pending {
+		responses[i], errs[i] = retriedResponses[j], retriedErrs[j]
+	}
+	return responses, errs
+}
+
+// pipeline does the work of communicateMany over the current connection.
+// When the connection breaks, requests not answered yet fail with the error, which is returned as broken
+func (n *Client) pipeline(packets []RequestPacket, window int) (responses []ResponsePacket, errs []error, broken error) {
+	responses = make([]ResponsePacket, len(packets))
+	errs = make([]error, len(packets))
+	done := make([]bool, len(packets))
+	first := n.Sequence + 1
+	next, inflight, pending := 0, 0, len(packets)
+	// fail everything not answered yet
+	breakAll := func(err error) {
+		for i := range packets {
+			if !done[i] {
+				errs[i] = err
+			}
+		}
+	}
+	response := make([]uint8, 1024)
+	for pending > 0 {
+		for next < len(packets) && inflight < window {
+			n.Sequence++
+			packets[next].SetSequence(n.Sequence)
+			if err := n.send(packets[next]); err != nil {
+				var cerr *connError
+				if errors.As(err, &cerr) {
+					breakAll(cerr.err)
+					return responses, errs, cerr.err
+				}
+				errs[next], done[next] = err, true
+				pending--
+			} else {
+				inflight++
+			}
+			next++
+		}
+		if inflight == 0 {
+			continue
+		}
+		read, err := n.receive(response)
+		if err != nil {
+			err = errors.Unwrap(err)
+			breakAll(err)
+			return responses, errs, err
+		}
+		head := new(ReplyHead)
+		if err := binary.Read(bytes.NewReader(response[:read]), binary.BigEndian, head); err != nil {
+			log.Debugf("skipping malformed reply: %v", err)
+			continue
+		}
+		i := int(head.Sequence - first)
+		if head.Sequence < first || i >= next || done[i] {
+			log.Debugf("skipping stale reply with sequence %d", head.Sequence)
+			continue
+		}
+		responses[i], errs[i] = decodePacket(response[:read])
+		done[i] = true
+		inflight--
+		pending--
+	}
+	return responses, errs, nil
+}
+
+// SetOnline marks sources matching address/mask online, nil address selects all sources.
+// chronyd only accepts it over the unix socket (ChronySocketPath), otherwise ErrNotAuthorized is returned.
+func (n *Client) SetOnline(address net.IP, mask net.IPMask) error {
+	return n.communicateNull(NewOnlinePacket(address, mask))
+}
+
+// SetOffline marks sources matching address/mask offline, nil address selects all sources.
+// chronyd only accepts it over the unix socket (ChronySocketPath), otherwise ErrNotAuthorized is returned.
+func (n *Client) SetOffline(address net.IP, mask net.IPMask) error {
+	return n.communicateNull(NewOfflinePacket(address, mask))
+}
+
+// Burst makes sources matching address/mask take a burst of nGood good samples out of at most nMax,
+// nil address selects all sources. A failure is reported as *StatusError.
+// chronyd only accepts it over the unix socket (ChronySocketPath), otherwise ErrNotAuthorized is returned.
+func (n *Client) Burst(nGood, nMax int, address net.IP, mask net.IPMask) error {
+	packet, err := NewBurstPacket(nGood, nMax, address, mask)
+	if err != nil {
+		return err
+	}
+	return n.communicateNull(packet)
+}
+
+// ModifyMakestep changes makestep threshold (in seconds) and limit, same as `chronyc makestep <threshold> <limit>`.
+// A failure is reported as *StatusError.
+// chronyd only accepts it over the unix socket (ChronySocketPath), otherwise ErrNotAuthorized is returned.
+func (n *Client) ModifyMakestep(threshold float64, limit int32) error {
+	return n.communicateNull(NewModifyMakestepPacket(threshold, limit))
+}
+
+// Dump makes chronyd write measurement history of sources into dumpdir, same as `chronyc dump`,
+// e.g. to be reloaded after maintenance. A failure (e.g. dumpdir isn't set) is reported as *StatusError.
+// chronyd only accepts it over the unix socket (ChronySocketPath), otherwise ErrNotAuthorized is returned.
+func (n *Client) Dump() error {
+	return n.communicateNull(NewDumpPacket())
+}
+
+// SelectedSource is a source chronyd uses to discipline the clock, with its index for per-source requests like NTPData
+type SelectedSource struct {
+	Index int32
+	SourceData
+}
+
+// SelectedSources returns sources in the SourceStateSync (selected, '*' in chronyc)
+// and SourceStateCandidate (combined, '+' in chronyc) states
+func (n *Client) SelectedSources() ([]SelectedSource, error) {
+	response, err := n.Communicate(NewSourcesPacket())
 	if err != nil {
 		return nil, err
 	}
-	log.Debugf("Read %d bytes", read)
-	return decodePacket(response[:read])
+	sources, ok := response.(*ReplySources)
+	if !ok {
+		return nil, fmt.Errorf("got wrong 'sources' response %+v", response)
+	}
+	var res []SelectedSource
+	for i := 0; i < sources.NSources; i++ {
+		response, err = n.Communicate(NewSourceDataPacket(int32(i)))
+		if err != nil {
+			return nil, fmt.Errorf("getting source %d data: %w", i, err)
+		}
+		data, ok := response.(*ReplySourceData)
+		if !ok {
+			return nil, fmt.Errorf("got wrong 'sourcedata' response %+v", response)
+		}
+		switch data.State {
+		case SourceStateSync, SourceStateCandidate:
+			log.Debugf("Source %d %v is %s", i, data.IPAddr, data.State)
+			res = append(res, SelectedSource{Index: int32(i), SourceData: data.SourceData})
+		}
+	}
+	return res, nil
+}
+
+// ClientAccesses returns all records of chronyd client table, same as `chronyc clients`.
+// The table is fetched page by page following NextIndex from each reply.
+// chronyd only accepts it over the unix socket (ChronySocketPath), otherwise ErrNotAuthorized is returned.
+func (n *Client) ClientAccesses() ([]ClientAccess, error) {
+	var res []ClientAccess
+	var index uint32
+	for {
+		response, err := n.Communicate(NewClientAccessesByIndexPacket(index, maxClientAccesses))
+		if err != nil {
+			return nil, fmt.Errorf("getting clients from index %d: %w", index, err)
+		}
+		page, ok := response.(*ReplyClientAccesses)
+		if !ok {
+			return nil, fmt.Errorf("got wrong 'clients' response %+v", response)
+		}
+		res = append(res, page.ClientAccesses...)
+		// chronyd skips empty slots, so NextIndex may jump ahead, but it must never go back
+		if page.NextIndex <= index || page.NextIndex >= page.NIndices {
+			return res, nil
+		}
+		index = page.NextIndex
+	}
+}
+
+// sourceNamesWindow is the max number of requests AllSourceNames keeps in flight
+const sourceNamesWindow = 16
+
+// AllSourceNames returns names of all sources indexed by source, same as `chronyc sources -N`.
+// NTP sources are named as specified in chronyd config, reference clocks by their driver name.
+// chronyd has no batch request, so per source requests are pipelined, keeping sourceNamesWindow of them in flight.
+// Names that failed to be fetched are left empty and reported in the error returned along with the rest of the names
+func (n *Client) AllSourceNames() ([]string, error) {
+	response, err := n.Communicate(NewSourcesPacket())
+	if err != nil {
+		return nil, err
+	}
+	sources, ok := response.(*ReplySources)
+	if !ok {
+		return nil, fmt.Errorf("got wrong 'sources' response %+v", response)
+	}
+	names := make([]string, sources.NSources)
+	var failed int
+	var firstErr error
+	fail := func(i int, err error) {
+		if firstErr == nil {
+			firstErr = fmt.Errorf("source %d: %w", i, err)
+		}
+		failed++
+	}
+
+	packets := make([]RequestPacket, 0, sources.NSources)
+	for i := 0; i < sources.NSources; i++ {
+		packets = append(packets, NewSourceDataPacket(int32(i)))
+	}
+	responses, errs := n.communicateMany(packets, sourceNamesWindow)
+	// indices of NTP sources, reference clocks are named by the source data
+	var indices []int
+	packets = packets[:0]
+	for i, response := range responses {
+		if errs[i] != nil {
+			fail(i, fmt.Errorf("getting source data: %w", errs[i]))
+			continue
+		}
+		data, ok := response.(*ReplySourceData)
+		if !ok {
+			fail(i, fmt.Errorf("got wrong 'sourcedata' response %+v", response))
+			continue
+		}
+		if data.Mode == SourceModeRef {
+			names[i] = data.RefclockName
+			continue
+		}
+		indices = append(indices, i)
+		packets = append(packets, NewNTPSourceNamePacket(data.IPAddr))
+	}
+
+	responses, errs = n.communicateMany(packets, sourceNamesWindow)
+	for j, response := range responses {
+		i := indices[j]
+		if errs[j] != nil {
+			fail(i, fmt.Errorf("getting source name: %w", errs[j]))
+			continue
+		}
+		name, ok := response.(*ReplyNTPSourceName)
+		if !ok {
+			fail(i, fmt.Errorf("got wrong 'ntpsourcename' response %+v", response))
+			continue
+		}
+		names[i] = name.Name
+	}
+	if failed > 0 {
+		return names, fmt.Errorf("failed to get %d of %d source names, first error: %w", failed, len(names), firstErr)
+	}
+	return names, nil
+}
+
+// DetailedSource is a source with its data and stats, as `chronyc sources -v` and `chronyc sourcestats -v` show them together.
+// OrigLatestMeas is the original offset of the last sample, LatestMeas is the one adjusted for clock updates since,
+// and Stats.StandardDeviation is the jitter of the samples
+type DetailedSource struct {
+	Index int32
+	SourceData
+	Stats SourceStats
+}
+
+// detailedSourcesWindow is the max number of requests DetailedSources keeps in flight
+const detailedSourcesWindow = 16
+
+// sourceName returns the reference clock name or the address identifying the source
+func sourceName(ip net.IP, refclockName string) string {
+	if refclockName != "" {
+		return refclockName
+	}
+	return ip.String()
+}
+
+// DetailedSources returns data and stats of all sources indexed by source.
+// chronyd has no request returning both, so per source data and stats requests are pipelined,
+// keeping detailedSourcesWindow of them in flight. As the sources may change in between,
+// data and stats which don't describe the same source are reported as an error
+func (n *Client) DetailedSources() ([]DetailedSource, error) {
+	response, err := n.Communicate(NewSourcesPacket())
+	if err != nil {
+		return nil, err
+	}
+	sources, ok := response.(*ReplySources)
+	if !ok {
+		return nil, fmt.Errorf("got wrong 'sources' response %+v", response)
+	}
+	packets := make([]RequestPacket, 0, 2*sources.NSources)
+	for i := 0; i < sources.NSources; i++ {
+		packets = append(packets, NewSourceDataPacket(int32(i)), NewSourceStatsPacket(int32(i)))
+	}
+	responses, errs := n.communicateMany(packets, detailedSourcesWindow)
+	res := make([]DetailedSource, 0, sources.NSources)
+	for i := 0; i < sources.NSources; i++ {
+		if errs[2*i] != nil {
+			return nil, fmt.Errorf("getting source %d data: %w", i, errs[2*i])
+		}
+		data, ok := responses[2*i].(*ReplySourceData)
+		if !ok {
+			return nil, fmt.Errorf("got wrong 'sourcedata' response %+v", responses[2*i])
+		}
+		if errs[2*i+1] != nil {
+			return nil, fmt.Errorf("getting source %d stats: %w", i, errs[2*i+1])
+		}
+		stats, ok := responses[2*i+1].(*ReplySourceStats)
+		if !ok {
+			return nil, fmt.Errorf("got wrong 'sourcestats' response %+v", responses[2*i+1])
+		}
+		dataID := sourceName(data.IPAddr, data.RefclockName)
+		statsID := sourceName(stats.IPAddr, stats.RefclockName)
+		if dataID != statsID {
+			return nil, fmt.Errorf("source %d changed between requests: got data of %s and stats of %s", i, dataID, statsID)
+		}
+		res = append(res, DetailedSource{Index: int32(i), SourceData: data.SourceData, Stats: stats.SourceStats})
+	}
+	return res, nil
+}
+
+// communicateNull sends the packet expecting reply without data
+func (n *Client) communicateNull(packet RequestPacket) error {
+	response, err := n.Do(packet)
+	if err != nil {
+		return err
+	}
+	if _, ok := response.(*ReplyNull); !ok {
+		return fmt.Errorf("got wrong response %+v", response)
+	}
+	return nil
 }
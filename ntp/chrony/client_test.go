@@ -19,9 +19,12 @@ package chrony
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -30,6 +33,8 @@ import (
 type fakeConn struct {
 	readCount int
 	outputs   []*bytes.Buffer
+	written   [][]byte
+	closed    bool
 }
 
 func newConn(outputs []*bytes.Buffer) *fakeConn {
@@ -49,8 +54,14 @@ func (c *fakeConn) Read(p []byte) (n int, err error) {
 }
 
 func (c *fakeConn) Write(p []byte) (n int, err error) {
-	// here we may assert writes
-	return 0, nil
+	// kept so tests may assert writes
+	c.written = append(c.written, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
 }
 
 // Test if we have errors when there is nothing on the line to read
@@ -160,3 +171,558 @@ func TestCommunicateOK(t *testing.T) {
 	}
 	require.Equal(t, expected, p)
 }
+
+func nullReply(t *testing.T, command CommandType, status ResponseStatusType) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	head := ReplyHead{
+		Version:  protoVersionNumber,
+		PKTType:  pktTypeCmdReply,
+		Command:  command,
+		Reply:    rpyNull,
+		Status:   status,
+		Sequence: 2,
+	}
+	require.NoError(t, binary.Write(buf, binary.BigEndian, head))
+	return buf
+}
+
+func TestSetOnline(t *testing.T) {
+	client := Client{Sequence: 1, Connection: newConn([]*bytes.Buffer{nullReply(t, reqOnline, sttSuccess)})}
+	require.NoError(t, client.SetOnline(nil, nil))
+}
+
+func TestSetOfflineUnauthorized(t *testing.T) {
+	client := Client{Sequence: 1, Connection: newConn([]*bytes.Buffer{nullReply(t, reqOffline, sttUnauth)})}
+	err := client.SetOffline(net.ParseIP("192.168.1.1"), nil)
+	require.ErrorIs(t, err, ErrNotAuthorized)
+}
+
+func TestSetOfflineNoSuchSource(t *testing.T) {
+	client := Client{Sequence: 1, Connection: newConn([]*bytes.Buffer{nullReply(t, reqOffline, sttNoSuchSource)})}
+	err := client.SetOffline(net.ParseIP("192.168.1.1"), nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "NOSUCHSOURCE")
+}
+
+func TestBurst(t *testing.T) {
+	client := Client{Sequence: 1, Connection: newConn([]*bytes.Buffer{nullReply(t, reqBurst, sttSuccess)})}
+	require.NoError(t, client.Burst(2, 4, nil, nil))
+}
+
+func TestBurstInvalid(t *testing.T) {
+	client := Client{Sequence: 1, Connection: newConn(nil)}
+	require.Error(t, client.Burst(4, 2, nil, nil))
+}
+
+func TestBurstFailed(t *testing.T) {
+	client := Client{Sequence: 1, Connection: newConn([]*bytes.Buffer{nullReply(t, reqBurst, sttNoSuchSource)})}
+	err := client.Burst(2, 4, net.ParseIP("10.0.0.1"), nil)
+	var statusErr *StatusError
+	require.True(t, errors.As(err, &statusErr))
+	require.Equal(t, sttNoSuchSource, statusErr.Status)
+}
+
+func TestModifyMakestep(t *testing.T) {
+	client := Client{Sequence: 1, Connection: newConn([]*bytes.Buffer{nullReply(t, reqModifyMakestep, sttSuccess)})}
+	require.NoError(t, client.ModifyMakestep(0.1, 3))
+
+	client = Client{Sequence: 1, Connection: newConn([]*bytes.Buffer{nullReply(t, reqModifyMakestep, sttUnauth)})}
+	require.ErrorIs(t, client.ModifyMakestep(0.1, 3), ErrNotAuthorized)
+}
+
+func sourcesReply(t *testing.T, n uint32) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	head := ReplyHead{
+		Version:  protoVersionNumber,
+		PKTType:  pktTypeCmdReply,
+		Command:  reqNSources,
+		Reply:    rpyNSources,
+		Status:   sttSuccess,
+		Sequence: 2,
+	}
+	require.NoError(t, binary.Write(buf, binary.BigEndian, head))
+	require.NoError(t, binary.Write(buf, binary.BigEndian, replySourcesContent{NSources: n}))
+	return buf
+}
+
+func sourceDataReply(t *testing.T, ip net.IP, state SourceStateType) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	head := ReplyHead{
+		Version:  protoVersionNumber,
+		PKTType:  pktTypeCmdReply,
+		Command:  reqSourceData,
+		Reply:    rpySourceData,
+		Status:   sttSuccess,
+		Sequence: 2,
+	}
+	body := replySourceDataContent{
+		IPAddr:       *newIPAddr(ip),
+		Poll:         6,
+		Stratum:      1,
+		State:        state,
+		Mode:         SourceModeClient,
+		Reachability: 255,
+	}
+	require.NoError(t, binary.Write(buf, binary.BigEndian, head))
+	require.NoError(t, binary.Write(buf, binary.BigEndian, body))
+	return buf
+}
+
+func TestDump(t *testing.T) {
+	client := Client{Sequence: 1, Connection: newConn([]*bytes.Buffer{nullReply(t, reqDump, sttSuccess)})}
+	require.NoError(t, client.Dump())
+
+	client = Client{Sequence: 1, Connection: newConn([]*bytes.Buffer{nullReply(t, reqDump, sttFailed)})}
+	var statusErr *StatusError
+	require.True(t, errors.As(client.Dump(), &statusErr))
+	require.Equal(t, sttFailed, statusErr.Status)
+
+	client = Client{Sequence: 1, Connection: newConn([]*bytes.Buffer{nullReply(t, reqDump, sttUnauth)})}
+	require.ErrorIs(t, client.Dump(), ErrNotAuthorized)
+}
+
+func TestSelectedSources(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		sourcesReply(t, 5),
+		sourceDataReply(t, net.ParseIP("192.168.0.1"), SourceStateUnreach),
+		sourceDataReply(t, net.ParseIP("192.168.0.2"), SourceStateCandidate),
+		sourceDataReply(t, net.ParseIP("192.168.0.3"), SourceStateSync),
+		sourceDataReply(t, net.ParseIP("192.168.0.4"), SourceStateOutlier),
+		sourceDataReply(t, net.ParseIP("192.168.0.5"), SourceStateFalseTicket),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	sources, err := client.SelectedSources()
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+	require.Equal(t, int32(1), sources[0].Index)
+	require.Equal(t, "candidate", sources[0].State.String())
+	require.True(t, net.ParseIP("192.168.0.2").Equal(sources[0].IPAddr))
+	require.Equal(t, int32(2), sources[1].Index)
+	require.Equal(t, "sync", sources[1].State.String())
+	require.True(t, net.ParseIP("192.168.0.3").Equal(sources[1].IPAddr))
+	require.Equal(t, uint16(255), sources[1].Reachability)
+}
+
+func TestSelectedSourcesNone(t *testing.T) {
+	client := Client{Sequence: 1, Connection: newConn([]*bytes.Buffer{sourcesReply(t, 0)})}
+	sources, err := client.SelectedSources()
+	require.NoError(t, err)
+	require.Empty(t, sources)
+}
+
+func TestSelectedSourcesError(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		sourcesReply(t, 2),
+		sourceDataReply(t, net.ParseIP("192.168.0.1"), SourceStateSync),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	_, err := client.SelectedSources()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "getting source 1 data")
+}
+
+func clientAccessesReply(t *testing.T, nIndices, nextIndex uint32, ips ...net.IP) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	head := ReplyHead{
+		Version:  protoVersionNumber,
+		PKTType:  pktTypeCmdReply,
+		Command:  reqClientAccessesByIndex,
+		Reply:    rpyClientAccessesByIndex,
+		Status:   sttSuccess,
+		Sequence: 2,
+	}
+	require.NoError(t, binary.Write(buf, binary.BigEndian, head))
+	require.NoError(t, binary.Write(buf, binary.BigEndian, replyClientAccessesHead{
+		NIndices:  nIndices,
+		NextIndex: nextIndex,
+		NClients:  uint32(len(ips)),
+	}))
+	for i, ip := range ips {
+		require.NoError(t, binary.Write(buf, binary.BigEndian, replyClientAccessContent{
+			IPAddr:        *newIPAddr(ip),
+			NTPHits:       uint32(100 + i),
+			LastNTPHitAgo: uint32(i),
+		}))
+	}
+	return buf
+}
+
+func TestClientAccesses(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		clientAccessesReply(t, 16, 8,
+			net.ParseIP("192.168.0.1"),
+			net.ParseIP("192.168.0.2"),
+			net.ParseIP("192.168.0.3"),
+			net.ParseIP("192.168.0.4"),
+			net.ParseIP("192.168.0.5"),
+			net.ParseIP("192.168.0.6"),
+			net.ParseIP("192.168.0.7"),
+			net.ParseIP("192.168.0.8"),
+		),
+		clientAccessesReply(t, 16, 16,
+			net.ParseIP("192.168.0.9"),
+			net.ParseIP("2401:db00::1"),
+		),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	clients, err := client.ClientAccesses()
+	require.NoError(t, err)
+	require.Len(t, clients, 10)
+	require.Equal(t, 2, conn.readCount)
+	require.True(t, net.ParseIP("192.168.0.1").Equal(clients[0].IPAddr))
+	require.Equal(t, uint32(100), clients[0].NTPHits)
+	require.True(t, net.ParseIP("192.168.0.9").Equal(clients[8].IPAddr))
+	require.True(t, net.ParseIP("2401:db00::1").Equal(clients[9].IPAddr))
+	require.Equal(t, uint32(101), clients[9].NTPHits)
+	require.Equal(t, uint32(1), clients[9].LastNTPHitAgo)
+}
+
+func TestClientAccessesEmpty(t *testing.T) {
+	client := Client{Sequence: 1, Connection: newConn([]*bytes.Buffer{clientAccessesReply(t, 0, 0)})}
+	clients, err := client.ClientAccesses()
+	require.NoError(t, err)
+	require.Empty(t, clients)
+}
+
+func TestClientAccessesError(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		clientAccessesReply(t, 16, 8, net.ParseIP("192.168.0.1")),
+		nullReply(t, reqClientAccessesByIndex, sttUnauth),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	_, err := client.ClientAccesses()
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrNotAuthorized))
+	require.Contains(t, err.Error(), "getting clients from index 8")
+}
+
+// sequencedReply builds reply with the given sequence, so replies can be delivered in any order
+func sequencedReply(t *testing.T, seq uint32, command CommandType, reply ReplyType, status ResponseStatusType, body interface{}) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	head := ReplyHead{
+		Version:  protoVersionNumber,
+		PKTType:  pktTypeCmdReply,
+		Command:  command,
+		Reply:    reply,
+		Status:   status,
+		Sequence: seq,
+	}
+	require.NoError(t, binary.Write(buf, binary.BigEndian, head))
+	if body != nil {
+		require.NoError(t, binary.Write(buf, binary.BigEndian, body))
+	}
+	return buf
+}
+
+func sourceDataSeqReply(t *testing.T, seq uint32, ip net.IP, mode ModeType) *bytes.Buffer {
+	body := replySourceDataContent{IPAddr: *newIPAddr(ip), Mode: mode, State: SourceStateSync}
+	return sequencedReply(t, seq, reqSourceData, rpySourceData, sttSuccess, body)
+}
+
+func sourceNameReply(t *testing.T, seq uint32, name string) *bytes.Buffer {
+	body := replyNTPSourceNameContent{}
+	copy(body.Name[:], name)
+	return sequencedReply(t, seq, reqNTPSourceName, rpyNTPSourceName, sttSuccess, body)
+}
+
+func TestAllSourceNames(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		sourcesReply(t, 4),
+		// source data replies in any order, with a duplicate
+		sourceDataSeqReply(t, 4, net.IPv4('P', 'P', 'S', 0), SourceModeRef),
+		sourceDataSeqReply(t, 3, net.ParseIP("192.168.0.1"), SourceModeClient),
+		sourceDataSeqReply(t, 4, net.IPv4('P', 'P', 'S', 0), SourceModeRef),
+		sourceDataSeqReply(t, 6, net.ParseIP("2401:db00::1"), SourceModeClient),
+		sourceDataSeqReply(t, 5, net.ParseIP("192.168.0.3"), SourceModePeer),
+		// names of sources 0, 2 and 3
+		sourceNameReply(t, 9, "time3.example.com"),
+		sourceNameReply(t, 7, "time1.example.com"),
+		sourceNameReply(t, 8, "time2.example.com"),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	names, err := client.AllSourceNames()
+	require.NoError(t, err)
+	require.Equal(t, []string{"time1.example.com", "PPS", "time2.example.com", "time3.example.com"}, names)
+}
+
+func TestAllSourceNamesPartialFailure(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		sourcesReply(t, 3),
+		sourceDataSeqReply(t, 3, net.ParseIP("192.168.0.1"), SourceModeClient),
+		sequencedReply(t, 4, reqSourceData, rpyNull, sttNoSuchSource, nil),
+		sourceDataSeqReply(t, 5, net.ParseIP("192.168.0.3"), SourceModeClient),
+		sequencedReply(t, 7, reqNTPSourceName, rpyNull, sttNoSuchSource, nil),
+		sourceNameReply(t, 6, "time1.example.com"),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	names, err := client.AllSourceNames()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to get 2 of 3 source names")
+	var statusErr *StatusError
+	require.True(t, errors.As(err, &statusErr))
+	require.Equal(t, sttNoSuchSource, statusErr.Status)
+	require.Equal(t, []string{"time1.example.com", "", ""}, names)
+}
+
+func TestAllSourceNamesConnectionError(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		sourcesReply(t, 2),
+		sourceDataSeqReply(t, 3, net.ParseIP("192.168.0.1"), SourceModeClient),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	names, err := client.AllSourceNames()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to get 2 of 2 source names")
+	require.Equal(t, []string{"", ""}, names)
+}
+
+func TestAllSourceNamesError(t *testing.T) {
+	client := Client{Sequence: 1, Connection: newConn(nil)}
+	_, err := client.AllSourceNames()
+	require.Error(t, err)
+}
+
+// rawReply returns a copy of raw reply packet with the sequence replaced
+func rawReply(raw []uint8, seq uint32) *bytes.Buffer {
+	b := append([]uint8(nil), raw...)
+	binary.BigEndian.PutUint32(b[16:20], seq)
+	return bytes.NewBuffer(b)
+}
+
+func TestDetailedSources(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		sourcesReply(t, 2),
+		rawReply(sourceDataRaw, 3),
+		rawReply(sourceStatsRefclockRaw, 6),
+		rawReply(sourceStatsRaw, 4),
+		rawReply(sourceDataRefclockRaw, 5),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	sources, err := client.DetailedSources()
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+
+	ip := net.ParseIP("2401:db00:3110:20c0:face:0:48:0")
+	require.Equal(t, int32(0), sources[0].Index)
+	require.True(t, ip.Equal(sources[0].IPAddr))
+	require.True(t, ip.Equal(sources[0].Stats.IPAddr))
+	require.Equal(t, SourceStateCandidate, sources[0].State)
+	require.Equal(t, 4.719099888461642e-05, sources[0].OrigLatestMeas)
+	require.Equal(t, 4.990374873159453e-05, sources[0].LatestMeas)
+	require.Equal(t, 1.770472044881899e-05, sources[0].Stats.StandardDeviation)
+	require.Equal(t, uint32(12), sources[0].Stats.NSamples)
+
+	require.Equal(t, int32(1), sources[1].Index)
+	require.Equal(t, "PPS", sources[1].RefclockName)
+	require.Equal(t, "PPS", sources[1].Stats.RefclockName)
+	require.Equal(t, SourceModeRef, sources[1].Mode)
+	require.Equal(t, -3.44656518791453e-06, sources[1].Stats.EstimatedOffset)
+}
+
+func TestDetailedSourcesChanged(t *testing.T) {
+	// source 0 was removed after its data was fetched, so the next one took its index
+	conn := newConn([]*bytes.Buffer{
+		sourcesReply(t, 1),
+		rawReply(sourceDataRaw, 3),
+		rawReply(sourceStatsRefclockRaw, 4),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	_, err := client.DetailedSources()
+	require.EqualError(t, err, "source 0 changed between requests: got data of 2401:db00:3110:20c0:face:0:48:0 and stats of PPS")
+}
+
+func TestDetailedSourcesError(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		sourcesReply(t, 1),
+		rawReply(sourceDataRaw, 3),
+		sequencedReply(t, 4, reqSourceStats, rpyNull, sttNoSuchSource, nil),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	_, err := client.DetailedSources()
+	var statusErr *StatusError
+	require.True(t, errors.As(err, &statusErr))
+	require.Equal(t, sttNoSuchSource, statusErr.Status)
+
+	client = Client{Sequence: 1, Connection: newConn(nil)}
+	_, err = client.DetailedSources()
+	require.Error(t, err)
+}
+
+func TestDo(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		// reply to the request given up on earlier
+		sequencedReply(t, 1, reqTracking, rpyTracking, sttSuccess, replyTrackingContent{Stratum: 1}),
+		sequencedReply(t, 2, reqTracking, rpyTracking, sttSuccess, replyTrackingContent{Stratum: 2}),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	response, err := client.Do(NewTrackingPacket())
+	require.NoError(t, err)
+	tracking, ok := response.(*ReplyTracking)
+	require.True(t, ok)
+	require.Equal(t, uint16(2), tracking.Stratum)
+	require.Equal(t, uint32(2), client.Sequence)
+
+	require.Len(t, conn.written, 1)
+	head := new(RequestHead)
+	require.NoError(t, binary.Read(bytes.NewReader(conn.written[0]), binary.BigEndian, head))
+	require.Equal(t, uint32(2), head.Sequence)
+	require.Equal(t, reqTracking, head.Command)
+}
+
+func TestDoGeneric(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		sequencedReply(t, 2, reqDump, rpyNull, sttSuccess, nil),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	packet, err := NewGenericPacket(reqDump, []byte{1, 2, 3})
+	require.NoError(t, err)
+	response, err := client.Do(packet)
+	require.NoError(t, err)
+	require.IsType(t, &ReplyNull{}, response)
+
+	require.Len(t, conn.written, 1)
+	require.Len(t, conn.written[0], binary.Size(RequestHead{})+maxDataLen)
+	head := new(RequestHead)
+	r := bytes.NewReader(conn.written[0])
+	require.NoError(t, binary.Read(r, binary.BigEndian, head))
+	require.Equal(t, reqDump, head.Command)
+	require.Equal(t, pktTypeCmdRequest, head.PKTType)
+	data := make([]byte, 4)
+	_, err = r.Read(data)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2, 3, 0}, data)
+}
+
+func TestDoStatusError(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		sequencedReply(t, 2, reqDump, rpyNull, sttFailed, nil),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	_, err := client.Do(NewDumpPacket())
+	var statusErr *StatusError
+	require.True(t, errors.As(err, &statusErr))
+	require.Equal(t, sttFailed, statusErr.Status)
+}
+
+func TestDoCommandMismatch(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		sequencedReply(t, 2, reqTracking, rpyTracking, sttSuccess, replyTrackingContent{}),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	_, err := client.Do(NewDumpPacket())
+	require.Error(t, err)
+}
+
+func TestDoEOF(t *testing.T) {
+	// only stale replies before the connection breaks
+	conn := newConn([]*bytes.Buffer{
+		sequencedReply(t, 1, reqDump, rpyNull, sttSuccess, nil),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	_, err := client.Do(NewDumpPacket())
+	require.Error(t, err)
+}
+
+// recordSleep records delays instead of sleeping
+func recordSleep(delays *[]time.Duration) func(time.Duration) {
+	return func(d time.Duration) {
+		*delays = append(*delays, d)
+	}
+}
+
+// dialer returns conns one by one, failing the dial when the next one is nil
+func dialer(conns ...*fakeConn) func() (io.ReadWriter, error) {
+	return func() (io.ReadWriter, error) {
+		if len(conns) == 0 {
+			return nil, fmt.Errorf("no such file or directory")
+		}
+		conn := conns[0]
+		conns = conns[1:]
+		if conn == nil {
+			return nil, fmt.Errorf("connection refused")
+		}
+		return conn, nil
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	var delays []time.Duration
+	// chronyd restarts after replying about the first source
+	conn := newConn([]*bytes.Buffer{
+		sourcesReply(t, 2),
+		sourceDataReply(t, net.ParseIP("192.168.0.1"), SourceStateSync),
+	})
+	restarted := newConn([]*bytes.Buffer{
+		sourceDataReply(t, net.ParseIP("192.168.0.2"), SourceStateCandidate),
+	})
+	var causes []error
+	client := Client{
+		Sequence:         1,
+		Connection:       conn,
+		Dial:             dialer(nil, nil, restarted),
+		ReconnectBackoff: time.Second,
+		OnReconnect: func(err error) {
+			causes = append(causes, err)
+		},
+		sleep: recordSleep(&delays),
+	}
+	sources, err := client.SelectedSources()
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+	require.Equal(t, int32(1), sources[1].Index)
+	require.Equal(t, "192.168.0.2", sources[1].IPAddr.String())
+
+	require.True(t, conn.closed)
+	require.Equal(t, []time.Duration{time.Second, 2 * time.Second}, delays)
+	require.Equal(t, uint64(1), client.Reconnects)
+	require.Len(t, causes, 1)
+	require.EqualError(t, causes[0], "EOF")
+	// sequence starts over on the new connection
+	require.Equal(t, uint32(1), client.Sequence)
+	require.Len(t, restarted.written, 1)
+	head := new(RequestHead)
+	require.NoError(t, binary.Read(bytes.NewReader(restarted.written[0]), binary.BigEndian, head))
+	require.Equal(t, uint32(1), head.Sequence)
+	require.Equal(t, reqSourceData, head.Command)
+}
+
+func TestReconnectPipelined(t *testing.T) {
+	var delays []time.Duration
+	// chronyd restarts after replying to some of the pipelined requests
+	conn := newConn([]*bytes.Buffer{
+		sourcesReply(t, 2),
+		rawReply(sourceStatsRaw, 4),
+		rawReply(sourceDataRefclockRaw, 5),
+	})
+	restarted := newConn([]*bytes.Buffer{
+		rawReply(sourceStatsRefclockRaw, 2),
+		rawReply(sourceDataRaw, 1),
+	})
+	client := Client{Sequence: 1, Connection: conn, Dial: dialer(restarted), sleep: recordSleep(&delays)}
+	sources, err := client.DetailedSources()
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+	require.Equal(t, uint32(12), sources[0].Stats.NSamples)
+	require.Equal(t, "PPS", sources[1].Stats.RefclockName)
+	require.Empty(t, delays)
+	require.Equal(t, uint64(1), client.Reconnects)
+	// only unanswered requests are sent again
+	require.Len(t, restarted.written, 2)
+}
+
+func TestReconnectGiveUp(t *testing.T) {
+	var delays []time.Duration
+	client := Client{
+		Sequence:            1,
+		Connection:          newConn(nil),
+		Dial:                dialer(),
+		ReconnectAttempts:   4,
+		ReconnectBackoff:    time.Second,
+		MaxReconnectBackoff: 3 * time.Second,
+		sleep:               recordSleep(&delays),
+	}
+	_, err := client.Communicate(NewTrackingPacket())
+	require.EqualError(t, err, "EOF, reconnecting failed: no such file or directory")
+	require.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, delays)
+	require.Equal(t, uint64(0), client.Reconnects)
+}
@@ -18,6 +18,7 @@ limitations under the License.
 Package chrony implements Chrony (https://chrony.tuxfamily.org) network protocol v6 used for monitoring of the timeserver.
 
 As of now, only monitoring part of protocol that is used to communicate between `chronyc` and `chronyd` is implemented.
+Protocol v6 has no command authentication, privileged requests are only accepted by chronyd over the local unix socket.
 Chronyc/chronyd protocol is not documented (https://chrony.tuxfamily.org/faq.html#_is_the_code_chronyc_code_code_chronyd_code_protocol_documented_anywhere).
 
 Library allows communicating with Chrony NTP server,
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"strings"
 	"time"
 	"unicode"
 )
@@ -36,14 +37,18 @@ const noHighSec uint32 = 0x7fffffff
 
 // ip stuff
 const (
-	ipAddrInet4 uint16 = 1
-	ipAddrInet6 uint16 = 2
+	ipAddrUnspec uint16 = 0
+	ipAddrInet4  uint16 = 1
+	ipAddrInet6  uint16 = 2
 )
 
-// magic numbers to convert chronyFloat to normal float
+// magic numbers to convert chronyFloat to normal float and back
 const (
 	floatExpBits  = 7
 	floatCoefBits = (4*8 - floatExpBits)
+	floatExpMin   = -(1 << (floatExpBits - 1))
+	floatExpMax   = -floatExpMin - 1
+	floatCoefMax  = (1 << (floatCoefBits - 1)) - 1
 )
 
 type ipAddr struct {
@@ -52,17 +57,25 @@ type ipAddr struct {
 	Pad    uint16
 }
 
+// ToNetIP converts chrony address to net.IP using the family tag.
+// IPv4 addresses are returned in 4-byte form, so they are rendered as 1.2.3.4
 func (ip *ipAddr) ToNetIP() net.IP {
-	if ip.Family == ipAddrInet4 {
-		return net.IP(ip.IP[:4])
+	switch ip.Family {
+	case ipAddrInet4:
+		return net.IPv4(ip.IP[0], ip.IP[1], ip.IP[2], ip.IP[3]).To4()
+	case ipAddrInet6:
+		res := make(net.IP, net.IPv6len)
+		copy(res, ip.IP[:])
+		return res
 	}
-	return net.IP(ip.IP[:])
+	return nil
 }
 
 func newIPAddr(ip net.IP) *ipAddr {
 	family := ipAddrInet6
-	if ip.To4() != nil {
+	if ip4 := ip.To4(); ip4 != nil {
 		family = ipAddrInet4
+		ip = ip4
 	}
 	var nIP [16]byte
 	copy(nIP[:], ip)
@@ -72,6 +85,24 @@ func newIPAddr(ip net.IP) *ipAddr {
 	}
 }
 
+// newMaskAddress converts address and mask to chrony source selector.
+// Nil address selects all sources, nil mask selects the address only
+func newMaskAddress(address net.IP, mask net.IPMask) (*ipAddr, *ipAddr) {
+	if address == nil {
+		return &ipAddr{}, &ipAddr{}
+	}
+	if ip4 := address.To4(); ip4 != nil {
+		address = ip4
+	}
+	if mask == nil {
+		mask = net.CIDRMask(len(address)*8, len(address)*8)
+	}
+	a := newIPAddr(address)
+	m := &ipAddr{Family: a.Family}
+	copy(m.IP[:], mask)
+	return m, a
+}
+
 type timeSpec struct {
 	SecHigh uint32
 	SecLow  uint32
@@ -94,12 +125,21 @@ The result is calculated as: 2^(exp - 25) * coef
 */
 type chronyFloat int32
 
-// ToFloat does magic to decode float from int32.
-// Code is copied and translated to Go from original C sources.
+// ToFloat decodes chrony float
 func (f chronyFloat) ToFloat() float64 {
-	var exp, coef int32
+	return decodeChronyFloat(uint32(f))
+}
 
-	x := uint32(f)
+// newChronyFloat encodes float as chrony float
+func newChronyFloat(x float64) chronyFloat {
+	return chronyFloat(encodeChronyFloat(x))
+}
+
+// decodeChronyFloat decodes chrony 32-bit float: 7-bit signed exponent followed by
+// 25-bit signed coefficient, value is coef * 2^(exp - 25).
+// Code is copied and translated to Go from original C sources (UTI_FloatNetworkToHost).
+func decodeChronyFloat(x uint32) float64 {
+	var exp, coef int32
 
 	exp = int32(x >> floatCoefBits)
 	if exp >= 1<<(floatExpBits-1) {
@@ -115,6 +155,58 @@ func (f chronyFloat) ToFloat() float64 {
 	return float64(coef) * math.Pow(2.0, float64(exp))
 }
 
+// encodeChronyFloat encodes float to chrony 32-bit float, see decodeChronyFloat.
+// Precision is 24 bits, values too big saturate to max, too small become 0, so does NaN.
+// Code is copied and translated to Go from original C sources (UTI_FloatHostToNetwork).
+func encodeChronyFloat(x float64) uint32 {
+	var exp, coef, neg int32
+
+	if x < 0.0 {
+		x = -x
+		neg = 1
+	} else if !(x >= 0.0) {
+		// save NaN as zero
+		x = 0.0
+	}
+
+	if x < 1.0e-100 {
+		exp, coef = 0, 0
+	} else if x > 1.0e100 {
+		exp = floatExpMax
+		coef = floatCoefMax + neg
+	} else {
+		exp = int32(math.Log(x)/math.Log(2)) + 1
+		coef = int32(x*math.Pow(2.0, float64(-exp+floatCoefBits)) + 0.5)
+
+		// we may need to shift up to two bits down
+		for coef > floatCoefMax+neg {
+			coef >>= 1
+			exp++
+		}
+
+		if exp > floatExpMax {
+			// overflow
+			exp = floatExpMax
+			coef = floatCoefMax + neg
+		} else if exp < floatExpMin {
+			// underflow
+			if exp+floatCoefBits >= floatExpMin {
+				coef >>= floatExpMin - exp
+				exp = floatExpMin
+			} else {
+				exp, coef = 0, 0
+			}
+		}
+	}
+
+	// negate back
+	if neg == 1 {
+		coef = int32(uint32(-coef) << floatExpBits >> floatExpBits)
+	}
+
+	return uint32(exp)<<floatCoefBits | uint32(coef)
+}
+
 // RefidAsHEX prints ref id as hex
 func RefidAsHEX(refID uint32) string {
 	return fmt.Sprintf("%08X", refID)
@@ -134,6 +226,35 @@ func RefidToString(refID uint32) string {
 	return string(result)
 }
 
+// refIDString renders ref id the way chronyc does: reference clocks
+// have printable ASCII names like "GPS" or "PPS", anything else is shown as IPv4
+func refIDString(refID uint32) string {
+	if name := refclockName(refID); name != "" {
+		return name
+	}
+	return net.IPv4(byte(refID>>24), byte(refID>>16), byte(refID>>8), byte(refID)).String()
+}
+
+// refclockName returns RefID as reference clock name, e.g. PPS or GPS. Empty if RefID isn't printable
+func refclockName(refID uint32) string {
+	b := []byte{byte(refID >> 24), byte(refID >> 16), byte(refID >> 8), byte(refID)}
+	name := strings.TrimRight(string(b), "\x00")
+	for _, c := range []byte(name) {
+		if c < 0x20 || c > 0x7e {
+			return ""
+		}
+	}
+	return name
+}
+
+// refclockAddrName returns reference clock name if the address is unspecified, as refclocks have no address
+func refclockAddrName(addr *ipAddr, refID uint32) string {
+	if addr.Family != ipAddrUnspec {
+		return ""
+	}
+	return refclockName(refID)
+}
+
 /* NTP tests from RFC 5905:
    +--------------------------+----------------------------------------+
    | Packet Type              | Description                            |
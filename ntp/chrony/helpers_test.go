@@ -17,7 +17,10 @@ limitations under the License.
 package chrony
 
 import (
+	"math"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -52,6 +55,105 @@ func TestFloat(t *testing.T) {
 	}
 }
 
+func TestNewChronyFloat(t *testing.T) {
+	testCases := []struct {
+		in  float64
+		out chronyFloat
+	}{
+		{in: 0.0, out: chronyFloat(0)},
+		{in: math.NaN(), out: chronyFloat(0)},
+		{in: 1.0, out: chronyFloat(0x04800000)},
+		{in: -0.5, out: chronyFloat(0x01000000)},
+		{in: 0.1, out: chronyFloat(-0x03333333)}, // 0xfccccccd
+		{in: 1e101, out: chronyFloat(0x7effffff)},
+	}
+	for _, testCase := range testCases {
+		require.Equal(t, testCase.out, newChronyFloat(testCase.in), "encoding %v", testCase.in)
+	}
+}
+
+func TestDecodeChronyFloat(t *testing.T) {
+	require.Equal(t, 0.0, decodeChronyFloat(0))
+	require.Equal(t, 1.0, decodeChronyFloat(0x04800000))
+	require.Equal(t, -0.5, decodeChronyFloat(0x01000000))
+	require.InDelta(t, 0.1, decodeChronyFloat(0xfccccccd), 1e-8)
+	// max and min representable values
+	require.Equal(t, float64(1<<24-1)*math.Pow(2, 63-25), decodeChronyFloat(0x7effffff))
+	require.Equal(t, math.Pow(2, -64-25), decodeChronyFloat(0x80000001))
+}
+
+func TestEncodeChronyFloatEdgeCases(t *testing.T) {
+	require.Equal(t, uint32(0), encodeChronyFloat(0))
+	require.Equal(t, uint32(0), encodeChronyFloat(math.NaN()))
+	require.Equal(t, uint32(0), encodeChronyFloat(1e-101), "too small becomes zero")
+	require.Equal(t, uint32(0x7effffff), encodeChronyFloat(math.Inf(1)), "too big saturates")
+	require.Equal(t, -math.Pow(2, 63-1), decodeChronyFloat(encodeChronyFloat(math.Inf(-1))), "negative coefficient goes one further")
+	// smallest values are encoded with the minimal exponent, losing precision
+	require.Equal(t, uint32(0x80000001), encodeChronyFloat(math.Pow(2, -89)))
+}
+
+func TestChronyFloatRoundTripRange(t *testing.T) {
+	// coefficient is truncated to 24 bits, so we may lose up to a whole last bit
+	precision := math.Pow(2, -23)
+	// full precision is kept from 2^-65 to 2^62
+	for e := -19; e <= 17; e++ {
+		for _, m := range []float64{1, 1.234567, 5, 9.999999} {
+			for _, sign := range []float64{1, -1} {
+				f := sign * m * math.Pow(10, float64(e))
+				got := decodeChronyFloat(encodeChronyFloat(f))
+				require.InDelta(t, f, got, math.Abs(f)*precision, "round trip of %v", f)
+			}
+		}
+	}
+}
+
+func TestChronyFloatRoundTrip(t *testing.T) {
+	for _, f := range []float64{0.1, -0.1, 0.039435696, -0.490620, 1.5, 1000, 1e-9, -1e-9} {
+		require.InDelta(t, f, newChronyFloat(f).ToFloat(), math.Abs(f)*1e-7, "round trip of %v", f)
+	}
+}
+
+func TestIPAddrToNetIP(t *testing.T) {
+	testCases := []struct {
+		in  ipAddr
+		out string
+		len int
+	}{
+		{
+			in:  ipAddr{IP: [16]uint8{0x01, 0x02, 0x03, 0x04}, Family: ipAddrInet4},
+			out: "1.2.3.4",
+			len: net.IPv4len,
+		},
+		{
+			in:  ipAddr{IP: [16]uint8{0x24, 0x01, 0xdb, 0x00, 0x23, 0x1c, 0x28, 0x12, 0xfa, 0xce, 0x00, 0x00, 0x01, 0x7b, 0x00, 0x00}, Family: ipAddrInet6},
+			out: "2401:db00:231c:2812:face:0:17b:0",
+			len: net.IPv6len,
+		},
+		{
+			in:  ipAddr{},
+			out: "<nil>",
+			len: 0,
+		},
+	}
+
+	for _, testCase := range testCases {
+		ip := testCase.in.ToNetIP()
+		require.Equal(t, testCase.out, ip.String())
+		require.Equal(t, testCase.len, len(ip))
+	}
+}
+
+func TestNewIPAddr(t *testing.T) {
+	v4 := newIPAddr(net.ParseIP("1.2.3.4"))
+	require.Equal(t, ipAddrInet4, v4.Family)
+	require.Equal(t, [16]uint8{0x01, 0x02, 0x03, 0x04}, v4.IP)
+	require.Equal(t, "1.2.3.4", v4.ToNetIP().String())
+
+	v6 := newIPAddr(net.ParseIP("2401:db00:231c:2812:face:0:17b:0"))
+	require.Equal(t, ipAddrInet6, v6.Family)
+	require.Equal(t, "2401:db00:231c:2812:face:0:17b:0", v6.ToNetIP().String())
+}
+
 func TestRefidToString(t *testing.T) {
 	testCases := []struct {
 		in  uint32
@@ -80,6 +182,47 @@ func TestRefidToString(t *testing.T) {
 	}
 }
 
+func TestRefIDString(t *testing.T) {
+	testCases := []struct {
+		name string
+		in   uint32
+		out  string
+	}{
+		{
+			name: "GPS refclock",
+			in:   0x47505300,
+			out:  "GPS",
+		},
+		{
+			name: "PPS refclock",
+			in:   0x50505300,
+			out:  "PPS",
+		},
+		{
+			name: "server",
+			in:   0x0a000001,
+			out:  "10.0.0.1",
+		},
+		{
+			name: "server with trailing zero",
+			in:   0xc0a80100,
+			out:  "192.168.1.0",
+		},
+		{
+			name: "zero",
+			in:   0,
+			out:  "0.0.0.0",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.out, Tracking{RefID: testCase.in}.RefIDString())
+			require.Equal(t, testCase.out, SourceStats{RefID: testCase.in}.RefIDString())
+		})
+	}
+}
+
 func TestNTPTestsFlagsString(t *testing.T) {
 	testCases := []struct {
 		in  uint16
@@ -103,3 +246,11 @@ func TestNTPTestsFlagsString(t *testing.T) {
 		)
 	}
 }
+
+func TestEstimatedSystemOffset(t *testing.T) {
+	// System time     : 0.000002000 seconds slow of NTP time
+	require.Equal(t, -2*time.Microsecond, Tracking{CurrentCorrection: 0.000002}.EstimatedSystemOffset())
+	// System time     : 0.001500000 seconds fast of NTP time
+	require.Equal(t, 1500*time.Microsecond, Tracking{CurrentCorrection: -0.0015}.EstimatedSystemOffset())
+	require.Equal(t, time.Duration(0), Tracking{}.EstimatedSystemOffset())
+}
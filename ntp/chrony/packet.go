@@ -19,7 +19,9 @@ package chrony
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
 	"net"
 	"time"
 
@@ -44,6 +46,12 @@ type SourceStateType uint16
 // ResponseStatusType identifies response status
 type ResponseStatusType uint16
 
+// LeapStatusType identifies leap second status of the clock
+type LeapStatusType uint16
+
+// TimestampSourceType identifies where NTP packet timestamp was taken
+type TimestampSourceType uint8
+
 // PacketType - request or reply
 type PacketType uint8
 
@@ -70,27 +78,42 @@ func (t PacketType) String() string {
 
 // request types. Only those we support, there are more
 const (
-	reqNSources    CommandType = 14
-	reqSourceData  CommandType = 15
-	reqTracking    CommandType = 33
-	reqSourceStats CommandType = 34
-	reqActivity    CommandType = 44
-	reqServerStats CommandType = 54
-	reqNTPData     CommandType = 57
+	reqOnline                CommandType = 1
+	reqOffline               CommandType = 2
+	reqNSources              CommandType = 14
+	reqSourceData            CommandType = 15
+	reqTracking              CommandType = 33
+	reqSourceStats           CommandType = 34
+	reqDump                  CommandType = 6
+	reqBurst                 CommandType = 3
+	reqModifyMakestep        CommandType = 50
+	reqSmoothing             CommandType = 51
+	reqActivity              CommandType = 44
+	reqServerStats           CommandType = 54
+	reqNTPData               CommandType = 57
+	reqNTPSourceName         CommandType = 65
+	reqClientAccessesByIndex CommandType = 68
 )
 
 // reply types
 const (
-	rpyNSources     ReplyType = 2
-	rpySourceData   ReplyType = 3
-	rpyTracking     ReplyType = 5
-	rpySourceStats  ReplyType = 6
-	rpyActivity     ReplyType = 12
-	rpyServerStats  ReplyType = 14
-	rpyNTPData      ReplyType = 16
-	rpyServerStats2 ReplyType = 22
+	rpyNull                  ReplyType = 1
+	rpyNSources              ReplyType = 2
+	rpySourceData            ReplyType = 3
+	rpyTracking              ReplyType = 5
+	rpySourceStats           ReplyType = 6
+	rpyActivity              ReplyType = 12
+	rpySmoothing             ReplyType = 13
+	rpyServerStats           ReplyType = 14
+	rpyNTPData               ReplyType = 16
+	rpyNTPSourceName         ReplyType = 19
+	rpyServerStats2          ReplyType = 22
+	rpyClientAccessesByIndex ReplyType = 21
 )
 
+// maxClientAccesses is the max number of client records in one reply (MAX_CLIENT_ACCESSES)
+const maxClientAccesses = 8
+
 // source modes
 const (
 	SourceModeClient ModeType = 0
@@ -108,6 +131,21 @@ const (
 	SourceStateOutlier     SourceStateType = 5
 )
 
+// leap status
+const (
+	LeapStatusNormal         LeapStatusType = 0
+	LeapStatusInsertSecond   LeapStatusType = 1
+	LeapStatusDeleteSecond   LeapStatusType = 2
+	LeapStatusUnsynchronised LeapStatusType = 3
+)
+
+// timestamp source, chronyd reports it as a character
+const (
+	TimestampSourceDaemon   TimestampSourceType = 'D'
+	TimestampSourceKernel   TimestampSourceType = 'K'
+	TimestampSourceHardware TimestampSourceType = 'H'
+)
+
 // source data flags
 const (
 	FlagNoselect uint16 = 0x1
@@ -116,6 +154,12 @@ const (
 	FlagRequire  uint16 = 0x8
 )
 
+// smoothing flags
+const (
+	SmoothingFlagActive   uint32 = 0x1
+	SmoothingFlagLeapOnly uint32 = 0x2
+)
+
 // ntpdata flags
 const (
 	NTPFlagsTests        uint16 = 0x3ff
@@ -211,6 +255,36 @@ func (m ModeType) String() string {
 	return ModeTypeDesc[m]
 }
 
+// LeapStatusDesc provides mapping from LeapStatusType to string, same as chronyc prints it
+var LeapStatusDesc = [4]string{
+	"Normal",
+	"Insert second",
+	"Delete second",
+	"Not synchronised",
+}
+
+func (l LeapStatusType) String() string {
+	if int(l) >= len(LeapStatusDesc) {
+		return fmt.Sprintf("unknown (%d)", l)
+	}
+	return LeapStatusDesc[l]
+}
+
+// TimestampSourceDesc provides mapping from TimestampSourceType to string
+var TimestampSourceDesc = map[TimestampSourceType]string{
+	TimestampSourceDaemon:   "daemon",
+	TimestampSourceKernel:   "kernel",
+	TimestampSourceHardware: "hardware",
+}
+
+func (t TimestampSourceType) String() string {
+	desc, ok := TimestampSourceDesc[t]
+	if !ok {
+		return fmt.Sprintf("unknown (%d)", t)
+	}
+	return desc
+}
+
 // RequestHead is the first (common) part of the request,
 // in a format that can be directly passed to binary.Write
 type RequestHead struct {
@@ -274,6 +348,71 @@ type RequestNTPData struct {
 	data [maxDataLen - 16]uint8 //nolint:unused,structcheck
 }
 
+// RequestNTPSourceName - packet to request name of the NTP source with given IP
+type RequestNTPSourceName struct {
+	RequestHead
+	IPAddr ipAddr
+	EOR    int32
+	// we pass at max ipv6 addr - 16 bytes
+	data [maxDataLen - 16]uint8 //nolint:unused,structcheck
+}
+
+// RequestOnline - packet to mark sources matching address/mask online.
+// As of now, it's only allowed by Chrony over unix socket connection.
+type RequestOnline struct {
+	RequestHead
+	Mask    ipAddr
+	Address ipAddr
+	EOR     int32
+	// we pass two addresses - 40 bytes
+	data [maxDataLen - 40]uint8 //nolint:unused,structcheck
+}
+
+// RequestOffline - packet to mark sources matching address/mask offline.
+// As of now, it's only allowed by Chrony over unix socket connection.
+type RequestOffline struct {
+	RequestHead
+	Mask    ipAddr
+	Address ipAddr
+	EOR     int32
+	// we pass two addresses - 40 bytes
+	data [maxDataLen - 40]uint8 //nolint:unused,structcheck
+}
+
+// RequestBurst - packet to make sources matching address/mask take a burst of samples.
+// As of now, it's only allowed by Chrony over unix socket connection.
+type RequestBurst struct {
+	RequestHead
+	Mask          ipAddr
+	Address       ipAddr
+	NGoodSamples  int32
+	NTotalSamples int32
+	EOR           int32
+	// we pass two addresses and two i32 - 48 bytes
+	data [maxDataLen - 48]uint8 //nolint:unused,structcheck
+}
+
+// RequestModifyMakestep - packet to change makestep threshold and limit.
+// As of now, it's only allowed by Chrony over unix socket connection.
+type RequestModifyMakestep struct {
+	RequestHead
+	Limit     int32
+	Threshold chronyFloat
+	EOR       int32
+	// we pass i32 and float - 8 bytes
+	data [maxDataLen - 8]uint8 //nolint:unused,structcheck
+}
+
+// RequestDump - packet to make chronyd dump measurement history into dumpdir.
+// As of now, it's only allowed by Chrony over unix socket connection.
+type RequestDump struct {
+	RequestHead
+	Pad int32
+	EOR int32
+	// we pass i32 - 4 bytes
+	data [maxDataLen - 4]uint8 //nolint:unused,structcheck
+}
+
 // RequestServerStats - packet to request server stats
 type RequestServerStats struct {
 	RequestHead
@@ -297,6 +436,26 @@ type RequestSourceStats struct {
 	data [maxDataLen - 4]uint8 //nolint:unused,structcheck
 }
 
+// RequestSmoothing - packet to request 'smoothing' data
+type RequestSmoothing struct {
+	RequestHead
+	// we actually need this to send proper packet
+	data [maxDataLen]uint8 //nolint:unused,structcheck
+}
+
+// RequestClientAccessesByIndex - packet to request a page of client access records starting with FirstIndex.
+// As of now, it's only allowed by Chrony over unix socket connection.
+type RequestClientAccessesByIndex struct {
+	RequestHead
+	FirstIndex uint32
+	NClients   uint32
+	MinHits    uint32
+	Reset      uint32
+	EOR        int32
+	// we pass four u32 - 16 bytes
+	data [maxDataLen - 16]uint8 //nolint:unused,structcheck
+}
+
 // RequestActivity - packet to request 'activity' data
 type RequestActivity struct {
 	RequestHead
@@ -304,6 +463,12 @@ type RequestActivity struct {
 	data [maxDataLen]uint8 //nolint:unused,structcheck
 }
 
+// RequestGeneric - packet with arbitrary command and data, for commands without a typed request
+type RequestGeneric struct {
+	RequestHead
+	Data [maxDataLen]uint8
+}
+
 // ReplyHead is the first (common) part of the reply packet,
 // in a format that can be directly passed to binary.Read
 type ReplyHead struct {
@@ -341,6 +506,11 @@ type replySourcesContent struct {
 	NSources uint32
 }
 
+// ReplyNull is a reply without data, chronyd sends it to commands like 'online' and 'offline'
+type ReplyNull struct {
+	ReplyHead
+}
+
 // ReplySources is a usable version of a reply to 'sources' command
 type ReplySources struct {
 	ReplyHead
@@ -364,6 +534,7 @@ type replySourceDataContent struct {
 // SourceData contains parsed version of 'source data' reply
 type SourceData struct {
 	IPAddr         net.IP
+	RefclockName   string // reference clock driver name, e.g. PPS, set instead of IPAddr
 	Poll           int16
 	Stratum        uint16
 	State          SourceStateType
@@ -377,8 +548,16 @@ type SourceData struct {
 }
 
 func newSourceData(r *replySourceDataContent) *SourceData {
+	ip := r.IPAddr.ToNetIP()
+	name := ""
+	// refclocks have no address, chrony puts their RefID into IPv4 one instead
+	if r.Mode == SourceModeRef && r.IPAddr.Family == ipAddrInet4 {
+		name = refIDString(binary.BigEndian.Uint32(r.IPAddr.IP[:4]))
+		ip = nil
+	}
 	return &SourceData{
-		IPAddr:         r.IPAddr.ToNetIP(),
+		IPAddr:         ip,
+		RefclockName:   name,
 		Poll:           r.Poll,
 		Stratum:        r.Stratum,
 		State:          r.State,
@@ -402,7 +581,7 @@ type replyTrackingContent struct {
 	RefID              uint32
 	IPAddr             ipAddr // our current sync source
 	Stratum            uint16
-	LeapStatus         uint16
+	LeapStatus         LeapStatusType
 	RefTime            timeSpec
 	CurrentCorrection  chronyFloat
 	LastOffset         chronyFloat
@@ -419,8 +598,9 @@ type replyTrackingContent struct {
 type Tracking struct {
 	RefID              uint32
 	IPAddr             net.IP
+	RefclockName       string // reference clock driver name, e.g. PPS, set instead of IPAddr
 	Stratum            uint16
-	LeapStatus         uint16
+	LeapStatus         LeapStatusType
 	RefTime            time.Time
 	CurrentCorrection  float64
 	LastOffset         float64
@@ -437,6 +617,7 @@ func newTracking(r *replyTrackingContent) *Tracking {
 	return &Tracking{
 		RefID:              r.RefID,
 		IPAddr:             r.IPAddr.ToNetIP(),
+		RefclockName:       refclockAddrName(&r.IPAddr, r.RefID),
 		Stratum:            r.Stratum,
 		LeapStatus:         r.LeapStatus,
 		RefTime:            r.RefTime.ToTime(),
@@ -452,6 +633,18 @@ func newTracking(r *replyTrackingContent) *Tracking {
 	}
 }
 
+// RefIDString returns RefID as reference clock name or IPv4 address, like chronyc does
+func (t Tracking) RefIDString() string {
+	return refIDString(t.RefID)
+}
+
+// EstimatedSystemOffset returns how far system clock is from NTP time (system - NTP),
+// so positive value means system clock is ahead. It's the same value chronyc prints as
+// "System time : X seconds fast of NTP time", while "slow" is reported as negative offset.
+func (t Tracking) EstimatedSystemOffset() time.Duration {
+	return -time.Duration(t.CurrentCorrection * float64(time.Second))
+}
+
 // ReplyTracking has usable 'tracking' response
 type ReplyTracking struct {
 	ReplyHead
@@ -475,6 +668,7 @@ type replySourceStatsContent struct {
 type SourceStats struct {
 	RefID              uint32
 	IPAddr             net.IP
+	RefclockName       string // reference clock driver name, e.g. PPS, set instead of IPAddr
 	NSamples           uint32
 	NRuns              uint32
 	SpanSeconds        uint32
@@ -489,6 +683,7 @@ func newSourceStats(r *replySourceStatsContent) *SourceStats {
 	return &SourceStats{
 		RefID:              r.RefID,
 		IPAddr:             r.IPAddr.ToNetIP(),
+		RefclockName:       refclockAddrName(&r.IPAddr, r.RefID),
 		NSamples:           r.NSamples,
 		NRuns:              r.NRuns,
 		SpanSeconds:        r.SpanSeconds,
@@ -500,6 +695,11 @@ func newSourceStats(r *replySourceStatsContent) *SourceStats {
 	}
 }
 
+// RefIDString returns RefID as reference clock name or IPv4 address, like chronyc does
+func (s SourceStats) RefIDString() string {
+	return refIDString(s.RefID)
+}
+
 // ReplySourceStats has usable 'sourcestats' response
 type ReplySourceStats struct {
 	ReplyHead
@@ -591,12 +791,62 @@ func newNTPData(r *replyNTPDataContent) *NTPData {
 	}
 }
 
+// TestsPassed reports if the last measurement passed all chronyd tests
+func (n NTPData) TestsPassed() bool {
+	return n.Flags&NTPFlagsTests == NTPFlagsTests
+}
+
+// Interleaved reports if the source is in interleaved mode
+func (n NTPData) Interleaved() bool {
+	return n.Flags&NTPFlagInterleaved != 0
+}
+
+// Authenticated reports if the source is authenticated
+func (n NTPData) Authenticated() bool {
+	return n.Flags&NTPFlagAuthenticated != 0
+}
+
+// TXTimestampSource returns where TX timestamp of the last packet was taken
+func (n NTPData) TXTimestampSource() TimestampSourceType {
+	return TimestampSourceType(n.TXTssChar)
+}
+
+// RXTimestampSource returns where RX timestamp of the last packet was taken
+func (n NTPData) RXTimestampSource() TimestampSourceType {
+	return TimestampSourceType(n.RXTssChar)
+}
+
+// FlagsString returns test results as bits, the same as chronyc's "Test result", followed by set mode flags,
+// e.g. "1111111101 interleaved authenticated"
+func (n NTPData) FlagsString() string {
+	res := fmt.Sprintf("%010b", n.Flags&NTPFlagsTests)
+	if n.Interleaved() {
+		res += " interleaved"
+	}
+	if n.Authenticated() {
+		res += " authenticated"
+	}
+	return res
+}
+
 // ReplyNTPData is a what end user will get for of 'ntp data' response
 type ReplyNTPData struct {
 	ReplyHead
 	NTPData
 }
 
+// replyNTPSourceNameContent is a payload of 'ntp source name' response
+type replyNTPSourceNameContent struct {
+	Name [256]uint8
+}
+
+// ReplyNTPSourceName is a what end user will get for of 'ntp source name' response
+type ReplyNTPSourceName struct {
+	ReplyHead
+	// Name is the name of the source as specified in chronyd config, e.g. hostname
+	Name string
+}
+
 // ServerStats contains parsed version of 'serverstats' reply
 type ServerStats struct {
 	NTPHits  uint32
@@ -645,6 +895,118 @@ type ReplyActivity struct {
 	Activity
 }
 
+type replySmoothingContent struct {
+	Flags         uint32
+	Offset        chronyFloat
+	FreqPPM       chronyFloat
+	WanderPPM     chronyFloat
+	LastUpdateAgo chronyFloat
+	RemainingTime chronyFloat
+}
+
+// SmoothingState contains parsed version of 'smoothing' reply
+type SmoothingState struct {
+	Flags         uint32
+	Offset        float64
+	FreqPPM       float64
+	WanderPPM     float64
+	LastUpdateAgo float64
+	RemainingTime float64
+}
+
+func newSmoothingState(r *replySmoothingContent) *SmoothingState {
+	return &SmoothingState{
+		Flags:         r.Flags,
+		Offset:        r.Offset.ToFloat(),
+		FreqPPM:       r.FreqPPM.ToFloat(),
+		WanderPPM:     r.WanderPPM.ToFloat(),
+		LastUpdateAgo: r.LastUpdateAgo.ToFloat(),
+		RemainingTime: r.RemainingTime.ToFloat(),
+	}
+}
+
+// Active reports if chronyd is currently smoothing served time
+func (s SmoothingState) Active() bool {
+	return s.Flags&SmoothingFlagActive != 0
+}
+
+// ReplySmoothing is a usable version of 'smoothing' response
+type ReplySmoothing struct {
+	ReplyHead
+	SmoothingState
+}
+
+type replyClientAccessesHead struct {
+	NIndices  uint32
+	NextIndex uint32
+	NClients  uint32
+}
+
+type replyClientAccessContent struct {
+	IPAddr             ipAddr
+	NTPHits            uint32
+	NKEHits            uint32
+	CMDHits            uint32
+	NTPDrops           uint32
+	NKEDrops           uint32
+	CMDDrops           uint32
+	NTPInterval        int8
+	NKEInterval        int8
+	CMDInterval        int8
+	NTPTimeoutInterval int8
+	LastNTPHitAgo      uint32
+	LastNKEHitAgo      uint32
+	LastCMDHitAgo      uint32
+}
+
+// ClientAccess contains parsed version of a single 'clients' record.
+// Intervals are log2 of the average interval between hits in seconds,
+// Last*HitAgo are seconds since the last hit.
+type ClientAccess struct {
+	IPAddr             net.IP
+	NTPHits            uint32
+	NKEHits            uint32
+	CMDHits            uint32
+	NTPDrops           uint32
+	NKEDrops           uint32
+	CMDDrops           uint32
+	NTPInterval        int8
+	NKEInterval        int8
+	CMDInterval        int8
+	NTPTimeoutInterval int8
+	LastNTPHitAgo      uint32
+	LastNKEHitAgo      uint32
+	LastCMDHitAgo      uint32
+}
+
+func newClientAccess(r *replyClientAccessContent) *ClientAccess {
+	return &ClientAccess{
+		IPAddr:             r.IPAddr.ToNetIP(),
+		NTPHits:            r.NTPHits,
+		NKEHits:            r.NKEHits,
+		CMDHits:            r.CMDHits,
+		NTPDrops:           r.NTPDrops,
+		NKEDrops:           r.NKEDrops,
+		CMDDrops:           r.CMDDrops,
+		NTPInterval:        r.NTPInterval,
+		NKEInterval:        r.NKEInterval,
+		CMDInterval:        r.CMDInterval,
+		NTPTimeoutInterval: r.NTPTimeoutInterval,
+		LastNTPHitAgo:      r.LastNTPHitAgo,
+		LastNKEHitAgo:      r.LastNKEHitAgo,
+		LastCMDHitAgo:      r.LastCMDHitAgo,
+	}
+}
+
+// ReplyClientAccesses is a usable version of 'clients' response page.
+// NIndices is the size of chronyd client table, NextIndex is where the next page starts.
+type ReplyClientAccesses struct {
+	ReplyHead
+	NIndices       uint32
+	NextIndex      uint32
+	ClientAccesses []ClientAccess
+}
+
 // here go request constuctors
 
 // NewSourcesPacket creates new packet to request number of sources (peers)
@@ -705,6 +1067,107 @@ func NewNTPDataPacket(ip net.IP) *RequestNTPData {
 	}
 }
 
+// NewNTPSourceNamePacket creates new packet to request name of the NTP source with given IP
+func NewNTPSourceNamePacket(ip net.IP) *RequestNTPSourceName {
+	return &RequestNTPSourceName{
+		RequestHead: RequestHead{
+			Version: protoVersionNumber,
+			PKTType: pktTypeCmdRequest,
+			Command: reqNTPSourceName,
+		},
+		IPAddr: *newIPAddr(ip),
+	}
+}
+
+// NewOnlinePacket creates new packet to mark sources matching address/mask online.
+// Same as chronyc, nil address selects all sources, nil mask selects just the address
+func NewOnlinePacket(address net.IP, mask net.IPMask) *RequestOnline {
+	m, a := newMaskAddress(address, mask)
+	return &RequestOnline{
+		RequestHead: RequestHead{
+			Version: protoVersionNumber,
+			PKTType: pktTypeCmdRequest,
+			Command: reqOnline,
+		},
+		Mask:    *m,
+		Address: *a,
+	}
+}
+
+// NewOfflinePacket creates new packet to mark sources matching address/mask offline.
+// Same as chronyc, nil address selects all sources, nil mask selects just the address
+func NewOfflinePacket(address net.IP, mask net.IPMask) *RequestOffline {
+	m, a := newMaskAddress(address, mask)
+	return &RequestOffline{
+		RequestHead: RequestHead{
+			Version: protoVersionNumber,
+			PKTType: pktTypeCmdRequest,
+			Command: reqOffline,
+		},
+		Mask:    *m,
+		Address: *a,
+	}
+}
+
+// NewBurstPacket creates new packet to request a burst of nGood good samples out of nMax
+// from sources matching address/mask. Nil address selects all sources, nil mask selects just the address
+func NewBurstPacket(nGood, nMax int, address net.IP, mask net.IPMask) (*RequestBurst, error) {
+	if nGood < 1 || nGood > nMax || nMax > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid burst of %d/%d samples, need 0 < good <= max", nGood, nMax)
+	}
+	m, a := newMaskAddress(address, mask)
+	return &RequestBurst{
+		RequestHead: RequestHead{
+			Version: protoVersionNumber,
+			PKTType: pktTypeCmdRequest,
+			Command: reqBurst,
+		},
+		Mask:          *m,
+		Address:       *a,
+		NGoodSamples:  int32(nGood),
+		NTotalSamples: int32(nMax),
+	}, nil
+}
+
+// NewModifyMakestepPacket creates new packet to make chronyd step the clock
+// if the adjustment is larger than threshold (in seconds), but only in the first limit clock updates
+func NewModifyMakestepPacket(threshold float64, limit int32) *RequestModifyMakestep {
+	return &RequestModifyMakestep{
+		RequestHead: RequestHead{
+			Version: protoVersionNumber,
+			PKTType: pktTypeCmdRequest,
+			Command: reqModifyMakestep,
+		},
+		Limit:     limit,
+		Threshold: newChronyFloat(threshold),
+	}
+}
+
+// NewDumpPacket creates new packet to make chronyd dump measurement history of sources into dumpdir
+func NewDumpPacket() *RequestDump {
+	return &RequestDump{
+		RequestHead: RequestHead{
+			Version: protoVersionNumber,
+			PKTType: pktTypeCmdRequest,
+			Command: reqDump,
+		},
+	}
+}
+
+// NewClientAccessesByIndexPacket creates new packet to request up to nClients 'clients' records
+// starting with firstIndex in chronyd client table
+func NewClientAccessesByIndexPacket(firstIndex, nClients uint32) *RequestClientAccessesByIndex {
+	return &RequestClientAccessesByIndex{
+		RequestHead: RequestHead{
+			Version: protoVersionNumber,
+			PKTType: pktTypeCmdRequest,
+			Command: reqClientAccessesByIndex,
+		},
+		FirstIndex: firstIndex,
+		NClients:   nClients,
+	}
+}
+
 // NewServerStatsPacket creates new packet to request 'serverstats' information
 func NewServerStatsPacket() *RequestServerStats {
 	return &RequestServerStats{
@@ -716,6 +1179,17 @@ func NewServerStatsPacket() *RequestServerStats {
 	}
 }
 
+// NewSmoothingPacket creates new packet to request 'smoothing' information
+func NewSmoothingPacket() *RequestSmoothing {
+	return &RequestSmoothing{
+		RequestHead: RequestHead{
+			Version: protoVersionNumber,
+			PKTType: pktTypeCmdRequest,
+			Command: reqSmoothing,
+		},
+	}
+}
+
 // NewActivityPacket creates new packet to request 'activity' information
 func NewActivityPacket() *RequestActivity {
 	return &RequestActivity{
@@ -727,19 +1201,95 @@ func NewActivityPacket() *RequestActivity {
 	}
 }
 
-// decodePacket decodes bytes to valid response packet
-func decodePacket(response []byte) (ResponsePacket, error) {
-	var err error
+// NewGenericPacket creates new packet with arbitrary command and data, which is laid out as chronyd expects
+// in the request body (big-endian, zero padded). It's an escape hatch for commands without a typed request
+func NewGenericPacket(command CommandType, data []byte) (*RequestGeneric, error) {
+	if len(data) > maxDataLen {
+		return nil, fmt.Errorf("%d bytes of data don't fit into %d bytes of request", len(data), maxDataLen)
+	}
+	p := &RequestGeneric{
+		RequestHead: RequestHead{
+			Version: protoVersionNumber,
+			PKTType: pktTypeCmdRequest,
+			Command: command,
+		},
+	}
+	copy(p.Data[:], data)
+	return p, nil
+}
+
+// ErrNotAuthorized is returned when chronyd refuses a privileged request.
+// Protocol v6 has no command authentication (it was removed in chrony 2.2),
+// such requests are only allowed over the local unix socket (ChronySocketPath).
+var ErrNotAuthorized = errors.New("request is not authorized, privileged commands require the chronyd unix socket")
+
+// StatusError is returned when chronyd replies with status other than success
+type StatusError struct {
+	Status ResponseStatusType
+}
+
+func (e *StatusError) Error() string {
+	if e.Status == sttUnauth {
+		return fmt.Sprintf("got status %s (%d): %v", e.Status, e.Status, ErrNotAuthorized)
+	}
+	return fmt.Sprintf("got status %s (%d)", e.Status, e.Status)
+}
+
+// Unwrap returns ErrNotAuthorized for UNAUTH status
+func (e *StatusError) Unwrap() error {
+	if e.Status == sttUnauth {
+		return ErrNotAuthorized
+	}
+	return nil
+}
+
+// DecodeError is returned when a reply can't be decoded. It keeps the raw packet for debugging,
+// the underlying error (e.g. *StatusError) is available via errors.As
+type DecodeError struct {
+	// Reply and Status are zero if the packet is too short for ReplyHead
+	Reply  ReplyType
+	Status ResponseStatusType
+	// Raw is the whole packet as received, its length is what chronyd sent
+	Raw []byte
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding reply type %d of %d bytes: %v", e.Reply, len(e.Raw), e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodePacket decodes bytes to valid response packet. Errors are reported as *DecodeError
+func decodePacket(response []byte) (packet ResponsePacket, err error) {
 	r := bytes.NewReader(response)
 	head := new(ReplyHead)
+	defer func() {
+		if err != nil {
+			packet = nil
+			err = &DecodeError{
+				Reply:  head.Reply,
+				Status: head.Status,
+				Raw:    append([]byte(nil), response...),
+				Err:    err,
+			}
+		}
+	}()
 	if err = binary.Read(r, binary.BigEndian, head); err != nil {
 		return nil, err
 	}
 	log.Debugf("response head: %+v", head)
 	if head.Status != sttSuccess {
-		return nil, fmt.Errorf("got status %s (%d)", head.Status, head.Status)
+		return nil, &StatusError{Status: head.Status}
 	}
 	switch head.Reply {
+	case rpyNull:
+		return &ReplyNull{
+			ReplyHead: *head,
+		}, nil
 	case rpyNSources:
 		data := new(replySourcesContent)
 		if err = binary.Read(r, binary.BigEndian, data); err != nil {
@@ -800,6 +1350,20 @@ func decodePacket(response []byte) (ResponsePacket, error) {
 			ReplyHead: *head,
 			NTPData:   *newNTPData(data),
 		}, nil
+	case rpyNTPSourceName:
+		data := new(replyNTPSourceNameContent)
+		if err = binary.Read(r, binary.BigEndian, data); err != nil {
+			return nil, err
+		}
+		log.Debugf("response data: %+v", data)
+		name := data.Name[:]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		return &ReplyNTPSourceName{
+			ReplyHead: *head,
+			Name:      string(name),
+		}, nil
 	case rpyServerStats2:
 		data := new(ServerStats2)
 		if err = binary.Read(r, binary.BigEndian, data); err != nil {
@@ -820,7 +1384,42 @@ func decodePacket(response []byte) (ResponsePacket, error) {
 			ReplyHead: *head,
 			Activity:  *data,
 		}, nil
+	case rpySmoothing:
+		data := new(replySmoothingContent)
+		if err = binary.Read(r, binary.BigEndian, data); err != nil {
+			return nil, err
+		}
+		log.Debugf("response data: %+v", data)
+		return &ReplySmoothing{
+			ReplyHead:      *head,
+			SmoothingState: *newSmoothingState(data),
+		}, nil
+	case rpyClientAccessesByIndex:
+		data := new(replyClientAccessesHead)
+		if err = binary.Read(r, binary.BigEndian, data); err != nil {
+			return nil, err
+		}
+		log.Debugf("response data: %+v", data)
+		if data.NClients > maxClientAccesses {
+			return nil, fmt.Errorf("invalid number of clients %d in 'clients' response", data.NClients)
+		}
+		reply := &ReplyClientAccesses{
+			ReplyHead: *head,
+			NIndices:  data.NIndices,
+			NextIndex: data.NextIndex,
+		}
+		for i := uint32(0); i < data.NClients; i++ {
+			client := new(replyClientAccessContent)
+			if err = binary.Read(r, binary.BigEndian, client); err != nil {
+				return nil, err
+			}
+			reply.ClientAccesses = append(reply.ClientAccesses, *newClientAccess(client))
+		}
+		return reply, nil
 	default:
+		if fn := registeredReply(head.Reply); fn != nil {
+			return fn(response)
+		}
 		return nil, fmt.Errorf("not implemented reply type %d from %+v", head.Reply, head)
 	}
 }
@@ -17,6 +17,10 @@ limitations under the License.
 package chrony
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
 	"net"
 	"testing"
 	"time"
@@ -43,8 +47,37 @@ func TestDecodeUnauthorized(t *testing.T) {
 		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xa3, 0xa8, 0xc8, 0x40,
 		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
 	}
+	packet, err := decodePacket(raw)
+	require.Nil(t, packet)
+	require.ErrorIs(t, err, ErrNotAuthorized)
+	var decodeErr *DecodeError
+	require.True(t, errors.As(err, &decodeErr))
+	require.Equal(t, sttUnauth, decodeErr.Status)
+	require.Equal(t, rpyNull, decodeErr.Reply)
+	require.Equal(t, raw, decodeErr.Raw)
+	var statusErr *StatusError
+	require.True(t, errors.As(err, &statusErr))
+	require.Equal(t, sttUnauth, statusErr.Status)
+}
+
+func TestDecodeErrorTruncated(t *testing.T) {
+	raw := []uint8{
+		0x06, 0x02, 0x00, 0x00, 0x00, 0x21, 0x00, 0x05, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xe6, 0x25,
+	}
 	_, err := decodePacket(raw)
-	require.Error(t, err)
+	var decodeErr *DecodeError
+	require.True(t, errors.As(err, &decodeErr))
+	require.Equal(t, rpyTracking, decodeErr.Reply)
+	require.Equal(t, sttSuccess, decodeErr.Status)
+	require.Equal(t, raw, decodeErr.Raw)
+	require.Equal(t, "decoding reply type 5 of 30 bytes: unexpected EOF", err.Error())
+
+	_, err = decodePacket(raw[:10])
+	require.True(t, errors.As(err, &decodeErr))
+	require.Equal(t, ReplyType(0), decodeErr.Reply)
+	require.Len(t, decodeErr.Raw, 10)
 }
 
 func TestDecodeSources(t *testing.T) {
@@ -70,17 +103,58 @@ func TestDecodeSources(t *testing.T) {
 	require.Equal(t, want, packet)
 }
 
+// sourcedata reply for an NTP source
+var sourceDataRaw = []uint8{
+	0x06, 0x02, 0x00, 0x00, 0x00, 0x0f, 0x00, 0x03, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x83, 0xbf, 0x73,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x24, 0x01,
+	0xdb, 0x00, 0x31, 0x10, 0x20, 0xc0, 0xfa, 0xce, 0x00, 0x00,
+	0x00, 0x48, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x0a,
+	0x00, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff,
+	0x00, 0x00, 0x06, 0xa9, 0xe6, 0xc5, 0xee, 0xf3, 0xe6, 0xd1,
+	0x4f, 0xbe, 0xea, 0xbb, 0x92, 0x3b,
+}
+
+// sourcedata reply for a PPS refclock, chrony puts RefID in place of IPv4 address
+var sourceDataRefclockRaw = []uint8{
+	0x06, 0x02, 0x00, 0x00, 0x00, 0x0f, 0x00, 0x03, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x83, 0xbf, 0x73,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x50, 0x50,
+	0x53, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x04,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0xff,
+	0x00, 0x00, 0x06, 0xa9, 0xe6, 0xc5, 0xee, 0xf3, 0xe6, 0xd1,
+	0x4f, 0xbe, 0xea, 0xbb, 0x92, 0x3b,
+}
+
+// sourcestats reply for the same NTP source as sourceDataRaw
+var sourceStatsRaw = []uint8{
+	0x06, 0x02, 0x00, 0x00, 0x00, 0x22, 0x00, 0x06, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x59, 0x95, 0xd8, 0xfa,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xbf, 0x8b,
+	0xe5, 0xe9, 0x24, 0x01, 0xdb, 0x00, 0x31, 0x10, 0x20, 0xc0,
+	0xfa, 0xce, 0x00, 0x00, 0x00, 0x48, 0x00, 0x00, 0x00, 0x02,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x00, 0x00, 0x00, 0x05,
+	0x00, 0x00, 0x1a, 0x27, 0xe4, 0x94, 0x84, 0x99, 0xed, 0x34,
+	0xe0, 0x09, 0xf6, 0xc0, 0x64, 0x94, 0xdf, 0x18, 0xb4, 0x76,
+	0xea, 0xb9, 0xc0, 0xa1,
+}
+
+// sourcestats reply for the same PPS refclock as sourceDataRefclockRaw, which has no address
+var sourceStatsRefclockRaw = []uint8{
+	0x06, 0x02, 0x00, 0x00, 0x00, 0x22, 0x00, 0x06, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x59, 0x95, 0xd8, 0xfa,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x50, 0x50,
+	0x53, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x00, 0x00, 0x00, 0x05,
+	0x00, 0x00, 0x1a, 0x27, 0xe4, 0x94, 0x84, 0x99, 0xed, 0x34,
+	0xe0, 0x09, 0xf6, 0xc0, 0x64, 0x94, 0xdf, 0x18, 0xb4, 0x76,
+	0xea, 0xb9, 0xc0, 0xa1,
+}
+
 func TestDecodeSourceData(t *testing.T) {
-	raw := []uint8{
-		0x06, 0x02, 0x00, 0x00, 0x00, 0x0f, 0x00, 0x03, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x83, 0xbf, 0x73,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x24, 0x01,
-		0xdb, 0x00, 0x31, 0x10, 0x20, 0xc0, 0xfa, 0xce, 0x00, 0x00,
-		0x00, 0x48, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x0a,
-		0x00, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff,
-		0x00, 0x00, 0x06, 0xa9, 0xe6, 0xc5, 0xee, 0xf3, 0xe6, 0xd1,
-		0x4f, 0xbe, 0xea, 0xbb, 0x92, 0x3b,
-	}
+	raw := sourceDataRaw
 	packet, err := decodePacket(raw)
 	require.Nil(t, err)
 	want := &ReplySourceData{
@@ -109,18 +183,39 @@ func TestDecodeSourceData(t *testing.T) {
 	require.Equal(t, want, packet)
 }
 
-func TestDecodeSourceStats(t *testing.T) {
-	raw := []uint8{
-		0x06, 0x02, 0x00, 0x00, 0x00, 0x22, 0x00, 0x06, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x59, 0x95, 0xd8, 0xfa,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xbf, 0x8b,
-		0xe5, 0xe9, 0x24, 0x01, 0xdb, 0x00, 0x31, 0x10, 0x20, 0xc0,
-		0xfa, 0xce, 0x00, 0x00, 0x00, 0x48, 0x00, 0x00, 0x00, 0x02,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x00, 0x00, 0x00, 0x05,
-		0x00, 0x00, 0x1a, 0x27, 0xe4, 0x94, 0x84, 0x99, 0xed, 0x34,
-		0xe0, 0x09, 0xf6, 0xc0, 0x64, 0x94, 0xdf, 0x18, 0xb4, 0x76,
-		0xea, 0xb9, 0xc0, 0xa1,
+// same reply for a PPS refclock, chrony puts RefID in place of IPv4 address
+func TestDecodeSourceDataRefclock(t *testing.T) {
+	raw := sourceDataRefclockRaw
+	packet, err := decodePacket(raw)
+	require.Nil(t, err)
+	want := &ReplySourceData{
+		ReplyHead: ReplyHead{
+			Version:  protoVersionNumber,
+			PKTType:  pktTypeCmdReply,
+			Command:  reqSourceData,
+			Reply:    rpySourceData,
+			Status:   sttSuccess,
+			Sequence: 209960819,
+		},
+		SourceData: SourceData{
+			RefclockName:   "PPS",
+			Poll:           4,
+			Stratum:        0,
+			State:          SourceStateSync,
+			Mode:           SourceModeRef,
+			Flags:          0,
+			Reachability:   255,
+			SinceSample:    1705,
+			OrigLatestMeas: 4.719099888461642e-05,
+			LatestMeas:     4.990374873159453e-05,
+			LatestMeasErr:  0.00017888184811454266,
+		},
 	}
+	require.Equal(t, want, packet)
+}
+
+func TestDecodeSourceStats(t *testing.T) {
+	raw := sourceStatsRaw
 	packet, err := decodePacket(raw)
 	require.Nil(t, err)
 	want := &ReplySourceStats{
@@ -148,6 +243,19 @@ func TestDecodeSourceStats(t *testing.T) {
 	require.Equal(t, want, packet)
 }
 
+// same reply for a PPS refclock, which has no address
+func TestDecodeSourceStatsRefclock(t *testing.T) {
+	raw := sourceStatsRefclockRaw
+	packet, err := decodePacket(raw)
+	require.Nil(t, err)
+	stats, ok := packet.(*ReplySourceStats)
+	require.True(t, ok)
+	require.Equal(t, uint32(0x50505300), stats.RefID)
+	require.Nil(t, stats.IPAddr)
+	require.Equal(t, "PPS", stats.RefclockName)
+	require.Equal(t, uint32(12), stats.NSamples)
+}
+
 func TestDecodeTracking(t *testing.T) {
 	raw := []uint8{
 		0x06, 0x02, 0x00, 0x00, 0x00, 0x21, 0x00, 0x05, 0x00, 0x00,
@@ -179,7 +287,7 @@ func TestDecodeTracking(t *testing.T) {
 			RefID:              3861235310,
 			IPAddr:             net.IP{36, 1, 219, 0, 49, 16, 33, 50, 250, 206, 0, 0, 0, 142, 0, 0},
 			Stratum:            3,
-			LeapStatus:         0,
+			LeapStatus:         LeapStatusNormal,
 			RefTime:            time.Unix(0, 1631117697915705301),
 			CurrentCorrection:  -3.4395072816550964e-06,
 			LastOffset:         -2.823539716700907e-06,
@@ -193,6 +301,34 @@ func TestDecodeTracking(t *testing.T) {
 		},
 	}
 	require.Equal(t, want, packet)
+	require.Equal(t, "Normal", want.LeapStatus.String())
+	// System time     : 0.000003440 seconds fast of NTP time
+	require.Equal(t, 3439*time.Nanosecond, want.EstimatedSystemOffset())
+}
+
+// same reply while synchronised to a PPS refclock, which has no address
+func TestDecodeTrackingRefclock(t *testing.T) {
+	raw := []uint8{
+		0x06, 0x02, 0x00, 0x00, 0x00, 0x21, 0x00, 0x05, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x50, 0x50,
+		0x53, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x61, 0x38, 0xe1, 0x81, 0x36, 0x94, 0x8d, 0xd5, 0xdf, 0x19,
+		0x2d, 0xb7, 0xdf, 0x42, 0x83, 0xf5, 0xe2, 0xeb, 0xca, 0x12,
+		0x05, 0x39, 0xe1, 0x11, 0xeb, 0x7b, 0x3e, 0x5d, 0xf4, 0xb0,
+		0x75, 0x12, 0xea, 0xe7, 0x5b, 0x0c, 0xf0, 0x88, 0x1d, 0x4e,
+		0x16, 0x82, 0x1f, 0x69,
+	}
+	packet, err := decodePacket(raw)
+	require.Nil(t, err)
+	tracking, ok := packet.(*ReplyTracking)
+	require.True(t, ok)
+	require.Nil(t, tracking.IPAddr)
+	require.Equal(t, "PPS", tracking.RefclockName)
+	require.Equal(t, "PPS", tracking.RefIDString())
+	require.Equal(t, uint16(1), tracking.Stratum)
 }
 
 /* private part of the protocol */
@@ -327,6 +463,92 @@ func TestDecodeNTPData(t *testing.T) {
 	require.Equal(t, want, packet)
 }
 
+func TestNTPDataFlags(t *testing.T) {
+	// fixture above: one test failed, interleaved
+	data := NTPData{Flags: 17405}
+	require.False(t, data.TestsPassed())
+	require.True(t, data.Interleaved())
+	require.False(t, data.Authenticated())
+	require.Equal(t, "1111111101 interleaved", data.FlagsString())
+
+	data = NTPData{Flags: 0xffff}
+	require.True(t, data.TestsPassed())
+	require.True(t, data.Interleaved())
+	require.True(t, data.Authenticated())
+	require.Equal(t, "1111111111 interleaved authenticated", data.FlagsString())
+
+	data = NTPData{Flags: NTPFlagAuthenticated}
+	require.False(t, data.Interleaved())
+	require.True(t, data.Authenticated())
+	require.Equal(t, "0000000000 authenticated", data.FlagsString())
+
+	// every test bit on its own
+	for i := 0; i < 10; i++ {
+		data = NTPData{Flags: NTPFlagsTests &^ (1 << i)}
+		require.False(t, data.TestsPassed())
+		require.False(t, data.Interleaved())
+		require.False(t, data.Authenticated())
+		require.Equal(t, "1111111111"[:9-i]+"0"+"1111111111"[10-i:], data.FlagsString())
+	}
+}
+
+func TestTimestampSourceTypeToString(t *testing.T) {
+	testCases := []struct {
+		in   TimestampSourceType
+		want string
+	}{
+		{in: 'D', want: "daemon"},
+		{in: 'K', want: "kernel"},
+		{in: 'H', want: "hardware"},
+		{in: '-', want: "unknown (45)"},
+		{in: 0, want: "unknown (0)"},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.want, tc.in.String())
+	}
+}
+
+func TestNTPDataTimestampSource(t *testing.T) {
+	// fixture above
+	data := NTPData{TXTssChar: 75, RXTssChar: 75}
+	require.Equal(t, TimestampSourceKernel, data.TXTimestampSource())
+	require.Equal(t, TimestampSourceKernel, data.RXTimestampSource())
+
+	data = NTPData{TXTssChar: 'D', RXTssChar: 'H'}
+	require.Equal(t, "daemon", data.TXTimestampSource().String())
+	require.Equal(t, "hardware", data.RXTimestampSource().String())
+}
+
+func TestDecodeNTPDataIPv4(t *testing.T) {
+	raw := []uint8{
+		0x06, 0x02, 0x00, 0x00, 0x00, 0x39, 0x00, 0x10, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xe9, 0xb2, 0x80, 0xdb,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0a, 0x00,
+		0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x0a, 0x00,
+		0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x7b,
+		0x00, 0x04, 0x04, 0x02, 0x0a, 0xe8, 0xe4, 0x80, 0x00, 0x00,
+		0xe4, 0x80, 0x00, 0x00, 0x23, 0xe1, 0x0b, 0x36, 0x00, 0x00,
+		0x00, 0x00, 0x61, 0x3a, 0x39, 0xf0, 0x06, 0x6a, 0xe1, 0xf8,
+		0xf3, 0x50, 0x79, 0x73, 0xfc, 0xa1, 0x7d, 0x6e, 0xd4, 0xb6,
+		0x81, 0xb7, 0xe6, 0xd1, 0xb9, 0x3d, 0x01, 0x04, 0xb6, 0xad,
+		0x43, 0xfd, 0x4b, 0x4b, 0x00, 0x00, 0x11, 0x2f, 0x00, 0x00,
+		0x11, 0x2c, 0x00, 0x00, 0x11, 0x2c, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff,
+	}
+	packet, err := decodePacket(raw)
+	require.Nil(t, err)
+	ntpData, ok := packet.(*ReplyNTPData)
+	require.True(t, ok)
+	require.Equal(t, net.IP{0x0a, 0x00, 0x00, 0x01}, ntpData.RemoteAddr)
+	require.Equal(t, "10.0.0.1", ntpData.RemoteAddr.String())
+	require.Equal(t, net.IP{0x0a, 0x00, 0x00, 0x02}, ntpData.LocalAddr)
+	require.Equal(t, "10.0.0.2", ntpData.LocalAddr.String())
+	require.Equal(t, uint16(123), ntpData.RemotePort)
+}
+
 func TestDecodeActivity(t *testing.T) {
 	raw := []uint8{
 		0x06, 0x02, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x0c, 0x00, 0x00,
@@ -383,6 +605,22 @@ func TestModeTypeToString(t *testing.T) {
 	require.Equal(t, want, got)
 }
 
+func TestLeapStatusTypeToString(t *testing.T) {
+	testCases := []struct {
+		in   LeapStatusType
+		want string
+	}{
+		{in: LeapStatusNormal, want: "Normal"},
+		{in: LeapStatusInsertSecond, want: "Insert second"},
+		{in: LeapStatusDeleteSecond, want: "Delete second"},
+		{in: LeapStatusUnsynchronised, want: "Not synchronised"},
+		{in: LeapStatusType(10), want: "unknown (10)"},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.want, tc.in.String())
+	}
+}
+
 func FuzzDecodePacket(f *testing.F) {
 	tracking := []uint8{
 		0x06, 0x02, 0x00, 0x00, 0x00, 0x21, 0x00, 0x05, 0x00, 0x00,
@@ -407,3 +645,295 @@ func FuzzDecodePacket(f *testing.F) {
 		}
 	})
 }
+
+func TestOfflinePacketLayout(t *testing.T) {
+	// as sent by `chronyc offline 192.168.1.0/24`, chronyc doesn't pad this request
+	chronyc := []uint8{
+		0x06, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// mask
+		0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00,
+		// address
+		0xc0, 0xa8, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00,
+		// EOR
+		0x00, 0x00, 0x00, 0x00,
+	}
+	_, subnet, err := net.ParseCIDR("192.168.1.0/24")
+	require.NoError(t, err)
+	packet := NewOfflinePacket(subnet.IP, subnet.Mask)
+	packet.SetSequence(1)
+	buf := &bytes.Buffer{}
+	require.NoError(t, binary.Write(buf, binary.BigEndian, packet))
+	b := buf.Bytes()
+	require.Equal(t, chronyc, b[:len(chronyc)])
+	require.Equal(t, make([]byte, len(b)-len(chronyc)), b[len(chronyc):], "the rest is padding")
+}
+
+func TestOnlinePacket(t *testing.T) {
+	packet := NewOnlinePacket(nil, nil)
+	require.Equal(t, reqOnline, packet.GetCommand())
+	require.Equal(t, ipAddr{}, packet.Mask, "all sources")
+	require.Equal(t, ipAddr{}, packet.Address, "all sources")
+
+	packet = NewOnlinePacket(net.ParseIP("2401:db00::1"), nil)
+	require.Equal(t, ipAddrInet6, packet.Mask.Family)
+	require.Equal(t, net.IP(net.CIDRMask(128, 128)), packet.Mask.ToNetIP())
+	require.Equal(t, net.ParseIP("2401:db00::1"), packet.Address.ToNetIP())
+
+	packet = NewOnlinePacket(net.ParseIP("10.0.0.1"), nil)
+	require.Equal(t, net.IP{255, 255, 255, 255}, packet.Mask.ToNetIP())
+	require.Equal(t, net.IP{10, 0, 0, 1}, packet.Address.ToNetIP())
+}
+
+func TestDecodeNull(t *testing.T) {
+	raw := []uint8{
+		0x06, 0x02, 0x00, 0x00, 0x00, 0x02, 0x00, 0x01, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	packet, err := decodePacket(raw)
+	require.Nil(t, err)
+	want := &ReplyNull{
+		ReplyHead: ReplyHead{
+			Version:  protoVersionNumber,
+			PKTType:  pktTypeCmdReply,
+			Command:  reqOffline,
+			Reply:    rpyNull,
+			Status:   sttSuccess,
+			Sequence: 1,
+		},
+	}
+	require.Equal(t, want, packet)
+}
+
+func TestBurstPacketLayout(t *testing.T) {
+	// as sent by `chronyc burst 2/10 10.0.0.1`
+	chronyc := []uint8{
+		0x06, 0x01, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// mask
+		0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00,
+		// address
+		0x0a, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00,
+		// good and total samples
+		0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x0a,
+		// EOR
+		0x00, 0x00, 0x00, 0x00,
+	}
+	packet, err := NewBurstPacket(2, 10, net.ParseIP("10.0.0.1"), nil)
+	require.NoError(t, err)
+	packet.SetSequence(1)
+	buf := &bytes.Buffer{}
+	require.NoError(t, binary.Write(buf, binary.BigEndian, packet))
+	b := buf.Bytes()
+	require.Equal(t, chronyc, b[:len(chronyc)])
+	require.Equal(t, make([]byte, len(b)-len(chronyc)), b[len(chronyc):], "the rest is padding")
+}
+
+func TestBurstPacketInvalid(t *testing.T) {
+	for _, c := range [][2]int{{0, 4}, {-1, 4}, {5, 4}, {1, 1 << 32}} {
+		_, err := NewBurstPacket(c[0], c[1], nil, nil)
+		require.Error(t, err, "burst %d/%d", c[0], c[1])
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	var err error = &StatusError{Status: sttNoSuchSource}
+	require.Equal(t, "got status NOSUCHSOURCE (4)", err.Error())
+	require.False(t, errors.Is(err, ErrNotAuthorized))
+
+	err = &StatusError{Status: sttUnauth}
+	require.ErrorIs(t, err, ErrNotAuthorized)
+}
+
+func TestModifyMakestepPacketLayout(t *testing.T) {
+	// as sent by `chronyc makestep 0.1 3`
+	chronyc := []uint8{
+		0x06, 0x01, 0x00, 0x00, 0x00, 0x32, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// limit
+		0x00, 0x00, 0x00, 0x03,
+		// threshold
+		0xfc, 0xcc, 0xcc, 0xcd,
+		// EOR
+		0x00, 0x00, 0x00, 0x00,
+	}
+	packet := NewModifyMakestepPacket(0.1, 3)
+	packet.SetSequence(1)
+	buf := &bytes.Buffer{}
+	require.NoError(t, binary.Write(buf, binary.BigEndian, packet))
+	b := buf.Bytes()
+	require.Equal(t, chronyc, b[:len(chronyc)])
+	require.Equal(t, make([]byte, len(b)-len(chronyc)), b[len(chronyc):], "the rest is padding")
+}
+
+func TestDumpPacketLayout(t *testing.T) {
+	// REQ_DUMP (6) with REQ_Dump body as laid out in chrony candm.h, not a capture of `chronyc dump`
+	expected := []uint8{
+		0x06, 0x01, 0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// pad
+		0x00, 0x00, 0x00, 0x00,
+		// EOR
+		0x00, 0x00, 0x00, 0x00,
+	}
+	packet := NewDumpPacket()
+	packet.SetSequence(1)
+	buf := &bytes.Buffer{}
+	require.NoError(t, binary.Write(buf, binary.BigEndian, packet))
+	b := buf.Bytes()
+	require.Equal(t, 20+maxDataLen+4, len(b))
+	require.Equal(t, expected, b[:len(expected)])
+	require.Equal(t, make([]byte, len(b)-len(expected)), b[len(expected):], "the rest is padding")
+}
+
+func TestGenericPacketLayout(t *testing.T) {
+	// same as the REQ_DUMP request, with data in place of pad and EOR
+	expected := []uint8{
+		0x06, 0x01, 0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	packet, err := NewGenericPacket(reqDump, make([]byte, 8))
+	require.NoError(t, err)
+	packet.SetSequence(1)
+	buf := &bytes.Buffer{}
+	require.NoError(t, binary.Write(buf, binary.BigEndian, packet))
+	b := buf.Bytes()
+	require.Equal(t, 20+maxDataLen, len(b))
+	require.Equal(t, expected, b[:len(expected)])
+
+	_, err = NewGenericPacket(reqDump, make([]byte, maxDataLen+1))
+	require.Error(t, err)
+}
+
+func TestDecodeSmoothing(t *testing.T) {
+	// smoothing reply with 123us offset left to smooth out over 100.25s
+	raw := []uint8{
+		0x06, 0x02, 0x00, 0x00, 0x00, 0x33, 0x00, 0x0d, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x07,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0xeb, 0x7f, 0x06, 0x70, 0xf6, 0xa3, 0xd7, 0x0a,
+		0xe8, 0xd1, 0xb7, 0x17, 0x08, 0xb0, 0x00, 0x00, 0x10, 0xc8,
+		0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	packet, err := decodePacket(raw)
+	require.Nil(t, err)
+	want := &ReplySmoothing{
+		ReplyHead: ReplyHead{
+			Version:  protoVersionNumber,
+			PKTType:  pktTypeCmdReply,
+			Command:  reqSmoothing,
+			Reply:    rpySmoothing,
+			Status:   sttSuccess,
+			Sequence: 7,
+		},
+		SmoothingState: SmoothingState{
+			Flags:         SmoothingFlagActive,
+			Offset:        -0.0001230000052601099,
+			FreqPPM:       0.009999999776482582,
+			WanderPPM:     9.999999747378752e-05,
+			LastUpdateAgo: 5.5,
+			RemainingTime: 100.25,
+		},
+	}
+	require.Equal(t, want, packet)
+	require.True(t, want.Active())
+	require.False(t, SmoothingState{Flags: SmoothingFlagLeapOnly}.Active())
+}
+
+func TestClientAccessesByIndexPacketLayout(t *testing.T) {
+	// as sent by `chronyc clients`
+	chronyc := []uint8{
+		0x06, 0x01, 0x00, 0x00, 0x00, 0x44, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// first index
+		0x00, 0x00, 0x00, 0x08,
+		// n clients
+		0x00, 0x00, 0x00, 0x08,
+		// min hits
+		0x00, 0x00, 0x00, 0x00,
+		// reset
+		0x00, 0x00, 0x00, 0x00,
+		// EOR
+		0x00, 0x00, 0x00, 0x00,
+	}
+	packet := NewClientAccessesByIndexPacket(8, maxClientAccesses)
+	packet.SetSequence(1)
+	buf := &bytes.Buffer{}
+	require.NoError(t, binary.Write(buf, binary.BigEndian, packet))
+	b := buf.Bytes()
+	require.Equal(t, chronyc, b[:len(chronyc)])
+	require.Equal(t, make([]byte, len(b)-len(chronyc)), b[len(chronyc):], "the rest is padding")
+}
+
+func TestDecodeClientAccesses(t *testing.T) {
+	raw := []uint8{
+		0x06, 0x02, 0x00, 0x00, 0x00, 0x44, 0x00, 0x15, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// n indices, next index, n clients
+		0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00, 0x01,
+		// ip
+		0xc0, 0xa8, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00,
+		// ntp hits, nke hits, cmd hits
+		0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+		// ntp drops, nke drops, cmd drops
+		0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// ntp, nke, cmd and ntp timeout intervals
+		0x06, 0x7f, 0xf9, 0x7f,
+		// last ntp, nke and cmd hit ago
+		0x00, 0x00, 0x00, 0x0a, 0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x0e, 0x10,
+	}
+	packet, err := decodePacket(raw)
+	require.NoError(t, err)
+	want := &ReplyClientAccesses{
+		ReplyHead: ReplyHead{
+			Version:  protoVersionNumber,
+			PKTType:  pktTypeCmdReply,
+			Command:  reqClientAccessesByIndex,
+			Reply:    rpyClientAccessesByIndex,
+			Status:   sttSuccess,
+			Sequence: 0,
+		},
+		NIndices:  64,
+		NextIndex: 5,
+		ClientAccesses: []ClientAccess{
+			{
+				IPAddr:             net.IP{192, 168, 0, 1},
+				NTPHits:            256,
+				CMDHits:            2,
+				NTPDrops:           3,
+				NTPInterval:        6,
+				NKEInterval:        127,
+				CMDInterval:        -7,
+				NTPTimeoutInterval: 127,
+				LastNTPHitAgo:      10,
+				LastNKEHitAgo:      math.MaxUint32,
+				LastCMDHitAgo:      3600,
+			},
+		},
+	}
+	require.Equal(t, want, packet)
+}
+
+func TestDecodeClientAccessesTooMany(t *testing.T) {
+	buf := &bytes.Buffer{}
+	head := ReplyHead{
+		Version: protoVersionNumber,
+		PKTType: pktTypeCmdReply,
+		Command: reqClientAccessesByIndex,
+		Reply:   rpyClientAccessesByIndex,
+		Status:  sttSuccess,
+	}
+	require.NoError(t, binary.Write(buf, binary.BigEndian, head))
+	require.NoError(t, binary.Write(buf, binary.BigEndian, replyClientAccessesHead{NIndices: 64, NClients: maxClientAccesses + 1}))
+	_, err := decodePacket(buf.Bytes())
+	require.Error(t, err)
+}
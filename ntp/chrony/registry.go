@@ -0,0 +1,50 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chrony
+
+import (
+	"sync"
+)
+
+// ReplyDecoder decodes a whole reply packet, ReplyHead included, into something usable
+type ReplyDecoder func(response []byte) (ResponsePacket, error)
+
+var (
+	replyDecodersMu sync.RWMutex
+	replyDecoders   = map[ReplyType]ReplyDecoder{}
+)
+
+// RegisterReply registers a decoder for a reply type this package doesn't support yet,
+// so replies of newer chronyd can be handled without forking. Replies with status other than success
+// never reach the decoder, and reply types this package supports are always decoded by the package.
+// Registering nil decoder removes the registered one
+func RegisterReply(reply ReplyType, fn ReplyDecoder) {
+	replyDecodersMu.Lock()
+	defer replyDecodersMu.Unlock()
+	if fn == nil {
+		delete(replyDecoders, reply)
+		return
+	}
+	replyDecoders[reply] = fn
+}
+
+// registeredReply returns a decoder registered for the reply type, nil if there is none
+func registeredReply(reply ReplyType) ReplyDecoder {
+	replyDecodersMu.RLock()
+	defer replyDecodersMu.RUnlock()
+	return replyDecoders[reply]
+}
@@ -0,0 +1,89 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chrony
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const rpyDummy ReplyType = 99
+
+type replyDummy struct {
+	ReplyHead
+	Value uint32
+}
+
+func dummyReply(t *testing.T, reply ReplyType, value uint32) []byte {
+	buf := &bytes.Buffer{}
+	head := ReplyHead{
+		Version:  protoVersionNumber,
+		PKTType:  pktTypeCmdReply,
+		Command:  99,
+		Reply:    reply,
+		Status:   sttSuccess,
+		Sequence: 1,
+	}
+	require.NoError(t, binary.Write(buf, binary.BigEndian, head))
+	require.NoError(t, binary.Write(buf, binary.BigEndian, value))
+	return buf.Bytes()
+}
+
+func decodeDummy(response []byte) (ResponsePacket, error) {
+	reply := new(replyDummy)
+	if err := binary.Read(bytes.NewReader(response), binary.BigEndian, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func TestRegisterReply(t *testing.T) {
+	raw := dummyReply(t, rpyDummy, 42)
+	_, err := decodePacket(raw)
+	require.Error(t, err)
+
+	RegisterReply(rpyDummy, decodeDummy)
+	t.Cleanup(func() { RegisterReply(rpyDummy, nil) })
+
+	packet, err := decodePacket(raw)
+	require.NoError(t, err)
+	reply, ok := packet.(*replyDummy)
+	require.True(t, ok)
+	require.Equal(t, rpyDummy, reply.Reply)
+	require.Equal(t, uint32(42), reply.Value)
+
+	// truncated packet
+	_, err = decodePacket(raw[:len(raw)-1])
+	require.Error(t, err)
+
+	RegisterReply(rpyDummy, nil)
+	_, err = decodePacket(raw)
+	require.Error(t, err)
+}
+
+func TestRegisterReplyBuiltin(t *testing.T) {
+	RegisterReply(rpyNull, decodeDummy)
+	t.Cleanup(func() { RegisterReply(rpyNull, nil) })
+
+	packet, err := decodePacket(dummyReply(t, rpyNull, 42))
+	require.NoError(t, err)
+	_, ok := packet.(*ReplyNull)
+	require.True(t, ok)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chrony
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode"
+)
+
+/*
+Captured replies can be decoded in bulk from a stream of frames.
+Each frame is a reply packet prefixed with its length:
+
+	+--------+--------+--------------------//--+
+	| length (uint16, big-endian) | packet     |
+	+--------+--------+--------------------//--+
+
+Such stream is easy to build from tshark or strace output,
+see WriteStreamFrame and packet_test.go for ways to capture packets.
+*/
+
+// WriteStreamFrame writes the packet to w as a single length-prefixed frame
+func WriteStreamFrame(w io.Writer, packet []byte) error {
+	if len(packet) > math.MaxUint16 {
+		return fmt.Errorf("packet of %d bytes is too big for a frame", len(packet))
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(len(packet))); err != nil {
+		return err
+	}
+	_, err := w.Write(packet)
+	return err
+}
+
+// DecodeStream reads length-prefixed frames from r until EOF and decodes each of them
+func DecodeStream(r io.Reader) ([]ResponsePacket, error) {
+	var packets []ResponsePacket
+	for i := 0; ; i++ {
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			if errors.Is(err, io.EOF) {
+				return packets, nil
+			}
+			return packets, fmt.Errorf("reading length of frame %d: %w", i, err)
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return packets, fmt.Errorf("reading frame %d: %w", i, err)
+		}
+		packet, err := decodePacket(buf)
+		if err != nil {
+			return packets, fmt.Errorf("decoding frame %d: %w", i, err)
+		}
+		packets = append(packets, packet)
+	}
+}
+
+// DecodeHex decodes a reply packet from a hex string, e.g. a payload printed by tshark.
+// Whitespace, colons, commas and 0x prefixes are ignored, so "0602 0000" and "0x06, 0x02, 0x00, 0x00" are the same
+func DecodeHex(s string) (ResponsePacket, error) {
+	var digits strings.Builder
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ':' || r == ','
+	})
+	for _, f := range fields {
+		f = strings.TrimPrefix(f, "0x")
+		f = strings.TrimPrefix(f, "0X")
+		digits.WriteString(f)
+	}
+	if digits.Len() == 0 {
+		return nil, errors.New("no hex digits")
+	}
+	if digits.Len()%2 != 0 {
+		return nil, fmt.Errorf("odd number of hex digits: %d", digits.Len())
+	}
+	raw, err := hex.DecodeString(digits.String())
+	if err != nil {
+		return nil, fmt.Errorf("decoding hex: %w", err)
+	}
+	return decodePacket(raw)
+}
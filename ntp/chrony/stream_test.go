@@ -0,0 +1,152 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chrony
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// replies captured with tshark, same as in packet_test.go
+var (
+	sourcesRaw = []uint8{
+		0x06, 0x02, 0x00, 0x00, 0x00, 0x0e, 0x00, 0x02, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x39, 0x3a, 0xb1, 0x23,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x12,
+	}
+	activityRaw = []uint8{
+		0x06, 0x02, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x0c, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xa7, 0xa8, 0x73, 0x83,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	unauthorizedRaw = []uint8{
+		0x06, 0x02, 0x00, 0x00, 0x00, 0x39, 0x00, 0x01, 0x00, 0x02,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xa3, 0xa8, 0xc8, 0x40,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+)
+
+func streamOf(t *testing.T, packets ...[]byte) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	for _, p := range packets {
+		require.NoError(t, WriteStreamFrame(buf, p))
+	}
+	return buf
+}
+
+func TestWriteStreamFrame(t *testing.T) {
+	buf := streamOf(t, sourcesRaw)
+	require.Equal(t, append([]byte{0x00, 0x20}, sourcesRaw...), buf.Bytes())
+
+	require.Error(t, WriteStreamFrame(buf, make([]byte, 1<<16)))
+}
+
+func TestDecodeStream(t *testing.T) {
+	packets, err := DecodeStream(streamOf(t, sourcesRaw, activityRaw, sourcesRaw))
+	require.NoError(t, err)
+	require.Len(t, packets, 3)
+
+	sources, ok := packets[0].(*ReplySources)
+	require.True(t, ok)
+	require.Equal(t, 18, sources.NSources)
+	activity, ok := packets[1].(*ReplyActivity)
+	require.True(t, ok)
+	require.Equal(t, int32(4), activity.Online)
+	require.Equal(t, packets[0], packets[2])
+}
+
+func TestDecodeStreamEmpty(t *testing.T) {
+	packets, err := DecodeStream(&bytes.Buffer{})
+	require.NoError(t, err)
+	require.Empty(t, packets)
+}
+
+func TestDecodeStreamTruncated(t *testing.T) {
+	buf := streamOf(t, sourcesRaw, activityRaw)
+	buf.Truncate(buf.Len() - 1)
+	packets, err := DecodeStream(buf)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Contains(t, err.Error(), "frame 1")
+	require.Len(t, packets, 1, "packets decoded before the error are returned")
+
+	// length prefix cut in half
+	_, err = DecodeStream(bytes.NewBuffer([]byte{0x00}))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestDecodeStreamBadPacket(t *testing.T) {
+	packets, err := DecodeStream(streamOf(t, sourcesRaw, unauthorizedRaw, activityRaw))
+	require.ErrorIs(t, err, ErrNotAuthorized)
+	require.Contains(t, err.Error(), "decoding frame 1")
+	require.Len(t, packets, 1)
+}
+
+func TestDecodeHex(t *testing.T) {
+	// tshark -T fields -e data
+	packet, err := DecodeHex(hex.EncodeToString(activityRaw) + "\n")
+	require.NoError(t, err)
+	activity, ok := packet.(*ReplyActivity)
+	require.True(t, ok)
+	require.Equal(t, int32(4), activity.Online)
+
+	// colon separated bytes
+	colons := make([]string, len(sourcesRaw))
+	for i, b := range sourcesRaw {
+		colons[i] = fmt.Sprintf("%02x", b)
+	}
+	packet, err = DecodeHex(strings.Join(colons, ":"))
+	require.NoError(t, err)
+	sources, ok := packet.(*ReplySources)
+	require.True(t, ok)
+	require.Equal(t, 18, sources.NSources)
+
+	// Go fixture with 0x prefixes, commas and line breaks
+	packet, err = DecodeHex(`
+		0x06, 0x02, 0x00, 0x00, 0x00, 0x0E, 0x00, 0x02, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x39, 0x3A, 0xB1, 0x23,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x12,
+	`)
+	require.NoError(t, err)
+	require.Equal(t, sources, packet)
+}
+
+func TestDecodeHexErrors(t *testing.T) {
+	_, err := DecodeHex(" \n0x ")
+	require.EqualError(t, err, "no hex digits")
+
+	_, err = DecodeHex("06020")
+	require.EqualError(t, err, "odd number of hex digits: 5")
+
+	_, err = DecodeHex("0602zz")
+	var invalid hex.InvalidByteError
+	require.True(t, errors.As(err, &invalid))
+	require.Equal(t, hex.InvalidByteError('z'), invalid)
+
+	_, err = DecodeHex(hex.EncodeToString(unauthorizedRaw))
+	require.ErrorIs(t, err, ErrNotAuthorized)
+}
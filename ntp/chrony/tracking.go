@@ -0,0 +1,124 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chrony
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// refIDLocal is the reference ID chronyd uses when synchronised to the local clock (LOCL)
+const refIDLocal = 0x7f7f0101
+
+// TrackingDiff is a change of chrony tracking between two polls
+type TrackingDiff struct {
+	// Elapsed is time between reference times of the polls
+	Elapsed time.Duration
+	// Offset is a change of EstimatedSystemOffset, positive when system clock moved ahead of NTP time
+	Offset time.Duration
+	// FreqPPM is a change of the frequency error, positive when the clock got faster
+	FreqPPM float64
+	// SkewPPM is a change of the estimated error bound on the frequency
+	SkewPPM float64
+}
+
+// Tracking returns chronyd tracking information, same as `chronyc tracking`
+func (n *Client) Tracking() (*Tracking, error) {
+	response, err := n.Communicate(NewTrackingPacket())
+	if err != nil {
+		return nil, err
+	}
+	tracking, ok := response.(*ReplyTracking)
+	if !ok {
+		return nil, fmt.Errorf("got wrong 'tracking' response %+v", response)
+	}
+	return &tracking.Tracking, nil
+}
+
+// synced checks if tracking is synchronised within thresholds, same as `chronyc waitsync`.
+// Zero threshold disables the check
+func (t Tracking) synced(maxCorrection, maxSkew float64) bool {
+	if t.RefID == 0 || t.RefID == refIDLocal || t.LeapStatus == LeapStatusUnsynchronised {
+		return false
+	}
+	if maxCorrection != 0 && math.Abs(t.CurrentCorrection) > maxCorrection {
+		return false
+	}
+	return maxSkew == 0 || t.SkewPPM <= maxSkew
+}
+
+// readDeadliner is a connection which reads can time out, like net.Conn
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// WaitSync polls tracking every interval until chronyd is synchronised to a source other than the local clock,
+// with the absolute correction (in seconds) and the skew (in PPM) within maxCorrection and maxSkew,
+// same as `chronyc waitsync`. Zero threshold disables the check.
+// Failed polls are retried, e.g. when chronyd is still starting. Context error is returned once ctx is done.
+// If the connection supports read deadlines, reads don't block past the ctx deadline
+func (n *Client) WaitSync(ctx context.Context, maxCorrection, maxSkew float64, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("waitsync interval must be positive, got %v", interval)
+	}
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		defer func() {
+			// connection may have been replaced by a reconnect
+			if conn, ok := n.Connection.(readDeadliner); ok {
+				_ = conn.SetReadDeadline(time.Time{})
+			}
+		}()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for try := 1; ; try++ {
+		if conn, ok := n.Connection.(readDeadliner); ok && hasDeadline {
+			if err := conn.SetReadDeadline(deadline); err != nil {
+				return fmt.Errorf("setting read deadline: %w", err)
+			}
+		}
+		tracking, err := n.Tracking()
+		if err != nil {
+			log.Debugf("waitsync try %d: %v", try, err)
+		} else {
+			log.Debugf("waitsync try %d: refid %08X, leap %s, correction %.9f, skew %.3f", try, tracking.RefID, tracking.LeapStatus, tracking.CurrentCorrection, tracking.SkewPPM)
+			if tracking.synced(maxCorrection, maxSkew) {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for sync: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// TrackingDelta returns the change of tracking from prev to cur
+func TrackingDelta(prev, cur Tracking) TrackingDiff {
+	return TrackingDiff{
+		Elapsed: cur.RefTime.Sub(prev.RefTime),
+		Offset:  cur.EstimatedSystemOffset() - prev.EstimatedSystemOffset(),
+		FreqPPM: cur.FreqPPM - prev.FreqPPM,
+		SkewPPM: cur.SkewPPM - prev.SkewPPM,
+	}
+}
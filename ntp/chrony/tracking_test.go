@@ -0,0 +1,170 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chrony
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackingDelta(t *testing.T) {
+	// same as in TestDecodeTracking
+	prev := Tracking{
+		RefTime:           time.Unix(0, 1631117697915705301),
+		CurrentCorrection: -3.4395072816550964e-06,
+		LastOffset:        -2.823539716700907e-06,
+		FreqPPM:           -1.5478190183639526,
+		SkewPPM:           0.005385049618780613,
+	}
+	// next update 520s later
+	cur := Tracking{
+		RefTime:           time.Unix(0, 1631118218406489101),
+		CurrentCorrection: 1.2094476066651987e-06,
+		LastOffset:        1.4060740779677872e-06,
+		FreqPPM:           -1.5449087619781494,
+		SkewPPM:           0.004846549499779940,
+	}
+
+	diff := TrackingDelta(prev, cur)
+	require.Equal(t, 520490783800*time.Nanosecond, diff.Elapsed)
+	// 3.439us fast, then 1.209us slow
+	require.Equal(t, -4648*time.Nanosecond, diff.Offset)
+	require.InDelta(t, 0.0029102564, diff.FreqPPM, 1e-9)
+	require.InDelta(t, -0.0005385001, diff.SkewPPM, 1e-9)
+
+	// going back flips the signs
+	back := TrackingDelta(cur, prev)
+	require.Equal(t, -diff.Elapsed, back.Elapsed)
+	require.Equal(t, -diff.Offset, back.Offset)
+	require.InDelta(t, -diff.FreqPPM, back.FreqPPM, 1e-12)
+	require.InDelta(t, -diff.SkewPPM, back.SkewPPM, 1e-12)
+}
+
+func trackingReply(t *testing.T, refID uint32, leap LeapStatusType, correction, skew float64) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	head := ReplyHead{
+		Version:  protoVersionNumber,
+		PKTType:  pktTypeCmdReply,
+		Command:  reqTracking,
+		Reply:    rpyTracking,
+		Status:   sttSuccess,
+		Sequence: 2,
+	}
+	require.NoError(t, binary.Write(buf, binary.BigEndian, head))
+	require.NoError(t, binary.Write(buf, binary.BigEndian, replyTrackingContent{
+		RefID:             refID,
+		LeapStatus:        leap,
+		CurrentCorrection: newChronyFloat(correction),
+		SkewPPM:           newChronyFloat(skew),
+	}))
+	return buf
+}
+
+func TestTracking(t *testing.T) {
+	client := Client{Sequence: 1, Connection: newConn([]*bytes.Buffer{trackingReply(t, 0xC0A80001, LeapStatusNormal, 0.001, 0.5)})}
+	tracking, err := client.Tracking()
+	require.NoError(t, err)
+	require.Equal(t, uint32(0xC0A80001), tracking.RefID)
+	require.Equal(t, LeapStatusNormal, tracking.LeapStatus)
+	require.InDelta(t, 0.001, tracking.CurrentCorrection, 1e-6)
+	require.InDelta(t, 0.5, tracking.SkewPPM, 1e-6)
+}
+
+func TestWaitSync(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		// chronyd has just started
+		trackingReply(t, 0, LeapStatusUnsynchronised, 0, 0),
+		// synchronised to the local clock only
+		trackingReply(t, refIDLocal, LeapStatusNormal, 0, 0),
+		trackingReply(t, 0xC0A80001, LeapStatusNormal, 0.5, 100),
+		trackingReply(t, 0xC0A80001, LeapStatusNormal, 0.0001, 100),
+		trackingReply(t, 0xC0A80001, LeapStatusNormal, 0.0001, 0.5),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	err := client.WaitSync(context.Background(), 0.001, 1, time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, 5, conn.readCount)
+}
+
+func TestWaitSyncNoThresholds(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		trackingReply(t, 0, LeapStatusUnsynchronised, 0, 0),
+		trackingReply(t, 0xC0A80001, LeapStatusInsertSecond, 0.5, 100),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	require.NoError(t, client.WaitSync(context.Background(), 0, 0, time.Millisecond))
+	require.Equal(t, 2, conn.readCount)
+}
+
+func TestWaitSyncTimeout(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{
+		trackingReply(t, 0xC0A80001, LeapStatusNormal, 0.5, 0.5),
+	})
+	client := Client{Sequence: 1, Connection: conn}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	// correction is never small enough, and then chronyd stops replying
+	err := client.WaitSync(ctx, 0.001, 0, time.Millisecond)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestWaitSyncInvalidInterval(t *testing.T) {
+	client := Client{Sequence: 1, Connection: newConn(nil)}
+	require.Error(t, client.WaitSync(context.Background(), 0, 0, 0))
+	require.Error(t, client.WaitSync(context.Background(), 0, 0, -time.Second))
+}
+
+// deadlineConn records read deadlines set on the connection
+type deadlineConn struct {
+	*fakeConn
+	deadlines []time.Time
+}
+
+func (c *deadlineConn) SetReadDeadline(t time.Time) error {
+	c.deadlines = append(c.deadlines, t)
+	return nil
+}
+
+func TestWaitSyncReadDeadline(t *testing.T) {
+	conn := &deadlineConn{fakeConn: newConn([]*bytes.Buffer{
+		trackingReply(t, 0, LeapStatusUnsynchronised, 0, 0),
+		trackingReply(t, 0xC0A80001, LeapStatusNormal, 0, 0),
+	})}
+	client := Client{Sequence: 1, Connection: conn}
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	require.NoError(t, client.WaitSync(ctx, 0, 0, time.Millisecond))
+	// deadline is set before every poll and cleared once done
+	require.Len(t, conn.deadlines, 3)
+	require.Equal(t, deadline, conn.deadlines[0])
+	require.Equal(t, deadline, conn.deadlines[1])
+	require.True(t, conn.deadlines[2].IsZero())
+
+	// no deadline without ctx deadline
+	conn = &deadlineConn{fakeConn: newConn([]*bytes.Buffer{
+		trackingReply(t, 0xC0A80001, LeapStatusNormal, 0, 0),
+	})}
+	client = Client{Sequence: 1, Connection: conn}
+	require.NoError(t, client.WaitSync(context.Background(), 0, 0, time.Millisecond))
+	require.Empty(t, conn.deadlines)
+}
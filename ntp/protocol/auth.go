@@ -0,0 +1,158 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+)
+
+// MACAlgo is a digest algorithm of NTP symmetric key authentication
+type MACAlgo int
+
+// Supported MAC algorithms
+const (
+	MACMD5 MACAlgo = iota
+	MACSHA1
+)
+
+// maxASCIIKeyLen is the longest key ntpd reads from the keyfile as is. Longer keys are hex
+const maxASCIIKeyLen = 20
+
+// keyIDSizeBytes is the size of the key id in the MAC trailer
+const keyIDSizeBytes = 4
+
+func (a MACAlgo) String() string {
+	switch a {
+	case MACMD5:
+		return "MD5"
+	case MACSHA1:
+		return "SHA1"
+	}
+	return fmt.Sprintf("MACAlgo(%d)", int(a))
+}
+
+func (a MACAlgo) hash() (hash.Hash, error) {
+	switch a {
+	case MACMD5:
+		return md5.New(), nil
+	case MACSHA1:
+		return sha1.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported MAC algorithm %v", a)
+}
+
+// macAlgoFromSize picks the algorithm by the digest size, the same way ntpd does on receive
+func macAlgoFromSize(size int) (MACAlgo, error) {
+	switch size {
+	case md5.Size:
+		return MACMD5, nil
+	case sha1.Size:
+		return MACSHA1, nil
+	}
+	return 0, fmt.Errorf("unsupported MAC digest size %d", size)
+}
+
+// ParseKey decodes a key as written in ntpd keyfile:
+// keys up to 20 characters are used as ASCII, 40 characters long keys are hex encoded.
+func ParseKey(key string) ([]byte, error) {
+	if len(key) <= maxASCIIKeyLen {
+		return []byte(key), nil
+	}
+	if len(key) != 2*maxASCIIKeyLen {
+		return nil, fmt.Errorf("key must be up to %d ASCII or %d hex characters", maxASCIIKeyLen, 2*maxASCIIKeyLen)
+	}
+	return hex.DecodeString(key)
+}
+
+// computeMAC calculates the digest of key followed by the NTP packet, as defined by RFC 5905
+func computeMAC(algo MACAlgo, key, packet []byte) ([]byte, error) {
+	h, err := algo.hash()
+	if err != nil {
+		return nil, err
+	}
+	h.Write(key)
+	h.Write(packet)
+	return h.Sum(nil), nil
+}
+
+// AuthenticatedPacket is an NTP packet followed by the key id and MAC trailer
+type AuthenticatedPacket struct {
+	Packet
+	KeyID  uint32
+	Digest []byte
+}
+
+// AppendMAC converts Packet to []bytes with the key id and MAC trailer appended
+func (p *Packet) AppendMAC(keyID uint32, key []byte, algo MACAlgo) ([]byte, error) {
+	b, err := p.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	digest, err := computeMAC(algo, key, b)
+	if err != nil {
+		return nil, err
+	}
+	trailer := make([]byte, keyIDSizeBytes, keyIDSizeBytes+len(digest))
+	binary.BigEndian.PutUint32(trailer, keyID)
+	return append(append(b, trailer...), digest...), nil
+}
+
+// UnmarshalBinary fills the AuthenticatedPacket from []bytes
+func (p *AuthenticatedPacket) UnmarshalBinary(b []byte) error {
+	if len(b) < PacketSizeBytes+keyIDSizeBytes {
+		return fmt.Errorf("packet of %d bytes has no MAC", len(b))
+	}
+	if _, err := macAlgoFromSize(len(b) - PacketSizeBytes - keyIDSizeBytes); err != nil {
+		return err
+	}
+	if err := p.Packet.UnmarshalBinary(b[:PacketSizeBytes]); err != nil {
+		return err
+	}
+	p.KeyID = binary.BigEndian.Uint32(b[PacketSizeBytes:])
+	p.Digest = append(p.Digest[:0], b[PacketSizeBytes+keyIDSizeBytes:]...)
+	return nil
+}
+
+// BytesToAuthenticatedPacket converts []bytes to AuthenticatedPacket
+func BytesToAuthenticatedPacket(b []byte) (*AuthenticatedPacket, error) {
+	packet := &AuthenticatedPacket{}
+	return packet, packet.UnmarshalBinary(b)
+}
+
+// VerifyMAC checks the packet digest against the key.
+// The algorithm is derived from the digest size.
+func (p *AuthenticatedPacket) VerifyMAC(key []byte) bool {
+	algo, err := macAlgoFromSize(len(p.Digest))
+	if err != nil {
+		return false
+	}
+	b, err := p.Packet.Bytes()
+	if err != nil {
+		return false
+	}
+	digest, err := computeMAC(algo, key, b)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(digest, p.Digest)
+}
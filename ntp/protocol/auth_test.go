@@ -0,0 +1,111 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var authRequest = &Packet{
+	Settings:   0x23,
+	Poll:       6,
+	Precision:  -20,
+	TxTimeSec:  3794210679,
+	TxTimeFrac: 2718216404,
+}
+
+// authRequestBytes is authRequest on the wire
+const authRequestBytes = "230006ec000000000000000000000000000000000000000000000000000000000000000000000000e2270f77a204b0d4"
+
+func TestParseKey(t *testing.T) {
+	key, err := ParseKey("ntpsecret")
+	require.NoError(t, err)
+	require.Equal(t, []byte("ntpsecret"), key)
+
+	key, err = ParseKey("0123456789abcdef0123456789abcdef01234567")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67}, key)
+
+	_, err = ParseKey("0123456789abcdef0123456789abcdef0123456")
+	require.Error(t, err)
+
+	_, err = ParseKey("0123456789abcdef0123456789abcdef0123456z")
+	require.Error(t, err)
+}
+
+func TestAppendMAC(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		algo    MACAlgo
+		keyID   uint32
+		trailer string
+	}{
+		{
+			name:    "MD5 ASCII key",
+			key:     "ntpsecret",
+			algo:    MACMD5,
+			keyID:   1,
+			trailer: "00000001" + "d69f5cad0e31380db24e0e1fb2ac3303",
+		},
+		{
+			name:    "SHA1 hex key",
+			key:     "0123456789abcdef0123456789abcdef01234567",
+			algo:    MACSHA1,
+			keyID:   42,
+			trailer: "0000002a" + "26ff67f02fb88e581077a2943cddd4f3bd5273b0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseKey(tt.key)
+			require.NoError(t, err)
+			b, err := authRequest.AppendMAC(tt.keyID, key, tt.algo)
+			require.NoError(t, err)
+			require.Equal(t, authRequestBytes+tt.trailer, hex.EncodeToString(b))
+
+			p, err := BytesToAuthenticatedPacket(b)
+			require.NoError(t, err)
+			require.Equal(t, *authRequest, p.Packet)
+			require.Equal(t, tt.keyID, p.KeyID)
+			require.True(t, p.VerifyMAC(key))
+			require.False(t, p.VerifyMAC([]byte("wrong")))
+
+			// tampered packet must not verify
+			p.TxTimeFrac++
+			require.False(t, p.VerifyMAC(key))
+		})
+	}
+}
+
+func TestAppendMACUnsupportedAlgo(t *testing.T) {
+	_, err := authRequest.AppendMAC(1, []byte("ntpsecret"), MACAlgo(42))
+	require.Error(t, err)
+}
+
+func TestBytesToAuthenticatedPacketError(t *testing.T) {
+	b, err := authRequest.Bytes()
+	require.NoError(t, err)
+	_, err = BytesToAuthenticatedPacket(b)
+	require.Error(t, err, "no MAC")
+
+	_, err = BytesToAuthenticatedPacket(append(b, make([]byte, keyIDSizeBytes+10)...))
+	require.Error(t, err, "unknown digest size")
+}
@@ -0,0 +1,53 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Kiss codes of Kiss-o'-Death packets asking client to back off, RFC 5905 section 7.4
+const (
+	// KissRate means client exceeds the rate limit and must reduce its poll interval
+	KissRate = "RATE"
+	// KissDeny means access is denied and client must stop sending to the server
+	KissDeny = "DENY"
+	// KissRestrict means access is restricted and client must stop sending to the server
+	KissRestrict = "RSTR"
+)
+
+// KissError is returned when server replies with a Kiss-o'-Death packet
+type KissError struct {
+	Code string
+}
+
+func (e *KissError) Error() string {
+	return fmt.Sprintf("kiss-o'-death from server: %s", e.Code)
+}
+
+// KissCode returns the kiss code carried in Reference ID of stratum 0 packet.
+// ok is false if the packet is not a Kiss-o'-Death one
+func (p *Packet) KissCode() (code string, ok bool) {
+	if p.Stratum != 0 {
+		return "", false
+	}
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, p.ReferenceID)
+	return strings.TrimRight(string(b), "\x00"), true
+}
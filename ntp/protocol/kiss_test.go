@@ -0,0 +1,50 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKissCode(t *testing.T) {
+	// 'R' 'A' 'T' 'E'
+	rate := &Packet{Settings: 0x24, Stratum: 0, ReferenceID: 0x52415445}
+	code, ok := rate.KissCode()
+	require.True(t, ok)
+	require.Equal(t, KissRate, code)
+
+	// 'D' 'E' 'N' 'Y'
+	deny := &Packet{Settings: 0x24, Stratum: 0, ReferenceID: 0x44454e59}
+	code, ok = deny.KissCode()
+	require.True(t, ok)
+	require.Equal(t, KissDeny, code)
+
+	synced := &Packet{Settings: 0x24, Stratum: 1, ReferenceID: 0x44454e59}
+	_, ok = synced.KissCode()
+	require.False(t, ok)
+}
+
+func TestKissError(t *testing.T) {
+	var err error = &KissError{Code: KissRate}
+	require.Equal(t, "kiss-o'-death from server: RATE", err.Error())
+	var kissErr *KissError
+	require.True(t, errors.As(err, &kissErr))
+	require.Equal(t, KissRate, kissErr.Code)
+}
@@ -44,6 +44,11 @@ func Unix(seconds, fractions uint32) time.Time {
 	return time.Unix(secs, nanos)
 }
 
+// ShortToDuration converts NTP short format (16.16 fixed point seconds) to time.Duration
+func ShortToDuration(v uint32) time.Duration {
+	return time.Duration(int64(v) * time.Second.Nanoseconds() >> 16)
+}
+
 // Offset uses NTP algorithm for clock offset
 func Offset(originTime, serverReceiveTime, serverTransmitTime, clientReceiveTime time.Time) int64 {
 	outboundClockDelta := serverReceiveTime.Sub(originTime).Nanoseconds()
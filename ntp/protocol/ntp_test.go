@@ -142,6 +142,24 @@ func TestInvalidSettingsFormat(t *testing.T) {
 	require.False(t, ntpBadRequest.ValidSettingsFormat())
 }
 
+func TestShortToDuration(t *testing.T) {
+	require.Equal(t, time.Second, ShortToDuration(1<<16))
+	require.Equal(t, 500*time.Millisecond, ShortToDuration(1<<15))
+	// 1/65536 of a second is 15258.789ns, truncated
+	require.Equal(t, 15258*time.Nanosecond, ShortToDuration(1))
+	require.Equal(t, 65535*time.Second+999984741*time.Nanosecond, ShortToDuration(0xffffffff))
+}
+
+func TestRootDistance(t *testing.T) {
+	require.Equal(t, 152587*time.Nanosecond, ntpResponse.RootDistance())
+	// 1s / 2 + 1s
+	require.Equal(t, 1500*time.Millisecond, ntpRequest.RootDistance())
+	// chronyd response: root delay 0x0000012a, root dispersion 0x0000003c
+	packet := &Packet{RootDelay: 0x12a, RootDispersion: 0x3c}
+	// 4547119ns / 2 + 915527ns
+	require.Equal(t, 3189086*time.Nanosecond, packet.RootDistance())
+}
+
 func TestTime(t *testing.T) {
 	testtime := time.Unix(usec, unsec)
 	sec, frac := Time(testtime)
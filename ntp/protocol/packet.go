@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"net"
+	"time"
 )
 
 // PacketSizeBytes sets the size of NTP packet
@@ -118,6 +119,11 @@ func (p *Packet) ValidSettingsFormat() bool {
 	return false
 }
 
+// RootDistance returns synchronization distance of the server to the reference clock: RootDelay/2 + RootDispersion
+func (p *Packet) RootDistance() time.Duration {
+	return ShortToDuration(p.RootDelay)/2 + ShortToDuration(p.RootDispersion)
+}
+
 // Bytes converts Packet to []bytes
 func (p *Packet) Bytes() ([]byte, error) {
 	var bytes bytes.Buffer
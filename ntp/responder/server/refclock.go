@@ -0,0 +1,82 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebook/time/phc"
+	log "github.com/sirupsen/logrus"
+)
+
+// refClockInterval is how often we measure reference clock offset to the system clock
+const refClockInterval = time.Second
+
+// refClock measures reference clock to system clock offset
+type refClock interface {
+	offset(device string) (phc.SysoffResult, error)
+}
+
+// phcRefClock reads PHC to system clock offset via PTP_SYS_OFFSET_EXTENDED
+type phcRefClock struct{}
+
+func (phcRefClock) offset(device string) (phc.SysoffResult, error) {
+	return phc.TimeAndOffsetFromDevice(device, phc.MethodIoctlSysOffsetExtended)
+}
+
+// clock returns reference clock used by the server, PHC unless overridden
+func (s *Server) clock() refClock {
+	if s.refClock == nil {
+		return phcRefClock{}
+	}
+	return s.refClock
+}
+
+// refOffset returns current offset of the reference clock to the system clock
+func (s *Server) refOffset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.refClockOffset))
+}
+
+// updateRefOffset measures PHC once and stores offset we need to add to system clock timestamps.
+// PHC runs in TAI, so UTC offset is subtracted to serve UTC to NTP clients.
+func (s *Server) updateRefOffset() error {
+	res, err := s.clock().offset(s.PHCDevice)
+	if err != nil {
+		return err
+	}
+	// res.Offset is system time - PHC time
+	atomic.StoreInt64(&s.refClockOffset, int64(-res.Offset-s.UTCOffset))
+	return nil
+}
+
+// trackRefClock periodically updates reference clock offset when PHC is used as a reference
+func (s *Server) trackRefClock(ctx context.Context) {
+	ticker := time.NewTicker(refClockInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.updateRefOffset(); err != nil {
+				log.Errorf("[server] failed to read %s: %v", s.PHCDevice, err)
+			}
+		}
+	}
+}
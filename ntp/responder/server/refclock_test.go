@@ -0,0 +1,61 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/phc"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRefClock struct {
+	res phc.SysoffResult
+	err error
+}
+
+func (f fakeRefClock) offset(_ string) (phc.SysoffResult, error) {
+	return f.res, f.err
+}
+
+func TestRefOffsetSystemClock(t *testing.T) {
+	s := &Server{}
+	require.Equal(t, time.Duration(0), s.refOffset())
+}
+
+func TestUpdateRefOffset(t *testing.T) {
+	// PHC is 37s (TAI) + 5ms ahead of the system clock
+	s := &Server{
+		PHCDevice: "/dev/ptp0",
+		UTCOffset: 37 * time.Second,
+		refClock:  fakeRefClock{res: phc.SysoffResult{Offset: -37*time.Second - 5*time.Millisecond}},
+	}
+	require.NoError(t, s.updateRefOffset())
+	require.Equal(t, 5*time.Millisecond, s.refOffset())
+}
+
+func TestUpdateRefOffsetError(t *testing.T) {
+	s := &Server{
+		PHCDevice:      "/dev/ptp0",
+		refClockOffset: int64(time.Millisecond),
+		refClock:       fakeRefClock{err: fmt.Errorf("no such device")},
+	}
+	require.Error(t, s.updateRefOffset())
+	require.Equal(t, time.Millisecond, s.refOffset())
+}
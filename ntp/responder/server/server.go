@@ -53,12 +53,25 @@ type Server struct {
 	ExtraOffset  time.Duration
 	RefID        string
 	Stratum      int
+	// PHCDevice is used as a reference clock if set, system clock otherwise
+	PHCDevice string
+	// UTCOffset is subtracted from PHC time
+	UTCOffset      time.Duration
+	refClockOffset int64
+	refClock       refClock
 }
 
 // Start UDP server.
 func (s *Server) Start(ctx context.Context, cancelFunc context.CancelFunc) {
 	log.Infof("Creating %d goroutine workers", s.Workers)
 	s.tasks = make(chan task, s.Workers)
+	if s.PHCDevice != "" {
+		log.Infof("Using %s as a reference clock", s.PHCDevice)
+		if err := s.updateRefOffset(); err != nil {
+			log.Fatalf("failed to read %s: %v", s.PHCDevice, err)
+		}
+		go s.trackRefClock(ctx)
+	}
 	// Pre-create workers
 	for i := 0; i < s.Workers; i++ {
 		go s.startWorker()
@@ -187,7 +200,7 @@ func (s *Server) startWorker() {
 	s.Stats.IncWorkers()
 	for {
 		task := <-s.tasks
-		task.serve(response, s.ExtraOffset)
+		task.serve(response, s.ExtraOffset+s.refOffset())
 	}
 }
 
@@ -221,3 +221,47 @@ func Benchmark_fillStaticHeaders(b *testing.B) {
 		s.fillStaticHeaders(response)
 	}
 }
+
+func TestServerRefClockOffset(t *testing.T) {
+	workers := 2
+	refOffset := 5 * time.Second
+	s := &Server{
+		Checker: &checker.SimpleChecker{
+			ExpectedListeners: 1,
+			ExpectedWorkers:   int64(workers),
+		},
+		Stats:          &stats.JSONStats{},
+		tasks:          make(chan task, workers),
+		refClockOffset: int64(refOffset),
+	}
+	for i := 0; i < workers; i++ {
+		go s.startWorker()
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer conn.Close()
+	go s.startListener(conn)
+
+	sendConn, err := net.DialTimeout("udp", conn.LocalAddr().String(), time.Second)
+	require.NoError(t, err)
+	defer sendConn.Close()
+	require.NoError(t, sendConn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	// simple SNTP exchange
+	clientTransmitTime := time.Now()
+	sec, frac := ntp.Time(clientTransmitTime)
+	request := &ntp.Packet{Settings: 0x1B, TxTimeSec: sec, TxTimeFrac: frac}
+	response := &ntp.Packet{}
+	require.NoError(t, binary.Write(sendConn, binary.BigEndian, request))
+	require.NoError(t, binary.Read(sendConn, binary.BigEndian, response))
+	clientReceiveTime := time.Now()
+
+	require.Equal(t, uint8(4), response.Settings&0x7, "response must be mode 4")
+	offset := time.Duration(ntp.Offset(
+		clientTransmitTime,
+		ntp.Unix(response.RxTimeSec, response.RxTimeFrac),
+		ntp.Unix(response.TxTimeSec, response.TxTimeFrac),
+		clientReceiveTime,
+	))
+	require.InDelta(t, refOffset, offset, float64(100*time.Millisecond))
+}
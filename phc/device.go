@@ -31,9 +31,19 @@ const (
 	ptpClkMagic   = '='
 )
 
+// Missing from sys/unix package, defined in Linux include/uapi/linux/net_tstamp.h
+const (
+	hwtstampTXOn             = 1
+	hwtstampFilterAll        = 1
+	hwtstampFilterPTPv2Event = 12
+)
+
 // ioctlPTPSysOffsetExtended is an IOCTL to get extended offset
 var ioctlPTPSysOffsetExtended = ioctl.IOWR(ptpClkMagic, 9, unsafe.Sizeof(PTPSysOffsetExtended{}))
 
+// ioctlPTPClockGetcaps is an IOCTL to get PTP clock capabilities
+var ioctlPTPClockGetcaps = ioctl.IOR(ptpClkMagic, 1, unsafe.Sizeof(PTPClockCaps{}))
+
 // Ifreq is the request we send with SIOCETHTOOL IOCTL
 // as per Linux kernel's include/uapi/linux/if.h
 type Ifreq struct {
@@ -67,6 +77,68 @@ type PTPSysOffsetExtended struct {
 	TS [ptpMaxSamples][3]PTPClockTime
 }
 
+// PTPClockCaps as defined in linux/ptp_clock.h
+type PTPClockCaps struct {
+	MaxAdj            int32 /* Maximum frequency adjustment in parts per billon. */
+	NAlarm            int32 /* Number of programmable alarms. */
+	NExtTs            int32 /* Number of external time stamp channels. */
+	NPerOut           int32 /* Number of programmable periodic signals. */
+	PPS               int32 /* Whether the clock supports a PPS callback. */
+	NPins             int32 /* Number of input/output pins. */
+	CrossTimestamping int32 /* Whether the clock supports precise system-device cross timestamps */
+	AdjustPhase       int32 /* Whether the clock supports adjust phase */
+	Rsv               [12]int32
+}
+
+// Caps is a parsed ptp_clock_caps of the PHC device
+type Caps struct {
+	// MaxAdjPPB is a maximum frequency adjustment in PPB
+	MaxAdjPPB float64
+	// NAlarms is a number of programmable alarms
+	NAlarms int
+	// NExtTimestamps is a number of external timestamp channels
+	NExtTimestamps int
+	// NPeriodicOutputs is a number of programmable periodic signals
+	NPeriodicOutputs int
+	// NPins is a number of input/output pins
+	NPins int
+	// PPS reports if the clock supports PPS callback
+	PPS bool
+	// CrossTimestamping reports if the clock supports precise system-device cross timestamps
+	CrossTimestamping bool
+	// AdjustPhase reports if the clock supports phase adjustment
+	AdjustPhase bool
+}
+
+// NewCaps parses ptp_clock_caps
+func NewCaps(caps *PTPClockCaps) *Caps {
+	return &Caps{
+		MaxAdjPPB:         float64(caps.MaxAdj),
+		NAlarms:           int(caps.NAlarm),
+		NExtTimestamps:    int(caps.NExtTs),
+		NPeriodicOutputs:  int(caps.NPerOut),
+		NPins:             int(caps.NPins),
+		PPS:               caps.PPS != 0,
+		CrossTimestamping: caps.CrossTimestamping != 0,
+		AdjustPhase:       caps.AdjustPhase != 0,
+	}
+}
+
+// SupportsSysOffsetPrecise reports if PTP_SYS_OFFSET_PRECISE can be used instead of PTP_SYS_OFFSET_EXTENDED
+func (c *Caps) SupportsSysOffsetPrecise() bool {
+	return c.CrossTimestamping
+}
+
+// SupportsPinProgramming reports if the clock has pins which can be assigned functions
+func (c *Caps) SupportsPinProgramming() bool {
+	return c.NPins > 0
+}
+
+// SupportsPeriodicOutput reports if the clock can generate periodic signals
+func (c *Caps) SupportsPeriodicOutput() bool {
+	return c.NPeriodicOutputs > 0
+}
+
 // IfaceInfo uses SIOCETHTOOL ioctl to get information for the give nic, i.e. eth0.
 func IfaceInfo(iface string) (*EthtoolTSinfo, error) {
 	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
@@ -95,6 +167,86 @@ func IfaceInfo(iface string) (*EthtoolTSinfo, error) {
 	return data, nil
 }
 
+// TimestampingCaps is a bitmask of SOF_TIMESTAMPING_* flags supported by the device
+type TimestampingCaps uint32
+
+// hwTimestamping are flags required for hardware timestamping
+const hwTimestamping = unix.SOF_TIMESTAMPING_TX_HARDWARE | unix.SOF_TIMESTAMPING_RX_HARDWARE | unix.SOF_TIMESTAMPING_RAW_HARDWARE
+
+// HardwareTimestamping reports if the device supports hardware TX and RX timestamps
+func (c TimestampingCaps) HardwareTimestamping() bool {
+	return c&hwTimestamping == hwTimestamping
+}
+
+// DeviceFromInterface returns path to PHC device associated with given network card iface,
+// as well as its timestamping capabilities
+func DeviceFromInterface(iface string) (string, TimestampingCaps, error) {
+	info, err := IfaceInfo(iface)
+	if err != nil {
+		return "", 0, fmt.Errorf("getting interface info: %w", err)
+	}
+	return deviceFromTSinfo(iface, info)
+}
+
+// deviceFromTSinfo returns path to PHC device and timestamping capabilities from the iface ethtool_ts_info
+func deviceFromTSinfo(iface string, info *EthtoolTSinfo) (string, TimestampingCaps, error) {
+	caps := TimestampingCaps(info.SOtimestamping)
+	if info.PHCIndex < 0 {
+		return "", caps, fmt.Errorf("%s doesn't support PHC", iface)
+	}
+	return fmt.Sprintf("/dev/ptp%d", info.PHCIndex), caps, nil
+}
+
+// TimestampingInfo is a parsed ethtool_ts_info of the network card
+type TimestampingInfo struct {
+	// Caps are SOF_TIMESTAMPING_* flags supported by the device
+	Caps TimestampingCaps
+	// PHCIndex is an index of the PHC device, negative if there is none
+	PHCIndex int
+	// TXTypes is a bitmask of supported HWTSTAMP_TX_* types
+	TXTypes uint32
+	// RXFilters is a bitmask of supported HWTSTAMP_FILTER_* filters
+	RXFilters uint32
+}
+
+// NewTimestampingInfo parses ethtool_ts_info
+func NewTimestampingInfo(info *EthtoolTSinfo) *TimestampingInfo {
+	return &TimestampingInfo{
+		Caps:      TimestampingCaps(info.SOtimestamping),
+		PHCIndex:  int(info.PHCIndex),
+		TXTypes:   info.TXTypes,
+		RXFilters: info.RXFilters,
+	}
+}
+
+// IfaceTimestampingInfo returns parsed timestamping info of the given network card iface
+func IfaceTimestampingInfo(iface string) (*TimestampingInfo, error) {
+	info, err := IfaceInfo(iface)
+	if err != nil {
+		return nil, fmt.Errorf("getting interface info: %w", err)
+	}
+	return NewTimestampingInfo(info), nil
+}
+
+// HardwareTX reports if the device can timestamp outgoing packets in hardware
+func (i *TimestampingInfo) HardwareTX() bool {
+	need := TimestampingCaps(unix.SOF_TIMESTAMPING_TX_HARDWARE | unix.SOF_TIMESTAMPING_RAW_HARDWARE)
+	return i.Caps&need == need && i.TXTypes&(1<<hwtstampTXOn) != 0
+}
+
+// HardwareRX reports if the device can timestamp incoming packets in hardware
+func (i *TimestampingInfo) HardwareRX() bool {
+	need := TimestampingCaps(unix.SOF_TIMESTAMPING_RX_HARDWARE | unix.SOF_TIMESTAMPING_RAW_HARDWARE)
+	// HWTSTAMP_FILTER_NONE is always there
+	return i.Caps&need == need && i.RXFilters&^1 != 0
+}
+
+// SupportsPTPv2 reports if the device can timestamp incoming PTPv2 event packets in hardware
+// with the filters the timestamp package enables
+func (i *TimestampingInfo) SupportsPTPv2() bool {
+	return i.HardwareRX() && i.RXFilters&(1<<hwtstampFilterAll|1<<hwtstampFilterPTPv2Event) != 0
+}
+
 // IfaceData has both net.Interface and EthtoolTSinfo
 type IfaceData struct {
 	Iface  net.Interface
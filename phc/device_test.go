@@ -0,0 +1,188 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestDeviceFromTSinfo(t *testing.T) {
+	device, caps, err := deviceFromTSinfo("eth0", &EthtoolTSinfo{
+		Cmd: unix.ETHTOOL_GET_TS_INFO,
+		SOtimestamping: unix.SOF_TIMESTAMPING_TX_HARDWARE |
+			unix.SOF_TIMESTAMPING_TX_SOFTWARE |
+			unix.SOF_TIMESTAMPING_RX_HARDWARE |
+			unix.SOF_TIMESTAMPING_RX_SOFTWARE |
+			unix.SOF_TIMESTAMPING_SOFTWARE |
+			unix.SOF_TIMESTAMPING_RAW_HARDWARE,
+		PHCIndex: 2,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "/dev/ptp2", device)
+	require.True(t, caps.HardwareTimestamping())
+}
+
+func TestDeviceFromTSinfoNoPHC(t *testing.T) {
+	// what virtual interfaces report
+	device, caps, err := deviceFromTSinfo("eth0", &EthtoolTSinfo{
+		Cmd: unix.ETHTOOL_GET_TS_INFO,
+		SOtimestamping: unix.SOF_TIMESTAMPING_TX_SOFTWARE |
+			unix.SOF_TIMESTAMPING_RX_SOFTWARE |
+			unix.SOF_TIMESTAMPING_SOFTWARE,
+		PHCIndex: -1,
+	})
+	require.Error(t, err)
+	require.Equal(t, "", device)
+	require.False(t, caps.HardwareTimestamping())
+	require.Equal(t, TimestampingCaps(unix.SOF_TIMESTAMPING_TX_SOFTWARE|unix.SOF_TIMESTAMPING_RX_SOFTWARE|unix.SOF_TIMESTAMPING_SOFTWARE), caps)
+}
+
+func TestDeviceFromInterfaceError(t *testing.T) {
+	_, _, err := DeviceFromInterface("nosuchiface0")
+	require.Error(t, err)
+
+	_, err = IfaceTimestampingInfo("nosuchiface0")
+	require.Error(t, err)
+}
+
+func TestTimestampingCaps(t *testing.T) {
+	require.False(t, TimestampingCaps(0).HardwareTimestamping())
+	// RX only
+	require.False(t, TimestampingCaps(unix.SOF_TIMESTAMPING_RX_HARDWARE|unix.SOF_TIMESTAMPING_RAW_HARDWARE).HardwareTimestamping())
+	require.True(t, TimestampingCaps(unix.SOF_TIMESTAMPING_TX_HARDWARE|unix.SOF_TIMESTAMPING_RX_HARDWARE|unix.SOF_TIMESTAMPING_RAW_HARDWARE).HardwareTimestamping())
+}
+
+func TestNewTimestampingInfo(t *testing.T) {
+	testCases := []struct {
+		name     string
+		in       EthtoolTSinfo
+		expected TimestampingInfo
+		tx       bool
+		rx       bool
+		ptpv2    bool
+	}{
+		{
+			// mlx5 timestamping everything
+			name: "hardware",
+			in: EthtoolTSinfo{
+				SOtimestamping: 0x5f,
+				PHCIndex:       0,
+				TXTypes:        0x3,
+				RXFilters:      0x3,
+			},
+			expected: TimestampingInfo{Caps: 0x5f, PHCIndex: 0, TXTypes: 0x3, RXFilters: 0x3},
+			tx:       true,
+			rx:       true,
+			ptpv2:    true,
+		},
+		{
+			// only PTPv2 over UDP events are timestamped
+			name: "hardware ptpv2 l4",
+			in: EthtoolTSinfo{
+				SOtimestamping: 0x45,
+				PHCIndex:       1,
+				TXTypes:        0x3,
+				RXFilters:      0x1 | 1<<6,
+			},
+			expected: TimestampingInfo{Caps: 0x45, PHCIndex: 1, TXTypes: 0x3, RXFilters: 0x41},
+			tx:       true,
+			rx:       true,
+			ptpv2:    false,
+		},
+		{
+			name: "hardware ptpv2 rx only",
+			in: EthtoolTSinfo{
+				SOtimestamping: 0x44,
+				PHCIndex:       1,
+				TXTypes:        0x1,
+				RXFilters:      0x1 | 1<<12,
+			},
+			expected: TimestampingInfo{Caps: 0x44, PHCIndex: 1, TXTypes: 0x1, RXFilters: 0x1001},
+			tx:       false,
+			rx:       true,
+			ptpv2:    true,
+		},
+		{
+			// virtio
+			name: "software",
+			in: EthtoolTSinfo{
+				SOtimestamping: 0x1a,
+				PHCIndex:       -1,
+			},
+			expected: TimestampingInfo{Caps: 0x1a, PHCIndex: -1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info := NewTimestampingInfo(&tc.in)
+			require.Equal(t, tc.expected, *info)
+			require.Equal(t, tc.tx, info.HardwareTX())
+			require.Equal(t, tc.rx, info.HardwareRX())
+			require.Equal(t, tc.ptpv2, info.SupportsPTPv2())
+		})
+	}
+}
+
+func TestNewCaps(t *testing.T) {
+	// ptp_clock_caps of a NIC with SDP pins and cross timestamping, as returned on x86
+	raw := []byte{
+		// max_adj
+		0x00, 0xe1, 0xf5, 0x05,
+		// n_alarm
+		0x00, 0x00, 0x00, 0x00,
+		// n_ext_ts
+		0x03, 0x00, 0x00, 0x00,
+		// n_per_out
+		0x04, 0x00, 0x00, 0x00,
+		// pps
+		0x01, 0x00, 0x00, 0x00,
+		// n_pins
+		0x07, 0x00, 0x00, 0x00,
+		// cross_timestamping
+		0x01, 0x00, 0x00, 0x00,
+		// adjust_phase
+		0x00, 0x00, 0x00, 0x00,
+	}
+	raw = append(raw, make([]byte, 48)...)
+	ptpCaps := &PTPClockCaps{}
+	require.NoError(t, binary.Read(bytes.NewReader(raw), binary.LittleEndian, ptpCaps))
+
+	caps := NewCaps(ptpCaps)
+	expected := &Caps{
+		MaxAdjPPB:         100000000,
+		NExtTimestamps:    3,
+		NPeriodicOutputs:  4,
+		NPins:             7,
+		PPS:               true,
+		CrossTimestamping: true,
+	}
+	require.Equal(t, expected, caps)
+	require.True(t, caps.SupportsSysOffsetPrecise())
+	require.True(t, caps.SupportsPinProgramming())
+	require.True(t, caps.SupportsPeriodicOutput())
+
+	caps = NewCaps(&PTPClockCaps{MaxAdj: 62499999})
+	require.Equal(t, 62499999.0, caps.MaxAdjPPB)
+	require.False(t, caps.SupportsSysOffsetPrecise())
+	require.False(t, caps.SupportsPinProgramming())
+	require.False(t, caps.SupportsPeriodicOutput())
+}
@@ -0,0 +1,191 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+	"unsafe"
+
+	"github.com/facebook/time/hostendian"
+	"github.com/vtolstov/go-ioctl"
+	"golang.org/x/sys/unix"
+)
+
+// PinFunc is a function assigned to a PHC pin, as per Linux kernel's include/uapi/linux/ptp_clock.h
+type PinFunc uint32
+
+// Pin functions
+const (
+	PinFuncNone    PinFunc = 0
+	PinFuncExtTS   PinFunc = 1
+	PinFuncPerOut  PinFunc = 2
+	PinFuncPhySync PinFunc = 3
+)
+
+// Flags of external timestamp requests and events, defined in Linux include/uapi/linux/ptp_clock.h
+const (
+	ptpEnableFeature = 1 << 0
+	ptpRisingEdge    = 1 << 1
+)
+
+// IOCTLs to set up external timestamps
+var (
+	ioctlPTPExtTSRequest = ioctl.IOW(ptpClkMagic, 2, unsafe.Sizeof(PTPExtTSRequest{}))
+	ioctlPTPPinSetFunc   = ioctl.IOW(ptpClkMagic, 7, unsafe.Sizeof(PTPPinDesc{}))
+)
+
+// PTPPinDesc as defined in linux/ptp_clock.h
+type PTPPinDesc struct {
+	Name  [64]byte  /* Hardware specific human readable pin name. */
+	Index uint32    /* Pin index in the range of zero to ptp_clock_caps.n_pins - 1. */
+	Func  PinFunc   /* Which of the PTP_PF_xxx functions to use on this pin. */
+	Chan  uint32    /* The specific channel to use for this function. */
+	Rsv   [5]uint32 /* Reserved for future use. */
+}
+
+// PTPExtTSRequest as defined in linux/ptp_clock.h
+type PTPExtTSRequest struct {
+	Index uint32    /* Which channel to configure. */
+	Flags uint32    /* Bit field for PTP_xxx flags. */
+	Rsv   [2]uint32 /* Reserved for future use. */
+}
+
+// PTPExtTSEvent as defined in linux/ptp_clock.h
+type PTPExtTSEvent struct {
+	T     PTPClockTime /* Time event occurred. */
+	Index uint32       /* Which channel produced the event. */
+	Flags uint32       /* Event type. */
+	Rsv   [2]uint32    /* Reserved for future use. */
+}
+
+// ExtTSEvent is a timestamp the PHC latched on the external timestamp channel, e.g. a PPS edge
+type ExtTSEvent struct {
+	Channel uint32
+	Time    time.Time
+}
+
+// SetPinFunc assigns function fn on the channel to the pin of PHC device opened as fd
+func SetPinFunc(fd uintptr, pin uint32, fn PinFunc, channel uint32) error {
+	desc := &PTPPinDesc{
+		Index: pin,
+		Func:  fn,
+		Chan:  channel,
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, ioctlPTPPinSetFunc, uintptr(unsafe.Pointer(desc)))
+	if errno != 0 {
+		return fmt.Errorf("failed PTP_PIN_SETFUNC: %w", errno)
+	}
+	return nil
+}
+
+// requestExtTS enables or disables external timestamps on the channel of PHC device opened as fd
+func requestExtTS(fd uintptr, channel uint32, flags uint32) error {
+	req := &PTPExtTSRequest{
+		Index: channel,
+		Flags: flags,
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, ioctlPTPExtTSRequest, uintptr(unsafe.Pointer(req)))
+	if errno != 0 {
+		return fmt.Errorf("failed PTP_EXTTS_REQUEST: %w", errno)
+	}
+	return nil
+}
+
+// EnableExtTS assigns external timestamp function on the channel to the pin
+// and enables capture of rising edges, e.g. of 1PPS from GNSS receiver
+func EnableExtTS(fd uintptr, pin, channel uint32) error {
+	if err := SetPinFunc(fd, pin, PinFuncExtTS, channel); err != nil {
+		return err
+	}
+	return requestExtTS(fd, channel, ptpEnableFeature|ptpRisingEdge)
+}
+
+// DisableExtTS disables external timestamps on the channel
+func DisableExtTS(fd uintptr, channel uint32) error {
+	return requestExtTS(fd, channel, 0)
+}
+
+// extTSEventSize is the size of a single event read from PHC device
+var extTSEventSize = int(unsafe.Sizeof(PTPExtTSEvent{}))
+
+// decodeExtTSEvents decodes events read from PHC device, the kernel only returns whole events
+func decodeExtTSEvents(b []byte) ([]ExtTSEvent, error) {
+	if len(b)%extTSEventSize != 0 {
+		return nil, fmt.Errorf("read %d bytes, not a multiple of %d bytes event", len(b), extTSEventSize)
+	}
+	res := make([]ExtTSEvent, 0, len(b)/extTSEventSize)
+	r := bytes.NewReader(b)
+	for r.Len() > 0 {
+		event := PTPExtTSEvent{}
+		if err := binary.Read(r, hostendian.Order, &event); err != nil {
+			return nil, err
+		}
+		res = append(res, ExtTSEvent{Channel: event.Index, Time: event.T.Time()})
+	}
+	return res, nil
+}
+
+// readDeadliner is a device which blocking Read can be interrupted, like *os.File of PHC device
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// ReadExtTSEvents reads external timestamp events from PHC device and sends them to events.
+// It blocks until reading fails, e.g. when the device is closed, or ctx is done.
+// Waiting for the next event is only interrupted by ctx if device supports read deadlines,
+// as *os.File does, otherwise the device has to be closed to stop it
+func ReadExtTSEvents(ctx context.Context, device io.Reader, events chan<- ExtTSEvent) error {
+	if d, ok := device.(readDeadliner); ok {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				// deadline in the past makes pending and next reads fail right away
+				_ = d.SetReadDeadline(time.Unix(1, 0))
+			case <-stop:
+			}
+		}()
+	}
+	// kernel keeps a queue of events, read as many as there are
+	buf := make([]byte, extTSEventSize*ptpMaxSamples)
+	for {
+		n, err := device.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		decoded, err := decodeExtTSEvents(buf[:n])
+		if err != nil {
+			return err
+		}
+		for _, e := range decoded {
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
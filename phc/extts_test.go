@@ -0,0 +1,108 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/facebook/time/hostendian"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtTSStructsPacking(t *testing.T) {
+	require.Equal(t, uintptr(96), unsafe.Sizeof(PTPPinDesc{}))
+	require.Equal(t, uintptr(16), unsafe.Sizeof(PTPExtTSRequest{}))
+	require.Equal(t, uintptr(32), unsafe.Sizeof(PTPExtTSEvent{}))
+	// PTP_PIN_SETFUNC and PTP_EXTTS_REQUEST from linux/ptp_clock.h
+	require.Equal(t, uintptr(0x40603d07), ioctlPTPPinSetFunc)
+	require.Equal(t, uintptr(0x40103d02), ioctlPTPExtTSRequest)
+}
+
+func extTSEvents(t *testing.T, events ...PTPExtTSEvent) []byte {
+	buf := &bytes.Buffer{}
+	for _, e := range events {
+		require.NoError(t, binary.Write(buf, hostendian.Order, e))
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeExtTSEvents(t *testing.T) {
+	raw := extTSEvents(t,
+		PTPExtTSEvent{T: PTPClockTime{Sec: 1653574589, NSec: 12}, Index: 0},
+		PTPExtTSEvent{T: PTPClockTime{Sec: 1653574590, NSec: 999999998}, Index: 1},
+	)
+	events, err := decodeExtTSEvents(raw)
+	require.NoError(t, err)
+	expected := []ExtTSEvent{
+		{Channel: 0, Time: time.Unix(1653574589, 12)},
+		{Channel: 1, Time: time.Unix(1653574590, 999999998)},
+	}
+	require.Equal(t, expected, events)
+
+	_, err = decodeExtTSEvents(raw[:40])
+	require.Error(t, err)
+}
+
+func TestReadExtTSEvents(t *testing.T) {
+	raw := extTSEvents(t,
+		PTPExtTSEvent{T: PTPClockTime{Sec: 1653574589}, Index: 0},
+		PTPExtTSEvent{T: PTPClockTime{Sec: 1653574590}, Index: 0},
+	)
+	events := make(chan ExtTSEvent, 2)
+	err := ReadExtTSEvents(context.Background(), bytes.NewReader(raw), events)
+	require.ErrorIs(t, err, io.EOF)
+	require.Len(t, events, 2)
+	require.Equal(t, time.Unix(1653574589, 0), (<-events).Time)
+	require.Equal(t, time.Unix(1653574590, 0), (<-events).Time)
+}
+
+func TestReadExtTSEventsCanceled(t *testing.T) {
+	raw := extTSEvents(t, PTPExtTSEvent{T: PTPClockTime{Sec: 1653574589}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// nobody reads the events
+	err := ReadExtTSEvents(ctx, bytes.NewReader(raw), make(chan ExtTSEvent))
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestReadExtTSEventsCanceledWhileReading(t *testing.T) {
+	// pipe without writes blocks reading like PHC device without events
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- ReadExtTSEvents(ctx, r, make(chan ExtTSEvent))
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading wasn't interrupted")
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phc
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"github.com/vtolstov/go-ioctl"
+	"golang.org/x/sys/unix"
+)
+
+// ioctlPTPPeroutRequest is an IOCTL to program a periodic output
+var ioctlPTPPeroutRequest = ioctl.IOW(ptpClkMagic, 3, unsafe.Sizeof(PTPPeroutRequest{}))
+
+// PTPPeroutRequest as defined in linux/ptp_clock.h
+type PTPPeroutRequest struct {
+	Start  PTPClockTime /* Absolute start time. */
+	Period PTPClockTime /* Desired period, zero means disable. */
+	Index  uint32       /* Which channel to configure. */
+	Flags  uint32       /* Bit field for PTP_PEROUT_xxx flags. */
+	On     PTPClockTime /* Duty cycle, reserved unless PTP_PEROUT_DUTY_CYCLE flag is set. */
+}
+
+// durationToPTPClockTime converts non-negative duration to ptp_clock_time
+func durationToPTPClockTime(d time.Duration) PTPClockTime {
+	return PTPClockTime{Sec: int64(d / time.Second), NSec: uint32(d % time.Second)}
+}
+
+// newPTPPeroutRequest returns request of the periodic output on the channel
+func newPTPPeroutRequest(channel uint32, start time.Time, period time.Duration) *PTPPeroutRequest {
+	return &PTPPeroutRequest{
+		Start:  PTPClockTime{Sec: start.Unix(), NSec: uint32(start.Nanosecond())},
+		Period: durationToPTPClockTime(period),
+		Index:  channel,
+	}
+}
+
+// validatePeriodicOutput checks the clock has the pin and the channel to generate periodic signal
+func validatePeriodicOutput(caps *Caps, pin, channel uint32, period time.Duration) error {
+	if period <= 0 {
+		return fmt.Errorf("invalid period %v, must be positive", period)
+	}
+	if int(pin) >= caps.NPins {
+		return fmt.Errorf("invalid pin %d, the clock has %d pins", pin, caps.NPins)
+	}
+	if int(channel) >= caps.NPeriodicOutputs {
+		return fmt.Errorf("invalid channel %d, the clock has %d periodic outputs", channel, caps.NPeriodicOutputs)
+	}
+	return nil
+}
+
+// requestPerout issues PTP_PERIOUT_REQUEST on PHC device opened as fd
+func requestPerout(fd uintptr, req *PTPPeroutRequest) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, ioctlPTPPeroutRequest, uintptr(unsafe.Pointer(req)))
+	if errno != 0 {
+		return fmt.Errorf("failed PTP_PERIOUT_REQUEST: %w", errno)
+	}
+	return nil
+}
+
+// EnablePeriodicOutput assigns periodic output function on the channel to the pin of PHC device opened as fd
+// and starts generating signal with the period at start, e.g. 1PPS for downstream equipment.
+// Pin and channel are checked against the clock capabilities
+func EnablePeriodicOutput(fd uintptr, pin, channel uint32, start time.Time, period time.Duration) error {
+	caps, err := ReadCaps(fd)
+	if err != nil {
+		return err
+	}
+	if err := validatePeriodicOutput(caps, pin, channel, period); err != nil {
+		return err
+	}
+	if _, err := timeToTimespec(start); err != nil {
+		return err
+	}
+	if err := SetPinFunc(fd, pin, PinFuncPerOut, channel); err != nil {
+		return err
+	}
+	return requestPerout(fd, newPTPPeroutRequest(channel, start, period))
+}
+
+// DisablePeriodicOutput stops periodic signal on the channel
+func DisablePeriodicOutput(fd uintptr, channel uint32) error {
+	return requestPerout(fd, &PTPPeroutRequest{Index: channel})
+}
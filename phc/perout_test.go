@@ -0,0 +1,71 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/facebook/time/hostendian"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPTPPeroutRequestEncoding(t *testing.T) {
+	require.Equal(t, uintptr(56), unsafe.Sizeof(PTPPeroutRequest{}))
+	// PTP_PERIOUT_REQUEST from linux/ptp_clock.h
+	require.Equal(t, uintptr(0x40383d03), ioctlPTPPeroutRequest)
+
+	req := newPTPPeroutRequest(1, time.Unix(1653574590, 500000000), 1500*time.Millisecond)
+	buf := &bytes.Buffer{}
+	require.NoError(t, binary.Write(buf, hostendian.Order, req))
+	expected := &bytes.Buffer{}
+	for _, v := range []interface{}{
+		// start
+		int64(1653574590), uint32(500000000), uint32(0),
+		// period
+		int64(1), uint32(500000000), uint32(0),
+		// index, flags
+		uint32(1), uint32(0),
+		// on
+		int64(0), uint32(0), uint32(0),
+	} {
+		require.NoError(t, binary.Write(expected, hostendian.Order, v))
+	}
+	require.Equal(t, expected.Bytes(), buf.Bytes())
+}
+
+func TestValidatePeriodicOutput(t *testing.T) {
+	caps := &Caps{NPins: 4, NPeriodicOutputs: 2}
+	require.NoError(t, validatePeriodicOutput(caps, 3, 1, time.Second))
+	require.Error(t, validatePeriodicOutput(caps, 4, 1, time.Second))
+	require.Error(t, validatePeriodicOutput(caps, 3, 2, time.Second))
+	require.Error(t, validatePeriodicOutput(caps, 0, 0, 0))
+	require.Error(t, validatePeriodicOutput(&Caps{}, 0, 0, time.Second))
+}
+
+func TestEnablePeriodicOutputNotPHC(t *testing.T) {
+	// regular files don't support PTP ioctls
+	f, err := os.CreateTemp("", "phc")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	require.Error(t, EnablePeriodicOutput(f.Fd(), 0, 0, time.Now(), time.Second))
+}
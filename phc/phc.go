@@ -57,14 +57,8 @@ var SupportedMethods = []TimeMethod{MethodSyscallClockGettime, MethodIoctlSysOff
 
 // IfaceToPHCDevice returns path to PHC device associated with given network card iface
 func IfaceToPHCDevice(iface string) (string, error) {
-	info, err := IfaceInfo(iface)
-	if err != nil {
-		return "", fmt.Errorf("getting interface info: %w", err)
-	}
-	if info.PHCIndex < 0 {
-		return "", fmt.Errorf("%s doesn't support PHC", iface)
-	}
-	return fmt.Sprintf("/dev/ptp%d", info.PHCIndex), nil
+	device, _, err := DeviceFromInterface(iface)
+	return device, err
 }
 
 // Time returns time we got from network card
@@ -122,6 +116,49 @@ func ReadPTPSysOffsetExtended(device string, nsamples int) (*PTPSysOffsetExtende
 	return res, nil
 }
 
+// readClockCaps issues PTP_CLOCK_GETCAPS ioctl on PHC device opened as fd
+func readClockCaps(fd uintptr) (*PTPClockCaps, error) {
+	caps := &PTPClockCaps{}
+	_, _, errno := unix.Syscall(
+		unix.SYS_IOCTL, fd,
+		ioctlPTPClockGetcaps,
+		uintptr(unsafe.Pointer(caps)),
+	)
+	if errno != 0 {
+		return nil, fmt.Errorf("failed PTP_CLOCK_GETCAPS: %w", errno)
+	}
+	return caps, nil
+}
+
+// ReadCaps returns capabilities of PHC device opened as fd
+func ReadCaps(fd uintptr) (*Caps, error) {
+	caps, err := readClockCaps(fd)
+	if err != nil {
+		return nil, err
+	}
+	return NewCaps(caps), nil
+}
+
+// CapsFromDevice returns capabilities of PHC device, e.g. /dev/ptp0
+func CapsFromDevice(device string) (*Caps, error) {
+	f, err := os.Open(device)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCaps(f.Fd())
+}
+
+// MaxAdjPPB returns maximum frequency adjustment in PPB supported by PHC device opened as fd.
+// Kernel silently clamps larger adjustments
+func MaxAdjPPB(fd uintptr) (float64, error) {
+	caps, err := ReadCaps(fd)
+	if err != nil {
+		return 0, err
+	}
+	return caps.MaxAdjPPB, nil
+}
+
 // ClockAdjtime issues CLOCK_ADJTIME syscall to either adjust the parameters of given clock,
 // or read them if buf is empty.  man(2) clock_adjtime
 func ClockAdjtime(clockid int32, buf *unix.Timex) (state int, err error) {
@@ -133,6 +170,33 @@ func ClockAdjtime(clockid int32, buf *unix.Timex) (state int, err error) {
 	return state, err
 }
 
+// maxPHCSeconds is the largest number of seconds PTP timestamps can carry, they are 48 bits wide
+const maxPHCSeconds = 1<<48 - 1
+
+// timeToTimespec converts time to timespec the PHC can be set to
+func timeToTimespec(t time.Time) (unix.Timespec, error) {
+	if t.Before(time.Unix(0, 0)) {
+		return unix.Timespec{}, fmt.Errorf("time %v is before the epoch", t)
+	}
+	if t.Unix() > maxPHCSeconds {
+		return unix.Timespec{}, fmt.Errorf("time %v is out of the PHC range", t)
+	}
+	return unix.TimeToTimespec(t)
+}
+
+// SetTime sets PHC device opened as fd to the given time. man(2) clock_settime
+func SetTime(fd uintptr, t time.Time) error {
+	ts, err := timeToTimespec(t)
+	if err != nil {
+		return err
+	}
+	_, _, errno := unix.Syscall(unix.SYS_CLOCK_SETTIME, uintptr(FDToClockID(fd)), uintptr(unsafe.Pointer(&ts)), 0)
+	if errno != 0 {
+		return fmt.Errorf("failed clock_settime: %w", errno)
+	}
+	return nil
+}
+
 // FrequencyPPBFromDevice reads PHC device frequency in PPB
 func FrequencyPPBFromDevice(device string) (freqPPB float64, err error) {
 	// we need RW permissions to issue CLOCK_ADJTIME on the device, even with empty struct
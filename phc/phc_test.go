@@ -0,0 +1,85 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phc
+
+import (
+	"os"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestTimeToTimespec(t *testing.T) {
+	ts, err := timeToTimespec(time.Unix(1653574589, 123456789))
+	require.NoError(t, err)
+	require.Equal(t, unix.Timespec{Sec: 1653574589, Nsec: 123456789}, ts)
+
+	ts, err = timeToTimespec(time.Unix(0, 0))
+	require.NoError(t, err)
+	require.Equal(t, unix.Timespec{}, ts)
+
+	ts, err = timeToTimespec(time.Unix(maxPHCSeconds, 999999999))
+	require.NoError(t, err)
+	require.Equal(t, unix.Timespec{Sec: maxPHCSeconds, Nsec: 999999999}, ts)
+}
+
+func TestTimeToTimespecOutOfRange(t *testing.T) {
+	_, err := timeToTimespec(time.Unix(-1, 999999999))
+	require.Error(t, err)
+
+	_, err = timeToTimespec(time.Time{})
+	require.Error(t, err)
+
+	_, err = timeToTimespec(time.Unix(maxPHCSeconds+1, 0))
+	require.Error(t, err)
+}
+
+func TestSetTimeBeforeEpoch(t *testing.T) {
+	require.Error(t, SetTime(0, time.Unix(-1, 0)))
+}
+
+func TestSetTimeNotPHC(t *testing.T) {
+	// regular files don't have a dynamic clock
+	f, err := os.CreateTemp("", "phc")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	require.Error(t, SetTime(f.Fd(), time.Now()))
+}
+
+func TestPTPClockCapsSize(t *testing.T) {
+	// struct ptp_clock_caps is 20 ints
+	require.Equal(t, uintptr(80), unsafe.Sizeof(PTPClockCaps{}))
+}
+
+func TestMaxAdjPPBNotPHC(t *testing.T) {
+	// regular files don't support PTP ioctls
+	f, err := os.CreateTemp("", "phc")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = MaxAdjPPB(f.Fd())
+	require.Error(t, err)
+}
+
+func TestCapsFromDeviceMissing(t *testing.T) {
+	_, err := CapsFromDevice("/does/not/exist")
+	require.Error(t, err)
+}
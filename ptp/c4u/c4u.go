@@ -17,6 +17,7 @@ limitations under the License.
 package c4u
 
 import (
+	"reflect"
 	"time"
 
 	"github.com/facebook/time/ptp/c4u/clock"
@@ -41,10 +42,15 @@ type Config struct {
 }
 
 var defaultConfig = &server.DynamicConfig{
-	DrainInterval:  30 * time.Second,
-	MaxSubDuration: 1 * time.Hour,
-	MetricInterval: 1 * time.Minute,
-	MinSubInterval: 1 * time.Second,
+	DrainInterval:           30 * time.Second,
+	MaxSubDuration:          1 * time.Hour,
+	MetricInterval:          1 * time.Minute,
+	MinSubDuration:          30 * time.Second,
+	MinSubInterval:          1 * time.Second,
+	OffsetScaledLogVariance: server.DefaultOffsetScaledLogVariance,
+	Priority1:               server.DefaultPriority,
+	Priority2:               server.DefaultPriority,
+	SweepInterval:           10 * time.Second,
 }
 
 func evaluateClockQuality(config *Config, q *ptp.ClockQuality) *ptp.ClockQuality {
@@ -136,7 +142,7 @@ func Run(config *Config, rb *clock.RingBuffer, st stats.Stats) error {
 	st.SetClockAccuracy(int64(pending.ClockAccuracy))
 	st.SetUTCOffsetSec(int64(pending.UTCOffset.Seconds()))
 
-	if *current != *pending {
+	if !reflect.DeepEqual(current, pending) {
 		log.Infof("Current: %+v", current)
 		log.Infof("Pending: %+v", pending)
 
@@ -34,13 +34,18 @@ func TestRun(t *testing.T) {
 	utcoffset, _ := utcoffset.Run()
 
 	expected := &server.DynamicConfig{
-		ClockClass:     clock.ClockClassUncalibrated,
-		ClockAccuracy:  ptp.ClockAccuracyUnknown,
-		DrainInterval:  30 * time.Second,
-		MaxSubDuration: 1 * time.Hour,
-		MetricInterval: 1 * time.Minute,
-		MinSubInterval: 1 * time.Second,
-		UTCOffset:      utcoffset,
+		ClockClass:              clock.ClockClassUncalibrated,
+		ClockAccuracy:           ptp.ClockAccuracyUnknown,
+		DrainInterval:           30 * time.Second,
+		MaxSubDuration:          1 * time.Hour,
+		MetricInterval:          1 * time.Minute,
+		MinSubDuration:          30 * time.Second,
+		MinSubInterval:          1 * time.Second,
+		OffsetScaledLogVariance: server.DefaultOffsetScaledLogVariance,
+		Priority1:               server.DefaultPriority,
+		Priority2:               server.DefaultPriority,
+		SweepInterval:           10 * time.Second,
+		UTCOffset:               utcoffset,
 	}
 
 	cfg, err := os.CreateTemp("", "c4u")
@@ -0,0 +1,53 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+// CompareAnnounce compares grandmasters announced in a and b using the IEEE 1588 dataset comparison.
+// It returns a negative number if a is better than b, a positive one if b is better and 0 if they are equal,
+// so announcements sorted with it start with the best grandmaster.
+// Identical grandmasters are told apart by the number of steps removed
+func CompareAnnounce(a, b AnnounceBody) int {
+	if a.GrandmasterIdentity != b.GrandmasterIdentity {
+		if a.GrandmasterPriority1 != b.GrandmasterPriority1 {
+			return compareUint(uint64(a.GrandmasterPriority1), uint64(b.GrandmasterPriority1))
+		}
+		if a.GrandmasterClockQuality.ClockClass != b.GrandmasterClockQuality.ClockClass {
+			return compareUint(uint64(a.GrandmasterClockQuality.ClockClass), uint64(b.GrandmasterClockQuality.ClockClass))
+		}
+		if a.GrandmasterClockQuality.ClockAccuracy != b.GrandmasterClockQuality.ClockAccuracy {
+			return compareUint(uint64(a.GrandmasterClockQuality.ClockAccuracy), uint64(b.GrandmasterClockQuality.ClockAccuracy))
+		}
+		if a.GrandmasterClockQuality.OffsetScaledLogVariance != b.GrandmasterClockQuality.OffsetScaledLogVariance {
+			return compareUint(uint64(a.GrandmasterClockQuality.OffsetScaledLogVariance), uint64(b.GrandmasterClockQuality.OffsetScaledLogVariance))
+		}
+		if a.GrandmasterPriority2 != b.GrandmasterPriority2 {
+			return compareUint(uint64(a.GrandmasterPriority2), uint64(b.GrandmasterPriority2))
+		}
+		return compareUint(uint64(a.GrandmasterIdentity), uint64(b.GrandmasterIdentity))
+	}
+	return compareUint(uint64(a.StepsRemoved), uint64(b.StepsRemoved))
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func announceBody() AnnounceBody {
+	return AnnounceBody{
+		GrandmasterPriority1: 128,
+		GrandmasterClockQuality: ClockQuality{
+			ClockClass:              ClockClass6,
+			ClockAccuracy:           ClockAccuracyNanosecond100,
+			OffsetScaledLogVariance: 23008,
+		},
+		GrandmasterPriority2: 128,
+		GrandmasterIdentity:  0x1,
+	}
+}
+
+func TestCompareAnnounce(t *testing.T) {
+	testCases := []struct {
+		name   string
+		better func(a *AnnounceBody)
+		worse  func(b *AnnounceBody)
+	}{
+		{
+			name:   "priority1",
+			better: func(a *AnnounceBody) { a.GrandmasterPriority1 = 1 },
+			// worse in everything else
+			worse: func(b *AnnounceBody) {
+				b.GrandmasterClockQuality.ClockClass = ClockClass52
+				b.GrandmasterPriority1 = 2
+			},
+		},
+		{
+			name:   "clock class",
+			better: func(a *AnnounceBody) { a.GrandmasterClockQuality.ClockAccuracy = ClockAccuracyUnknown },
+			worse:  func(b *AnnounceBody) { b.GrandmasterClockQuality.ClockClass = ClockClass7 },
+		},
+		{
+			name:   "clock accuracy",
+			better: func(a *AnnounceBody) { a.GrandmasterClockQuality.OffsetScaledLogVariance = 0xffff },
+			worse:  func(b *AnnounceBody) { b.GrandmasterClockQuality.ClockAccuracy = ClockAccuracyMicrosecond1 },
+		},
+		{
+			name:   "offset scaled log variance",
+			better: func(a *AnnounceBody) { a.GrandmasterPriority2 = 255 },
+			worse:  func(b *AnnounceBody) { b.GrandmasterClockQuality.OffsetScaledLogVariance = 23009 },
+		},
+		{
+			name:   "priority2",
+			better: func(a *AnnounceBody) {},
+			worse:  func(b *AnnounceBody) { b.GrandmasterPriority2 = 129 },
+		},
+		{
+			name: "clock identity",
+			better: func(a *AnnounceBody) {
+				a.GrandmasterIdentity = 0x1
+				a.StepsRemoved = 10
+			},
+			worse: func(b *AnnounceBody) { b.GrandmasterIdentity = 0x3 },
+		},
+		{
+			name: "steps removed",
+			better: func(a *AnnounceBody) {
+				a.GrandmasterIdentity = 0x1
+				a.StepsRemoved = 1
+			},
+			worse: func(b *AnnounceBody) { b.StepsRemoved = 2 },
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// b wins the identity tie-break unless overridden
+			a := announceBody()
+			a.GrandmasterIdentity = 0x2
+			b := announceBody()
+			tc.better(&a)
+			tc.worse(&b)
+			require.Less(t, CompareAnnounce(a, b), 0)
+			require.Greater(t, CompareAnnounce(b, a), 0)
+		})
+	}
+}
+
+func TestCompareAnnounceEqual(t *testing.T) {
+	a := announceBody()
+	b := announceBody()
+	// fields outside of the dataset comparison don't matter
+	b.CurrentUTCOffset = 37
+	b.TimeSource = TimeSourceGNSS
+	require.Equal(t, 0, CompareAnnounce(a, b))
+}
+
+func TestCompareAnnounceSort(t *testing.T) {
+	best := announceBody()
+	best.GrandmasterIdentity = 0x3
+	holdover := announceBody()
+	holdover.GrandmasterIdentity = 0x1
+	holdover.GrandmasterClockQuality.ClockClass = ClockClass7
+	drained := announceBody()
+	drained.GrandmasterIdentity = 0x2
+	drained.GrandmasterPriority1 = 255
+
+	announces := []AnnounceBody{drained, holdover, best}
+	sort.Slice(announces, func(i, j int) bool {
+		return CompareAnnounce(announces[i], announces[j]) < 0
+	})
+	require.Equal(t, []AnnounceBody{best, holdover, drained}, announces)
+}
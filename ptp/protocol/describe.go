@@ -0,0 +1,186 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// flagNames lists FlagField bits in the order they are printed, names as per Table 37 Values of flagField
+var flagNames = []struct {
+	flag uint16
+	name string
+}{
+	{FlagAlternateMaster, "alternateMasterFlag"},
+	{FlagTwoStep, "twoStepFlag"},
+	{FlagUnicast, "unicastFlag"},
+	{FlagProfileSpecific1, "PTP profile Specific 1"},
+	{FlagProfileSpecific2, "PTP profile Specific 2"},
+	{FlagLeap61, "leap61"},
+	{FlagLeap59, "leap59"},
+	{FlagCurrentUtcOffsetValid, "currentUtcOffsetValid"},
+	{FlagPTPTimescale, "ptpTimescale"},
+	{FlagTimeTraceable, "timeTraceable"},
+	{FlagFrequencyTraceable, "frequencyTraceable"},
+	{FlagSynchronizationUncertain, "synchronizationUncertain"},
+}
+
+// describer accumulates indented "name: value" lines
+type describer struct {
+	b strings.Builder
+}
+
+func (d *describer) line(indent int, name, format string, args ...interface{}) {
+	d.b.WriteString(strings.Repeat("    ", indent))
+	d.b.WriteString(name)
+	d.b.WriteString(": ")
+	fmt.Fprintf(&d.b, format, args...)
+	d.b.WriteByte('\n')
+}
+
+func (d *describer) timestamp(indent int, name string, ts Timestamp) {
+	d.line(indent, name, "%d.%09d", ts.Seconds.Seconds(), ts.Nanoseconds)
+}
+
+func (d *describer) portIdentity(indent int, name string, p PortIdentity) {
+	d.line(indent, name, "%s", p)
+}
+
+func (d *describer) header(h *Header) {
+	msgType := h.MessageType()
+	fmt.Fprintf(&d.b, "Precision Time Protocol (IEEE1588) %s\n", msgType)
+	d.line(1, "majorSdoId", "%d", uint8(h.SdoIDAndMsgType)>>4)
+	d.line(1, "messageType", "%s (0x%x)", msgType, uint8(msgType))
+	d.line(1, "versionPTP", "%d", h.Version&MajorVersionMask)
+	d.line(1, "minorVersionPTP", "%d", h.Version>>4)
+	d.line(1, "messageLength", "%d", h.MessageLength)
+	d.line(1, "domainNumber", "%d", h.DomainNumber)
+	d.line(1, "minorSdoId", "%d", h.MinorSdoID)
+	var set []string
+	for _, f := range flagNames {
+		if h.FlagField&f.flag != 0 {
+			set = append(set, f.name)
+		}
+	}
+	d.line(1, "flags", "0x%04x %v", h.FlagField, set)
+	d.line(1, "correctionField", "%s", h.CorrectionField)
+	d.line(1, "messageTypeSpecific", "%d", h.MessageTypeSpecific)
+	d.portIdentity(1, "sourcePortIdentity", h.SourcePortIdentity)
+	d.line(1, "sequenceId", "%d", h.SequenceID)
+	d.line(1, "controlField", "%d", h.ControlField)
+	d.line(1, "logMessagePeriod", "%d", h.LogMessageInterval)
+}
+
+func (d *describer) tlvs(tlvs []TLV) {
+	for _, tlv := range tlvs {
+		d.line(1, "TLV", "%s (0x%04x)", tlv.Type(), uint16(tlv.Type()))
+		switch v := tlv.(type) {
+		case *RequestUnicastTransmissionTLV:
+			d.line(2, "messageType", "%s", v.MsgTypeAndReserved.MsgType())
+			d.line(2, "logInterMessagePeriod", "%d", v.LogInterMessagePeriod)
+			d.line(2, "durationField", "%d", v.DurationField)
+		case *GrantUnicastTransmissionTLV:
+			d.line(2, "messageType", "%s", v.MsgTypeAndReserved.MsgType())
+			d.line(2, "logInterMessagePeriod", "%d", v.LogInterMessagePeriod)
+			d.line(2, "durationField", "%d", v.DurationField)
+			d.line(2, "renewal", "%d", v.Renewal)
+		case *CancelUnicastTransmissionTLV:
+			d.line(2, "messageType", "%s", v.MsgTypeAndFlags.MsgType())
+		case *AcknowledgeCancelUnicastTransmissionTLV:
+			d.line(2, "messageType", "%s", v.MsgTypeAndFlags.MsgType())
+		case *PathTraceTLV:
+			for _, c := range v.PathSequence {
+				d.line(2, "pathSequence", "%s", c)
+			}
+		case *AlternateTimeOffsetIndicatorTLV:
+			d.line(2, "keyField", "%d", v.KeyField)
+			d.line(2, "currentOffset", "%d", v.CurrentOffset)
+			d.line(2, "jumpSeconds", "%d", v.JumpSeconds)
+			d.line(2, "timeOfNextJump", "%d", v.TimeOfNextJump.Seconds())
+			d.line(2, "displayName", "%q", v.DisplayName)
+		default:
+			d.line(2, "value", "%+v", v)
+		}
+	}
+}
+
+// Describe renders a parsed PTP message into a human-readable multi-line description,
+// similar to how Wireshark displays it. Unknown packet types are printed with %+v
+func Describe(msg Packet) string {
+	d := &describer{}
+	switch v := msg.(type) {
+	case *SyncDelayReq:
+		d.header(&v.Header)
+		d.timestamp(1, "originTimestamp", v.OriginTimestamp)
+	case *FollowUp:
+		d.header(&v.Header)
+		d.timestamp(1, "preciseOriginTimestamp", v.PreciseOriginTimestamp)
+	case *DelayResp:
+		d.header(&v.Header)
+		d.timestamp(1, "receiveTimestamp", v.ReceiveTimestamp)
+		d.portIdentity(1, "requestingPortIdentity", v.RequestingPortIdentity)
+	case *PDelayReq:
+		d.header(&v.Header)
+		d.timestamp(1, "originTimestamp", v.OriginTimestamp)
+	case *PDelayResp:
+		d.header(&v.Header)
+		d.timestamp(1, "requestReceiptTimestamp", v.RequestReceiptTimestamp)
+		d.portIdentity(1, "requestingPortIdentity", v.RequestingPortIdentity)
+	case *PDelayRespFollowUp:
+		d.header(&v.Header)
+		d.timestamp(1, "responseOriginTimestamp", v.ResponseOriginTimestamp)
+		d.portIdentity(1, "requestingPortIdentity", v.RequestingPortIdentity)
+	case *Announce:
+		d.header(&v.Header)
+		d.timestamp(1, "originTimestamp", v.OriginTimestamp)
+		d.line(1, "currentUtcOffset", "%d", v.CurrentUTCOffset)
+		d.line(1, "grandmasterPriority1", "%d", v.GrandmasterPriority1)
+		d.line(1, "grandmasterClockClass", "%d (%s)", v.GrandmasterClockQuality.ClockClass, v.GrandmasterClockQuality.ClockClass)
+		d.line(1, "grandmasterClockAccuracy", "0x%02x (%s)", uint8(v.GrandmasterClockQuality.ClockAccuracy), v.GrandmasterClockQuality.ClockAccuracy)
+		d.line(1, "grandmasterClockVariance", "%d", v.GrandmasterClockQuality.OffsetScaledLogVariance)
+		d.line(1, "grandmasterPriority2", "%d", v.GrandmasterPriority2)
+		d.line(1, "grandmasterClockIdentity", "%s", v.GrandmasterIdentity)
+		d.line(1, "localStepsRemoved", "%d", v.StepsRemoved)
+		d.line(1, "timeSource", "%s (0x%02x)", v.TimeSource, uint8(v.TimeSource))
+		d.tlvs(v.TLVs)
+	case *Signaling:
+		d.header(&v.Header)
+		d.portIdentity(1, "targetPortIdentity", v.TargetPortIdentity)
+		d.tlvs(v.TLVs)
+	case *Management:
+		d.header(&v.Header)
+		d.portIdentity(1, "targetPortIdentity", v.TargetPortIdentity)
+		d.line(1, "startingBoundaryHops", "%d", v.StartingBoundaryHops)
+		d.line(1, "boundaryHops", "%d", v.BoundaryHops)
+		d.line(1, "actionField", "%d", v.ActionField)
+		if v.TLV != nil {
+			d.line(1, "managementId", "0x%04x", uint16(v.TLV.MgmtID()))
+			d.line(2, "value", "%+v", v.TLV)
+		}
+	case *ManagementMsgErrorStatus:
+		d.header(&v.Header)
+		d.portIdentity(1, "targetPortIdentity", v.TargetPortIdentity)
+		d.line(1, "actionField", "%d", v.ActionField)
+		d.line(1, "managementErrorId", "%s", v.ManagementErrorID)
+		d.line(1, "managementId", "0x%04x", uint16(v.ManagementErrorStatusTLV.ManagementID))
+		d.line(1, "displayData", "%q", v.DisplayData)
+	default:
+		return fmt.Sprintf("%T %+v\n", msg, msg)
+	}
+	return d.b.String()
+}
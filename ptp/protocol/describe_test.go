@@ -0,0 +1,109 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribeSync(t *testing.T) {
+	source := PortIdentity{ClockIdentity: 0x001122fffe334455, PortNumber: 1}
+	p := &SyncDelayReq{
+		Header: NewHeader(MessageSync, 0, 24, FlagTwoStep|FlagUnicast, 42, source),
+		SyncDelayReqBody: SyncDelayReqBody{
+			OriginTimestamp: NewTimestamp(time.Unix(1650000000, 123)),
+		},
+	}
+	p.MessageLength = 44
+	want := `Precision Time Protocol (IEEE1588) SYNC
+    majorSdoId: 0
+    messageType: SYNC (0x0)
+    versionPTP: 2
+    minorVersionPTP: 1
+    messageLength: 44
+    domainNumber: 24
+    minorSdoId: 0
+    flags: 0x0600 [twoStepFlag unicastFlag]
+    correctionField: Correction(0.000ns)
+    messageTypeSpecific: 0
+    sourcePortIdentity: 001122.fffe.334455-1
+    sequenceId: 42
+    controlField: 0
+    logMessagePeriod: 0
+    originTimestamp: 1650000000.000000123
+`
+	require.Equal(t, want, Describe(p))
+}
+
+func TestDescribeAnnounce(t *testing.T) {
+	source := PortIdentity{ClockIdentity: 0x001122fffe334455, PortNumber: 1}
+	p := &Announce{
+		Header: NewHeader(MessageAnnounce, 0, 0, FlagUnicast|FlagPTPTimescale|FlagCurrentUtcOffsetValid, 7, source),
+		AnnounceBody: AnnounceBody{
+			CurrentUTCOffset:     37,
+			GrandmasterPriority1: 128,
+			GrandmasterClockQuality: ClockQuality{
+				ClockClass:              ClockClass6,
+				ClockAccuracy:           ClockAccuracyNanosecond100,
+				OffsetScaledLogVariance: 23008,
+			},
+			GrandmasterPriority2: 128,
+			GrandmasterIdentity:  source.ClockIdentity,
+			TimeSource:           TimeSourceGNSS,
+		},
+		TLVs: []TLV{
+			&PathTraceTLV{
+				TLVHead:      TLVHead{TLVType: TLVPathTrace, LengthField: 8},
+				PathSequence: []ClockIdentity{source.ClockIdentity},
+			},
+		},
+	}
+	p.MessageLength = 76
+	p.LogMessageInterval = 1
+	want := `Precision Time Protocol (IEEE1588) ANNOUNCE
+    majorSdoId: 0
+    messageType: ANNOUNCE (0xb)
+    versionPTP: 2
+    minorVersionPTP: 1
+    messageLength: 76
+    domainNumber: 0
+    minorSdoId: 0
+    flags: 0x040c [unicastFlag currentUtcOffsetValid ptpTimescale]
+    correctionField: Correction(0.000ns)
+    messageTypeSpecific: 0
+    sourcePortIdentity: 001122.fffe.334455-1
+    sequenceId: 7
+    controlField: 5
+    logMessagePeriod: 1
+    originTimestamp: 0.000000000
+    currentUtcOffset: 37
+    grandmasterPriority1: 128
+    grandmasterClockClass: 6 (locked to primary reference, PTP timescale)
+    grandmasterClockAccuracy: 0x21 (within 100ns)
+    grandmasterClockVariance: 23008
+    grandmasterPriority2: 128
+    grandmasterClockIdentity: 001122.fffe.334455
+    localStepsRemoved: 0
+    timeSource: GNSS (0x20)
+    TLV: PATH_TRACE (0x0008)
+        pathSequence: 001122.fffe.334455
+`
+	require.Equal(t, want, Describe(p))
+}
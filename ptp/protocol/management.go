@@ -199,7 +199,10 @@ func (p *ManagementMsgErrorStatus) UnmarshalBinary(rawBytes []byte) error {
 		// DisplayData is completely optional
 		return nil
 	}
-	data := make([]byte, reader.Len())
+	if toRead > reader.Len() {
+		toRead = reader.Len()
+	}
+	data := make([]byte, toRead)
 	if _, err := io.ReadFull(reader, data); err != nil {
 		return err
 	}
@@ -190,6 +190,11 @@ func TestParseMsgErrorStatusWithText(t *testing.T) {
 	pp, err := DecodePacket(raw)
 	require.Nil(t, err)
 	assert.Equal(t, &want, pp)
+
+	// DisplayData doesn't fit into the message length, trailing bytes don't count
+	raw[3] = 0x3e
+	err = FromBytes(raw, packet)
+	require.Error(t, err)
 }
 
 // io.Writer with limited space
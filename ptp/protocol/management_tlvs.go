@@ -156,6 +156,9 @@ var mgmtTLVDecoder = map[ManagementID]MgmtTLVDecoderFunc{
 		tlv.UnicastMasterTable.UnicastMasters = make([]UnicastMasterEntry, int(tlv.UnicastMasterTable.ActualTableSize))
 		n := binary.Size(tlv.ManagementTLVHead) + binary.Size(tlv.UnicastMasterTable.ActualTableSize)
 		for i := 0; i < int(tlv.UnicastMasterTable.ActualTableSize); i++ {
+			if n >= len(data) {
+				return nil, fmt.Errorf("not enough data to decode UnicastMasterTable entry %d", i)
+			}
 			entry := UnicastMasterEntry{}
 			if err := entry.UnmarshalBinary(data[n:]); err != nil {
 				return nil, err
@@ -0,0 +1,51 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"math"
+	"time"
+)
+
+// correctionNanoseconds returns correction in nanoseconds keeping fractions of nanosecond.
+// Correction which is too big to be represented can't be used and counts as 0
+func correctionNanoseconds(c Correction) float64 {
+	if c.TooBig() {
+		return 0
+	}
+	return c.Nanoseconds()
+}
+
+// TwoStepOffset computes offset from the server and mean path delay of a two-step exchange (11.3.2, 11.3.3):
+//
+//	t1 is the Follow_Up preciseOriginTimestamp, t2 is syncRx,
+//	t3 is delayReqTx and t4 is the Delay_Resp receiveTimestamp.
+//	offset = ((t2 − t1 − c1 − c2) − (t4 − t3 − c3))/2
+//	delay = ((t2 − t1 − c1 − c2) + (t4 − t3 − c3))/2
+//
+// where c1, c2 and c3 are correctionFields of Sync, Follow_Up and Delay_Resp.
+// Transparent clocks accumulate residence time of Sync and Delay_Req there.
+// Correction is scaled by 2^16, its fractions of nanosecond are kept until the final rounding.
+func TwoStepOffset(sync *SyncDelayReq, syncRx time.Time, fu *FollowUp, delayReqTx time.Time, resp *DelayResp) (offset, delay time.Duration) {
+	t1 := fu.PreciseOriginTimestamp.Time()
+	t4 := resp.ReceiveTimestamp.Time()
+	serverToClient := float64(syncRx.Sub(t1)) - correctionNanoseconds(sync.CorrectionField) - correctionNanoseconds(fu.CorrectionField)
+	clientToServer := float64(t4.Sub(delayReqTx)) - correctionNanoseconds(resp.CorrectionField)
+	offset = time.Duration(math.Round((serverToClient - clientToServer) / 2))
+	delay = time.Duration(math.Round((serverToClient + clientToServer) / 2))
+	return offset, delay
+}
@@ -0,0 +1,116 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// twoStepPackets returns Sync, Follow_Up and Delay_Resp carrying t1 and t4
+func twoStepPackets(t1, t4 time.Time) (*SyncDelayReq, *FollowUp, *DelayResp) {
+	sync := &SyncDelayReq{}
+	fu := &FollowUp{FollowUpBody: FollowUpBody{PreciseOriginTimestamp: NewTimestamp(t1)}}
+	resp := &DelayResp{DelayRespBody: DelayRespBody{ReceiveTimestamp: NewTimestamp(t4)}}
+	return sync, fu, resp
+}
+
+func TestTwoStepOffset(t *testing.T) {
+	// client is 2µs ahead of the server, path delay is 10µs each way
+	t1 := time.Unix(1653574589, 806127000)
+	t2 := t1.Add(12 * time.Microsecond)
+	t3 := t2.Add(500 * time.Microsecond)
+	t4 := t3.Add(8 * time.Microsecond)
+
+	sync, fu, resp := twoStepPackets(t1, t4)
+	offset, delay := TwoStepOffset(sync, t2, fu, t3, resp)
+	require.Equal(t, 2*time.Microsecond, offset)
+	require.Equal(t, 10*time.Microsecond, delay)
+}
+
+func TestTwoStepOffsetCorrection(t *testing.T) {
+	// transparent clocks add 1µs of residence time to Sync and 2µs to its Follow_Up,
+	// and 4µs to DelayReq reported back in Delay_Resp
+	t1 := time.Unix(1653574589, 806127000)
+	t2 := t1.Add(15 * time.Microsecond)
+	t3 := t2.Add(500 * time.Microsecond)
+	t4 := t3.Add(12 * time.Microsecond)
+
+	sync, fu, resp := twoStepPackets(t1, t4)
+	sync.CorrectionField = NewCorrection(1000)
+	fu.CorrectionField = NewCorrection(2000)
+	resp.CorrectionField = NewCorrection(4000)
+	offset, delay := TwoStepOffset(sync, t2, fu, t3, resp)
+	require.Equal(t, 2*time.Microsecond, offset)
+	require.Equal(t, 10*time.Microsecond, delay)
+}
+
+func TestTwoStepOffsetSubNanosecondCorrection(t *testing.T) {
+	t1 := time.Unix(1653574589, 806127000)
+	t2 := t1.Add(10 * time.Microsecond)
+	t3 := t2.Add(500 * time.Microsecond)
+	t4 := t3.Add(10 * time.Microsecond)
+
+	// 0.75ns correction is 0xc000 in the correctionField, Sync and Follow_Up sum up to 1.5ns
+	sync, fu, resp := twoStepPackets(t1, t4)
+	sync.CorrectionField = Correction(0xc000)
+	fu.CorrectionField = Correction(0xc000)
+	offset, delay := TwoStepOffset(sync, t2, fu, t3, resp)
+	// -0.75ns and 9999.25ns, truncating the corrections first would give 0 and 10000ns
+	require.Equal(t, -1*time.Nanosecond, offset)
+	require.Equal(t, 9999*time.Nanosecond, delay)
+}
+
+func TestTwoStepOffsetCorrectionTooBig(t *testing.T) {
+	t1 := time.Unix(1653574589, 806127000)
+	t2 := t1.Add(12 * time.Microsecond)
+	t3 := t2.Add(500 * time.Microsecond)
+	t4 := t3.Add(8 * time.Microsecond)
+
+	sync, fu, resp := twoStepPackets(t1, t4)
+	sync.CorrectionField = Correction(0x7fffffffffffffff)
+	fu.CorrectionField = Correction(0x7fffffffffffffff)
+	resp.CorrectionField = Correction(0x7fffffffffffffff)
+	offset, delay := TwoStepOffset(sync, t2, fu, t3, resp)
+	require.Equal(t, 2*time.Microsecond, offset)
+	require.Equal(t, 10*time.Microsecond, delay)
+}
+
+func TestTwoStepOffsetDecoded(t *testing.T) {
+	// Follow_Up as sent by ptp4u, with 2.5ns correction
+	raw := []byte{
+		0x08, 0x12, 0x00, 0x2c, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x80, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0xb8, 0xce, 0xf6, 0xff, 0xfe, 0x7b, 0x2c, 0x7a, 0x00, 0x01, 0x00, 0x2a,
+		0x02, 0x00, 0x00, 0x00, 0x62, 0x8f, 0x6d, 0xbd, 0x30, 0x0c, 0x55, 0x98,
+	}
+	fu := &FollowUp{}
+	require.NoError(t, FromBytes(raw, fu))
+	require.Equal(t, 2.5, fu.CorrectionField.Nanoseconds())
+
+	t1 := fu.PreciseOriginTimestamp.Time()
+	t2 := t1.Add(37*time.Second + 10*time.Microsecond + 3*time.Nanosecond)
+	t3 := t2.Add(time.Millisecond)
+	t4 := t3.Add(10*time.Microsecond - 37*time.Second)
+	sync, _, resp := twoStepPackets(t1, t4)
+	offset, delay := TwoStepOffset(sync, t2, fu, t3, resp)
+	// offset = ((37s + 10003ns - 2.5ns) - (10000ns - 37s))/2 = 37s + 0.25ns
+	// delay = ((37s + 10003ns - 2.5ns) + (10000ns - 37s))/2 = 10000.25ns
+	require.Equal(t, 37*time.Second, offset)
+	require.Equal(t, 10000*time.Nanosecond, delay)
+}
@@ -23,6 +23,7 @@ import (
 	"encoding"
 	"encoding/binary"
 	"fmt"
+	"time"
 )
 
 // what version of PTP protocol we implement
@@ -73,6 +74,38 @@ type Header struct {
 
 const headerSize = 34 // bytes
 
+// controlField returns the controlField value for the message type, as per Table 23 of IEEE 1588-2008
+func controlField(msgType MessageType) uint8 {
+	switch msgType {
+	case MessageSync:
+		return 0
+	case MessageDelayReq:
+		return 1
+	case MessageFollowUp:
+		return 2
+	case MessageDelayResp:
+		return 3
+	case MessageManagement:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// NewHeader builds the common header for the message type originating from the given port.
+// MessageLength and LogMessageInterval are message specific and left for the caller to set
+func NewHeader(msgType MessageType, sdoID uint8, domain uint8, flags uint16, sequence uint16, source PortIdentity) Header {
+	return Header{
+		SdoIDAndMsgType:    NewSdoIDAndMsgType(msgType, sdoID),
+		Version:            Version,
+		DomainNumber:       domain,
+		FlagField:          flags,
+		SourcePortIdentity: source,
+		SequenceID:         sequence,
+		ControlField:       controlField(msgType),
+	}
+}
+
 // unmarshalHeader is not a Header.UnmarshalBinary to prevent all packets
 // from having default (and incomplete) UnmarshalBinary implementation through embedding
 func unmarshalHeader(p *Header, b []byte) {
@@ -276,6 +309,19 @@ func (p *SyncDelayReq) UnmarshalBinary(b []byte) error {
 	return nil
 }
 
+// DelayReq is a full Delay_Req packet. It has the same layout as Sync (Table 44)
+type DelayReq = SyncDelayReq
+
+// NewDelayReq builds Delay_Req packet originating from the given port
+func NewDelayReq(source PortIdentity, sequence uint16) *DelayReq {
+	p := &DelayReq{
+		Header: NewHeader(MessageDelayReq, 0, 0, FlagUnicast, sequence, source),
+	}
+	p.MessageLength = uint16(binary.Size(SyncDelayReq{}))
+	p.LogMessageInterval = 0x7f
+	return p
+}
+
 // FollowUpBody Table 45 Follow_Up message fields
 type FollowUpBody struct {
 	PreciseOriginTimestamp Timestamp
@@ -367,6 +413,22 @@ func (p *DelayResp) UnmarshalBinary(b []byte) error {
 	return nil
 }
 
+// NewDelayResp builds Delay_Resp packet in response to the Delay_Req received at rxTS.
+// Sequence, domain, correction and requesting port identity are copied from the request
+func NewDelayResp(req *DelayReq, source PortIdentity, rxTS time.Time) *DelayResp {
+	p := &DelayResp{
+		Header: NewHeader(MessageDelayResp, 0, req.DomainNumber, FlagUnicast, req.SequenceID, source),
+		DelayRespBody: DelayRespBody{
+			ReceiveTimestamp:       NewTimestamp(rxTS),
+			RequestingPortIdentity: req.SourcePortIdentity,
+		},
+	}
+	p.MessageLength = uint16(binary.Size(DelayResp{}))
+	p.CorrectionField = req.CorrectionField
+	p.LogMessageInterval = 0x7f
+	return p
+}
+
 // PDelayReqBody Table 47 Pdelay_Req message fields
 type PDelayReqBody struct {
 	OriginTimestamp Timestamp
@@ -409,17 +471,56 @@ type Packet interface {
 	SetSequence(uint16)
 }
 
+// packetHeader returns the header of the packet, or nil if the packet type is not supported
+func packetHeader(p Packet) *Header {
+	switch v := p.(type) {
+	case *SyncDelayReq:
+		return &v.Header
+	case *FollowUp:
+		return &v.Header
+	case *DelayResp:
+		return &v.Header
+	case *PDelayReq:
+		return &v.Header
+	case *PDelayResp:
+		return &v.Header
+	case *PDelayRespFollowUp:
+		return &v.Header
+	case *Announce:
+		return &v.Header
+	case *Signaling:
+		return &v.Header
+	}
+	return nil
+}
+
+// AddCorrection adds d to the correctionField of the message, e.g. residence time in a transparent clock
+func AddCorrection(msg Packet, d time.Duration) error {
+	h := packetHeader(msg)
+	if h == nil {
+		return fmt.Errorf("unsupported packet type %T", msg)
+	}
+	h.CorrectionField = h.CorrectionField.Add(d)
+	return nil
+}
+
 // BinaryMarshalerTo is an interface implemented by an object that can marshal itself into a binary form into provided []byte
 type BinaryMarshalerTo interface {
 	MarshalBinaryTo([]byte) (int, error)
 }
 
-// BytesTo marhals packets that support this optimized marshalling into []byte
+// BytesTo marhals packets that support this optimized marshalling into []byte.
+// For packets messageLength is set to the number of bytes actually written and
+// controlField to the legacy value of the message type, as some clients are strict about both.
 func BytesTo(p BinaryMarshalerTo, buf []byte) (int, error) {
 	n, err := p.MarshalBinaryTo(buf)
 	if err != nil {
 		return 0, err
 	}
+	if _, ok := p.(Packet); ok && n >= headerSize {
+		binary.BigEndian.PutUint16(buf[2:], uint16(n))
+		buf[32] = controlField(SdoIDAndMsgType(buf[0]).MsgType())
+	}
 	// add two zero bytes
 	buf[n] = 0x0
 	buf[n+1] = 0x0
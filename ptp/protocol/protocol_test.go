@@ -17,8 +17,10 @@ limitations under the License.
 package protocol
 
 import (
+	"encoding"
 	"encoding/binary"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -74,6 +76,39 @@ func TestBytesTo(t *testing.T) {
 	})
 }
 
+func TestBytesToMessageLengthControlField(t *testing.T) {
+	source := PortIdentity{PortNumber: 1, ClockIdentity: 36138748164966842}
+	buf := make([]byte, 512)
+
+	sync := &SyncDelayReq{Header: NewHeader(MessageSync, 0, 0, FlagUnicast, 1, source)}
+	sync.MessageLength = 0
+	sync.ControlField = 5
+	n, err := BytesTo(sync, buf)
+	require.NoError(t, err)
+	require.Equal(t, uint16(44), binary.BigEndian.Uint16(buf[2:]))
+	require.Equal(t, uint8(0), buf[32])
+	require.Equal(t, 46, n)
+
+	// messageLength must account for TLVs as well
+	announce := &Announce{Header: NewHeader(MessageAnnounce, 0, 0, FlagUnicast, 1, source)}
+	announce.MessageLength = uint16(headerSize + 30)
+	announce.TLVs = []TLV{
+		&PathTraceTLV{
+			TLVHead:      TLVHead{TLVType: TLVPathTrace, LengthField: 8},
+			PathSequence: []ClockIdentity{source.ClockIdentity},
+		},
+	}
+	n, err = BytesTo(announce, buf)
+	require.NoError(t, err)
+	require.Equal(t, uint16(headerSize+30+12), binary.BigEndian.Uint16(buf[2:]))
+	require.Equal(t, uint8(5), buf[32])
+	require.Equal(t, headerSize+30+12+2, n)
+
+	got := &Announce{}
+	require.NoError(t, FromBytes(buf[:n], got))
+	require.Equal(t, uint16(headerSize+30+12), got.MessageLength)
+}
+
 func TestParseSync(t *testing.T) {
 	raw := []uint8{
 		0x10, 0x02, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
@@ -321,6 +356,78 @@ func TestParseDelayResp(t *testing.T) {
 	assert.Equal(t, &want, pp)
 }
 
+func TestDelayReqRoundTrip(t *testing.T) {
+	source := PortIdentity{PortNumber: 1, ClockIdentity: 13283824497738493774}
+	req := NewDelayReq(source, 10)
+	req.CorrectionField = NewCorrection(100)
+	b, err := Bytes(req)
+	require.Nil(t, err)
+
+	got := &DelayReq{}
+	err = FromBytes(b, got)
+	require.Nil(t, err)
+	require.Equal(t, req, got)
+	require.Equal(t, MessageDelayReq, got.MessageType())
+}
+
+func TestNewDelayRespRoundTrip(t *testing.T) {
+	client := PortIdentity{PortNumber: 1, ClockIdentity: 13283824497738493774}
+	server := PortIdentity{PortNumber: 1, ClockIdentity: 36138748164966842}
+	req := NewDelayReq(client, 10)
+	req.DomainNumber = 24
+	req.CorrectionField = NewCorrection(100)
+	rxTS := time.Unix(1169232218, 73257582)
+
+	resp := NewDelayResp(req, server, rxTS)
+	b, err := Bytes(resp)
+	require.Nil(t, err)
+
+	pp, err := DecodePacket(b)
+	require.Nil(t, err)
+	got, ok := pp.(*DelayResp)
+	require.True(t, ok)
+	require.Equal(t, MessageDelayResp, got.MessageType())
+	require.Equal(t, uint16(10), got.SequenceID)
+	require.Equal(t, uint8(24), got.DomainNumber)
+	require.Equal(t, req.CorrectionField, got.CorrectionField)
+	require.Equal(t, server, got.SourcePortIdentity)
+	require.Equal(t, client, got.RequestingPortIdentity)
+	require.Equal(t, rxTS, got.ReceiveTimestamp.Time())
+}
+
+func TestNewHeader(t *testing.T) {
+	source := PortIdentity{PortNumber: 1, ClockIdentity: 36138748164966842}
+	tests := []struct {
+		msgType MessageType
+		flags   uint16
+		control uint8
+	}{
+		{msgType: MessageSync, flags: FlagUnicast | FlagTwoStep, control: 0},
+		{msgType: MessageDelayReq, flags: FlagUnicast, control: 1},
+		{msgType: MessageFollowUp, flags: FlagUnicast, control: 2},
+		{msgType: MessageDelayResp, flags: FlagUnicast, control: 3},
+		{msgType: MessageManagement, flags: 0, control: 4},
+		{msgType: MessageAnnounce, flags: FlagUnicast | FlagPTPTimescale, control: 5},
+		{msgType: MessageSignaling, flags: FlagUnicast, control: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.msgType.String(), func(t *testing.T) {
+			want := Header{
+				SdoIDAndMsgType:    NewSdoIDAndMsgType(tt.msgType, 1),
+				Version:            Version,
+				DomainNumber:       24,
+				FlagField:          tt.flags,
+				SourcePortIdentity: source,
+				SequenceID:         10,
+				ControlField:       tt.control,
+			}
+			got := NewHeader(tt.msgType, 1, 24, tt.flags, 10, source)
+			require.Equal(t, want, got)
+			require.Equal(t, tt.msgType, got.MessageType())
+		})
+	}
+}
+
 func BenchmarkReadSyncDelay(b *testing.B) {
 	raw := []uint8{
 		0x12, 0x02, 0x00, 0x36, 0x00, 0x00, 0x00, 0x00,
@@ -553,3 +660,55 @@ func FuzzDecodePacket(f *testing.F) {
 		}
 	})
 }
+
+func FuzzParseMessage(f *testing.F) {
+	for _, seed := range [][]byte{{}, {0}, {9}, {0x0b, 0x02}, {0x0c, 0x02, 0x00, 0x2c}, {0x0d, 0x02, 0x00, 0x30}} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		// none of these may panic on arbitrary input, errors are fine
+		for _, p := range []encoding.BinaryUnmarshaler{
+			&Announce{},
+			&SyncDelayReq{},
+			&FollowUp{},
+			&DelayResp{},
+			&Signaling{},
+			&Management{},
+			&ManagementMsgErrorStatus{},
+			new(PTPText),
+			&PortAddress{},
+			&UnicastMasterEntry{},
+			&RequestUnicastTransmissionTLV{},
+			&GrantUnicastTransmissionTLV{},
+			&CancelUnicastTransmissionTLV{},
+			&AcknowledgeCancelUnicastTransmissionTLV{},
+			&PathTraceTLV{},
+			&AlternateTimeOffsetIndicatorTLV{},
+		} {
+			_ = p.UnmarshalBinary(b)
+		}
+		_, _ = DecodePacket(b)
+	})
+}
+
+func TestAddCorrectionRoundTrip(t *testing.T) {
+	sync := &SyncDelayReq{
+		Header: Header{
+			SdoIDAndMsgType: NewSdoIDAndMsgType(MessageSync, 0),
+			Version:         Version,
+			MessageLength:   44,
+			CorrectionField: NewCorrection(123.456),
+		},
+	}
+	require.NoError(t, AddCorrection(sync, 2*time.Nanosecond))
+
+	b, err := Bytes(sync)
+	require.NoError(t, err)
+	got := &SyncDelayReq{}
+	require.NoError(t, FromBytes(b, got))
+	// fractions of nanosecond survive the wire within the 2^-16 ns resolution
+	require.InDelta(t, 125.456, got.CorrectionField.Nanoseconds(), 1.0/twoPow16)
+	require.Equal(t, sync.CorrectionField, got.CorrectionField)
+
+	require.Error(t, AddCorrection(&Management{}, time.Nanosecond))
+}
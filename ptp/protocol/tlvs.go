@@ -92,6 +92,10 @@ func writeTLVs(tlvs []TLV, b []byte) (int, error) {
 }
 
 func readTLVs(tlvs []TLV, maxLength int, b []byte) ([]TLV, error) {
+	// never trust the length from the header more than the actual buffer
+	if maxLength > len(b) {
+		maxLength = len(b)
+	}
 	pos := 0
 	var tlvType TLVType
 	for {
@@ -307,14 +311,13 @@ func (t *PathTraceTLV) UnmarshalBinary(b []byte) error {
 	if err := checkTLVLength(&t.TLVHead, len(b), 8, false); err != nil {
 		return err
 	}
-	t.PathSequence = []ClockIdentity{}
-	for i := 0; i*8 <= int(t.TLVHead.LengthField); i++ {
-		pos := tlvHeadSize + i*8
-		if pos+8 >= len(b) {
-			break
-		}
-		identity := ClockIdentity(binary.BigEndian.Uint64(b[pos:]))
-		t.PathSequence = append(t.PathSequence, identity)
+	if t.LengthField%8 != 0 {
+		return fmt.Errorf("PathTraceTLV length %d is not a multiple of 8", t.LengthField)
+	}
+	n := int(t.LengthField) / 8
+	t.PathSequence = make([]ClockIdentity, n)
+	for i := 0; i < n; i++ {
+		t.PathSequence[i] = ClockIdentity(binary.BigEndian.Uint64(b[tlvHeadSize+i*8:]))
 	}
 	return nil
 }
@@ -360,7 +363,8 @@ func (t *AlternateTimeOffsetIndicatorTLV) UnmarshalBinary(b []byte) error {
 	t.CurrentOffset = int32(binary.BigEndian.Uint32(b[tlvHeadSize+1:]))
 	t.JumpSeconds = int32(binary.BigEndian.Uint32(b[tlvHeadSize+5:]))
 	copy(t.TimeOfNextJump[:], b[tlvHeadSize+9:]) // uint48
-	if err := t.DisplayName.UnmarshalBinary(b[tlvHeadSize+15:]); err != nil {
+	// DisplayName must fit into the TLV itself
+	if err := t.DisplayName.UnmarshalBinary(b[tlvHeadSize+15 : tlvHeadSize+int(t.LengthField)]); err != nil {
 		return fmt.Errorf("reading AlternateTimeOffsetIndicatorTLV DisplayName: %w", err)
 	}
 	return nil
@@ -149,3 +149,30 @@ func TestParseAnnounceWithAlternateTimeOffsetIndicator(t *testing.T) {
 	require.Nil(t, err)
 	assert.Equal(t, &want, pp)
 }
+
+func TestPathTraceTLVLength(t *testing.T) {
+	// no trailing bytes after the last entry
+	raw := []byte{0x00, 0x08, 0x00, 0x10, 0x08, 0xc0, 0xeb, 0xff, 0xfe, 0x63, 0x7a, 0x4e, 0x01, 0xb6, 0xaf, 0xc4, 0xe5, 0x46, 0x12, 0x29}
+	tlv := &PathTraceTLV{}
+	require.NoError(t, tlv.UnmarshalBinary(raw))
+	require.Equal(t, []ClockIdentity{630763432548989518, 123479299994292777}, tlv.PathSequence)
+
+	// length is not 8N
+	raw[3] = 0x0c
+	require.Error(t, tlv.UnmarshalBinary(raw))
+	// length is past the buffer
+	raw[3] = 0x18
+	require.Error(t, tlv.UnmarshalBinary(raw))
+}
+
+func TestAlternateTimeOffsetIndicatorTLVDisplayNameLength(t *testing.T) {
+	raw := []byte{0x00, 0x09, 0x00, 0x14, 0x01, 0x00, 0x00, 0x00, 0x25, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x62, 0xc2, 0xfd, 0xb6, 0x03, 0x50, 0x54, 0x50, 0x00}
+	tlv := &AlternateTimeOffsetIndicatorTLV{}
+	require.NoError(t, tlv.UnmarshalBinary(raw))
+	require.Equal(t, PTPText("PTP"), tlv.DisplayName)
+
+	// DisplayName doesn't fit into the TLV even though there are enough bytes after it
+	raw[19] = 0x05
+	raw = append(raw, 0x00, 0x00)
+	require.Error(t, tlv.UnmarshalBinary(raw))
+}
@@ -22,6 +22,8 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -175,6 +177,20 @@ func (t Correction) TooBig() bool {
 	return t == 0x7fffffffffffffff // one in all bits, except the most significant
 }
 
+// Add returns Correction increased by d, which is scaled by 2^16 without losing the fractions of nanosecond.
+// Result is too big to be represented if it overflows or the Correction already was too big
+func (t Correction) Add(d time.Duration) Correction {
+	if t.TooBig() || int64(d) > math.MaxInt64/twoPow16 || int64(d) < math.MinInt64/twoPow16 {
+		return Correction(0x7fffffffffffffff)
+	}
+	delta := int64(d) * twoPow16
+	sum := int64(t) + delta
+	if (delta > 0 && sum < int64(t)) || (delta < 0 && sum > int64(t)) {
+		return Correction(0x7fffffffffffffff)
+	}
+	return Correction(sum)
+}
+
 // NewCorrection returns Correction built from Nanoseconds
 func NewCorrection(ns float64) Correction {
 	t := ns * twoPow16
@@ -211,11 +227,13 @@ func (c ClockIdentity) MAC() net.HardwareAddr {
 	return mac
 }
 
-// NewClockIdentity creates new ClockIdentity from MAC address
-func NewClockIdentity(mac net.HardwareAddr) (ClockIdentity, error) {
+// ClockIdentityFromMAC derives ClockIdentity from MAC address as per IEEE 1588-2019 7.5.2.2.2:
+// EUI-48 is turned into EUI-64 by inserting 0xFFFE in the middle, EUI-64 is used as is.
+// Zero ClockIdentity is returned for any other address length
+func ClockIdentityFromMAC(mac net.HardwareAddr) ClockIdentity {
 	b := [8]byte{}
-	macLen := len(mac)
-	if macLen == 6 { // EUI-48
+	switch len(mac) {
+	case 6: // EUI-48
 		b[0] = mac[0]
 		b[1] = mac[1]
 		b[2] = mac[2]
@@ -224,12 +242,33 @@ func NewClockIdentity(mac net.HardwareAddr) (ClockIdentity, error) {
 		b[5] = mac[3]
 		b[6] = mac[4]
 		b[7] = mac[5]
-	} else if macLen == 8 { // EUI-64
+	case 8: // EUI-64
 		copy(b[:], mac)
-	} else {
+	default:
+		return 0
+	}
+	return ClockIdentity(binary.BigEndian.Uint64(b[:]))
+}
+
+// NewClockIdentity creates new ClockIdentity from MAC address
+func NewClockIdentity(mac net.HardwareAddr) (ClockIdentity, error) {
+	if len(mac) != 6 && len(mac) != 8 {
 		return 0, fmt.Errorf("unsupported MAC %v, must be either EUI48 or EUI64", mac)
 	}
-	return ClockIdentity(binary.BigEndian.Uint64(b[:])), nil
+	return ClockIdentityFromMAC(mac), nil
+}
+
+// ParseClockIdentity parses ClockIdentity formatted the same way ptp4l pmc client does, e.g. 0c42a1.fffe.6d7ca6
+func ParseClockIdentity(s string) (ClockIdentity, error) {
+	raw := strings.ReplaceAll(s, ".", "")
+	if len(raw) != 16 {
+		return 0, fmt.Errorf("invalid clock identity %q", s)
+	}
+	v, err := strconv.ParseUint(raw, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid clock identity %q: %w", s, err)
+	}
+	return ClockIdentity(v), nil
 }
 
 // The PortIdentity type identifies a PTP Port or a Link Port
@@ -342,6 +381,33 @@ const (
 	ClockClassSlaveOnly ClockClass = 255
 )
 
+// ClockClassToString is a map from ClockClass to string, Table 4 clockClass specifications
+var ClockClassToString = map[ClockClass]string{
+	ClockClass6:         "locked to primary reference, PTP timescale",
+	ClockClass7:         "holdover within specification, PTP timescale",
+	ClockClass13:        "locked to application-specific source, ARB timescale",
+	ClockClass14:        "holdover within specification, ARB timescale",
+	ClockClass52:        "degradation alternative A, PTP timescale",
+	ClockClass58:        "degradation alternative A, ARB timescale",
+	187:                 "degradation alternative B, PTP timescale",
+	193:                 "degradation alternative B, ARB timescale",
+	248:                 "default",
+	251:                 "version 1 compatibility",
+	ClockClassSlaveOnly: "slave-only",
+}
+
+// String returns a description of the clock class. Values not in the table are either
+// reserved or defined by alternate PTP profiles, e.g. 135-165 of telecom profiles
+func (c ClockClass) String() string {
+	if s, ok := ClockClassToString[c]; ok {
+		return s
+	}
+	if (c >= 68 && c <= 122) || (c >= 133 && c <= 170) || (c >= 216 && c <= 232) {
+		return fmt.Sprintf("alternate PTP profile (%d)", uint8(c))
+	}
+	return fmt.Sprintf("reserved (%d)", uint8(c))
+}
+
 // ClockAccuracy represents a PTP clock accuracy
 type ClockAccuracy uint8
 
@@ -369,6 +435,50 @@ const (
 	ClockAccuracyUnknown            ClockAccuracy = 0xFE
 )
 
+// ClockAccuracyToString is a map from ClockAccuracy to string, Table 5 clockAccuracy enumeration
+var ClockAccuracyToString = map[ClockAccuracy]string{
+	0x17:                            "within 1ps",
+	0x18:                            "within 2.5ps",
+	0x19:                            "within 10ps",
+	0x1A:                            "within 25ps",
+	0x1B:                            "within 100ps",
+	0x1C:                            "within 250ps",
+	0x1D:                            "within 1ns",
+	0x1E:                            "within 2.5ns",
+	0x1F:                            "within 10ns",
+	ClockAccuracyNanosecond25:       "within 25ns",
+	ClockAccuracyNanosecond100:      "within 100ns",
+	ClockAccuracyNanosecond250:      "within 250ns",
+	ClockAccuracyMicrosecond1:       "within 1µs",
+	ClockAccuracyMicrosecond2point5: "within 2.5µs",
+	ClockAccuracyMicrosecond10:      "within 10µs",
+	ClockAccuracyMicrosecond25:      "within 25µs",
+	ClockAccuracyMicrosecond100:     "within 100µs",
+	ClockAccuracyMicrosecond250:     "within 250µs",
+	ClockAccuracyMillisecond1:       "within 1ms",
+	ClockAccuracyMillisecond2point5: "within 2.5ms",
+	ClockAccuracyMillisecond10:      "within 10ms",
+	ClockAccuracyMillisecond25:      "within 25ms",
+	ClockAccuracyMillisecond100:     "within 100ms",
+	ClockAccuracyMillisecond250:     "within 250ms",
+	ClockAccuracySecond1:            "within 1s",
+	ClockAccuracySecond10:           "within 10s",
+	ClockAccuracySecondGreater10:    "greater than 10s",
+	ClockAccuracyUnknown:            "unknown",
+}
+
+// String returns a description of the clock accuracy. Values not in the table are either
+// reserved or defined by alternate PTP profiles
+func (c ClockAccuracy) String() string {
+	if s, ok := ClockAccuracyToString[c]; ok {
+		return s
+	}
+	if c >= 0x80 && c <= 0xFD {
+		return fmt.Sprintf("alternate PTP profile (0x%02X)", uint8(c))
+	}
+	return fmt.Sprintf("reserved (0x%02X)", uint8(c))
+}
+
 // ClockAccuracyFromOffset returns PTP Clock Accuracy covering the time.Duration
 func ClockAccuracyFromOffset(offset time.Duration) ClockAccuracy {
 	if offset < 0 {
@@ -545,8 +655,8 @@ func (p *PTPText) UnmarshalBinary(rawBytes []byte) error {
 		return nil
 	}
 
-	if len(rawBytes) < int(length+1) {
-		return fmt.Errorf("text field is too short, need %d got %d", len(rawBytes), length+1)
+	if len(rawBytes) < int(length)+1 {
+		return fmt.Errorf("text field is too short, need %d got %d", int(length)+1, len(rawBytes))
 	}
 	text := make([]byte, length)
 	if err := binary.Read(reader, binary.BigEndian, text); err != nil {
@@ -661,7 +771,7 @@ func (p *PortAddress) UnmarshalBinary(b []byte) error {
 		return fmt.Errorf("not enough data to decode PortAddress address")
 	}
 	p.AddressField = make([]byte, p.AddressLength)
-	copy(p.AddressField, b[4:4+p.AddressLength])
+	copy(p.AddressField, b[4:4+int(p.AddressLength)])
 	return nil
 }
 
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -265,6 +266,21 @@ func TestCorrection(t *testing.T) {
 	}
 }
 
+func TestCorrectionAdd(t *testing.T) {
+	c := NewCorrection(123.456)
+	require.Equal(t, Correction(0x7b74bc), c)
+
+	got := c.Add(time.Microsecond)
+	require.InDelta(t, 1123.456, got.Nanoseconds(), 1.0/twoPow16)
+	got = got.Add(-time.Microsecond)
+	require.Equal(t, c, got)
+
+	tooBig := Correction(0x7fffffffffffffff)
+	require.True(t, tooBig.Add(time.Nanosecond).TooBig())
+	require.True(t, c.Add(50*time.Hour).TooBig())
+	require.True(t, NewCorrection(float64(39*time.Hour)).Add(time.Hour).TooBig())
+}
+
 func TestLogInterval(t *testing.T) {
 	tests := []struct {
 		in   LogInterval
@@ -318,6 +334,44 @@ func TestClockIdentity(t *testing.T) {
 	assert.Equal(t, mac, back)
 }
 
+func TestClockIdentityFromMAC(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ClockIdentity
+	}{
+		{in: "00:1b:21:3a:4c:5d", want: 0x001b21fffe3a4c5d},
+		{in: "b8:ce:f6:01:02:03", want: 0xb8cef6fffe010203},
+		{in: "00:1b:21:ff:fe:3a:4c:5d", want: 0x001b21fffe3a4c5d},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			mac, err := net.ParseMAC(tt.in)
+			require.Nil(t, err)
+			assert.Equal(t, tt.want, ClockIdentityFromMAC(mac))
+		})
+	}
+	// no MAC, e.g. loopback interface
+	assert.Equal(t, ClockIdentity(0), ClockIdentityFromMAC(nil))
+	_, err := NewClockIdentity(nil)
+	require.Error(t, err)
+}
+
+func TestParseClockIdentity(t *testing.T) {
+	got, err := ParseClockIdentity("0c42a1.fffe.6d7ca6")
+	require.Nil(t, err)
+	assert.Equal(t, ClockIdentity(0xc42a1fffe6d7ca6), got)
+	assert.Equal(t, "0c42a1.fffe.6d7ca6", got.String())
+
+	got, err = ParseClockIdentity("0c42a1fffe6d7ca6")
+	require.Nil(t, err)
+	assert.Equal(t, ClockIdentity(0xc42a1fffe6d7ca6), got)
+
+	_, err = ParseClockIdentity("0c42a1.fffe")
+	require.Error(t, err)
+	_, err = ParseClockIdentity("0c42a1.fffe.6d7cxx")
+	require.Error(t, err)
+}
+
 func TestPTPText(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -532,3 +586,73 @@ func TestClockAccuracyToDuration(t *testing.T) {
 	require.Equal(t, time.Second*10, ClockAccuracySecond10.Duration())
 	require.Equal(t, time.Second*25, ClockAccuracySecondGreater10.Duration())
 }
+
+func TestClockAccuracyString(t *testing.T) {
+	tests := []struct {
+		in   ClockAccuracy
+		want string
+	}{
+		{in: 0x17, want: "within 1ps"},
+		{in: 0x1E, want: "within 2.5ns"},
+		{in: ClockAccuracyNanosecond25, want: "within 25ns"},
+		{in: ClockAccuracyNanosecond100, want: "within 100ns"},
+		{in: ClockAccuracyMicrosecond2point5, want: "within 2.5µs"},
+		{in: ClockAccuracyMillisecond250, want: "within 250ms"},
+		{in: ClockAccuracySecond10, want: "within 10s"},
+		{in: ClockAccuracySecondGreater10, want: "greater than 10s"},
+		{in: ClockAccuracyUnknown, want: "unknown"},
+		{in: 0x00, want: "reserved (0x00)"},
+		{in: 0x16, want: "reserved (0x16)"},
+		{in: 0x32, want: "reserved (0x32)"},
+		{in: 0x7F, want: "reserved (0x7F)"},
+		{in: 0x80, want: "alternate PTP profile (0x80)"},
+		{in: 0xFD, want: "alternate PTP profile (0xFD)"},
+		{in: 0xFF, want: "reserved (0xFF)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.in.String())
+		})
+	}
+	for c := range ClockAccuracyToString {
+		require.False(t, strings.HasPrefix(c.String(), "reserved"))
+	}
+	require.Equal(t, "within 100ns", fmt.Sprintf("%v", ClockAccuracyNanosecond100))
+}
+
+func TestClockClassString(t *testing.T) {
+	tests := []struct {
+		in   ClockClass
+		want string
+	}{
+		{in: ClockClass6, want: "locked to primary reference, PTP timescale"},
+		{in: ClockClass7, want: "holdover within specification, PTP timescale"},
+		{in: ClockClass13, want: "locked to application-specific source, ARB timescale"},
+		{in: ClockClass14, want: "holdover within specification, ARB timescale"},
+		{in: ClockClass52, want: "degradation alternative A, PTP timescale"},
+		{in: ClockClass58, want: "degradation alternative A, ARB timescale"},
+		{in: 187, want: "degradation alternative B, PTP timescale"},
+		{in: 193, want: "degradation alternative B, ARB timescale"},
+		{in: 248, want: "default"},
+		{in: 251, want: "version 1 compatibility"},
+		{in: ClockClassSlaveOnly, want: "slave-only"},
+		{in: 0, want: "reserved (0)"},
+		{in: 8, want: "reserved (8)"},
+		{in: 67, want: "reserved (67)"},
+		{in: 68, want: "alternate PTP profile (68)"},
+		{in: 122, want: "alternate PTP profile (122)"},
+		{in: 127, want: "reserved (127)"},
+		{in: 135, want: "alternate PTP profile (135)"},
+		{in: 165, want: "alternate PTP profile (165)"},
+		{in: 171, want: "reserved (171)"},
+		{in: 216, want: "alternate PTP profile (216)"},
+		{in: 232, want: "alternate PTP profile (232)"},
+		{in: 233, want: "reserved (233)"},
+		{in: 254, want: "reserved (254)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.in.String())
+		})
+	}
+}
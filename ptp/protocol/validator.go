@@ -0,0 +1,169 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"fmt"
+)
+
+// ViolationType is a type of protocol invariant violation found by Validator
+type ViolationType uint8
+
+// Violation types reported by Validator
+const (
+	// ViolationSequence is a sequenceId which didn't increase since the previous message of the same type from the same port
+	ViolationSequence ViolationType = iota
+	// ViolationMissingFollowUp is a two-step Sync which wasn't followed by a Follow_Up
+	ViolationMissingFollowUp
+	// ViolationFollowUpWithoutSync is a Follow_Up with no preceding two-step Sync
+	ViolationFollowUpWithoutSync
+	// ViolationFollowUpSequence is a Follow_Up with a sequenceId different from the preceding Sync
+	ViolationFollowUpSequence
+	// ViolationDelayRespWithoutDelayReq is a Delay_Resp which doesn't answer any Delay_Req
+	ViolationDelayRespWithoutDelayReq
+	// ViolationMissingDelayResp is a Delay_Req which wasn't answered by a Delay_Resp
+	ViolationMissingDelayResp
+)
+
+// ViolationTypeToString is a map from ViolationType to string
+var ViolationTypeToString = map[ViolationType]string{
+	ViolationSequence:                 "SEQUENCE",
+	ViolationMissingFollowUp:          "MISSING_FOLLOW_UP",
+	ViolationFollowUpWithoutSync:      "FOLLOW_UP_WITHOUT_SYNC",
+	ViolationFollowUpSequence:         "FOLLOW_UP_SEQUENCE",
+	ViolationDelayRespWithoutDelayReq: "DELAY_RESP_WITHOUT_DELAY_REQ",
+	ViolationMissingDelayResp:         "MISSING_DELAY_RESP",
+}
+
+func (t ViolationType) String() string {
+	return ViolationTypeToString[t]
+}
+
+// Violation describes a single protocol invariant violation
+type Violation struct {
+	Type        ViolationType
+	MessageType MessageType
+	// Port is a source port of the offending message, or requesting port for Delay_Req/Delay_Resp pairing
+	Port       PortIdentity
+	SequenceID uint16
+	// Expected is a sequenceId the message was expected to have or to follow, where applicable
+	Expected uint16
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s from %s seq %d (expected %d)", v.Type, v.MessageType, v.Port, v.SequenceID, v.Expected)
+}
+
+type sequenceKey struct {
+	port    PortIdentity
+	msgType MessageType
+}
+
+type delayReqKey struct {
+	port PortIdentity
+	seq  uint16
+}
+
+// Validator checks invariants of a stream of parsed PTP messages:
+// sequenceId increases per port and message type (modulo 2^16),
+// every two-step Sync is followed by a Follow_Up with the same sequenceId
+// and every Delay_Resp answers a previously seen Delay_Req.
+// Unicast servers keep sequences per client, so the stream should be the view of a single client.
+type Validator struct {
+	lastSeq     map[sequenceKey]uint16
+	pendingSync map[PortIdentity]uint16
+	pendingReq  map[delayReqKey]struct{}
+}
+
+// NewValidator returns a new Validator
+func NewValidator() *Validator {
+	return &Validator{
+		lastSeq:     make(map[sequenceKey]uint16),
+		pendingSync: make(map[PortIdentity]uint16),
+		pendingReq:  make(map[delayReqKey]struct{}),
+	}
+}
+
+// Check validates the next message of the stream and returns violations it caused.
+// Messages of unsupported types are ignored
+func (v *Validator) Check(p Packet) []Violation {
+	h := packetHeader(p)
+	if h == nil {
+		return nil
+	}
+	var res []Violation
+	msgType := h.MessageType()
+	port := h.SourcePortIdentity
+	seq := h.SequenceID
+
+	key := sequenceKey{port: port, msgType: msgType}
+	if last, ok := v.lastSeq[key]; ok {
+		// sequenceId wraps around, anything within a half of the space ahead is an increase
+		if diff := seq - last; diff == 0 || diff >= 0x8000 {
+			res = append(res, Violation{Type: ViolationSequence, MessageType: msgType, Port: port, SequenceID: seq, Expected: last + 1})
+		}
+	}
+	v.lastSeq[key] = seq
+
+	switch msgType {
+	case MessageSync:
+		if prev, ok := v.pendingSync[port]; ok {
+			res = append(res, Violation{Type: ViolationMissingFollowUp, MessageType: MessageSync, Port: port, SequenceID: prev, Expected: prev})
+			delete(v.pendingSync, port)
+		}
+		if h.FlagField&FlagTwoStep != 0 {
+			v.pendingSync[port] = seq
+		}
+	case MessageFollowUp:
+		syncSeq, ok := v.pendingSync[port]
+		if !ok {
+			res = append(res, Violation{Type: ViolationFollowUpWithoutSync, MessageType: msgType, Port: port, SequenceID: seq, Expected: seq})
+			break
+		}
+		if seq != syncSeq {
+			res = append(res, Violation{Type: ViolationFollowUpSequence, MessageType: msgType, Port: port, SequenceID: seq, Expected: syncSeq})
+		}
+		delete(v.pendingSync, port)
+	case MessageDelayReq:
+		v.pendingReq[delayReqKey{port: port, seq: seq}] = struct{}{}
+	case MessageDelayResp:
+		requesting := p.(*DelayResp).RequestingPortIdentity
+		reqKey := delayReqKey{port: requesting, seq: seq}
+		if _, ok := v.pendingReq[reqKey]; !ok {
+			res = append(res, Violation{Type: ViolationDelayRespWithoutDelayReq, MessageType: msgType, Port: requesting, SequenceID: seq, Expected: seq})
+			break
+		}
+		delete(v.pendingReq, reqKey)
+	}
+	return res
+}
+
+// Flush returns violations for two-step Syncs still waiting for a Follow_Up
+// and Delay_Reqs still waiting for a Delay_Resp, and forgets them.
+// Call it at the end of the stream
+func (v *Validator) Flush() []Violation {
+	var res []Violation
+	for port, seq := range v.pendingSync {
+		res = append(res, Violation{Type: ViolationMissingFollowUp, MessageType: MessageSync, Port: port, SequenceID: seq, Expected: seq})
+	}
+	for k := range v.pendingReq {
+		res = append(res, Violation{Type: ViolationMissingDelayResp, MessageType: MessageDelayReq, Port: k.port, SequenceID: k.seq, Expected: k.seq})
+	}
+	v.pendingSync = make(map[PortIdentity]uint16)
+	v.pendingReq = make(map[delayReqKey]struct{})
+	return res
+}
@@ -0,0 +1,148 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	validatorServer = PortIdentity{ClockIdentity: 0x1, PortNumber: 1}
+	validatorClient = PortIdentity{ClockIdentity: 0x2, PortNumber: 1}
+)
+
+func validatorSync(seq uint16, twoStep bool) *SyncDelayReq {
+	p := &SyncDelayReq{
+		Header: Header{
+			SdoIDAndMsgType:    NewSdoIDAndMsgType(MessageSync, 0),
+			SourcePortIdentity: validatorServer,
+			SequenceID:         seq,
+		},
+	}
+	if twoStep {
+		p.FlagField = FlagTwoStep
+	}
+	return p
+}
+
+func validatorFollowUp(seq uint16) *FollowUp {
+	return &FollowUp{
+		Header: Header{
+			SdoIDAndMsgType:    NewSdoIDAndMsgType(MessageFollowUp, 0),
+			SourcePortIdentity: validatorServer,
+			SequenceID:         seq,
+		},
+	}
+}
+
+func validatorDelayResp(requesting PortIdentity, seq uint16) *DelayResp {
+	return &DelayResp{
+		Header: Header{
+			SdoIDAndMsgType:    NewSdoIDAndMsgType(MessageDelayResp, 0),
+			SourcePortIdentity: validatorServer,
+			SequenceID:         seq,
+		},
+		DelayRespBody: DelayRespBody{RequestingPortIdentity: requesting},
+	}
+}
+
+func TestValidatorValidStream(t *testing.T) {
+	v := NewValidator()
+	for _, seq := range []uint16{0xfffe, 0xffff, 0, 1} {
+		require.Empty(t, v.Check(validatorSync(seq, true)))
+		require.Empty(t, v.Check(validatorFollowUp(seq)))
+		require.Empty(t, v.Check(NewDelayReq(validatorClient, seq)))
+		require.Empty(t, v.Check(validatorDelayResp(validatorClient, seq)))
+	}
+	// one-step Sync needs no Follow_Up
+	require.Empty(t, v.Check(validatorSync(2, false)))
+	// unsupported packets are ignored
+	require.Empty(t, v.Check(&Management{}))
+	require.Empty(t, v.Flush())
+}
+
+func TestValidatorSequence(t *testing.T) {
+	v := NewValidator()
+	require.Empty(t, v.Check(NewDelayReq(validatorClient, 10)))
+	require.Empty(t, v.Check(validatorDelayResp(validatorClient, 10)))
+
+	want := []Violation{{Type: ViolationSequence, MessageType: MessageDelayReq, Port: validatorClient, SequenceID: 10, Expected: 11}}
+	require.Equal(t, want, v.Check(NewDelayReq(validatorClient, 10)))
+	want = []Violation{{Type: ViolationSequence, MessageType: MessageDelayReq, Port: validatorClient, SequenceID: 5, Expected: 11}}
+	require.Equal(t, want, v.Check(NewDelayReq(validatorClient, 5)))
+
+	// sequences are tracked per port
+	other := PortIdentity{ClockIdentity: 0x3, PortNumber: 1}
+	require.Empty(t, v.Check(NewDelayReq(other, 1)))
+}
+
+func TestValidatorMissingFollowUp(t *testing.T) {
+	v := NewValidator()
+	require.Empty(t, v.Check(validatorSync(1, true)))
+	want := []Violation{{Type: ViolationMissingFollowUp, MessageType: MessageSync, Port: validatorServer, SequenceID: 1, Expected: 1}}
+	require.Equal(t, want, v.Check(validatorSync(2, true)))
+
+	want = []Violation{{Type: ViolationMissingFollowUp, MessageType: MessageSync, Port: validatorServer, SequenceID: 2, Expected: 2}}
+	require.Equal(t, want, v.Flush())
+	require.Empty(t, v.Flush())
+}
+
+func TestValidatorFollowUpWithoutSync(t *testing.T) {
+	v := NewValidator()
+	want := []Violation{{Type: ViolationFollowUpWithoutSync, MessageType: MessageFollowUp, Port: validatorServer, SequenceID: 1, Expected: 1}}
+	require.Equal(t, want, v.Check(validatorFollowUp(1)))
+
+	// one-step Sync doesn't expect a Follow_Up
+	require.Empty(t, v.Check(validatorSync(2, false)))
+	want = []Violation{{Type: ViolationFollowUpWithoutSync, MessageType: MessageFollowUp, Port: validatorServer, SequenceID: 2, Expected: 2}}
+	require.Equal(t, want, v.Check(validatorFollowUp(2)))
+}
+
+func TestValidatorFollowUpSequence(t *testing.T) {
+	v := NewValidator()
+	require.Empty(t, v.Check(validatorSync(42, true)))
+	want := []Violation{{Type: ViolationFollowUpSequence, MessageType: MessageFollowUp, Port: validatorServer, SequenceID: 43, Expected: 42}}
+	require.Equal(t, want, v.Check(validatorFollowUp(43)))
+	require.Empty(t, v.Flush())
+}
+
+func TestValidatorDelayRespWithoutDelayReq(t *testing.T) {
+	v := NewValidator()
+	require.Empty(t, v.Check(NewDelayReq(validatorClient, 7)))
+
+	// same sequenceId, different requesting port
+	other := PortIdentity{ClockIdentity: 0x3, PortNumber: 1}
+	want := []Violation{{Type: ViolationDelayRespWithoutDelayReq, MessageType: MessageDelayResp, Port: other, SequenceID: 7, Expected: 7}}
+	require.Equal(t, want, v.Check(validatorDelayResp(other, 7)))
+
+	want = []Violation{{Type: ViolationDelayRespWithoutDelayReq, MessageType: MessageDelayResp, Port: validatorClient, SequenceID: 8, Expected: 8}}
+	require.Equal(t, want, v.Check(validatorDelayResp(validatorClient, 8)))
+}
+
+func TestValidatorMissingDelayResp(t *testing.T) {
+	v := NewValidator()
+	require.Empty(t, v.Check(NewDelayReq(validatorClient, 7)))
+	want := []Violation{{Type: ViolationMissingDelayResp, MessageType: MessageDelayReq, Port: validatorClient, SequenceID: 7, Expected: 7}}
+	require.Equal(t, want, v.Flush())
+}
+
+func TestViolationString(t *testing.T) {
+	v := Violation{Type: ViolationFollowUpSequence, MessageType: MessageFollowUp, Port: validatorServer, SequenceID: 43, Expected: 42}
+	require.Equal(t, "FOLLOW_UP_SEQUENCE: FOLLOW_UP from 000000.0000.000001-1 seq 43 (expected 42)", v.String())
+}
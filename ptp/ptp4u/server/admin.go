@@ -0,0 +1,72 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+)
+
+// SubscriptionInfo describes a client subscription
+type SubscriptionInfo struct {
+	Address      string        `json:"address"`
+	PortIdentity string        `json:"port_identity"`
+	Type         string        `json:"type"`
+	Interval     time.Duration `json:"interval_ns"`
+	Expire       time.Time     `json:"expire"`
+}
+
+// info returns the subscription description
+func (sc *SubscriptionClient) info(clientID ptp.PortIdentity) SubscriptionInfo {
+	sc.Lock()
+	defer sc.Unlock()
+	return SubscriptionInfo{
+		Address:      timestamp.SockaddrToIP(sc.eclisa).String(),
+		PortIdentity: clientID.String(),
+		Type:         strings.ToLower(sc.subscriptionType.String()),
+		Interval:     sc.interval,
+		Expire:       sc.expire,
+	}
+}
+
+// Subscriptions returns current subscriptions of all workers, expired ones are skipped
+func (s *Server) Subscriptions() []SubscriptionInfo {
+	res := []SubscriptionInfo{}
+	for _, w := range s.workers() {
+		res = append(res, w.subscriptions()...)
+	}
+	return res
+}
+
+// SubscriptionsHandler serves current subscriptions as json
+func (s *Server) SubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	js, err := json.Marshal(s.Subscriptions())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(js); err != nil {
+		log.Errorf("Failed to reply: %v", err)
+	}
+}
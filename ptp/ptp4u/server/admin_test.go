@@ -0,0 +1,98 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerSubscriptions(t *testing.T) {
+	c := &Config{
+		StaticConfig: StaticConfig{
+			SendWorkers: 2,
+			QueueSize:   10,
+		},
+	}
+	s := Server{
+		Config: c,
+		Stats:  stats.NewJSONStats(),
+		sw:     make([]*sendWorker, c.SendWorkers),
+	}
+	s.sw[0] = newSendWorker(0, s.Config, s.Stats)
+	s.sw[1] = newSendWorker(1, s.Config, s.Stats)
+	require.Empty(t, s.Subscriptions())
+
+	clipi := ptp.PortIdentity{
+		PortNumber:    1,
+		ClockIdentity: ptp.ClockIdentity(1234),
+	}
+	sa := timestamp.IPToSockaddr(net.ParseIP("192.0.2.1"), 123)
+	expire := time.Now().Add(time.Minute)
+	scS := NewSubscriptionClient(s.sw[1].queue, s.sw[1].signalingQueue, sa, sa, ptp.MessageSync, c, time.Second/4, expire)
+	s.sw[1].RegisterSubscription(clipi, ptp.MessageSync, scS)
+	scA := NewSubscriptionClient(s.sw[0].queue, s.sw[0].signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Now().Add(-time.Second))
+	s.sw[0].RegisterSubscription(clipi, ptp.MessageAnnounce, scA)
+
+	want := []SubscriptionInfo{
+		{
+			Address:      "192.0.2.1",
+			PortIdentity: clipi.String(),
+			Type:         "sync",
+			Interval:     250 * time.Millisecond,
+			Expire:       expire,
+		},
+	}
+	// expired announce subscription is not listed
+	require.Equal(t, want, s.Subscriptions())
+
+	// and disappears once sync one expires too
+	scS.SetExpire(time.Now().Add(-time.Second))
+	require.Empty(t, s.Subscriptions())
+}
+
+func TestSubscriptionsHandler(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{QueueSize: 10}}
+	s := Server{
+		Config: c,
+		Stats:  stats.NewJSONStats(),
+		sw:     []*sendWorker{newSendWorker(0, c, stats.NewJSONStats())},
+	}
+	clipi := ptp.PortIdentity{PortNumber: 1, ClockIdentity: ptp.ClockIdentity(1234)}
+	sa := timestamp.IPToSockaddr(net.ParseIP("2001:db8::1"), 123)
+	sc := NewSubscriptionClient(s.sw[0].queue, s.sw[0].signalingQueue, sa, sa, ptp.MessageDelayResp, c, time.Second, time.Now().Add(time.Minute))
+	s.sw[0].RegisterSubscription(clipi, ptp.MessageDelayResp, sc)
+
+	rec := httptest.NewRecorder()
+	s.SubscriptionsHandler(rec, httptest.NewRequest("GET", "/subscriptions", nil))
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var got []map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	require.Len(t, got, 1)
+	require.Equal(t, "2001:db8::1", got[0]["address"])
+	require.Equal(t, "delay_resp", got[0]["type"])
+	require.Equal(t, float64(time.Second), got[0]["interval_ns"])
+}
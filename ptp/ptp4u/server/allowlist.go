@@ -0,0 +1,74 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+)
+
+// IPNets is a list of IPv4 and IPv6 networks, in config it's a list of CIDRs
+type IPNets []*net.IPNet
+
+// ParseIPNets parses CIDRs like 192.0.2.0/24 or 2001:db8::/32
+func ParseIPNets(cidrs ...string) (IPNets, error) {
+	nets := make(IPNets, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing network %q: %w", cidr, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Allow reports if the ip belongs to any of the networks. Empty list allows everything
+func (n IPNets) Allow(ip net.IP) bool {
+	if len(n) == 0 {
+		return true
+	}
+	for _, ipnet := range n {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (n IPNets) MarshalYAML() (interface{}, error) {
+	cidrs := make([]string, 0, len(n))
+	for _, ipnet := range n {
+		cidrs = append(cidrs, ipnet.String())
+	}
+	return cidrs, nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (n *IPNets) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var cidrs []string
+	if err := unmarshal(&cidrs); err != nil {
+		return err
+	}
+	nets, err := ParseIPNets(cidrs...)
+	if err != nil {
+		return err
+	}
+	*n = nets
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestIPNetsAllow(t *testing.T) {
+	nets, err := ParseIPNets("192.0.2.0/24", "2001:db8::/32")
+	require.NoError(t, err)
+
+	require.True(t, nets.Allow(net.ParseIP("192.0.2.42")))
+	require.True(t, nets.Allow(net.ParseIP("2001:db8::42")))
+	require.False(t, nets.Allow(net.ParseIP("198.51.100.42")))
+	require.False(t, nets.Allow(net.ParseIP("2001:db9::42")))
+
+	// empty list allows everyone
+	require.True(t, IPNets{}.Allow(net.ParseIP("198.51.100.42")))
+}
+
+func TestParseIPNetsError(t *testing.T) {
+	_, err := ParseIPNets("192.0.2.0/24", "192.0.2.300/24")
+	require.Error(t, err)
+}
+
+func TestIPNetsYAML(t *testing.T) {
+	nets, err := ParseIPNets("192.0.2.0/24", "2001:db8::/32")
+	require.NoError(t, err)
+	dc := &DynamicConfig{AllowedNetworks: nets}
+	d, err := yaml.Marshal(dc)
+	require.NoError(t, err)
+	require.Contains(t, string(d), "allowednetworks:\n- 192.0.2.0/24\n- 2001:db8::/32\n")
+
+	parsed := &DynamicConfig{}
+	require.NoError(t, yaml.Unmarshal(d, parsed))
+	require.Equal(t, nets, parsed.AllowedNetworks)
+}
+
+func TestReadDynamicConfigAllowedNetworks(t *testing.T) {
+	cfg, err := os.CreateTemp("", "ptp4u")
+	require.NoError(t, err)
+	defer os.Remove(cfg.Name())
+
+	_, err = cfg.WriteString("utcoffset: 37s\nallowednetworks: [\"192.0.2.0/24\", \"2001:db8::/32\"]\n")
+	require.NoError(t, err)
+	dc, err := ReadDynamicConfig(cfg.Name())
+	require.NoError(t, err)
+	require.True(t, dc.AllowedNetworks.Allow(net.ParseIP("192.0.2.1")))
+	require.False(t, dc.AllowedNetworks.Allow(net.ParseIP("198.51.100.1")))
+
+	require.NoError(t, cfg.Truncate(0))
+	_, err = cfg.WriteAt([]byte("utcoffset: 37s\nallowednetworks: [\"192.0.2.0/33\"]\n"), 0)
+	require.NoError(t, err)
+	_, err = ReadDynamicConfig(cfg.Name())
+	require.Error(t, err)
+}
@@ -0,0 +1,45 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"time"
+
+	"github.com/facebook/time/timestamp"
+)
+
+// Clock is a source of time for the send workers, replaceable to make Sync/FollowUp timing deterministic in tests
+type Clock interface {
+	// Now returns the current system time
+	Now() time.Time
+	// ReadTXtimestamp reads TX timestamp of the last packet sent over the socket, e.g. from PHC,
+	// along with the number of read attempts
+	ReadTXtimestamp(connFd int, oob, toob []byte) (time.Time, int, error)
+}
+
+// SystemClock is the Clock backed by the system clock and TX timestamps reported by the kernel
+type SystemClock struct{}
+
+// Now returns the current system time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ReadTXtimestamp reads TX timestamp from the socket error queue
+func (SystemClock) ReadTXtimestamp(connFd int, oob, toob []byte) (time.Time, int, error) {
+	return timestamp.ReadTXtimestampBuf(connFd, oob, toob)
+}
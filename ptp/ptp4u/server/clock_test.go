@@ -0,0 +1,65 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// fakeClock is a Clock standing still unless advanced. TX timestamp is the time the packet was sent at
+type fakeClock struct {
+	mux sync.Mutex
+	now time.Time
+	// txDelay is how long reading TX timestamp takes
+	txDelay time.Duration
+	// txErr fails TX timestamp reads when set
+	txErr error
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.now = f.now.Add(d)
+}
+
+func (f *fakeClock) ReadTXtimestamp(_ int, _, _ []byte) (time.Time, int, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	txTS := f.now
+	f.now = f.now.Add(f.txDelay)
+	if f.txErr != nil {
+		return time.Time{}, 100, f.txErr
+	}
+	return txTS, 1, nil
+}
+
+// txtsClock is the system clock with TX timestamp reads replaced
+type txtsClock struct {
+	SystemClock
+	read func(connFd int, oob, toob []byte) (time.Time, int, error)
+}
+
+func (c txtsClock) ReadTXtimestamp(connFd int, oob, toob []byte) (time.Time, int, error) {
+	return c.read(connFd, oob, toob)
+}
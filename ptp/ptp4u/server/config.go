@@ -24,51 +24,155 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/facebook/time/leapsectz"
 	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 	yaml "gopkg.in/yaml.v2"
 )
 
 var errInsaneUTCoffset = errors.New("UTC offset is outside of sane range")
 
+var errInsaneLogInterval = errors.New("log message interval is outside of sane range")
+
+// Range of log message intervals which can be configured, from 128 messages per second to one per 128 seconds
+const (
+	minLogInterval ptp.LogInterval = -7
+	maxLogInterval ptp.LogInterval = 7
+)
+
+// unicastLogInterval is logMessageInterval of unicast Sync unless configured
+const unicastLogInterval ptp.LogInterval = 0x7f
+
+// Default announce quality values
+const (
+	DefaultOffsetScaledLogVariance uint16 = 23008
+	DefaultPriority                uint8  = 128
+)
+
+// Dispatch policies to pick a send worker for a new client
+const (
+	// DispatchHash spreads clients over send workers by the hash of their port identity
+	DispatchHash = "hash"
+	// DispatchLeastLoaded picks the send worker with the lowest load
+	DispatchLeastLoaded = "leastloaded"
+)
+
+// Policies for a subscription which finds the send worker queue full
+const (
+	// QueuePolicyBlock waits until the queue has room
+	QueuePolicyBlock = "block"
+	// QueuePolicyDropNewest drops the subscription job which doesn't fit
+	QueuePolicyDropNewest = "drop-newest"
+	// QueuePolicyDropOldest drops the longest waiting job to make room
+	QueuePolicyDropOldest = "drop-oldest"
+)
+
+// MaintenanceClockClass is a degraded clock class announced in maintenance mode
+const MaintenanceClockClass = ptp.ClockClass52
+
 // dcMux is a dynamic config mutex
 var dcMux = sync.Mutex{}
 
 // StaticConfig is a set of static options which require a server restart
 type StaticConfig struct {
-	ConfigFile     string
-	DebugAddr      string
-	DSCP           int
-	Interface      string
-	IP             net.IP
-	LogLevel       string
-	MonitoringPort int
-	PidFile        string
-	QueueSize      int
-	RecvWorkers    int
-	SendWorkers    int
-	TimestampType  string
+	ClockIdentity       ptp.ClockIdentity
+	ConfigFile          string
+	CPUAffinity         []int
+	DebugAddr           string
+	DispatchPolicy      string
+	DomainNumber        int
+	DSCP                int
+	EventPorts          PortRange
+	GeneralPorts        PortRange
+	HealthTXTSFailures  int
+	HealthUnlocked      time.Duration
+	Interface           string
+	IP                  net.IP
+	LeapSecondsFile     string
+	LogLevel            string
+	MaxSendWorkers      int
+	MonitoringPort      int
+	MTU                 int
+	PidFile             string
+	PortNumber          int
+	PrewarmIP           net.IP
+	Profile             Profile
+	QueuePolicy         string
+	QueueSize           int
+	RecvBufferBytes     int
+	RecvWorkers         int
+	ScaleQueueThreshold int
+	SendBufferBytes     int
+	SendWorkers         int
+	SyncBatch           int
+	TimestampType       string
+	TXTimestampFallback bool
+	Transport           string
+	TransportSpecific   int
 }
 
 // DynamicConfig is a set of dynamic options which don't need a server restart
 type DynamicConfig struct {
+	// AllowedNetworks are networks clients may subscribe from. Everyone may subscribe if empty
+	AllowedNetworks IPNets `yaml:",omitempty"`
 	// ClockCccuracy to report via announce messages. Time Accurate within 100ns
 	ClockAccuracy ptp.ClockAccuracy
-	// ClockClass to report via announce messages. 6 - Locked with Primary Reference Clock
+	// ClockClass to report via announce messages. 6 - Locked with Primary Reference Clock.
+	// c4u bumps it when the clock degrades (e.g. into holdover) and ptp4u picks it up on SIGHUP.
+	// The time source may also report holdover directly, see HoldoverClockClass
 	ClockClass ptp.ClockClass
+	// DelayReqBurst is a number of delay requests a client may send in a burst. DelayReqRate if unset
+	DelayReqBurst int `yaml:",omitempty"`
+	// DelayReqRate is a number of delay requests per second served to a client, the rest are dropped.
+	// Not limited if unset
+	DelayReqRate int `yaml:",omitempty"`
 	// DrainInterval is an interval for drain checks
 	DrainInterval time.Duration
+	// GrandmasterIdentity to report via announce messages when ptp4u is a boundary clock following it.
+	// Own clock identity if unset
+	GrandmasterIdentity ptp.ClockIdentity `yaml:",omitempty"`
+	// HoldoverClockClass to report via announce messages once the time source is in holdover
+	// (see Server.SetHoldover) for longer than HoldoverThreshold. ClockClass7 if unset.
+	// It never improves on ClockClass
+	HoldoverClockClass ptp.ClockClass `yaml:",omitempty"`
+	// HoldoverThreshold is how long the time source may be in holdover before HoldoverClockClass is announced,
+	// so short gaps in samples don't make downstream BMCA react
+	HoldoverThreshold time.Duration `yaml:",omitempty"`
+	// LeapSecondsMaxAge is how old LeapSecondsFile may get before the UTC offset is announced as not valid.
+	// Not checked if unset
+	LeapSecondsMaxAge time.Duration `yaml:",omitempty"`
+	// LogAnnounceInterval to report via announce messages. The interval granted to the subscription if unset
+	LogAnnounceInterval *ptp.LogInterval `yaml:",omitempty"`
+	// LogSyncInterval to report via sync and follow up messages. 0x7f for sync and the granted interval
+	// for follow up if unset
+	LogSyncInterval *ptp.LogInterval `yaml:",omitempty"`
 	// MaxSubDuration is a maximum sync/announce/delay_resp subscription duration
 	MaxSubDuration time.Duration
 	// MetricInterval is an interval of resetting metrics
 	MetricInterval time.Duration
+	// MinSubDuration is a minimum sync/announce/delay_resp subscription duration
+	MinSubDuration time.Duration
 	// MinSubInterval is a minimum interval of the sync/announce subscription messages
 	MinSubInterval time.Duration
+	// OffsetScaledLogVariance to report via announce messages
+	OffsetScaledLogVariance uint16
+	// Priority1 to report via announce messages as grandmasterPriority1
+	Priority1 uint8
+	// Priority2 to report via announce messages as grandmasterPriority2
+	Priority2 uint8
+	// StepsRemoved to report via announce messages. 0 as a grandmaster,
+	// upstream stepsRemoved + 1 as a boundary clock
+	StepsRemoved uint16 `yaml:",omitempty"`
+	// SweepInterval is an interval of evicting expired subscriptions
+	SweepInterval time.Duration
 	// UTCOffset is a current UTC offset.
 	UTCOffset time.Duration
 }
@@ -78,7 +182,227 @@ type Config struct {
 	StaticConfig
 	DynamicConfig
 
+	// Logger is used by send workers instead of the global logrus logger when set
+	Logger log.FieldLogger
+	// Clock is used by send workers instead of the system clock when set
+	Clock Clock
+	// NewSubscriptionStore creates subscription storage of every send worker instead of MapSubscriptionStore when set
+	NewSubscriptionStore func() SubscriptionStore
+
 	clockIdentity ptp.ClockIdentity
+	maintenance   int32
+	// holdoverSince is when the time source entered holdover in unix nanoseconds, 0 if it's not in holdover
+	holdoverSince int64
+	// mtu packets are checked against before sending, not checked if 0
+	mtu int
+	// leapSeconds holds *leapSecondsTable, nil unless loaded. It's replaced as a whole on reload
+	leapSeconds atomic.Value
+	// leapSecondsStale is set while the leap seconds table is older than LeapSecondsMaxAge
+	leapSecondsStale int32
+}
+
+// logger returns the configured Logger, or the global logrus logger if unset
+func (c *Config) logger() log.FieldLogger {
+	if c == nil || c.Logger == nil {
+		return log.StandardLogger()
+	}
+	return c.Logger
+}
+
+// clock returns the configured Clock, or the system clock if unset
+func (c *Config) clock() Clock {
+	if c == nil || c.Clock == nil {
+		return SystemClock{}
+	}
+	return c.Clock
+}
+
+// newSubscriptionStore returns storage created by the configured NewSubscriptionStore,
+// or a MapSubscriptionStore if unset
+func (c *Config) newSubscriptionStore() SubscriptionStore {
+	if c == nil || c.NewSubscriptionStore == nil {
+		return NewMapSubscriptionStore()
+	}
+	return c.NewSubscriptionStore()
+}
+
+// SetMaintenance atomically toggles maintenance mode
+func (c *Config) SetMaintenance(maintenance bool) {
+	var v int32
+	if maintenance {
+		v = 1
+	}
+	atomic.StoreInt32(&c.maintenance, v)
+}
+
+// Maintenance atomically reports if maintenance mode is engaged
+func (c *Config) Maintenance() bool {
+	return atomic.LoadInt32(&c.maintenance) == 1
+}
+
+// maxPayloadSize returns the largest UDP payload which fits into the MTU without fragmentation.
+// Not limited if 0
+func (c *Config) maxPayloadSize() int {
+	if c.mtu == 0 {
+		return 0
+	}
+	if c.IP.To4() != nil {
+		return c.mtu - ipv4HeaderSize - udpHeaderSize
+	}
+	return c.mtu - ipv6HeaderSize - udpHeaderSize
+}
+
+// AnnounceGrandmasterIdentity returns grandmaster identity to report via announce messages.
+// It's the upstream GrandmasterIdentity as a boundary clock and own clock identity otherwise
+func (c *Config) AnnounceGrandmasterIdentity() ptp.ClockIdentity {
+	if c.GrandmasterIdentity != 0 {
+		return c.GrandmasterIdentity
+	}
+	return c.clockIdentity
+}
+
+// SourcePortIdentity returns sourcePortIdentity of all sent messages.
+// It's the clock identity with PortNumber, or port 1 if unset
+func (c *Config) SourcePortIdentity() ptp.PortIdentity {
+	portNumber := uint16(1)
+	if c.PortNumber != 0 {
+		portNumber = uint16(c.PortNumber)
+	}
+	return ptp.PortIdentity{
+		ClockIdentity: c.clockIdentity,
+		PortNumber:    portNumber,
+	}
+}
+
+// SetHoldover atomically marks the time source entering holdover at now, or leaving it.
+// Entering holdover again keeps the original time
+func (c *Config) SetHoldover(holdover bool, now time.Time) {
+	if !holdover {
+		atomic.StoreInt64(&c.holdoverSince, 0)
+		return
+	}
+	atomic.CompareAndSwapInt64(&c.holdoverSince, 0, now.UnixNano())
+}
+
+// Holdover atomically reports how long the time source is in holdover as of now, 0 if it isn't
+func (c *Config) Holdover(now time.Time) time.Duration {
+	since := atomic.LoadInt64(&c.holdoverSince)
+	if since == 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, since))
+}
+
+// AnnounceClockClass returns clock class to report via announce messages.
+// It's degraded to the profile maintenance clock class in maintenance mode
+// and to HoldoverClockClass after HoldoverThreshold in holdover
+func (c *Config) AnnounceClockClass() ptp.ClockClass {
+	return c.announceClockClassAt(c.clock().Now())
+}
+
+func (c *Config) announceClockClassAt(now time.Time) ptp.ClockClass {
+	if c.Maintenance() {
+		return c.Profile.maintenanceClockClass()
+	}
+	if h := c.Holdover(now); h > 0 && h >= c.HoldoverThreshold {
+		holdoverClass := c.HoldoverClockClass
+		if holdoverClass == 0 {
+			holdoverClass = ptp.ClockClass7
+		}
+		// greater clock classes are worse ones
+		if holdoverClass > c.ClockClass {
+			return holdoverClass
+		}
+	}
+	return c.ClockClass
+}
+
+// leapSecondsTable is a leap seconds table read from LeapSecondsFile
+type leapSecondsTable struct {
+	// seconds are sorted by time
+	seconds []leapsectz.LeapSecond
+	// modTime is modification time of the file
+	modTime time.Time
+}
+
+// setLeapSeconds replaces the leap seconds table
+func (c *Config) setLeapSeconds(ls []leapsectz.LeapSecond, modTime time.Time) {
+	sort.Slice(ls, func(i, j int) bool { return ls[i].Time().Before(ls[j].Time()) })
+	c.leapSeconds.Store(&leapSecondsTable{seconds: ls, modTime: modTime})
+}
+
+// leapSecondsTable returns the loaded leap seconds table, empty if there is none
+func (c *Config) leapSecondsTable() *leapSecondsTable {
+	if t, ok := c.leapSeconds.Load().(*leapSecondsTable); ok {
+		return t
+	}
+	return &leapSecondsTable{}
+}
+
+// LoadLeapSeconds reads the leap seconds table from LeapSecondsFile.
+// Once loaded, it takes precedence over the configured UTCOffset
+func (c *Config) LoadLeapSeconds() error {
+	// stat first, so the file changing while it's parsed is picked up by the next reload
+	fi, err := os.Stat(c.LeapSecondsFile)
+	if err != nil {
+		return fmt.Errorf("reading leap seconds from %q: %w", c.LeapSecondsFile, err)
+	}
+	ls, err := leapsectz.Parse(c.LeapSecondsFile)
+	if err != nil {
+		return fmt.Errorf("reading leap seconds from %q: %w", c.LeapSecondsFile, err)
+	}
+	c.setLeapSeconds(ls, fi.ModTime())
+	return nil
+}
+
+// ReloadLeapSeconds reads the leap seconds table from LeapSecondsFile again if the file was modified
+// since it was loaded. It reports whether the table was replaced, the loaded one is kept on error
+func (c *Config) ReloadLeapSeconds() (bool, error) {
+	fi, err := os.Stat(c.LeapSecondsFile)
+	if err != nil {
+		return false, fmt.Errorf("reading leap seconds from %q: %w", c.LeapSecondsFile, err)
+	}
+	if fi.ModTime().Equal(c.leapSecondsTable().modTime) {
+		return false, nil
+	}
+	if err := c.LoadLeapSeconds(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// leapSecondsFresh reports if the leap seconds table modified at modTime is within LeapSecondsMaxAge at now.
+// Going stale and back is logged once
+func (c *Config) leapSecondsFresh(now, modTime time.Time) bool {
+	stale := int32(0)
+	age := now.Sub(modTime)
+	if c.LeapSecondsMaxAge > 0 && age > c.LeapSecondsMaxAge {
+		stale = 1
+	}
+	if atomic.SwapInt32(&c.leapSecondsStale, stale) != stale {
+		if stale == 1 {
+			c.logger().Warningf("Leap seconds file %s is %v old, over %v. UTC offset is announced as not valid", c.LeapSecondsFile, age, c.LeapSecondsMaxAge)
+		} else {
+			c.logger().Infof("Leap seconds file %s is %v old, UTC offset is valid again", c.LeapSecondsFile, age)
+		}
+	}
+	return stale == 0
+}
+
+// UTCOffsetAt returns TAI-UTC offset in effect at the moment and whether it is valid.
+// It is derived from the leap seconds table when loaded, so it changes exactly at the leap second.
+// Otherwise it's the configured UTCOffset
+func (c *Config) UTCOffsetAt(now time.Time) (time.Duration, bool) {
+	// index of the first leap second which is still in the future
+	t := c.leapSecondsTable()
+	i := sort.Search(len(t.seconds), func(i int) bool { return t.seconds[i].Time().After(now) })
+	fresh := len(t.seconds) == 0 || c.leapSecondsFresh(now, t.modTime)
+	if i == 0 {
+		return c.UTCOffset, c.UTCOffsetSanity() == nil && fresh
+	}
+	// TAI-UTC was 10s before the first leap second in 1972
+	offset := 10*time.Second + time.Duration(t.seconds[i-1].Nleap)*time.Second
+	return offset, offset >= 30*time.Second && offset <= 50*time.Second && fresh
 }
 
 // UTCOffsetSanity checks if UTC offset value has an adequate value
@@ -90,8 +414,42 @@ func (dc *DynamicConfig) UTCOffsetSanity() error {
 	return nil
 }
 
+// LogIntervalSanity checks if configured log message intervals are within [-7, 7]
+func (dc *DynamicConfig) LogIntervalSanity() error {
+	for _, i := range []*ptp.LogInterval{dc.LogAnnounceInterval, dc.LogSyncInterval} {
+		if i != nil && (*i < minLogInterval || *i > maxLogInterval) {
+			return fmt.Errorf("%w: %d", errInsaneLogInterval, *i)
+		}
+	}
+	return nil
+}
+
+// SubDuration clamps the requested subscription duration to the [MinSubDuration, MaxSubDuration] range.
+// Zero limits are ignored
+func (dc *DynamicConfig) SubDuration(requested time.Duration) time.Duration {
+	if dc.MinSubDuration > 0 && requested < dc.MinSubDuration {
+		return dc.MinSubDuration
+	}
+	if dc.MaxSubDuration > 0 && requested > dc.MaxSubDuration {
+		return dc.MaxSubDuration
+	}
+	return requested
+}
+
+// ReadDynamicConfig reads dynamic config from the file. Announce quality fields
+// which are missing in the file are set to the defaults
 func ReadDynamicConfig(path string) (*DynamicConfig, error) {
-	dc := &DynamicConfig{}
+	return ReadDynamicConfigDefaults(path, DynamicConfig{
+		OffsetScaledLogVariance: DefaultOffsetScaledLogVariance,
+		Priority1:               DefaultPriority,
+		Priority2:               DefaultPriority,
+	})
+}
+
+// ReadDynamicConfigDefaults reads dynamic config from the file.
+// Fields which are missing in the file are set to the given defaults
+func ReadDynamicConfigDefaults(path string, defaults DynamicConfig) (*DynamicConfig, error) {
+	dc := &defaults
 	cData, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -106,6 +464,10 @@ func ReadDynamicConfig(path string) (*DynamicConfig, error) {
 		return nil, err
 	}
 
+	if err := dc.LogIntervalSanity(); err != nil {
+		return nil, err
+	}
+
 	return dc, nil
 }
 
@@ -154,6 +516,78 @@ func ReadPidFile(path string) (int, error) {
 	return strconv.Atoi(strings.Replace(string(content), "\n", "", -1))
 }
 
+// ParseCPUList parses comma separated list of CPUs and CPU ranges, e.g. "0,2,4-7"
+func ParseCPUList(list string) ([]int, error) {
+	cpus := []int{}
+	if list == "" {
+		return cpus, nil
+	}
+	for _, part := range strings.Split(list, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU %q: %w", part, err)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("invalid CPU range %q: %w", part, err)
+			}
+		}
+		if first < 0 || last < first {
+			return nil, fmt.Errorf("invalid CPU range %q", part)
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// PortRange is an inclusive range of UDP ports. Empty range means any ephemeral port
+type PortRange struct {
+	First int
+	Last  int
+}
+
+// Empty reports if the range has no ports configured
+func (r PortRange) Empty() bool {
+	return r.First == 0 && r.Last == 0
+}
+
+func (r PortRange) String() string {
+	if r.Empty() {
+		return "ephemeral"
+	}
+	if r.First == r.Last {
+		return strconv.Itoa(r.First)
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// ParsePortRange parses a single port or a range of ports, e.g. "32000" or "32000-32099".
+// Empty string is an empty range
+func ParsePortRange(s string) (PortRange, error) {
+	if s == "" {
+		return PortRange{}, nil
+	}
+	bounds := strings.SplitN(s, "-", 2)
+	first, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port %q: %w", s, err)
+	}
+	last := first
+	if len(bounds) == 2 {
+		if last, err = strconv.Atoi(bounds[1]); err != nil {
+			return PortRange{}, fmt.Errorf("invalid port range %q: %w", s, err)
+		}
+	}
+	if first < 1 || last > 65535 || last < first {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	return PortRange{First: first, Last: last}, nil
+}
+
 // ifaceIPs gets all IPs on the specified interface
 func ifaceIPs(iface string) ([]net.IP, error) {
 	i, err := net.InterfaceByName(iface)
@@ -19,9 +19,12 @@ package server
 import (
 	"net"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/facebook/time/leapsectz"
+	ptp "github.com/facebook/time/ptp/protocol"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sys/unix"
 )
@@ -66,13 +69,16 @@ func TestConfigIfaceHasIP(t *testing.T) {
 
 func TestReadDynamicConfigOk(t *testing.T) {
 	expected := &DynamicConfig{
-		ClockAccuracy:  0,
-		ClockClass:     1,
-		DrainInterval:  2 * time.Second,
-		MaxSubDuration: 3 * time.Hour,
-		MetricInterval: 4 * time.Minute,
-		MinSubInterval: 5 * time.Second,
-		UTCOffset:      37 * time.Second,
+		ClockAccuracy:           0,
+		ClockClass:              1,
+		DrainInterval:           2 * time.Second,
+		MaxSubDuration:          3 * time.Hour,
+		MetricInterval:          4 * time.Minute,
+		MinSubInterval:          5 * time.Second,
+		OffsetScaledLogVariance: DefaultOffsetScaledLogVariance,
+		Priority1:               DefaultPriority,
+		Priority2:               DefaultPriority,
+		UTCOffset:               37 * time.Second,
 	}
 
 	dc, err := ReadDynamicConfig("")
@@ -139,17 +145,27 @@ clockclass: 1
 draininterval: 2s
 maxsubduration: 3h0m0s
 metricinterval: 4m0s
+minsubduration: 1m0s
 minsubinterval: 5s
+offsetscaledlogvariance: 1
+priority1: 2
+priority2: 3
+sweepinterval: 6s
 utcoffset: 37s
 `
 	dc := &DynamicConfig{
-		ClockAccuracy:  0,
-		ClockClass:     1,
-		DrainInterval:  2 * time.Second,
-		MaxSubDuration: 3 * time.Hour,
-		MetricInterval: 4 * time.Minute,
-		MinSubInterval: 5 * time.Second,
-		UTCOffset:      37 * time.Second,
+		ClockAccuracy:           0,
+		ClockClass:              1,
+		DrainInterval:           2 * time.Second,
+		MaxSubDuration:          3 * time.Hour,
+		MetricInterval:          4 * time.Minute,
+		MinSubDuration:          1 * time.Minute,
+		MinSubInterval:          5 * time.Second,
+		OffsetScaledLogVariance: 1,
+		Priority1:               2,
+		Priority2:               3,
+		SweepInterval:           6 * time.Second,
+		UTCOffset:               37 * time.Second,
 	}
 
 	cfg, err := os.CreateTemp("", "ptp4u")
@@ -176,6 +192,228 @@ func TestUTCOffsetSanity(t *testing.T) {
 	require.NoError(t, dc.UTCOffsetSanity())
 }
 
+func TestLogIntervalSanity(t *testing.T) {
+	dc := &DynamicConfig{}
+	require.NoError(t, dc.LogIntervalSanity())
+	i := ptp.LogInterval(-7)
+	dc.LogSyncInterval = &i
+	require.NoError(t, dc.LogIntervalSanity())
+	j := ptp.LogInterval(8)
+	dc.LogAnnounceInterval = &j
+	require.ErrorIs(t, dc.LogIntervalSanity(), errInsaneLogInterval)
+	dc.LogAnnounceInterval = nil
+	k := ptp.LogInterval(-8)
+	dc.LogSyncInterval = &k
+	require.ErrorIs(t, dc.LogIntervalSanity(), errInsaneLogInterval)
+}
+
+func TestReadDynamicConfigLogIntervals(t *testing.T) {
+	cfg, err := os.CreateTemp("", "ptp4u")
+	require.NoError(t, err)
+	defer os.Remove(cfg.Name())
+	_, err = cfg.WriteString("logannounceinterval: 1\nlogsyncinterval: -4\nutcoffset: \"37s\"\n")
+	require.NoError(t, err)
+
+	dc, err := ReadDynamicConfig(cfg.Name())
+	require.NoError(t, err)
+	require.Equal(t, ptp.LogInterval(1), *dc.LogAnnounceInterval)
+	require.Equal(t, ptp.LogInterval(-4), *dc.LogSyncInterval)
+
+	require.NoError(t, cfg.Truncate(0))
+	_, err = cfg.WriteAt([]byte("logsyncinterval: 10\nutcoffset: \"37s\"\n"), 0)
+	require.NoError(t, err)
+	dc, err = ReadDynamicConfig(cfg.Name())
+	require.ErrorIs(t, err, errInsaneLogInterval)
+	require.Nil(t, dc)
+}
+
+// leapSecond returns a leap second which brings TAI-UTC to 10+n seconds at the moment
+func leapSecond(at time.Time, n int32) leapsectz.LeapSecond {
+	return leapsectz.LeapSecond{Tleap: uint64(at.Unix()) + uint64(n) - 1, Nleap: n}
+}
+
+func TestUTCOffsetAt(t *testing.T) {
+	leap2017 := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+	leap2030 := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := &Config{DynamicConfig: DynamicConfig{UTCOffset: 36 * time.Second}}
+
+	// configured value without leap seconds table
+	offset, valid := c.UTCOffsetAt(leap2017)
+	require.Equal(t, 36*time.Second, offset)
+	require.True(t, valid)
+	c.UTCOffset = 0
+	_, valid = c.UTCOffsetAt(leap2017)
+	require.False(t, valid)
+
+	c.UTCOffset = 36 * time.Second
+	c.setLeapSeconds([]leapsectz.LeapSecond{leapSecond(leap2017, 27), leapSecond(leap2030, 28)}, time.Time{})
+	offset, valid = c.UTCOffsetAt(leap2017.Add(-time.Nanosecond))
+	require.Equal(t, 36*time.Second, offset)
+	require.True(t, valid)
+	offset, valid = c.UTCOffsetAt(leap2017)
+	require.Equal(t, 37*time.Second, offset)
+	require.True(t, valid)
+	offset, _ = c.UTCOffsetAt(leap2030.Add(-time.Nanosecond))
+	require.Equal(t, 37*time.Second, offset)
+	offset, _ = c.UTCOffsetAt(leap2030)
+	require.Equal(t, 38*time.Second, offset)
+}
+
+func TestLoadLeapSeconds(t *testing.T) {
+	leap2017 := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+	leap2030 := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "UTC")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	err = leapsectz.Write(f, '2', []leapsectz.LeapSecond{leapSecond(leap2030, 28), leapSecond(leap2017, 27)}, "UTC")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	c := &Config{StaticConfig: StaticConfig{LeapSecondsFile: path}}
+	require.NoError(t, c.LoadLeapSeconds())
+	offset, valid := c.UTCOffsetAt(leap2030.Add(-time.Second))
+	require.Equal(t, 37*time.Second, offset)
+	require.True(t, valid)
+	offset, _ = c.UTCOffsetAt(leap2030)
+	require.Equal(t, 38*time.Second, offset)
+
+	c.LeapSecondsFile = filepath.Join(t.TempDir(), "missing")
+	require.Error(t, c.LoadLeapSeconds())
+}
+
+func TestReloadLeapSeconds(t *testing.T) {
+	leap2017 := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+	leap2030 := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "UTC")
+	write := func(modTime time.Time, ls ...leapsectz.LeapSecond) {
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		require.NoError(t, leapsectz.Write(f, '2', ls, "UTC"))
+		require.NoError(t, f.Close())
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	loaded := time.Now().Add(-time.Hour)
+	write(loaded, leapSecond(leap2017, 27))
+
+	c := &Config{StaticConfig: StaticConfig{LeapSecondsFile: path}}
+	require.NoError(t, c.LoadLeapSeconds())
+	offset, _ := c.UTCOffsetAt(leap2030)
+	require.Equal(t, 37*time.Second, offset)
+
+	// unchanged file isn't read again
+	reloaded, err := c.ReloadLeapSeconds()
+	require.NoError(t, err)
+	require.False(t, reloaded)
+
+	// updated file brings the upcoming leap second
+	write(loaded.Add(time.Minute), leapSecond(leap2017, 27), leapSecond(leap2030, 28))
+	reloaded, err = c.ReloadLeapSeconds()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+	offset, _ = c.UTCOffsetAt(leap2030)
+	require.Equal(t, 38*time.Second, offset)
+	require.Equal(t, loaded.Add(time.Minute).Unix(), c.leapSecondsTable().modTime.Unix())
+
+	// broken file keeps the loaded table
+	require.NoError(t, os.WriteFile(path, []byte("garbage"), 0644))
+	reloaded, err = c.ReloadLeapSeconds()
+	require.Error(t, err)
+	require.False(t, reloaded)
+	offset, _ = c.UTCOffsetAt(leap2030)
+	require.Equal(t, 38*time.Second, offset)
+
+	require.NoError(t, os.Remove(path))
+	_, err = c.ReloadLeapSeconds()
+	require.Error(t, err)
+	offset, _ = c.UTCOffsetAt(leap2030)
+	require.Equal(t, 38*time.Second, offset)
+}
+
+func TestUTCOffsetAtLeapSecondsMaxAge(t *testing.T) {
+	leap2017 := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := &Config{DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second}}
+	c.setLeapSeconds([]leapsectz.LeapSecond{leapSecond(leap2017, 27)}, now.Add(-48*time.Hour))
+
+	// not checked if unset
+	_, valid := c.UTCOffsetAt(now)
+	require.True(t, valid)
+
+	c.LeapSecondsMaxAge = 72 * time.Hour
+	_, valid = c.UTCOffsetAt(now)
+	require.True(t, valid)
+
+	c.LeapSecondsMaxAge = 24 * time.Hour
+	offset, valid := c.UTCOffsetAt(now)
+	require.Equal(t, 37*time.Second, offset)
+	require.False(t, valid)
+
+	// fresh file is loaded again
+	c.setLeapSeconds([]leapsectz.LeapSecond{leapSecond(leap2017, 27)}, now)
+	_, valid = c.UTCOffsetAt(now)
+	require.True(t, valid)
+
+	// no leap seconds table, nothing to check
+	c.setLeapSeconds(nil, time.Time{})
+	_, valid = c.UTCOffsetAt(now)
+	require.True(t, valid)
+}
+
+func TestAnnounceClockClassHoldover(t *testing.T) {
+	now := time.Date(2022, time.March, 1, 0, 0, 0, 0, time.UTC)
+	c := &Config{DynamicConfig: DynamicConfig{ClockClass: ptp.ClockClass6}}
+	require.Equal(t, time.Duration(0), c.Holdover(now))
+
+	c.SetHoldover(true, now)
+	// entering holdover again keeps the original time
+	c.SetHoldover(true, now.Add(time.Second))
+	require.Equal(t, 2*time.Second, c.Holdover(now.Add(2*time.Second)))
+	require.Equal(t, ptp.ClockClass7, c.announceClockClassAt(now.Add(time.Second)))
+
+	// never improves on the configured clock class
+	c.ClockClass = ptp.ClockClass(248)
+	require.Equal(t, ptp.ClockClass(248), c.announceClockClassAt(now.Add(time.Second)))
+
+	c.SetMaintenance(true)
+	c.ClockClass = ptp.ClockClass6
+	require.Equal(t, MaintenanceClockClass, c.announceClockClassAt(now.Add(time.Second)))
+}
+
+func TestMaxPayloadSize(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{IP: net.ParseIP("192.168.0.1")}}
+	require.Equal(t, 0, c.maxPayloadSize())
+
+	c.mtu = 1500
+	require.Equal(t, 1472, c.maxPayloadSize())
+	c.IP = net.ParseIP("::1")
+	require.Equal(t, 1452, c.maxPayloadSize())
+}
+
+func TestSourcePortIdentity(t *testing.T) {
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234)}
+	require.Equal(t, ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(1234), PortNumber: 1}, c.SourcePortIdentity())
+
+	c.PortNumber = 3
+	require.Equal(t, ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(1234), PortNumber: 3}, c.SourcePortIdentity())
+}
+
+func TestSubDuration(t *testing.T) {
+	dc := &DynamicConfig{
+		MinSubDuration: 1 * time.Minute,
+		MaxSubDuration: 1 * time.Hour,
+	}
+	require.Equal(t, 1*time.Minute, dc.SubDuration(0))
+	require.Equal(t, 1*time.Minute, dc.SubDuration(10*time.Second))
+	require.Equal(t, 5*time.Minute, dc.SubDuration(5*time.Minute))
+	require.Equal(t, 1*time.Hour, dc.SubDuration(1*time.Hour))
+	require.Equal(t, 1*time.Hour, dc.SubDuration(5*time.Hour))
+
+	// zero limits are ignored
+	dc = &DynamicConfig{}
+	require.Equal(t, 10*time.Second, dc.SubDuration(10*time.Second))
+	require.Equal(t, 5*time.Hour, dc.SubDuration(5*time.Hour))
+}
+
 func TestPidFile(t *testing.T) {
 	cfg, err := os.CreateTemp("", "ptp4u")
 	require.NoError(t, err)
@@ -202,3 +440,40 @@ func TestPidFile(t *testing.T) {
 	require.NoError(t, err)
 	require.NoFileExists(t, c.PidFile)
 }
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := ParseCPUList("")
+	require.NoError(t, err)
+	require.Equal(t, []int{}, cpus)
+
+	cpus, err = ParseCPUList("0,2,4-7")
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 2, 4, 5, 6, 7}, cpus)
+
+	for _, list := range []string{"a", "1,", "3-1", "-1", "1-b"} {
+		_, err = ParseCPUList(list)
+		require.Error(t, err, list)
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	r, err := ParsePortRange("")
+	require.NoError(t, err)
+	require.True(t, r.Empty())
+	require.Equal(t, "ephemeral", r.String())
+
+	r, err = ParsePortRange("32000")
+	require.NoError(t, err)
+	require.Equal(t, PortRange{First: 32000, Last: 32000}, r)
+	require.Equal(t, "32000", r.String())
+
+	r, err = ParsePortRange("32000-32099")
+	require.NoError(t, err)
+	require.Equal(t, PortRange{First: 32000, Last: 32099}, r)
+	require.Equal(t, "32000-32099", r.String())
+
+	for _, s := range []string{"a", "0", "65536", "2-1", "1-", "1-b"} {
+		_, err = ParsePortRange(s)
+		require.Error(t, err, s)
+	}
+}
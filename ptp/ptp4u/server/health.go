@@ -0,0 +1,135 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebook/time/phc"
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+)
+
+// Health describes signals ptp4u health is derived from
+type Health struct {
+	Healthy bool `json:"healthy"`
+	// Reasons explain why ptp4u is unhealthy
+	Reasons []string `json:"reasons,omitempty"`
+	// TimestampingFailed is a number of sockets timestamps can't be enabled on
+	TimestampingFailed int `json:"timestamping_failed"`
+	// ClockClass is a clock class of the time source
+	ClockClass ptp.ClockClass `json:"clock_class"`
+	// Unlocked is how long the clock is unlocked
+	Unlocked time.Duration `json:"unlocked_ns"`
+	// TXTSFailures is the highest number of consecutive TX timestamp read failures across workers
+	TXTSFailures int64 `json:"txts_failures"`
+}
+
+// phcReader reads PHC time and its offset from the system clock
+type phcReader interface {
+	timeAndOffset(iface string, method phc.TimeMethod) (phc.SysoffResult, error)
+}
+
+// ifacePHC reads the PHC of the network interface
+type ifacePHC struct{}
+
+func (ifacePHC) timeAndOffset(iface string, method phc.TimeMethod) (phc.SysoffResult, error) {
+	return phc.TimeAndOffset(iface, method)
+}
+
+// measurePHCOffset records the offset of the interface PHC from the system clock, so the server's
+// own clock drifting away is noticed before clients do. PHC is in TAI, so the UTC offset is accounted.
+// It's only measured with hardware timestamps, as there is no PHC involved otherwise
+func (s *Server) measurePHCOffset() {
+	if s.Config.TimestampType != timestamp.HWTIMESTAMP {
+		return
+	}
+	if s.phc == nil {
+		s.phc = ifacePHC{}
+	}
+	res, err := s.phc.timeAndOffset(s.Config.Interface, phc.MethodIoctlSysOffsetExtended)
+	if err != nil {
+		log.Warningf("Failed to measure PHC offset of %s: %v", s.Config.Interface, err)
+		return
+	}
+	utcOffset, _ := s.Config.UTCOffsetAt(res.SysTime)
+	// result offset is system time minus PHC time
+	s.Stats.SetPHCOffset(-res.Offset - utcOffset)
+}
+
+// trackClockLock notes when the clock got unlocked. The clock is locked with clock class 6
+func (s *Server) trackClockLock(now time.Time) {
+	if s.Config.ClockClass == ptp.ClockClass6 {
+		atomic.StoreInt64(&s.unlockedSince, 0)
+		return
+	}
+	atomic.CompareAndSwapInt64(&s.unlockedSince, 0, now.UnixNano())
+}
+
+// Health reports whether ptp4u is healthy: timestamps are enabled on all sockets, the clock isn't unlocked
+// for longer than HealthUnlocked and no worker fails to read HealthTXTSFailures TX timestamps in a row
+func (s *Server) Health(now time.Time) Health {
+	h := Health{ClockClass: s.Config.ClockClass}
+	if atomic.LoadInt32(&s.timestampingFailed) != 0 {
+		h.TimestampingFailed++
+	}
+	for _, w := range s.workers() {
+		if atomic.LoadInt32(&w.timestampingFailed) != 0 {
+			h.TimestampingFailed++
+		}
+		if f := atomic.LoadInt64(&w.txtsFailures); f > h.TXTSFailures {
+			h.TXTSFailures = f
+		}
+	}
+	if since := atomic.LoadInt64(&s.unlockedSince); since != 0 {
+		h.Unlocked = now.Sub(time.Unix(0, since))
+	}
+
+	if h.TimestampingFailed > 0 {
+		h.Reasons = append(h.Reasons, fmt.Sprintf("failed to enable %s timestamps on %d sockets", s.Config.TimestampType, h.TimestampingFailed))
+	}
+	if s.Config.HealthUnlocked > 0 && h.Unlocked > s.Config.HealthUnlocked {
+		h.Reasons = append(h.Reasons, fmt.Sprintf("clock is unlocked with clock class %d for %v", h.ClockClass, h.Unlocked))
+	}
+	if s.Config.HealthTXTSFailures > 0 && h.TXTSFailures >= int64(s.Config.HealthTXTSFailures) {
+		h.Reasons = append(h.Reasons, fmt.Sprintf("failed to read %d TX timestamps in a row", h.TXTSFailures))
+	}
+	h.Healthy = len(h.Reasons) == 0
+	return h
+}
+
+// HealthHandler serves health signals as json with 200 if ptp4u is healthy and 503 otherwise
+func (s *Server) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	h := s.Health(s.Config.clock().Now())
+	js, err := json.Marshal(h)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !h.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if _, err = w.Write(js); err != nil {
+		log.Errorf("Failed to reply: %v", err)
+	}
+}
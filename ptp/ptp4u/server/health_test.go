@@ -0,0 +1,223 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/phc"
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func serveHealth(t *testing.T, s *Server) (int, Health) {
+	rec := httptest.NewRecorder()
+	s.HealthHandler(rec, httptest.NewRequest("GET", "/health", nil))
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var h Health
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &h))
+	return rec.Code, h
+}
+
+func TestHealthHandlerHealthy(t *testing.T) {
+	c := &Config{
+		StaticConfig:  StaticConfig{HealthTXTSFailures: 3, HealthUnlocked: time.Minute},
+		DynamicConfig: DynamicConfig{ClockClass: ptp.ClockClass6},
+	}
+	s := &Server{Config: c, sw: []*sendWorker{newSendWorker(0, c, stats.NewJSONStats())}}
+	s.trackClockLock(time.Now())
+
+	code, h := serveHealth(t, s)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, Health{Healthy: true, ClockClass: ptp.ClockClass6}, h)
+}
+
+func TestHealthTimestampingFailed(t *testing.T) {
+	c := &Config{
+		StaticConfig: StaticConfig{
+			Interface:     "lo",
+			IP:            net.ParseIP("127.0.0.1"),
+			TimestampType: timestamp.HWTIMESTAMP,
+		},
+		DynamicConfig: DynamicConfig{ClockClass: ptp.ClockClass6},
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+	s := &Server{Config: c, sw: []*sendWorker{w}}
+
+	// loopback doesn't support hardware timestamps
+	_, _, err := w.listen()
+	require.Error(t, err)
+	code, h := serveHealth(t, s)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.False(t, h.Healthy)
+	require.Equal(t, 1, h.TimestampingFailed)
+	require.Equal(t, []string{"failed to enable hardware timestamps on 1 sockets"}, h.Reasons)
+
+	c.TimestampType = timestamp.SWTIMESTAMP
+	eFd, gFd, err := w.listen()
+	require.NoError(t, err)
+	defer unix.Close(eFd)
+	defer unix.Close(gFd)
+	require.True(t, s.Health(time.Now()).Healthy)
+}
+
+func TestHealthUnlocked(t *testing.T) {
+	c := &Config{
+		StaticConfig:  StaticConfig{HealthUnlocked: time.Minute},
+		DynamicConfig: DynamicConfig{ClockClass: ptp.ClockClass7},
+	}
+	s := &Server{Config: c}
+	now := time.Now()
+	s.trackClockLock(now)
+	// unlocked since the first time it's seen unlocked
+	s.trackClockLock(now.Add(30 * time.Second))
+
+	h := s.Health(now.Add(30 * time.Second))
+	require.True(t, h.Healthy)
+	require.Equal(t, 30*time.Second, h.Unlocked)
+
+	h = s.Health(now.Add(2 * time.Minute))
+	require.False(t, h.Healthy)
+	require.Equal(t, ptp.ClockClass7, h.ClockClass)
+	require.Equal(t, 2*time.Minute, h.Unlocked)
+	require.Equal(t, []string{"clock is unlocked with clock class 7 for 2m0s"}, h.Reasons)
+
+	c.ClockClass = ptp.ClockClass6
+	s.trackClockLock(now.Add(2 * time.Minute))
+	h = s.Health(now.Add(3 * time.Minute))
+	require.True(t, h.Healthy)
+	require.Equal(t, time.Duration(0), h.Unlocked)
+
+	// not checked without a threshold
+	c.HealthUnlocked = 0
+	c.ClockClass = ptp.ClockClass7
+	s.trackClockLock(now)
+	require.True(t, s.Health(now.Add(time.Hour)).Healthy)
+}
+
+func TestHealthTXTSFailures(t *testing.T) {
+	eConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer eConn.Close()
+
+	clock := &fakeClock{now: time.Now(), txErr: fmt.Errorf("no TX timestamp found after 100 tries")}
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			HealthTXTSFailures: 3,
+			IP:                 net.ParseIP("127.0.0.1"),
+			TimestampType:      timestamp.SWTIMESTAMP,
+		},
+		DynamicConfig: DynamicConfig{ClockClass: ptp.ClockClass6},
+		Clock:         clock,
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+	s := &Server{Config: c, sw: []*sendWorker{w}}
+	eFd, gFd, err := w.listen()
+	require.NoError(t, err)
+	defer unix.Close(eFd)
+	defer unix.Close(gFd)
+
+	esa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), eConn.LocalAddr().(*net.UDPAddr).Port)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, esa, esa, ptp.MessageSync, c, time.Second, clock.Now().Add(time.Minute))
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	toob := make([]byte, timestamp.ControlSizeBytes)
+
+	for i := 0; i < 2; i++ {
+		_, err = w.sendSync(eFd, gFd, sc, buf, oob, toob)
+		require.Error(t, err)
+	}
+	require.True(t, s.Health(clock.Now()).Healthy)
+
+	_, err = w.sendSync(eFd, gFd, sc, buf, oob, toob)
+	require.Error(t, err)
+	code, h := serveHealth(t, s)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, int64(3), h.TXTSFailures)
+	require.Equal(t, []string{"failed to read 3 TX timestamps in a row"}, h.Reasons)
+
+	// a successful read starts over
+	clock.txErr = nil
+	_, err = w.sendSync(eFd, gFd, sc, buf, oob, toob)
+	require.NoError(t, err)
+	code, h = serveHealth(t, s)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, int64(0), h.TXTSFailures)
+}
+
+// phcOffsetStats records the PHC offset
+type phcOffsetStats struct {
+	*stats.JSONStats
+	offset *time.Duration
+}
+
+func (s *phcOffsetStats) SetPHCOffset(offset time.Duration) {
+	s.offset = &offset
+}
+
+type fakePHC func(iface string, method phc.TimeMethod) (phc.SysoffResult, error)
+
+func (f fakePHC) timeAndOffset(iface string, method phc.TimeMethod) (phc.SysoffResult, error) {
+	return f(iface, method)
+}
+
+func TestMeasurePHCOffset(t *testing.T) {
+	sysTime := time.Unix(1650000000, 0)
+	read := func(iface string, method phc.TimeMethod) (phc.SysoffResult, error) {
+		require.Equal(t, "eth0", iface)
+		// PHC is in TAI and 150ns ahead of the system clock
+		phcTime := sysTime.Add(37*time.Second + 150*time.Nanosecond)
+		return phc.SysoffResult{SysTime: sysTime, PHCTime: phcTime, Offset: sysTime.Sub(phcTime)}, nil
+	}
+	st := &phcOffsetStats{JSONStats: stats.NewJSONStats()}
+	c := &Config{
+		StaticConfig:  StaticConfig{Interface: "eth0", TimestampType: timestamp.HWTIMESTAMP},
+		DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second},
+	}
+	s := &Server{Config: c, Stats: st, phc: fakePHC(read)}
+
+	s.measurePHCOffset()
+	require.NotNil(t, st.offset)
+	require.Equal(t, 150*time.Nanosecond, *st.offset)
+
+	// failed measurement isn't recorded
+	st.offset = nil
+	s.phc = fakePHC(func(string, phc.TimeMethod) (phc.SysoffResult, error) {
+		return phc.SysoffResult{}, fmt.Errorf("no PHC")
+	})
+	s.measurePHCOffset()
+	require.Nil(t, st.offset)
+
+	// there is no PHC with software timestamps
+	c.TimestampType = timestamp.SWTIMESTAMP
+	s.phc = fakePHC(func(string, phc.TimeMethod) (phc.SysoffResult, error) {
+		t.Fatal("PHC must not be read")
+		return phc.SysoffResult{}, nil
+	})
+	s.measurePHCOffset()
+	require.Nil(t, st.offset)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+)
+
+// linkCheckInterval is an interval of interface link state checks
+const linkCheckInterval = time.Second
+
+// linkState is a link state of the network interface
+type linkState struct {
+	up    bool
+	index int
+}
+
+// linkStater reports link state of the network interface
+type linkStater interface {
+	linkState(iface string) (linkState, error)
+}
+
+// sysfsLink gets link state from the interface flags and sysfs operstate
+type sysfsLink struct{}
+
+func (sysfsLink) linkState(iface string) (linkState, error) {
+	i, err := net.InterfaceByName(iface)
+	if err != nil {
+		return linkState{}, err
+	}
+	state := linkState{up: i.Flags&net.FlagUp != 0, index: i.Index}
+	// operstate is "unknown" for interfaces which don't report carrier, like loopback
+	operstate, err := os.ReadFile(fmt.Sprintf("/sys/class/net/%s/operstate", iface))
+	if err != nil {
+		return state, nil
+	}
+	if strings.TrimSpace(string(operstate)) == "down" {
+		state.up = false
+	}
+	return state, nil
+}
+
+// watchLink periodically checks the interface link state and rebinds sockets once it's back
+func (s *Server) watchLink() {
+	if s.link == nil {
+		s.link = sysfsLink{}
+	}
+	// sockets were just bound, only track changes from now on
+	state, err := s.link.linkState(s.Config.Interface)
+	if err != nil {
+		log.Warningf("Failed to get link state of %s: %v", s.Config.Interface, err)
+	}
+	for range time.Tick(linkCheckInterval) {
+		state = s.checkLink(state)
+	}
+}
+
+// checkLink gets the current link state and rebinds sockets if the link went up
+// or the interface was recreated since the previous check. Returns the current link state
+func (s *Server) checkLink(prev linkState) linkState {
+	cur, err := s.link.linkState(s.Config.Interface)
+	if err != nil {
+		log.Warningf("Failed to get link state of %s: %v", s.Config.Interface, err)
+		// missing interface is as good as down
+		return linkState{}
+	}
+	if !cur.up {
+		if prev.up {
+			log.Warningf("Link on %s is down", s.Config.Interface)
+		}
+		return cur
+	}
+	if !prev.up || cur.index != prev.index {
+		s.rebindSockets()
+	}
+	return cur
+}
+
+// rebindSockets re-enables RX timestamps on the event listener and makes workers re-create their sockets
+func (s *Server) rebindSockets() {
+	log.Warningf("Link on %s is up, rebinding sockets", s.Config.Interface)
+	if s.Config.TimestampType == timestamp.HWTIMESTAMP && s.eFd > 0 {
+		if err := timestamp.EnableHWTimestamps(s.eFd, s.Config.Interface); err != nil {
+			log.Errorf("Cannot re-enable hardware RX timestamps: %v", err)
+			atomic.StoreInt32(&s.timestampingFailed, 1)
+		} else {
+			atomic.StoreInt32(&s.timestampingFailed, 0)
+		}
+	}
+	for _, w := range s.workers() {
+		w.Rebind()
+	}
+	s.Stats.IncSocketRebind()
+}
@@ -0,0 +1,120 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLink returns link states one by one
+type fakeLink struct {
+	states []linkState
+}
+
+func (f *fakeLink) linkState(iface string) (linkState, error) {
+	if len(f.states) == 0 {
+		return linkState{}, fmt.Errorf("no such interface %s", iface)
+	}
+	state := f.states[0]
+	f.states = f.states[1:]
+	return state, nil
+}
+
+// rebindStats counts socket rebinds
+type rebindStats struct {
+	*stats.JSONStats
+	rebinds int
+}
+
+func (s *rebindStats) IncSocketRebind() {
+	s.rebinds++
+}
+
+func rebindRequested(w *sendWorker) bool {
+	select {
+	case <-w.rebind:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestCheckLink(t *testing.T) {
+	c := &Config{
+		StaticConfig: StaticConfig{
+			Interface:     "eth0",
+			TimestampType: timestamp.SWTIMESTAMP,
+			QueueSize:     10,
+		},
+	}
+	st := &rebindStats{JSONStats: stats.NewJSONStats()}
+	w := newSendWorker(0, c, st)
+	s := Server{
+		Config: c,
+		Stats:  st,
+		sw:     []*sendWorker{w},
+		link: &fakeLink{states: []linkState{
+			{up: true, index: 2},
+			{up: false, index: 2},
+			{up: true, index: 2},
+			{up: true, index: 3},
+		}},
+	}
+
+	// Link stays up
+	state := s.checkLink(linkState{up: true, index: 2})
+	require.Equal(t, linkState{up: true, index: 2}, state)
+	require.False(t, rebindRequested(w))
+
+	// Link goes down
+	state = s.checkLink(state)
+	require.False(t, state.up)
+	require.False(t, rebindRequested(w))
+
+	// Link comes back
+	state = s.checkLink(state)
+	require.True(t, state.up)
+	require.True(t, rebindRequested(w))
+	require.Equal(t, 1, st.rebinds)
+
+	// Interface is recreated with a new index
+	state = s.checkLink(state)
+	require.Equal(t, 3, state.index)
+	require.True(t, rebindRequested(w))
+	require.Equal(t, 2, st.rebinds)
+
+	// Interface is gone
+	state = s.checkLink(state)
+	require.Equal(t, linkState{}, state)
+	require.False(t, rebindRequested(w))
+}
+
+func TestWorkerRebind(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{QueueSize: 10}}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+
+	// Pending requests are coalesced
+	w.Rebind()
+	w.Rebind()
+	require.True(t, rebindRequested(w))
+	require.False(t, rebindRequested(w))
+}
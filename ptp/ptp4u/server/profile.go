@@ -0,0 +1,260 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// Profile is a PTP profile which defines conformant transport, message rates and announce quality
+type Profile string
+
+// Supported PTP profiles
+const (
+	// ProfileDefault is the IEEE 1588 default delay request-response profile
+	ProfileDefault Profile = "default"
+	// ProfileG82752 is the ITU-T G.8275.2 telecom profile with partial timing support from the network
+	ProfileG82752 Profile = "g8275.2"
+)
+
+// Transports PTP messages can be sent over
+const (
+	// TransportUDP is PTP over UDP over IPv4 or IPv6
+	TransportUDP = "udp"
+)
+
+// clockClass248 is a telecom profile clock class of the free-running grandmaster
+const clockClass248 ptp.ClockClass = 248
+
+// telecomClockClasses are clock classes a telecom profile grandmaster is allowed to announce
+var telecomClockClasses = []ptp.ClockClass{
+	ptp.ClockClass6,
+	ptp.ClockClass7,
+	135,
+	140,
+	150,
+	160,
+	165,
+	clockClass248,
+}
+
+// profileSettings are conformance requirements and defaults of the profile
+type profileSettings struct {
+	// transports allowed by the profile, the first one is the default
+	transports []string
+	// clockClasses allowed by the profile, any is allowed if empty
+	clockClasses []ptp.ClockClass
+	// maintenanceClockClass is a degraded clock class announced in maintenance mode
+	maintenanceClockClass ptp.ClockClass
+	// minSubInterval is an interval of the highest message rate allowed by the profile
+	minSubInterval time.Duration
+	// priority1 is a fixed grandmasterPriority1, any is allowed if 0
+	priority1 uint8
+	// domainNumber is the default domain number, minDomainNumber and maxDomainNumber is the allowed range
+	domainNumber    int
+	minDomainNumber int
+	maxDomainNumber int
+	// dynamic are defaults of the dynamic config
+	dynamic DynamicConfig
+}
+
+// baseDynamicConfig are dynamic config defaults profiles start with
+var baseDynamicConfig = DynamicConfig{
+	ClockAccuracy:           ptp.ClockAccuracyNanosecond100,
+	ClockClass:              ptp.ClockClass6,
+	DrainInterval:           30 * time.Second,
+	MaxSubDuration:          1 * time.Hour,
+	MetricInterval:          1 * time.Minute,
+	MinSubDuration:          30 * time.Second,
+	MinSubInterval:          1 * time.Second,
+	OffsetScaledLogVariance: DefaultOffsetScaledLogVariance,
+	Priority1:               DefaultPriority,
+	Priority2:               DefaultPriority,
+	SweepInterval:           10 * time.Second,
+	UTCOffset:               37 * time.Second,
+}
+
+// withBase returns baseDynamicConfig with the profile specific changes applied
+func withBase(change func(dc *DynamicConfig)) DynamicConfig {
+	dc := baseDynamicConfig
+	change(&dc)
+	return dc
+}
+
+// G.8275.1 is not supported as it runs over multicast Ethernet, ptp4u only serves PTP over UDP
+var profiles = map[Profile]profileSettings{
+	// IEEE 1588 domains 128-255 are reserved
+	ProfileDefault: {
+		transports:            []string{TransportUDP},
+		maintenanceClockClass: MaintenanceClockClass,
+		domainNumber:          0,
+		minDomainNumber:       0,
+		maxDomainNumber:       127,
+		dynamic:               baseDynamicConfig,
+	},
+	// G.8275.2 runs over unicast UDP with up to 128 sync/delay_resp per second
+	ProfileG82752: {
+		transports:            []string{TransportUDP},
+		clockClasses:          telecomClockClasses,
+		maintenanceClockClass: clockClass248,
+		minSubInterval:        time.Second / 128,
+		priority1:             DefaultPriority,
+		domainNumber:          44,
+		minDomainNumber:       44,
+		maxDomainNumber:       63,
+		dynamic: withBase(func(dc *DynamicConfig) {
+			dc.MinSubDuration = 60 * time.Second
+			dc.MinSubInterval = time.Second / 128
+			dc.OffsetScaledLogVariance = 0x4E5D
+		}),
+	},
+}
+
+// settings returns the profile settings. Unset profile is the default one
+func (p Profile) settings() (profileSettings, error) {
+	if p == "" {
+		p = ProfileDefault
+	}
+	ps, ok := profiles[p]
+	if !ok {
+		return profileSettings{}, fmt.Errorf("unsupported profile %q", p)
+	}
+	return ps, nil
+}
+
+// DynamicConfig returns dynamic config defaults of the profile
+func (p Profile) DynamicConfig() (*DynamicConfig, error) {
+	ps, err := p.settings()
+	if err != nil {
+		return nil, err
+	}
+	dc := ps.dynamic
+	return &dc, nil
+}
+
+// Transport returns the default transport of the profile
+func (p Profile) Transport() (string, error) {
+	ps, err := p.settings()
+	if err != nil {
+		return "", err
+	}
+	return ps.transports[0], nil
+}
+
+// DomainNumber returns the default domain number of the profile
+func (p Profile) DomainNumber() (int, error) {
+	ps, err := p.settings()
+	if err != nil {
+		return 0, err
+	}
+	return ps.domainNumber, nil
+}
+
+// maintenanceClockClass returns a degraded clock class conformant with the profile
+func (p Profile) maintenanceClockClass() ptp.ClockClass {
+	ps, err := p.settings()
+	if err != nil {
+		return MaintenanceClockClass
+	}
+	return ps.maintenanceClockClass
+}
+
+// ApplyProfile sets the transport, domain number and dynamic config to the profile defaults.
+// Transport which is already set is kept, explicit domain number should be set afterwards
+func (c *Config) ApplyProfile() error {
+	dc, err := c.Profile.DynamicConfig()
+	if err != nil {
+		return err
+	}
+	if c.Transport == "" {
+		if c.Transport, err = c.Profile.Transport(); err != nil {
+			return err
+		}
+	}
+	if c.DomainNumber, err = c.Profile.DomainNumber(); err != nil {
+		return err
+	}
+	c.DynamicConfig = *dc
+	return nil
+}
+
+// ReadDynamicConfig reads dynamic config from the config file. With the profile set
+// fields which are missing in the file are set to the profile defaults and the result is validated
+func (c *Config) ReadDynamicConfig() (*DynamicConfig, error) {
+	if c.Profile == "" {
+		return ReadDynamicConfig(c.ConfigFile)
+	}
+	defaults, err := c.Profile.DynamicConfig()
+	if err != nil {
+		return nil, err
+	}
+	dc, err := ReadDynamicConfigDefaults(c.ConfigFile, *defaults)
+	if err != nil {
+		return nil, err
+	}
+	// validate a copy, the current config is still in use
+	check := Config{StaticConfig: c.StaticConfig, DynamicConfig: *dc}
+	if err := check.ValidateProfile(); err != nil {
+		return nil, err
+	}
+	return dc, nil
+}
+
+// ValidateProfile checks the config doesn't violate the profile
+func (c *Config) ValidateProfile() error {
+	ps, err := c.Profile.settings()
+	if err != nil {
+		return err
+	}
+	if !containsString(ps.transports, c.Transport) {
+		return fmt.Errorf("profile %s requires %v transport, got %q", c.Profile, ps.transports, c.Transport)
+	}
+	if c.DomainNumber < ps.minDomainNumber || c.DomainNumber > ps.maxDomainNumber {
+		return fmt.Errorf("profile %s allows domain numbers %d-%d, got %d", c.Profile, ps.minDomainNumber, ps.maxDomainNumber, c.DomainNumber)
+	}
+	if len(ps.clockClasses) > 0 && !containsClockClass(ps.clockClasses, c.ClockClass) {
+		return fmt.Errorf("profile %s doesn't allow clock class %d", c.Profile, c.ClockClass)
+	}
+	if c.MinSubInterval < ps.minSubInterval {
+		return fmt.Errorf("profile %s allows min subscription interval of %v, got %v", c.Profile, ps.minSubInterval, c.MinSubInterval)
+	}
+	if ps.priority1 != 0 && c.Priority1 != ps.priority1 {
+		return fmt.Errorf("profile %s requires priority1 %d, got %d", c.Profile, ps.priority1, c.Priority1)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsClockClass(list []ptp.ClockClass, cc ptp.ClockClass) bool {
+	for _, v := range list {
+		if v == cc {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyProfileDefault(t *testing.T) {
+	expected := DynamicConfig{
+		ClockAccuracy:           ptp.ClockAccuracyNanosecond100,
+		ClockClass:              ptp.ClockClass6,
+		DrainInterval:           30 * time.Second,
+		MaxSubDuration:          1 * time.Hour,
+		MetricInterval:          1 * time.Minute,
+		MinSubDuration:          30 * time.Second,
+		MinSubInterval:          1 * time.Second,
+		OffsetScaledLogVariance: DefaultOffsetScaledLogVariance,
+		Priority1:               DefaultPriority,
+		Priority2:               DefaultPriority,
+		SweepInterval:           10 * time.Second,
+		UTCOffset:               37 * time.Second,
+	}
+	c := &Config{StaticConfig: StaticConfig{Profile: ProfileDefault}}
+	require.NoError(t, c.ApplyProfile())
+	require.Equal(t, TransportUDP, c.Transport)
+	require.Equal(t, 0, c.DomainNumber)
+	require.Equal(t, expected, c.DynamicConfig)
+	require.NoError(t, c.ValidateProfile())
+
+	// Unset profile is the default one
+	c = &Config{}
+	require.NoError(t, c.ApplyProfile())
+	require.Equal(t, TransportUDP, c.Transport)
+	require.Equal(t, expected, c.DynamicConfig)
+}
+
+func TestApplyProfileG82752(t *testing.T) {
+	expected := DynamicConfig{
+		ClockAccuracy:           ptp.ClockAccuracyNanosecond100,
+		ClockClass:              ptp.ClockClass6,
+		DrainInterval:           30 * time.Second,
+		MaxSubDuration:          1 * time.Hour,
+		MetricInterval:          1 * time.Minute,
+		MinSubDuration:          60 * time.Second,
+		MinSubInterval:          7812500 * time.Nanosecond,
+		OffsetScaledLogVariance: 0x4E5D,
+		Priority1:               128,
+		Priority2:               128,
+		SweepInterval:           10 * time.Second,
+		UTCOffset:               37 * time.Second,
+	}
+	c := &Config{StaticConfig: StaticConfig{Profile: ProfileG82752}}
+	require.NoError(t, c.ApplyProfile())
+	require.Equal(t, TransportUDP, c.Transport)
+	require.Equal(t, 44, c.DomainNumber)
+	require.Equal(t, expected, c.DynamicConfig)
+	require.NoError(t, c.ValidateProfile())
+}
+
+func TestApplyProfileKeepsTransport(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{Profile: ProfileDefault, Transport: "l2"}}
+	require.NoError(t, c.ApplyProfile())
+	require.Equal(t, "l2", c.Transport)
+	// only UDP is served
+	require.Error(t, c.ValidateProfile())
+}
+
+func TestApplyProfileUnsupported(t *testing.T) {
+	for _, p := range []Profile{"g8265.1", "g8275.1"} {
+		c := &Config{StaticConfig: StaticConfig{Profile: p}}
+		require.Error(t, c.ApplyProfile())
+		require.Error(t, c.ValidateProfile())
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		profile  Profile
+		override func(c *Config)
+	}{
+		{
+			name:     "G.8275.2 over L2",
+			profile:  ProfileG82752,
+			override: func(c *Config) { c.Transport = "l2" },
+		},
+		{
+			name:     "G.8275.2 in the default domain",
+			profile:  ProfileG82752,
+			override: func(c *Config) { c.DomainNumber = 0 },
+		},
+		{
+			name:     "G.8275.2 above the domain range",
+			profile:  ProfileG82752,
+			override: func(c *Config) { c.DomainNumber = 64 },
+		},
+		{
+			name:     "default profile in a reserved domain",
+			profile:  ProfileDefault,
+			override: func(c *Config) { c.DomainNumber = 128 },
+		},
+		{
+			name:     "G.8275.2 with unknown transport",
+			profile:  ProfileG82752,
+			override: func(c *Config) { c.Transport = "udp6" },
+		},
+		{
+			name:     "G.8275.2 with default profile clock class",
+			profile:  ProfileG82752,
+			override: func(c *Config) { c.ClockClass = ptp.ClockClass52 },
+		},
+		{
+			name:     "G.8275.2 above the max message rate",
+			profile:  ProfileG82752,
+			override: func(c *Config) { c.MinSubInterval = time.Millisecond },
+		},
+		{
+			name:     "G.8275.2 with custom priority1",
+			profile:  ProfileG82752,
+			override: func(c *Config) { c.Priority1 = 1 },
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{StaticConfig: StaticConfig{Profile: tc.profile}}
+			require.NoError(t, c.ApplyProfile())
+			require.NoError(t, c.ValidateProfile())
+			tc.override(c)
+			require.Error(t, c.ValidateProfile())
+		})
+	}
+}
+
+func TestValidateProfileOverrides(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{Profile: ProfileG82752}}
+	require.NoError(t, c.ApplyProfile())
+
+	c.ClockClass = 140
+	c.Priority2 = 1
+	c.MinSubInterval = time.Second
+	c.DomainNumber = 63
+	require.NoError(t, c.ValidateProfile())
+
+	// Default profile allows anything
+	c = &Config{StaticConfig: StaticConfig{Profile: ProfileDefault}}
+	require.NoError(t, c.ApplyProfile())
+	c.ClockClass = ptp.ClockClass52
+	c.Priority1 = 1
+	c.MinSubInterval = time.Microsecond
+	c.DomainNumber = 24
+	require.NoError(t, c.ValidateProfile())
+}
+
+func TestProfileReadDynamicConfig(t *testing.T) {
+	cfg, err := os.CreateTemp("", "ptp4u")
+	require.NoError(t, err)
+	defer os.Remove(cfg.Name())
+
+	_, err = cfg.WriteString("clockclass: 7\nminsubinterval: \"1s\"\n")
+	require.NoError(t, err)
+
+	c := &Config{StaticConfig: StaticConfig{Profile: ProfileG82752, ConfigFile: cfg.Name()}}
+	require.NoError(t, c.ApplyProfile())
+	dc, err := c.ReadDynamicConfig()
+	require.NoError(t, err)
+
+	// Overrides are applied on top of the profile defaults
+	expected, err := ProfileG82752.DynamicConfig()
+	require.NoError(t, err)
+	expected.ClockClass = ptp.ClockClass7
+	expected.MinSubInterval = time.Second
+	require.Equal(t, expected, dc)
+
+	// Overrides which violate the profile are rejected
+	require.NoError(t, cfg.Truncate(0))
+	_, err = cfg.WriteAt([]byte("clockclass: 52\n"), 0)
+	require.NoError(t, err)
+	_, err = c.ReadDynamicConfig()
+	require.Error(t, err)
+}
+
+func TestAnnounceClockClassProfile(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{Profile: ProfileG82752}}
+	require.NoError(t, c.ApplyProfile())
+	c.SetMaintenance(true)
+	require.Equal(t, clockClass248, c.AnnounceClockClass())
+
+	c = &Config{}
+	c.SetMaintenance(true)
+	require.Equal(t, MaintenanceClockClass, c.AnnounceClockClass())
+}
@@ -0,0 +1,91 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// tokenBucket holds tokens of a single client
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds tokens accumulated since the last refill, up to burst
+func (b *tokenBucket) refill(now time.Time, rate, burst float64) {
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+}
+
+// rateLimiter is a per client token bucket rate limiter keyed by the client address.
+// Zero value is ready to use
+type rateLimiter struct {
+	mux     sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// allow reports if the client can be served at now, taking a token from its bucket.
+// Bucket holds up to burst tokens and refills at rate tokens per second, rate <= 0 disables limiting
+func (l *rateLimiter) allow(ip net.IP, now time.Time, rate, burst int) bool {
+	if rate <= 0 {
+		return true
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.buckets == nil {
+		l.buckets = make(map[string]*tokenBucket)
+	}
+	key := string(ip.To16())
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+	b.refill(now, float64(rate), float64(burst))
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// forgetIdle drops buckets which are full by now, they are no different from the new ones
+func (l *rateLimiter) forgetIdle(now time.Time, rate, burst int) int {
+	if burst <= 0 {
+		burst = rate
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	forgotten := 0
+	for key, b := range l.buckets {
+		b.refill(now, float64(rate), float64(burst))
+		if rate <= 0 || b.tokens >= float64(burst) {
+			delete(l.buckets, key)
+			forgotten++
+		}
+	}
+	return forgotten
+}
@@ -0,0 +1,77 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	var l rateLimiter
+	ip := net.ParseIP("1.2.3.4")
+	other := net.ParseIP("2001:db8::1")
+	now := time.Now()
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if l.allow(ip, now, 2, 4) {
+			allowed++
+		}
+	}
+	require.Equal(t, 4, allowed)
+	// other clients have their own buckets
+	require.True(t, l.allow(other, now, 2, 4))
+
+	// refill at 2 per second
+	require.False(t, l.allow(ip, now.Add(400*time.Millisecond), 2, 4))
+	require.True(t, l.allow(ip, now.Add(500*time.Millisecond), 2, 4))
+	require.False(t, l.allow(ip, now.Add(500*time.Millisecond), 2, 4))
+}
+
+func TestRateLimiterDefaultBurst(t *testing.T) {
+	var l rateLimiter
+	ip := net.ParseIP("1.2.3.4")
+	now := time.Now()
+	require.True(t, l.allow(ip, now, 1, 0))
+	require.False(t, l.allow(ip, now, 1, 0))
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	var l rateLimiter
+	ip := net.ParseIP("1.2.3.4")
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		require.True(t, l.allow(ip, now, 0, 0))
+	}
+	require.Empty(t, l.buckets)
+}
+
+func TestRateLimiterForgetIdle(t *testing.T) {
+	var l rateLimiter
+	now := time.Now()
+	require.True(t, l.allow(net.ParseIP("1.2.3.4"), now, 1, 2))
+	require.True(t, l.allow(net.ParseIP("1.2.3.5"), now.Add(time.Second), 1, 2))
+
+	require.Equal(t, 1, l.forgetIdle(now.Add(1500*time.Millisecond), 1, 2))
+	require.Len(t, l.buckets, 1)
+	require.Equal(t, 1, l.forgetIdle(now.Add(2*time.Second), 1, 2))
+	require.Empty(t, l.buckets)
+}
@@ -0,0 +1,132 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"golang.org/x/sys/unix"
+)
+
+// selfTestTimeout is how long SelfTest waits for the packets when ctx has no deadline
+const selfTestTimeout = time.Second
+
+// selfTestMaxSkew is how far the FollowUp preciseOriginTimestamp may be from the system clock
+const selfTestMaxSkew = time.Second
+
+// SelfTestResult is what a passed SelfTest measured
+type SelfTestResult struct {
+	// TXTSLatency is how long it took to read the Sync TX timestamp
+	TXTSLatency time.Duration
+	// PreciseOriginTimestamp is the Sync TX timestamp the FollowUp carried
+	PreciseOriginTimestamp time.Time
+}
+
+// SelfTest sends Sync and FollowUp through the real send worker path to a local client
+// and checks the TX timestamp was read and the FollowUp carries it.
+// Packets to a local client never leave the loopback interface, which has no hardware timestamping,
+// so software timestamps are used whatever TimestampType is configured. NIC timestamping is not tested
+func (s *Server) SelfTest(ctx context.Context) (SelfTestResult, error) {
+	var res SelfTestResult
+	ip := s.Config.IP
+	if ip == nil || ip.IsUnspecified() {
+		ip = net.IPv6loopback
+		if s.Config.IP.To4() != nil {
+			ip = net.IPv4(127, 0, 0, 1)
+		}
+	}
+	eConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip})
+	if err != nil {
+		return res, fmt.Errorf("listening for sync: %w", err)
+	}
+	defer eConn.Close()
+	gConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip})
+	if err != nil {
+		return res, fmt.Errorf("listening for followup: %w", err)
+	}
+	defer gConn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(selfTestTimeout)
+	}
+	if err := eConn.SetReadDeadline(deadline); err != nil {
+		return res, err
+	}
+	if err := gConn.SetReadDeadline(deadline); err != nil {
+		return res, err
+	}
+
+	c := *s.Config
+	c.TimestampType = timestamp.SWTIMESTAMP
+	// dedicated worker and stats keep the self-test out of the server metrics
+	w := newSendWorker(0, &c, stats.NewJSONStats())
+	eFd, gFd, err := w.listen()
+	if err != nil {
+		return res, fmt.Errorf("creating worker sockets: %w", err)
+	}
+	defer unix.Close(eFd)
+	defer unix.Close(gFd)
+
+	esa := timestamp.IPToSockaddr(ip, eConn.LocalAddr().(*net.UDPAddr).Port)
+	gsa := timestamp.IPToSockaddr(ip, gConn.LocalAddr().(*net.UDPAddr).Port)
+	sc := NewSubscriptionClient(nil, nil, esa, gsa, ptp.MessageSync, &c, time.Second, deadline)
+
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	toob := make([]byte, timestamp.ControlSizeBytes)
+	res.TXTSLatency, err = w.sendSync(eFd, gFd, sc, buf, oob, toob)
+	if err != nil {
+		return res, fmt.Errorf("sending sync: %w", err)
+	}
+
+	n, err := eConn.Read(buf)
+	if err != nil {
+		return res, fmt.Errorf("receiving sync: %w", err)
+	}
+	sync := &ptp.SyncDelayReq{}
+	if err := ptp.FromBytes(buf[:n], sync); err != nil {
+		return res, fmt.Errorf("decoding sync: %w", err)
+	}
+	n, err = gConn.Read(buf)
+	if err != nil {
+		return res, fmt.Errorf("receiving followup: %w", err)
+	}
+	followup := &ptp.FollowUp{}
+	if err := ptp.FromBytes(buf[:n], followup); err != nil {
+		return res, fmt.Errorf("decoding followup: %w", err)
+	}
+
+	if followup.SequenceID != sync.SequenceID {
+		return res, fmt.Errorf("followup sequence %d doesn't match sync sequence %d", followup.SequenceID, sync.SequenceID)
+	}
+	// adjusted software timestamps are in TAI
+	now := c.clock().Now()
+	utcOffset, _ := c.UTCOffsetAt(now)
+	origin := followup.PreciseOriginTimestamp.Time()
+	if skew := origin.Sub(now.Add(utcOffset)); skew > selfTestMaxSkew || skew < -selfTestMaxSkew {
+		return res, fmt.Errorf("followup preciseOriginTimestamp %v is %v away from the system clock", origin, skew)
+	}
+	res.PreciseOriginTimestamp = origin
+	return res, nil
+}
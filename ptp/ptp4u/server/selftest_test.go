@@ -0,0 +1,91 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func selfTestServer() *Server {
+	return &Server{
+		Config: &Config{
+			clockIdentity: ptp.ClockIdentity(1234),
+			StaticConfig: StaticConfig{
+				IP:            net.ParseIP("127.0.0.1"),
+				TimestampType: timestamp.SWTIMESTAMP,
+			},
+			DynamicConfig: DynamicConfig{
+				UTCOffset: 37 * time.Second,
+			},
+		},
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	s := selfTestServer()
+	before := time.Now()
+	res, err := s.SelfTest(context.Background())
+	require.NoError(t, err)
+	require.Greater(t, res.TXTSLatency, time.Duration(0))
+	// software timestamp is adjusted to TAI
+	require.Greater(t, res.PreciseOriginTimestamp.Sub(before), 37*time.Second-time.Millisecond)
+
+	// unspecified IP is tested over loopback
+	s.Config.IP = net.ParseIP("0.0.0.0")
+	_, err = s.SelfTest(context.Background())
+	require.NoError(t, err)
+}
+
+func TestSelfTestHardwareTimestamps(t *testing.T) {
+	// loopback has no hardware timestamps, software ones are used instead
+	s := selfTestServer()
+	s.Config.TimestampType = timestamp.HWTIMESTAMP
+	_, err := s.SelfTest(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, timestamp.HWTIMESTAMP, s.Config.TimestampType)
+}
+
+func TestSelfTestTXTimestampFailure(t *testing.T) {
+	s := selfTestServer()
+	s.Config.Clock = txtsClock{read: func(connFd int, oob, toob []byte) (time.Time, int, error) {
+		return time.Time{}, 100, errors.New("no TX timestamp")
+	}}
+
+	_, err := s.SelfTest(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no TX timestamp")
+}
+
+func TestSelfTestInsaneTimestamp(t *testing.T) {
+	s := selfTestServer()
+	s.Config.Clock = txtsClock{read: func(connFd int, oob, toob []byte) (time.Time, int, error) {
+		_, attempts, err := timestamp.ReadTXtimestampBuf(connFd, oob, toob)
+		return time.Unix(0, 0), attempts, err
+	}}
+
+	_, err := s.SelfTest(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "away from the system clock")
+}
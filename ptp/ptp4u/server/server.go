@@ -37,16 +37,42 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+const (
+	// scaleInterval is an interval of send worker pool scaling checks
+	scaleInterval = time.Second
+	// workerIdleTimeout is how long a worker should be idle before it's retired
+	workerIdleTimeout = time.Minute
+)
+
 // Server is PTP unicast server
 type Server struct {
 	Config *Config
 	Stats  stats.Stats
 	Checks []drain.Drain
 	sw     []*sendWorker
+	swMux  sync.RWMutex
+
+	// assigned maps client port identity to the send worker its subscriptions are registered on,
+	// so they are found with a single lookup however the pool was scaled since.
+	// assignMux prevents forgetting clients while their subscriptions are being registered
+	assigned  sync.Map
+	assignMux sync.RWMutex
+
+	// delayReqLimiter limits delay requests rate per client
+	delayReqLimiter rateLimiter
+
+	// link is a source of the interface link state
+	link linkStater
+	// phc is a source of the interface PHC offset from the system clock
+	phc phcReader
 
 	// server source fds
 	eFd int
 	gFd int
+	// timestampingFailed is set while RX timestamps can't be re-enabled on the event listener
+	timestampingFailed int32
+	// unlockedSince is a unix nano time since the clock is unlocked, 0 if locked
+	unlockedSince int64
 
 	// drain logic
 	cancel context.CancelFunc
@@ -63,15 +89,12 @@ func (s *Server) Start() error {
 	}
 
 	// Set clock identity
-	iface, err := net.InterfaceByName(s.Config.Interface)
-	if err != nil {
-		return fmt.Errorf("unable to get mac address of the interface: %w", err)
-	}
-	s.Config.clockIdentity, err = ptp.NewClockIdentity(iface.HardwareAddr)
-	if err != nil {
-		return fmt.Errorf("unable to get the Clock Identity (EUI-64 address) of the interface: %w", err)
+	if err := s.setClockIdentity(); err != nil {
+		return err
 	}
 
+	s.setMTU()
+
 	// initialize the context for the subscriptions
 	s.ctx, s.cancel = context.WithCancel(context.Background())
 
@@ -86,10 +109,20 @@ func (s *Server) Start() error {
 	for i := 0; i < s.Config.SendWorkers; i++ {
 		// Each worker to monitor own queue
 		s.sw[i] = newSendWorker(i, s.Config, s.Stats)
-		go func(i int) {
+		go func(w *sendWorker) {
 			defer wg.Done()
-			s.sw[i].Start()
-		}(i)
+			w.Start()
+		}(s.sw[i])
+	}
+
+	// Scale send workers with the queue pressure
+	if s.scalingEnabled() {
+		go func() {
+			defer wg.Done()
+			for ; true; <-time.After(scaleInterval) {
+				s.scaleWorkers()
+			}
+		}()
 	}
 
 	go func() {
@@ -124,12 +157,33 @@ func (s *Server) Start() error {
 		}
 	}()
 
+	// Evict expired subscriptions
+	go func() {
+		defer wg.Done()
+		for ; true; <-time.After(s.sweepInterval()) {
+			s.sweepExpired()
+			s.delayReqLimiter.forgetIdle(s.Config.clock().Now(), s.Config.DelayReqRate, s.Config.DelayReqBurst)
+		}
+	}()
+
+	// Rebind sockets when the link comes back
+	go func() {
+		defer wg.Done()
+		s.watchLink()
+	}()
+
 	// Watch for SIGHUP and reload dynamic config
 	go func() {
 		defer wg.Done()
 		s.handleSighup()
 	}()
 
+	// Watch for SIGUSR1 and toggle maintenance mode
+	go func() {
+		defer wg.Done()
+		s.handleSigusr1()
+	}()
+
 	// Watch for SIGTERM and remove pid file
 	go func() {
 		defer wg.Done()
@@ -140,12 +194,20 @@ func (s *Server) Start() error {
 	go func() {
 		defer wg.Done()
 		for ; true; <-time.After(s.Config.MetricInterval) {
-			for _, w := range s.sw {
+			workers := s.workers()
+			for _, w := range workers {
 				w.inventoryClients()
 			}
-			s.Stats.SetUTCOffsetSec(int64(s.Config.UTCOffset.Seconds()))
+			s.Stats.SetWorkers(int64(len(workers)))
+			s.Stats.SetMTU(int64(s.Config.mtu))
+			s.reloadLeapSeconds()
+			utcOffset, _ := s.Config.UTCOffsetAt(s.Config.clock().Now())
+			s.Stats.SetUTCOffsetSec(int64(utcOffset.Seconds()))
 			s.Stats.SetClockAccuracy(int64(s.Config.ClockAccuracy))
-			s.Stats.SetClockClass(int64(s.Config.ClockClass))
+			s.Stats.SetClockClass(int64(s.Config.AnnounceClockClass()))
+			s.trackClockLock(s.Config.clock().Now())
+			s.measurePHCOffset()
+			s.setMaintenanceStats()
 
 			s.Stats.Snapshot()
 			s.Stats.Reset()
@@ -163,6 +225,37 @@ func (s *Server) Start() error {
 	return fmt.Errorf("one of server routines finished")
 }
 
+// setClockIdentity sets clock identity from the config override or derives it from the interface MAC
+func (s *Server) setClockIdentity() error {
+	if s.Config.ClockIdentity != 0 {
+		s.Config.clockIdentity = s.Config.ClockIdentity
+		return nil
+	}
+	iface, err := net.InterfaceByName(s.Config.Interface)
+	if err != nil {
+		return fmt.Errorf("unable to get mac address of the interface: %w", err)
+	}
+	s.Config.clockIdentity, err = ptp.NewClockIdentity(iface.HardwareAddr)
+	if err != nil {
+		return fmt.Errorf("unable to get the Clock Identity (EUI-64 address) of the interface: %w", err)
+	}
+	return nil
+}
+
+// setMTU sets MTU packets are checked against from the config override or the interface
+func (s *Server) setMTU() {
+	if s.Config.MTU != 0 {
+		s.Config.mtu = s.Config.MTU
+		return
+	}
+	iface, err := net.InterfaceByName(s.Config.Interface)
+	if err != nil {
+		log.Warningf("Unable to get MTU of the interface, packet size is not checked: %v", err)
+		return
+	}
+	s.Config.mtu = iface.MTU
+}
+
 // startEventListener launches the listener which listens to subscription requests
 func (s *Server) startEventListener() {
 	var err error
@@ -263,11 +356,7 @@ func (s *Server) handleEventMessages(eventConn *net.UDPConn) {
 	buf := make([]byte, timestamp.PayloadSizeBytes)
 	oob := make([]byte, timestamp.ControlSizeBytes)
 	dReq := &ptp.SyncDelayReq{}
-	// Initialize the new random. We will re-seed it every time in findWorker
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	var msgType ptp.MessageType
-	var worker *sendWorker
-	var sc *SubscriptionClient
 
 	for {
 		bbuf, clisa, rxTS, err := timestamp.ReadPacketWithRXTimestampBuf(s.eFd, buf, oob)
@@ -275,8 +364,11 @@ func (s *Server) handleEventMessages(eventConn *net.UDPConn) {
 			log.Errorf("Failed to read packet on %s: %v", eventConn.LocalAddr(), err)
 			continue
 		}
+		// rxTS may come from PHC, use system clock to measure the processing latency
+		read := s.Config.clock().Now()
 		if s.Config.TimestampType != timestamp.HWTIMESTAMP {
-			rxTS = rxTS.Add(s.Config.UTCOffset)
+			utcOffset, _ := s.Config.UTCOffsetAt(rxTS)
+			rxTS = rxTS.Add(utcOffset)
 		}
 
 		msgType, err = ptp.ProbeMsgType(buf[:bbuf])
@@ -289,26 +381,46 @@ func (s *Server) handleEventMessages(eventConn *net.UDPConn) {
 
 		switch msgType {
 		case ptp.MessageDelayReq:
+			if !s.delayReqLimiter.allow(timestamp.SockaddrToIP(clisa), read, s.Config.DelayReqRate, s.Config.DelayReqBurst) {
+				log.Debugf("Delay request from %s is rate limited", timestamp.SockaddrToIP(clisa))
+				s.Stats.IncDelayReqRateLimited()
+				continue
+			}
 			if err := ptp.FromBytes(buf[:bbuf], dReq); err != nil {
 				log.Errorf("Failed to read the ptp SyncDelayReq: %v", err)
 				continue
 			}
-
-			log.Debugf("Got delay request")
-			worker = s.findWorker(dReq.Header.SourcePortIdentity, r)
-			sc = worker.FindSubscription(dReq.Header.SourcePortIdentity, ptp.MessageDelayResp)
-			if sc == nil {
-				log.Infof("Delay request from %s is not in the subscription list", timestamp.SockaddrToIP(clisa))
-				continue
+			if log.IsLevelEnabled(log.TraceLevel) {
+				log.Tracef("Received from %s:\n%s", timestamp.SockaddrToIP(clisa), ptp.Describe(dReq))
 			}
-			sc.UpdateDelayResp(&dReq.Header, rxTS)
-			sc.Once()
+			s.handleDelayReq(dReq, clisa, rxTS, read)
 		default:
 			log.Errorf("Got unsupported message type %s(%d)", msgType, msgType)
 		}
 	}
 }
 
+// handleDelayReq queues Delay Response to the client. Requests from other domains and
+// from clients without Delay Response subscription are dropped
+func (s *Server) handleDelayReq(dReq *ptp.SyncDelayReq, clisa unix.Sockaddr, rxTS, read time.Time) {
+	if dReq.Header.DomainNumber != uint8(s.Config.DomainNumber) {
+		log.Debugf("Delay request from %s is in domain %d", timestamp.SockaddrToIP(clisa), dReq.Header.DomainNumber)
+		s.Stats.IncDelayReqWrongDomain()
+		return
+	}
+
+	log.Debugf("Got delay request")
+	_, sc := s.findSubscription(dReq.Header.SourcePortIdentity, ptp.MessageDelayResp)
+	if sc == nil {
+		log.Infof("Delay request from %s is not in the subscription list", timestamp.SockaddrToIP(clisa))
+		s.Stats.IncDelayReqDropped()
+		return
+	}
+	sc.UpdateDelayResp(&dReq.Header, rxTS)
+	sc.setDelayReqRead(read)
+	sc.Once()
+}
+
 // handleGeneralMessage is a handler which gets called every time General Message arrives
 func (s *Server) handleGeneralMessages(generalConn *net.UDPConn) {
 	buf := make([]byte, timestamp.PayloadSizeBytes)
@@ -318,10 +430,6 @@ func (s *Server) handleGeneralMessages(generalConn *net.UDPConn) {
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 
 	var signalingType ptp.MessageType
-	var durationt time.Duration
-	var intervalt time.Duration
-	var expire time.Time
-	var worker *sendWorker
 	var sc *SubscriptionClient
 
 	for {
@@ -344,56 +452,19 @@ func (s *Server) handleGeneralMessages(generalConn *net.UDPConn) {
 				log.Error(err)
 				continue
 			}
+			if log.IsLevelEnabled(log.TraceLevel) {
+				log.Tracef("Received from %s:\n%s", timestamp.SockaddrToIP(gclisa), ptp.Describe(signaling))
+			}
 
 			for _, tlv := range signaling.TLVs {
 				switch v := tlv.(type) {
 				case *ptp.RequestUnicastTransmissionTLV:
-					signalingType = v.MsgTypeAndReserved.MsgType()
-					s.Stats.IncRXSignalingGrant(signalingType)
-					log.Debugf("Got %s grant request", signalingType)
-					durationt = time.Duration(v.DurationField) * time.Second
-					expire = time.Now().Add(durationt)
-					intervalt = v.LogInterMessagePeriod.Duration()
-
-					switch signalingType {
-					case ptp.MessageAnnounce, ptp.MessageSync, ptp.MessageDelayResp:
-						worker = s.findWorker(signaling.SourcePortIdentity, r)
-						sc = worker.FindSubscription(signaling.SourcePortIdentity, signalingType)
-						if sc == nil || !sc.Running() {
-							ip := timestamp.SockaddrToIP(gclisa)
-							eclisa := timestamp.IPToSockaddr(ip, ptp.PortEvent)
-							sc = NewSubscriptionClient(worker.queue, worker.signalingQueue, eclisa, gclisa, signalingType, s.Config, intervalt, expire)
-							worker.RegisterSubscription(signaling.SourcePortIdentity, signalingType, sc)
-						} else {
-							// Update existing subscription data
-							sc.SetExpire(expire)
-							sc.SetInterval(intervalt)
-							// Update gclisa in case of renewal. This is against the standard,
-							// but we want to be able to respond to DelayResps coming from ephemeral ports
-							sc.SetGclisa(gclisa)
-						}
-
-						// Reject queries out of limit
-						if intervalt < s.Config.MinSubInterval || durationt > s.Config.MaxSubDuration || s.ctx.Err() != nil {
-							sc.sendSignalingGrant(signaling, v.MsgTypeAndReserved, v.LogInterMessagePeriod, 0)
-							continue
-						}
-
-						// Send confirmation grant
-						sc.sendSignalingGrant(signaling, v.MsgTypeAndReserved, v.LogInterMessagePeriod, v.DurationField)
-
-						if !sc.Running() {
-							go sc.Start(s.ctx)
-						}
-					default:
-						log.Errorf("Got unsupported grant type %s", signalingType)
-					}
+					s.handleGrant(signaling, v, gclisa, r)
 				case *ptp.CancelUnicastTransmissionTLV:
 					signalingType = v.MsgTypeAndFlags.MsgType()
 					s.Stats.IncRXSignalingCancel(signalingType)
 					log.Debugf("Got %s cancel request", signalingType)
-					worker = s.findWorker(signaling.SourcePortIdentity, r)
-					sc = worker.FindSubscription(signaling.SourcePortIdentity, signalingType)
+					_, sc = s.findSubscription(signaling.SourcePortIdentity, signalingType)
 					if sc != nil {
 						sc.Stop()
 					}
@@ -407,10 +478,188 @@ func (s *Server) handleGeneralMessages(generalConn *net.UDPConn) {
 	}
 }
 
+// handleGrant subscribes the client on unicast transmission request, or renews its existing subscription
+func (s *Server) handleGrant(signaling *ptp.Signaling, v *ptp.RequestUnicastTransmissionTLV, gclisa unix.Sockaddr, r *rand.Rand) {
+	signalingType := v.MsgTypeAndReserved.MsgType()
+	s.Stats.IncRXSignalingGrant(signalingType)
+	log.Debugf("Got %s grant request", signalingType)
+	// Clamp the requested duration and grant the one we will serve
+	durationt := s.Config.SubDuration(time.Duration(v.DurationField) * time.Second)
+	expire := s.Config.clock().Now().Add(durationt)
+	intervalt := v.LogInterMessagePeriod.Duration()
+
+	switch signalingType {
+	case ptp.MessageAnnounce, ptp.MessageSync, ptp.MessageDelayResp:
+		if ip := timestamp.SockaddrToIP(gclisa); !s.Config.AllowedNetworks.Allow(ip) {
+			log.Debugf("Rejected %s grant request from %s outside of allowed networks", signalingType, ip)
+			s.Stats.IncSubscriptionRejected(signalingType)
+			return
+		}
+		s.assignMux.RLock()
+		worker := s.findWorker(signaling.SourcePortIdentity, r)
+		sc := worker.FindSubscription(signaling.SourcePortIdentity, signalingType)
+		renewal := sc != nil && sc.Running()
+		if !renewal {
+			// keep the zone, so link-local clients are served over the interface they subscribed on
+			eclisa := timestamp.SockaddrWithPort(gclisa, ptp.PortEvent)
+			sc = NewSubscriptionClient(worker.queue, worker.signalingQueue, eclisa, gclisa, signalingType, s.Config, intervalt, expire)
+			for !worker.RegisterSubscription(signaling.SourcePortIdentity, signalingType, sc) {
+				// worker has just been retired, pick another one
+				s.assigned.Delete(signaling.SourcePortIdentity)
+				worker = s.findWorker(signaling.SourcePortIdentity, r)
+				sc = NewSubscriptionClient(worker.queue, worker.signalingQueue, eclisa, gclisa, signalingType, s.Config, intervalt, expire)
+			}
+		} else if !s.Config.Maintenance() {
+			// Update existing subscription data
+			sc.SetExpire(expire)
+			worker.setInterval(sc, intervalt)
+			// Update gclisa in case of renewal. This is against the standard,
+			// but we want to be able to respond to DelayResps coming from ephemeral ports
+			sc.SetGclisa(gclisa)
+		}
+		s.assignMux.RUnlock()
+
+		// Reject queries out of limit. In maintenance mode existing subscriptions are served until expiry
+		if intervalt < s.Config.MinSubInterval || s.ctx.Err() != nil || s.Config.Maintenance() {
+			sc.sendSignalingGrant(signaling, v.MsgTypeAndReserved, v.LogInterMessagePeriod, 0)
+			return
+		}
+
+		// Send confirmation grant
+		sc.sendSignalingGrant(signaling, v.MsgTypeAndReserved, v.LogInterMessagePeriod, uint32(durationt.Seconds()))
+		if renewal {
+			s.Stats.IncSubscriptionRenewed(signalingType)
+		} else {
+			s.Stats.IncSubscriptionGranted(signalingType)
+		}
+
+		if !sc.Running() {
+			go sc.Start(s.ctx)
+		}
+	default:
+		log.Errorf("Got unsupported grant type %s", signalingType)
+	}
+}
+
+// findWorker returns the worker client subscriptions are registered on.
+// New clients are assigned a worker according to the dispatch policy
 func (s *Server) findWorker(clientID ptp.PortIdentity, r *rand.Rand) *sendWorker {
+	if w, ok := s.assigned.Load(clientID); ok {
+		return w.(*sendWorker)
+	}
+	var worker *sendWorker
+	if s.Config.DispatchPolicy == DispatchLeastLoaded {
+		worker = s.leastLoadedWorker()
+	} else {
+		worker = s.hashWorker(clientID, r)
+	}
+	// all subscriptions of the client stay on the same worker
+	w, _ := s.assigned.LoadOrStore(clientID, worker)
+	return w.(*sendWorker)
+}
+
+// findSubscription looks up the client subscription and the worker it belongs to.
+// Returns nils for clients without subscriptions, nothing is assigned to them
+func (s *Server) findSubscription(clientID ptp.PortIdentity, st ptp.MessageType) (*sendWorker, *SubscriptionClient) {
+	w, ok := s.assigned.Load(clientID)
+	if !ok {
+		return nil, nil
+	}
+	worker := w.(*sendWorker)
+	return worker, worker.FindSubscription(clientID, st)
+}
+
+// hashWorker picks the worker by the client port identity
+func (s *Server) hashWorker(clientID ptp.PortIdentity, r *rand.Rand) *sendWorker {
+	workers := s.workers()
 	// Seeding random with the same value will produce the same number
 	r.Seed(int64(clientID.ClockIdentity) + int64(clientID.PortNumber))
-	return s.sw[r.Intn(s.Config.SendWorkers)]
+	return workers[r.Intn(len(workers))]
+}
+
+// leastLoadedWorker returns the worker with the lowest load
+func (s *Server) leastLoadedWorker() *sendWorker {
+	workers := s.workers()
+	worker := workers[0]
+	for _, w := range workers[1:] {
+		if w.Load() < worker.Load() {
+			worker = w
+		}
+	}
+	return worker
+}
+
+// forgetIdleClients drops worker assignments of clients without subscriptions
+func (s *Server) forgetIdleClients() {
+	s.assignMux.Lock()
+	defer s.assignMux.Unlock()
+	s.assigned.Range(func(k, v interface{}) bool {
+		if !v.(*sendWorker).hasClient(k.(ptp.PortIdentity)) {
+			s.assigned.Delete(k)
+		}
+		return true
+	})
+}
+
+// workers returns current send workers
+func (s *Server) workers() []*sendWorker {
+	s.swMux.RLock()
+	defer s.swMux.RUnlock()
+	return s.sw
+}
+
+// scalingEnabled reports if the send worker pool can scale
+func (s *Server) scalingEnabled() bool {
+	return s.Config.MaxSendWorkers > s.Config.SendWorkers
+}
+
+// scaleWorkers adds a send worker when any worker queue is deeper than ScaleQueueThreshold
+// and retires the last one once it's idle. The pool is kept between SendWorkers and MaxSendWorkers
+func (s *Server) scaleWorkers() {
+	s.swMux.Lock()
+	defer s.swMux.Unlock()
+
+	depth := 0
+	for _, w := range s.sw {
+		if q := len(w.queue); q > depth {
+			depth = q
+		}
+	}
+
+	n := len(s.sw)
+	switch {
+	case depth > s.Config.ScaleQueueThreshold && n < s.Config.MaxSendWorkers:
+		w := newSendWorker(n, s.Config, s.Stats)
+		go w.Start()
+		// never append in place, callers may hold the previous slice
+		s.sw = append(s.sw[:n:n], w)
+		log.Infof("Worker queue depth %d is over %d, scaled up to %d send workers", depth, s.Config.ScaleQueueThreshold, len(s.sw))
+	case depth == 0 && n > s.Config.SendWorkers && s.sw[n-1].retire(workerIdleTimeout):
+		s.sw = s.sw[: n-1 : n-1]
+		log.Infof("Retired idle worker#%d, scaled down to %d send workers", n-1, len(s.sw))
+	}
+	s.Stats.SetWorkers(int64(len(s.sw)))
+}
+
+// sweepInterval returns configured sweep interval falling back to a second
+func (s *Server) sweepInterval() time.Duration {
+	if s.Config.SweepInterval <= 0 {
+		return time.Second
+	}
+	return s.Config.SweepInterval
+}
+
+// sweepExpired evicts expired subscriptions from all workers
+func (s *Server) sweepExpired() int {
+	swept := 0
+	for _, w := range s.workers() {
+		swept += w.sweepExpired()
+	}
+	if swept > 0 {
+		log.Infof("Swept %d expired subscriptions", swept)
+	}
+	s.forgetIdleClients()
+	return swept
 }
 
 // Drain traffic
@@ -422,14 +671,11 @@ func (s *Server) Drain() {
 	// Wait for drain to complete for up to 10 seconds
 	for i := 0; i < 10; i++ {
 		// Verifying all subscriptions are over
-		for _, w := range s.sw {
+		for _, w := range s.workers() {
 			w.inventoryClients()
-			for _, subs := range w.clients {
-				if len(subs) != 0 {
-					log.Warningf("Still waiting for %d subscriptions on worker %d to finish...", len(subs), w.id)
-					time.Sleep(time.Second)
-					break
-				}
+			if n := w.subscriptionCount(); n != 0 {
+				log.Warningf("Still waiting for %d subscriptions on worker %d to finish...", n, w.id)
+				time.Sleep(time.Second)
 			}
 		}
 	}
@@ -442,18 +688,69 @@ func (s *Server) Undrain() {
 	}
 }
 
-// handleSighup watches for SIGHUP and reloads the dynamic config
+// SetMaintenance toggles maintenance mode. In maintenance mode announce messages report
+// a degraded clock class and no subscriptions are granted, existing ones are served until expiry.
+// Unlike Drain it doesn't stop serving traffic
+func (s *Server) SetMaintenance(maintenance bool) {
+	if maintenance {
+		log.Warningf("Engaging maintenance mode, announcing clock class %d", s.Config.Profile.maintenanceClockClass())
+	} else {
+		log.Warning("Disengaging maintenance mode")
+	}
+	s.Config.SetMaintenance(maintenance)
+	s.setMaintenanceStats()
+}
+
+// setMaintenanceStats reports maintenance mode state
+func (s *Server) setMaintenanceStats() {
+	if s.Config.Maintenance() {
+		s.Stats.SetMaintenance(1)
+	} else {
+		s.Stats.SetMaintenance(0)
+	}
+}
+
+// SetHoldover is called by the time source, e.g. a servo disciplining the PHC, entering or leaving holdover.
+// After HoldoverThreshold in holdover announce messages report HoldoverClockClass
+func (s *Server) SetHoldover(holdover bool) {
+	if holdover {
+		log.Warningf("Time source entered holdover, announcing degraded clock class after %v", s.Config.HoldoverThreshold)
+	} else {
+		log.Info("Time source left holdover")
+	}
+	s.Config.SetHoldover(holdover, s.Config.clock().Now())
+}
+
+// handleSigusr1 watches for SIGUSR1 and toggles maintenance mode
+func (s *Server) handleSigusr1() {
+	log.Infof("Engaging the SIGUSR1 monitoring")
+	sigchan := make(chan os.Signal, 10)
+	signal.Notify(sigchan, unix.SIGUSR1)
+	for range sigchan {
+		log.Info("SIGUSR1 received, toggling maintenance mode")
+		s.SetMaintenance(!s.Config.Maintenance())
+	}
+}
+
+// handleSighup watches for SIGHUP and reloads the dynamic config and the leap seconds file if it changed
 func (s *Server) handleSighup() {
 	log.Infof("Engaging the SIGHUP monitoring")
 	sigchan := make(chan os.Signal, 10)
 	signal.Notify(sigchan, unix.SIGHUP)
 	for range sigchan {
 		log.Info("SIGHUP received, reloading config")
-		dc, err := ReadDynamicConfig(s.Config.ConfigFile)
+		s.reloadLeapSeconds()
+		dc, err := s.Config.ReadDynamicConfig()
 		if err != nil {
 			log.Errorf("Failed to reload config: %v. Moving on", err)
 			continue
 		}
+		if dc.UTCOffset != s.Config.UTCOffset {
+			log.Warningf("UTC offset manually changed from %v to %v", s.Config.UTCOffset, dc.UTCOffset)
+			if len(s.Config.leapSecondsTable().seconds) > 0 {
+				log.Warningf("Leap seconds table from %s takes precedence over the configured UTC offset", s.Config.LeapSecondsFile)
+			}
+		}
 		dcMux.Lock()
 		s.Config.DynamicConfig = *dc
 		dcMux.Unlock()
@@ -462,6 +759,21 @@ func (s *Server) handleSighup() {
 	}
 }
 
+// reloadLeapSeconds picks up changes of the leap seconds file, keeping the loaded table if it can't be read
+func (s *Server) reloadLeapSeconds() {
+	if s.Config.LeapSecondsFile == "" {
+		return
+	}
+	reloaded, err := s.Config.ReloadLeapSeconds()
+	if err != nil {
+		log.Errorf("Failed to reload leap seconds: %v. Moving on", err)
+		return
+	}
+	if reloaded {
+		log.Infof("Reloaded leap seconds from %s", s.Config.LeapSecondsFile)
+	}
+}
+
 // handleSigterm watches for SIGTERM and SIGINT and removes the pid file
 func (s *Server) handleSigterm() {
 	log.Infof("Engaging the SIGTERM/SIGINT monitoring")
@@ -21,6 +21,7 @@ import (
 	"math/rand"
 	"net"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -74,6 +75,206 @@ func TestFindWorker(t *testing.T) {
 	require.Equal(t, 1, s.findWorker(clipi3, r).id)
 }
 
+func TestFindWorkerLeastLoaded(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			DispatchPolicy: DispatchLeastLoaded,
+			SendWorkers:    3,
+		},
+	}
+	s := Server{
+		Config: c,
+		Stats:  stats.NewJSONStats(),
+		sw:     make([]*sendWorker, c.SendWorkers),
+	}
+	for i := 0; i < s.Config.SendWorkers; i++ {
+		s.sw[i] = newSendWorker(i, c, s.Stats)
+	}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	clipi1 := ptp.PortIdentity{PortNumber: 1, ClockIdentity: ptp.ClockIdentity(1234)}
+	clipi2 := ptp.PortIdentity{PortNumber: 2, ClockIdentity: ptp.ClockIdentity(1234)}
+
+	// Busy worker is avoided
+	s.sw[0].load = 100
+	w := s.findWorker(clipi1, r)
+	require.Equal(t, 1, w.id)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	require.True(t, w.RegisterSubscription(clipi1, ptp.MessageSync, sc))
+	require.Equal(t, int64(3600), w.Load())
+
+	// Client sticks to the assigned worker
+	require.Equal(t, 1, s.findWorker(clipi1, r).id)
+	found, fsc := s.findSubscription(clipi1, ptp.MessageSync)
+	require.Equal(t, 1, found.id)
+	require.Equal(t, sc, fsc)
+
+	// New client goes to the least loaded one
+	require.Equal(t, 2, s.findWorker(clipi2, r).id)
+
+	// Clients without subscriptions are forgotten
+	s.sweepExpired()
+	_, ok := s.assigned.Load(clipi1)
+	require.True(t, ok)
+	_, ok = s.assigned.Load(clipi2)
+	require.False(t, ok)
+}
+
+// TestDispatchSkewedLoad simulates clients with skewed rates.
+// Worker load is the number of messages queued per hour, so the most loaded worker defines the tail latency
+func TestDispatchSkewedLoad(t *testing.T) {
+	maxLoad := func(policy string) int64 {
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		c := &Config{
+			clockIdentity: ptp.ClockIdentity(1234),
+			StaticConfig: StaticConfig{
+				DispatchPolicy: policy,
+				SendWorkers:    10,
+			},
+		}
+		s := Server{
+			Config: c,
+			Stats:  stats.NewJSONStats(),
+			sw:     make([]*sendWorker, c.SendWorkers),
+		}
+		for i := 0; i < s.Config.SendWorkers; i++ {
+			s.sw[i] = newSendWorker(i, c, s.Stats)
+		}
+		sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+		for i := 0; i < 1000; i++ {
+			clipi := ptp.PortIdentity{PortNumber: 1, ClockIdentity: ptp.ClockIdentity(i)}
+			// every 20th client syncs 128 times a second, the rest once a second
+			interval := time.Second
+			if i%20 == 0 {
+				interval = time.Second / 128
+			}
+			w := s.findWorker(clipi, r)
+			sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, interval, time.Now().Add(time.Minute))
+			require.True(t, w.RegisterSubscription(clipi, ptp.MessageSync, sc))
+		}
+		var load, total int64
+		for _, w := range s.sw {
+			total += w.Load()
+			if w.Load() > load {
+				load = w.Load()
+			}
+		}
+		t.Logf("%s: max worker load %d, mean %d", policy, load, total/int64(len(s.sw)))
+		return load
+	}
+
+	require.Less(t, maxLoad(DispatchLeastLoaded), maxLoad(DispatchHash))
+}
+
+func TestFindSubscriptionScaled(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			SendWorkers:    1,
+			MaxSendWorkers: 10,
+		},
+	}
+	s := Server{
+		Config: c,
+		Stats:  stats.NewJSONStats(),
+		sw:     []*sendWorker{newSendWorker(0, c, stats.NewJSONStats())},
+	}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	clipi := ptp.PortIdentity{PortNumber: 1, ClockIdentity: ptp.ClockIdentity(1234)}
+
+	// Unknown clients are not assigned a worker
+	w, sc := s.findSubscription(clipi, ptp.MessageSync)
+	require.Nil(t, w)
+	require.Nil(t, sc)
+	_, ok := s.assigned.Load(clipi)
+	require.False(t, ok)
+
+	w = s.findWorker(clipi, r)
+	sc = NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	require.True(t, w.RegisterSubscription(clipi, ptp.MessageSync, sc))
+
+	// Subscription stays on its worker however the pool grows
+	for i := 1; i < c.MaxSendWorkers; i++ {
+		s.sw = append(s.sw, newSendWorker(i, c, s.Stats))
+	}
+	found, fsc := s.findSubscription(clipi, ptp.MessageSync)
+	require.Equal(t, w, found)
+	require.Equal(t, sc, fsc)
+	require.Equal(t, w, s.findWorker(clipi, r))
+}
+
+func TestScaleWorkers(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			IP:                  net.ParseIP("127.0.0.1"),
+			TimestampType:       timestamp.SWTIMESTAMP,
+			SendWorkers:         1,
+			MaxSendWorkers:      2,
+			QueueSize:           10,
+			ScaleQueueThreshold: 1,
+		},
+	}
+	s := Server{
+		Config: c,
+		Stats:  stats.NewJSONStats(),
+		sw:     []*sendWorker{newSendWorker(0, c, stats.NewJSONStats())},
+	}
+	require.True(t, s.scalingEnabled())
+
+	// No queue pressure
+	s.scaleWorkers()
+	require.Equal(t, 1, len(s.workers()))
+
+	// Queue pressure grows the pool up to the max
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(s.sw[0].queue, s.sw[0].signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Now().Add(time.Minute))
+	s.sw[0].queue <- sc
+	s.sw[0].queue <- sc
+	s.scaleWorkers()
+	require.Equal(t, 2, len(s.workers()))
+	added := s.sw[1]
+	// stop the started worker even if the test fails halfway
+	t.Cleanup(func() {
+		added.mux.Lock()
+		defer added.mux.Unlock()
+		added.shutdown()
+	})
+	s.scaleWorkers()
+	require.Equal(t, 2, len(s.workers()))
+
+	// Pressure is gone, but the new worker is not idle long enough
+	<-s.sw[0].queue
+	<-s.sw[0].queue
+	s.scaleWorkers()
+	require.Equal(t, 2, len(s.workers()))
+
+	// Idle worker is retired, never below SendWorkers
+	atomic.StoreInt64(&added.lastActive, time.Now().Add(-2*workerIdleTimeout).UnixNano())
+	s.scaleWorkers()
+	require.Equal(t, 1, len(s.workers()))
+	require.False(t, added.RegisterSubscription(ptp.PortIdentity{}, ptp.MessageAnnounce, sc))
+	atomic.StoreInt64(&s.sw[0].lastActive, time.Now().Add(-2*workerIdleTimeout).UnixNano())
+	s.scaleWorkers()
+	require.Equal(t, 1, len(s.workers()))
+}
+
+func TestSetClockIdentity(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{Interface: "lo"}}
+	s := Server{Config: c}
+
+	// loopback has no MAC to derive clock identity from
+	err := s.setClockIdentity()
+	require.Error(t, err)
+
+	c.ClockIdentity = ptp.ClockIdentity(0xc42a1fffe6d7ca6)
+	err = s.setClockIdentity()
+	require.NoError(t, err)
+	require.Equal(t, ptp.ClockIdentity(0xc42a1fffe6d7ca6), c.clockIdentity)
+}
+
 func TestStartEventListener(t *testing.T) {
 	ptp.PortEvent = 0
 	c := &Config{
@@ -141,16 +342,190 @@ func TestUndrain(t *testing.T) {
 	require.NoError(t, s.ctx.Err())
 }
 
+func TestSetMaintenance(t *testing.T) {
+	w := &sendWorker{}
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		DynamicConfig: DynamicConfig{ClockClass: ptp.ClockClass6},
+	}
+	s := Server{
+		Config: c,
+		Stats:  stats.NewJSONStats(),
+	}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
+
+	sc.UpdateAnnounce()
+	require.Equal(t, ptp.ClockClass6, sc.Announce().GrandmasterClockQuality.ClockClass)
+
+	s.SetMaintenance(true)
+	require.True(t, c.Maintenance())
+	sc.UpdateAnnounce()
+	require.Equal(t, MaintenanceClockClass, sc.Announce().GrandmasterClockQuality.ClockClass)
+
+	s.SetMaintenance(false)
+	require.False(t, c.Maintenance())
+	sc.UpdateAnnounce()
+	require.Equal(t, ptp.ClockClass6, sc.Announce().GrandmasterClockQuality.ClockClass)
+}
+
+func TestServerSweepExpired(t *testing.T) {
+	c := &Config{
+		StaticConfig: StaticConfig{
+			SendWorkers: 2,
+			QueueSize:   10,
+		},
+	}
+	s := Server{
+		Config: c,
+		Stats:  stats.NewJSONStats(),
+		sw:     make([]*sendWorker, c.SendWorkers),
+	}
+	clipi := ptp.PortIdentity{
+		PortNumber:    1,
+		ClockIdentity: ptp.ClockIdentity(1234),
+	}
+
+	s.sw[0] = newSendWorker(0, s.Config, s.Stats)
+	s.sw[1] = newSendWorker(1, s.Config, s.Stats)
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	scA := NewSubscriptionClient(s.sw[0].queue, s.sw[0].signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Now().Add(-time.Second))
+	scS := NewSubscriptionClient(s.sw[1].queue, s.sw[1].signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(-time.Second))
+	s.sw[0].RegisterSubscription(clipi, ptp.MessageAnnounce, scA)
+	s.sw[1].RegisterSubscription(clipi, ptp.MessageSync, scS)
+
+	require.Equal(t, 2, s.sweepExpired())
+	require.Equal(t, 0, s.sweepExpired())
+}
+
+type grantStats struct {
+	*stats.JSONStats
+	granted int64
+	renewed int64
+}
+
+func (s *grantStats) IncSubscriptionGranted(_ ptp.MessageType) {
+	atomic.AddInt64(&s.granted, 1)
+}
+
+func (s *grantStats) IncSubscriptionRenewed(_ ptp.MessageType) {
+	atomic.AddInt64(&s.renewed, 1)
+}
+
+func TestHandleGrantRenewal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := &fakeClock{now: time.Date(2022, time.March, 1, 0, 0, 0, 0, time.UTC)}
+	c := &Config{
+		StaticConfig: StaticConfig{
+			SendWorkers: 1,
+			QueueSize:   10,
+		},
+		DynamicConfig: DynamicConfig{MaxSubDuration: 5 * time.Minute},
+		Clock:         clock,
+	}
+	st := &grantStats{JSONStats: stats.NewJSONStats()}
+	s := Server{
+		Config: c,
+		Stats:  st,
+		ctx:    ctx,
+		sw:     []*sendWorker{newSendWorker(0, c, st)},
+	}
+	clipi := ptp.PortIdentity{
+		PortNumber:    1,
+		ClockIdentity: ptp.ClockIdentity(1234),
+	}
+	signaling := &ptp.Signaling{Header: ptp.Header{SourcePortIdentity: clipi}}
+	req := &ptp.RequestUnicastTransmissionTLV{
+		MsgTypeAndReserved:    ptp.NewUnicastMsgTypeAndFlags(ptp.MessageSync, 0),
+		LogInterMessagePeriod: 0,
+		DurationField:         60,
+	}
+	gclisa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 320)
+	r := rand.New(rand.NewSource(0))
+
+	s.handleGrant(signaling, req, gclisa, r)
+	sc := s.sw[0].FindSubscription(clipi, ptp.MessageSync)
+	require.NotNil(t, sc)
+	time.Sleep(10 * time.Millisecond)
+	require.True(t, sc.Running())
+	require.Equal(t, int64(1), atomic.LoadInt64(&st.granted))
+
+	// renewal before expiry extends the same subscription, requested duration is clamped
+	clock.Advance(50 * time.Second)
+	req.DurationField = 600
+	s.handleGrant(signaling, req, gclisa, r)
+	require.True(t, sc == s.sw[0].FindSubscription(clipi, ptp.MessageSync))
+	require.Len(t, s.sw[0].FindClients(ptp.MessageSync), 1)
+	grant := sc.Signaling().TLVs[0].(*ptp.GrantUnicastTransmissionTLV)
+	require.Equal(t, uint32(300), grant.DurationField)
+	require.Equal(t, int64(1), atomic.LoadInt64(&st.granted))
+	require.Equal(t, int64(1), atomic.LoadInt64(&st.renewed))
+
+	clock.Advance(5 * time.Minute)
+	require.False(t, sc.Expired())
+	clock.Advance(time.Second)
+	require.True(t, sc.Expired())
+}
+
+func TestHandleGrantLinkLocal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &Config{
+		StaticConfig: StaticConfig{
+			SendWorkers: 1,
+			QueueSize:   10,
+		},
+		DynamicConfig: DynamicConfig{MaxSubDuration: 5 * time.Minute},
+	}
+	st := stats.NewJSONStats()
+	s := Server{
+		Config: c,
+		Stats:  st,
+		ctx:    ctx,
+		sw:     []*sendWorker{newSendWorker(0, c, st)},
+	}
+	clipi := ptp.PortIdentity{
+		PortNumber:    1,
+		ClockIdentity: ptp.ClockIdentity(1234),
+	}
+	signaling := &ptp.Signaling{Header: ptp.Header{SourcePortIdentity: clipi}}
+	req := &ptp.RequestUnicastTransmissionTLV{
+		MsgTypeAndReserved:    ptp.NewUnicastMsgTypeAndFlags(ptp.MessageSync, 0),
+		LogInterMessagePeriod: 0,
+		DurationField:         60,
+	}
+	gclisa := &unix.SockaddrInet6{Port: 320, ZoneId: 2}
+	copy(gclisa.Addr[:], net.ParseIP("fe80::1").To16())
+
+	s.handleGrant(signaling, req, gclisa, rand.New(rand.NewSource(0)))
+	sc := s.sw[0].FindSubscription(clipi, ptp.MessageSync)
+	require.NotNil(t, sc)
+	defer sc.Stop()
+	require.Equal(t, &unix.SockaddrInet6{Port: ptp.PortEvent, ZoneId: 2, Addr: gclisa.Addr}, sc.eclisa)
+	require.Equal(t, gclisa, sc.gclisa)
+}
+
+func TestSweepInterval(t *testing.T) {
+	s := Server{Config: &Config{}}
+	require.Equal(t, time.Second, s.sweepInterval())
+	s.Config.SweepInterval = time.Minute
+	require.Equal(t, time.Minute, s.sweepInterval())
+}
+
 func TestHandleSighup(t *testing.T) {
 	expected := &Config{
 		DynamicConfig: DynamicConfig{
-			ClockAccuracy:  0,
-			ClockClass:     1,
-			DrainInterval:  2 * time.Second,
-			MaxSubDuration: 3 * time.Hour,
-			MetricInterval: 4 * time.Minute,
-			MinSubInterval: 5 * time.Second,
-			UTCOffset:      37 * time.Second,
+			ClockAccuracy:           0,
+			ClockClass:              1,
+			DrainInterval:           2 * time.Second,
+			MaxSubDuration:          3 * time.Hour,
+			MetricInterval:          4 * time.Minute,
+			MinSubInterval:          5 * time.Second,
+			OffsetScaledLogVariance: DefaultOffsetScaledLogVariance,
+			Priority1:               DefaultPriority,
+			Priority2:               DefaultPriority,
+			UTCOffset:               37 * time.Second,
 		},
 	}
 
@@ -243,3 +618,62 @@ func TestHandleSigterm(t *testing.T) {
 	s.handleSigterm()
 	require.NoFileExists(t, cfg.Name())
 }
+
+type delayReqStats struct {
+	*stats.JSONStats
+	dropped     int64
+	wrongDomain int64
+}
+
+func (s *delayReqStats) IncDelayReqDropped() {
+	atomic.AddInt64(&s.dropped, 1)
+}
+
+func (s *delayReqStats) IncDelayReqWrongDomain() {
+	atomic.AddInt64(&s.wrongDomain, 1)
+}
+
+func TestHandleDelayReqDomain(t *testing.T) {
+	c := &Config{
+		StaticConfig: StaticConfig{
+			DomainNumber: 24,
+			QueueSize:    10,
+			SendWorkers:  1,
+		},
+	}
+	st := &delayReqStats{JSONStats: stats.NewJSONStats()}
+	s := Server{
+		Config: c,
+		Stats:  st,
+		sw:     []*sendWorker{newSendWorker(0, c, st)},
+	}
+	clipi := ptp.PortIdentity{
+		PortNumber:    1,
+		ClockIdentity: ptp.ClockIdentity(1234),
+	}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 319)
+	sc := NewSubscriptionClient(s.sw[0].queue, s.sw[0].signalingQueue, sa, sa, ptp.MessageDelayResp, c, time.Second, time.Now().Add(time.Minute))
+	s.sw[0].RegisterSubscription(clipi, ptp.MessageDelayResp, sc)
+	s.assigned.Store(clipi, s.sw[0])
+
+	dReq := &ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageDelayReq, 0),
+			DomainNumber:       0,
+			SequenceID:         1,
+			SourcePortIdentity: clipi,
+		},
+	}
+	s.handleDelayReq(dReq, sa, time.Now(), time.Now())
+	require.Equal(t, int64(1), atomic.LoadInt64(&st.wrongDomain))
+	require.Equal(t, int64(0), atomic.LoadInt64(&st.dropped))
+	require.Len(t, s.sw[0].queue, 0)
+
+	dReq.DomainNumber = 24
+	s.handleDelayReq(dReq, sa, time.Now(), time.Now())
+	require.Equal(t, int64(1), atomic.LoadInt64(&st.wrongDomain))
+	require.Len(t, s.sw[0].queue, 1)
+	resp := (<-s.sw[0].queue).DelayResp()
+	require.Equal(t, uint8(24), resp.DomainNumber)
+	require.Equal(t, uint16(1), resp.SequenceID)
+}
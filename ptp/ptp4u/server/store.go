@@ -0,0 +1,106 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sync"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// SubscriptionStore keeps subscriptions of a send worker. Implementations must be safe for concurrent use,
+// a sharded one can be supplied via Config.NewSubscriptionStore to reduce lock contention with many clients
+type SubscriptionStore interface {
+	// Add stores the subscription, overwriting an existing one
+	Add(clientID ptp.PortIdentity, st ptp.MessageType, sc *SubscriptionClient)
+	// Get returns the subscription, nil if there is none
+	Get(clientID ptp.PortIdentity, st ptp.MessageType) *SubscriptionClient
+	// Remove deletes the subscription if present
+	Remove(clientID ptp.PortIdentity, st ptp.MessageType)
+	// Range calls f for every subscription until f returns false. f must not modify the store
+	Range(f func(clientID ptp.PortIdentity, st ptp.MessageType, sc *SubscriptionClient) bool)
+	// Expire removes all subscriptions matching the expired func and returns them
+	Expire(expired func(sc *SubscriptionClient) bool) []*SubscriptionClient
+}
+
+// MapSubscriptionStore is the default SubscriptionStore, a map guarded by a single lock
+type MapSubscriptionStore struct {
+	sync.RWMutex
+	clients map[ptp.MessageType]map[ptp.PortIdentity]*SubscriptionClient
+}
+
+// NewMapSubscriptionStore creates a new MapSubscriptionStore
+func NewMapSubscriptionStore() *MapSubscriptionStore {
+	return &MapSubscriptionStore{
+		clients: make(map[ptp.MessageType]map[ptp.PortIdentity]*SubscriptionClient),
+	}
+}
+
+// Add stores the subscription, overwriting an existing one
+func (m *MapSubscriptionStore) Add(clientID ptp.PortIdentity, st ptp.MessageType, sc *SubscriptionClient) {
+	m.Lock()
+	defer m.Unlock()
+	subs, ok := m.clients[st]
+	if !ok {
+		subs = map[ptp.PortIdentity]*SubscriptionClient{}
+		m.clients[st] = subs
+	}
+	subs[clientID] = sc
+}
+
+// Get returns the subscription, nil if there is none
+func (m *MapSubscriptionStore) Get(clientID ptp.PortIdentity, st ptp.MessageType) *SubscriptionClient {
+	m.RLock()
+	defer m.RUnlock()
+	return m.clients[st][clientID]
+}
+
+// Remove deletes the subscription if present
+func (m *MapSubscriptionStore) Remove(clientID ptp.PortIdentity, st ptp.MessageType) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.clients[st], clientID)
+}
+
+// Range calls f for every subscription until f returns false
+func (m *MapSubscriptionStore) Range(f func(clientID ptp.PortIdentity, st ptp.MessageType, sc *SubscriptionClient) bool) {
+	m.RLock()
+	defer m.RUnlock()
+	for st, subs := range m.clients {
+		for clientID, sc := range subs {
+			if !f(clientID, st, sc) {
+				return
+			}
+		}
+	}
+}
+
+// Expire removes all subscriptions matching the expired func and returns them
+func (m *MapSubscriptionStore) Expire(expired func(sc *SubscriptionClient) bool) []*SubscriptionClient {
+	m.Lock()
+	defer m.Unlock()
+	var res []*SubscriptionClient
+	for _, subs := range m.clients {
+		for clientID, sc := range subs {
+			if expired(sc) {
+				delete(subs, clientID)
+				res = append(res, sc)
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,180 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+// shardedSubscriptionStore spreads subscriptions over MapSubscriptionStore shards by client clock identity
+type shardedSubscriptionStore []*MapSubscriptionStore
+
+func newShardedSubscriptionStore(n int) shardedSubscriptionStore {
+	s := make(shardedSubscriptionStore, n)
+	for i := range s {
+		s[i] = NewMapSubscriptionStore()
+	}
+	return s
+}
+
+func (s shardedSubscriptionStore) shard(clientID ptp.PortIdentity) *MapSubscriptionStore {
+	return s[uint64(clientID.ClockIdentity)%uint64(len(s))]
+}
+
+func (s shardedSubscriptionStore) Add(clientID ptp.PortIdentity, st ptp.MessageType, sc *SubscriptionClient) {
+	s.shard(clientID).Add(clientID, st, sc)
+}
+
+func (s shardedSubscriptionStore) Get(clientID ptp.PortIdentity, st ptp.MessageType) *SubscriptionClient {
+	return s.shard(clientID).Get(clientID, st)
+}
+
+func (s shardedSubscriptionStore) Remove(clientID ptp.PortIdentity, st ptp.MessageType) {
+	s.shard(clientID).Remove(clientID, st)
+}
+
+func (s shardedSubscriptionStore) Range(f func(clientID ptp.PortIdentity, st ptp.MessageType, sc *SubscriptionClient) bool) {
+	stop := false
+	for _, m := range s {
+		m.Range(func(clientID ptp.PortIdentity, st ptp.MessageType, sc *SubscriptionClient) bool {
+			stop = !f(clientID, st, sc)
+			return !stop
+		})
+		if stop {
+			return
+		}
+	}
+}
+
+func (s shardedSubscriptionStore) Expire(expired func(sc *SubscriptionClient) bool) []*SubscriptionClient {
+	var res []*SubscriptionClient
+	for _, m := range s {
+		res = append(res, m.Expire(expired)...)
+	}
+	return res
+}
+
+func testSubscriptionStore(t *testing.T, store SubscriptionStore) {
+	c := &Config{}
+	sp1 := ptp.PortIdentity{PortNumber: 1, ClockIdentity: ptp.ClockIdentity(1234)}
+	sp2 := ptp.PortIdentity{PortNumber: 1, ClockIdentity: ptp.ClockIdentity(5678)}
+	sc1 := NewSubscriptionClient(nil, nil, nil, nil, ptp.MessageSync, c, time.Second, time.Now().Add(-time.Second))
+	sc2 := NewSubscriptionClient(nil, nil, nil, nil, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	sc3 := NewSubscriptionClient(nil, nil, nil, nil, ptp.MessageAnnounce, c, time.Second, time.Now().Add(time.Minute))
+
+	require.Nil(t, store.Get(sp1, ptp.MessageSync))
+	store.Add(sp1, ptp.MessageSync, sc1)
+	store.Add(sp2, ptp.MessageSync, sc2)
+	store.Add(sp1, ptp.MessageAnnounce, sc3)
+	require.True(t, store.Get(sp1, ptp.MessageSync) == sc1)
+	require.True(t, store.Get(sp1, ptp.MessageAnnounce) == sc3)
+	require.Nil(t, store.Get(sp2, ptp.MessageAnnounce))
+
+	n := 0
+	store.Range(func(ptp.PortIdentity, ptp.MessageType, *SubscriptionClient) bool {
+		n++
+		return true
+	})
+	require.Equal(t, 3, n)
+
+	n = 0
+	store.Range(func(ptp.PortIdentity, ptp.MessageType, *SubscriptionClient) bool {
+		n++
+		return false
+	})
+	require.Equal(t, 1, n)
+
+	expired := store.Expire(func(sc *SubscriptionClient) bool { return sc.Expired() })
+	require.Len(t, expired, 1)
+	require.True(t, expired[0] == sc1)
+	require.Nil(t, store.Get(sp1, ptp.MessageSync))
+
+	store.Remove(sp2, ptp.MessageSync)
+	require.Nil(t, store.Get(sp2, ptp.MessageSync))
+	// removing a missing subscription is a no-op
+	store.Remove(sp2, ptp.MessageDelayResp)
+	require.True(t, store.Get(sp1, ptp.MessageAnnounce) == sc3)
+}
+
+func TestMapSubscriptionStore(t *testing.T) {
+	testSubscriptionStore(t, NewMapSubscriptionStore())
+}
+
+func TestShardedSubscriptionStore(t *testing.T) {
+	testSubscriptionStore(t, newShardedSubscriptionStore(4))
+}
+
+func TestConfigNewSubscriptionStore(t *testing.T) {
+	c := &Config{}
+	_, ok := newSendWorker(0, c, nil).clients.(*MapSubscriptionStore)
+	require.True(t, ok)
+
+	c.NewSubscriptionStore = func() SubscriptionStore { return newShardedSubscriptionStore(4) }
+	w := newSendWorker(0, c, nil)
+	_, ok = w.clients.(shardedSubscriptionStore)
+	require.True(t, ok)
+
+	sp := ptp.PortIdentity{PortNumber: 1, ClockIdentity: ptp.ClockIdentity(1234)}
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, nil, nil, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	require.True(t, w.RegisterSubscription(sp, ptp.MessageSync, sc))
+	require.True(t, w.FindSubscription(sp, ptp.MessageSync) == sc)
+	require.True(t, w.hasClient(sp))
+}
+
+// benchmarkSubscriptionStore looks up and renews subscriptions from parallel goroutines
+// while one in every 64 operations ranges over the whole store, like the sweeper does
+func benchmarkSubscriptionStore(b *testing.B, store SubscriptionStore) {
+	const clients = 10000
+	c := &Config{}
+	ids := make([]ptp.PortIdentity, clients)
+	for i := range ids {
+		ids[i] = ptp.PortIdentity{PortNumber: 1, ClockIdentity: ptp.ClockIdentity(i)}
+		store.Add(ids[i], ptp.MessageSync, NewSubscriptionClient(nil, nil, nil, nil, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute)))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			id := ids[i%clients]
+			switch {
+			case i%64 == 0:
+				store.Range(func(ptp.PortIdentity, ptp.MessageType, *SubscriptionClient) bool { return true })
+			case i%2 == 0:
+				store.Add(id, ptp.MessageSync, store.Get(id, ptp.MessageSync))
+			default:
+				store.Get(id, ptp.MessageSync)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkSubscriptionStore(b *testing.B) {
+	b.Run("map", func(b *testing.B) {
+		benchmarkSubscriptionStore(b, NewMapSubscriptionStore())
+	})
+	for _, shards := range []int{4, 16, 64} {
+		b.Run(fmt.Sprintf("sharded-%d", shards), func(b *testing.B) {
+			benchmarkSubscriptionStore(b, newShardedSubscriptionStore(shards))
+		})
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
 	"github.com/facebook/time/timestamp"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
@@ -40,6 +41,8 @@ type SubscriptionClient struct {
 	signalingQueue   chan *SubscriptionClient
 	subscriptionType ptp.MessageType
 	serverConfig     *Config
+	// stats of the worker owning the queue, set on registration
+	stats stats.Stats
 
 	interval   time.Duration
 	expire     time.Time
@@ -60,6 +63,12 @@ type SubscriptionClient struct {
 	announceP  *ptp.Announce
 	delayRespP *ptp.DelayResp
 	signaling  *ptp.Signaling
+
+	// delayReqRead is a system time the last DelayReq was read off the socket.
+	// Set by the listener and read by the worker, so guarded by the mutex
+	delayReqRead time.Time
+	// lastSyncTX is a TX timestamp of the last Sync sent to the client
+	lastSyncTX time.Time
 }
 
 // NewSubscriptionClient gets minimal required arguments to create a subscription
@@ -95,7 +104,7 @@ func (sc *SubscriptionClient) Start(ctx context.Context) {
 		sc.Once()
 	}
 
-	sc.runningInterval = sc.interval
+	sc.runningInterval = sc.Interval()
 	sc.intervalTicker = time.NewTicker(sc.runningInterval)
 
 	defer log.Infof(over)
@@ -115,8 +124,8 @@ func (sc *SubscriptionClient) Start(ctx context.Context) {
 			}
 
 			// check if interval changed, maybe update our ticker
-			if sc.runningInterval != sc.interval {
-				sc.runningInterval = sc.interval
+			if interval := sc.Interval(); sc.runningInterval != interval {
+				sc.runningInterval = interval
 				sc.intervalTicker.Reset(sc.runningInterval)
 			}
 			if sc.subscriptionType != ptp.MessageDelayResp {
@@ -127,9 +136,41 @@ func (sc *SubscriptionClient) Start(ctx context.Context) {
 	}
 }
 
-// Once adds itself to the worker queue once
+// Once adds itself to the worker queue once.
+// Full queue is handled according to the QueuePolicy, blocking by default
 func (sc *SubscriptionClient) Once() {
-	sc.queue <- sc
+	switch sc.serverConfig.QueuePolicy {
+	case QueuePolicyDropNewest:
+		select {
+		case sc.queue <- sc:
+		default:
+			sc.dropped(sc)
+		}
+	case QueuePolicyDropOldest:
+		for {
+			select {
+			case sc.queue <- sc:
+				return
+			default:
+			}
+			// worker may drain the queue meanwhile, don't wait for it
+			select {
+			case old := <-sc.queue:
+				sc.dropped(old)
+			default:
+			}
+		}
+	default:
+		sc.queue <- sc
+	}
+}
+
+// dropped accounts for the job of the subscription dropped from the worker queue
+func (sc *SubscriptionClient) dropped(job *SubscriptionClient) {
+	log.Debugf("Worker queue is full, dropped %s for %s", job.subscriptionType, timestamp.SockaddrToIP(job.eclisa))
+	if sc.stats != nil {
+		sc.stats.IncQueueDropped(job.subscriptionType)
+	}
 }
 
 // OnceSignaling adds itself to the worker signaling queue once
@@ -141,7 +182,7 @@ func (sc *SubscriptionClient) OnceSignaling() {
 func (sc *SubscriptionClient) Expired() bool {
 	sc.Lock()
 	defer sc.Unlock()
-	return time.Now().After(sc.expire)
+	return sc.serverConfig.clock().Now().After(sc.expire)
 }
 
 // Stop stops the subscription
@@ -149,7 +190,7 @@ func (sc *SubscriptionClient) Stop() {
 	sc.Lock()
 	defer sc.Unlock()
 	// Make sure we mark subscription as expired
-	sc.expire = time.Now()
+	sc.expire = sc.serverConfig.clock().Now()
 	// And demand subscription stop
 	if sc.running {
 		sc.stop <- true
@@ -177,6 +218,13 @@ func (sc *SubscriptionClient) SetInterval(interval time.Duration) {
 	sc.interval = interval
 }
 
+// Interval atomically returns interval
+func (sc *SubscriptionClient) Interval() time.Duration {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.interval
+}
+
 // SetGclisa atomically sets gclisa
 func (sc *SubscriptionClient) SetGclisa(gclisa unix.Sockaddr) {
 	sc.Lock()
@@ -196,28 +244,36 @@ func (sc *SubscriptionClient) IncSequenceID() {
 	sc.sequenceID++
 }
 
+// header builds the common header of the message type sent by this server
+func (sc *SubscriptionClient) header(msgType ptp.MessageType, flags uint16, length int, interval ptp.LogInterval) ptp.Header {
+	h := ptp.NewHeader(
+		msgType,
+		uint8(sc.serverConfig.TransportSpecific),
+		uint8(sc.serverConfig.DomainNumber),
+		flags,
+		0,
+		sc.serverConfig.SourcePortIdentity(),
+	)
+	h.MessageLength = uint16(length)
+	h.LogMessageInterval = interval
+	return h
+}
+
 func (sc *SubscriptionClient) initSync() {
 	sc.syncP = &ptp.SyncDelayReq{
-		Header: ptp.Header{
-			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageSync, 0),
-			Version:         ptp.Version,
-			MessageLength:   uint16(binary.Size(ptp.SyncDelayReq{})),
-			DomainNumber:    0,
-			FlagField:       ptp.FlagUnicast | ptp.FlagTwoStep,
-			SequenceID:      0,
-			SourcePortIdentity: ptp.PortIdentity{
-				PortNumber:    1,
-				ClockIdentity: sc.serverConfig.clockIdentity,
-			},
-			LogMessageInterval: 0x7f,
-			ControlField:       0,
-		},
+		Header: sc.header(ptp.MessageSync, ptp.FlagUnicast|ptp.FlagTwoStep, binary.Size(ptp.SyncDelayReq{}), unicastLogInterval),
 	}
 }
 
 // UpdateSync updates ptp Sync packet
 func (sc *SubscriptionClient) UpdateSync() {
 	sc.syncP.SequenceID = sc.sequenceID
+	// we are the GM, there is no residence time to account for
+	sc.syncP.CorrectionField = 0
+	sc.syncP.LogMessageInterval = unicastLogInterval
+	if sc.serverConfig.LogSyncInterval != nil {
+		sc.syncP.LogMessageInterval = *sc.serverConfig.LogSyncInterval
+	}
 }
 
 // Sync returns ptp Sync packet
@@ -227,30 +283,21 @@ func (sc *SubscriptionClient) Sync() *ptp.SyncDelayReq {
 
 func (sc *SubscriptionClient) initFollowup() {
 	sc.followupP = &ptp.FollowUp{
-		Header: ptp.Header{
-			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageFollowUp, 0),
-			Version:         ptp.Version,
-			MessageLength:   uint16(binary.Size(ptp.FollowUp{})),
-			DomainNumber:    0,
-			FlagField:       ptp.FlagUnicast,
-			SequenceID:      0,
-			SourcePortIdentity: ptp.PortIdentity{
-				PortNumber:    1,
-				ClockIdentity: sc.serverConfig.clockIdentity,
-			},
-			LogMessageInterval: 0,
-			ControlField:       2,
-		},
+		Header: sc.header(ptp.MessageFollowUp, ptp.FlagUnicast, binary.Size(ptp.FollowUp{}), 0),
 		FollowUpBody: ptp.FollowUpBody{
-			PreciseOriginTimestamp: ptp.NewTimestamp(time.Now()),
+			PreciseOriginTimestamp: ptp.NewTimestamp(sc.serverConfig.clock().Now()),
 		},
 	}
 }
 
-// UpdateFollowup updates ptp Follow Up packet
-func (sc *SubscriptionClient) UpdateFollowup(hwts time.Time) {
+// UpdateFollowup updates ptp Follow Up packet for the Sync with the sequence id
+func (sc *SubscriptionClient) UpdateFollowup(seq uint16, hwts time.Time) {
 	i, _ := ptp.NewLogInterval(sc.interval)
-	sc.followupP.SequenceID = sc.sequenceID
+	if sc.serverConfig.LogSyncInterval != nil {
+		i = *sc.serverConfig.LogSyncInterval
+	}
+	sc.followupP.SequenceID = seq
+	sc.followupP.CorrectionField = 0
 	sc.followupP.LogMessageInterval = i
 	sc.followupP.PreciseOriginTimestamp = ptp.NewTimestamp(hwts)
 }
@@ -262,30 +309,17 @@ func (sc *SubscriptionClient) Followup() *ptp.FollowUp {
 
 func (sc *SubscriptionClient) initAnnounce() {
 	sc.announceP = &ptp.Announce{
-		Header: ptp.Header{
-			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageAnnounce, 0),
-			Version:         ptp.Version,
-			MessageLength:   uint16(binary.Size(ptp.Header{}) + binary.Size(ptp.AnnounceBody{})),
-			DomainNumber:    0,
-			FlagField:       ptp.FlagUnicast | ptp.FlagPTPTimescale,
-			SequenceID:      0,
-			SourcePortIdentity: ptp.PortIdentity{
-				PortNumber:    1,
-				ClockIdentity: sc.serverConfig.clockIdentity,
-			},
-			LogMessageInterval: 0,
-			ControlField:       5,
-		},
+		Header: sc.header(ptp.MessageAnnounce, ptp.FlagUnicast|ptp.FlagPTPTimescale, binary.Size(ptp.Header{})+binary.Size(ptp.AnnounceBody{}), 0),
 		AnnounceBody: ptp.AnnounceBody{
 			CurrentUTCOffset:     0,
 			Reserved:             0,
-			GrandmasterPriority1: 128,
+			GrandmasterPriority1: DefaultPriority,
 			GrandmasterClockQuality: ptp.ClockQuality{
 				ClockClass:              0,
 				ClockAccuracy:           0,
-				OffsetScaledLogVariance: 23008,
+				OffsetScaledLogVariance: DefaultOffsetScaledLogVariance,
 			},
-			GrandmasterPriority2: 128,
+			GrandmasterPriority2: DefaultPriority,
 			GrandmasterIdentity:  sc.serverConfig.clockIdentity,
 			StepsRemoved:         0,
 			TimeSource:           ptp.TimeSourceGNSS,
@@ -295,12 +329,37 @@ func (sc *SubscriptionClient) initAnnounce() {
 
 // UpdateAnnounce updates ptp Announce packet
 func (sc *SubscriptionClient) UpdateAnnounce() {
+	sc.updateAnnounceAt(sc.serverConfig.clock().Now())
+}
+
+// updateAnnounceAt updates ptp Announce packet with the UTC offset in effect at the moment
+func (sc *SubscriptionClient) updateAnnounceAt(now time.Time) {
 	i, _ := ptp.NewLogInterval(sc.interval)
+	if sc.serverConfig.LogAnnounceInterval != nil {
+		i = *sc.serverConfig.LogAnnounceInterval
+	}
 	sc.announceP.SequenceID = sc.sequenceID
 	sc.announceP.LogMessageInterval = i
-	sc.announceP.CurrentUTCOffset = int16(sc.serverConfig.UTCOffset.Seconds())
-	sc.announceP.GrandmasterClockQuality.ClockClass = sc.serverConfig.ClockClass
+	utcOffset, valid := sc.serverConfig.UTCOffsetAt(now)
+	if current := int16(utcOffset.Seconds()); current != sc.announceP.CurrentUTCOffset {
+		// zero is the initial value of a new subscription
+		if sc.announceP.CurrentUTCOffset != 0 {
+			log.Infof("UTC offset announced to %v changed from %ds to %ds", sc.eclisa, sc.announceP.CurrentUTCOffset, current)
+		}
+		sc.announceP.CurrentUTCOffset = current
+	}
+	if valid {
+		sc.announceP.FlagField |= ptp.FlagCurrentUtcOffsetValid
+	} else {
+		sc.announceP.FlagField &^= ptp.FlagCurrentUtcOffsetValid
+	}
+	sc.announceP.GrandmasterClockQuality.ClockClass = sc.serverConfig.announceClockClassAt(now)
 	sc.announceP.GrandmasterClockQuality.ClockAccuracy = sc.serverConfig.ClockAccuracy
+	sc.announceP.GrandmasterClockQuality.OffsetScaledLogVariance = sc.serverConfig.OffsetScaledLogVariance
+	sc.announceP.GrandmasterPriority1 = sc.serverConfig.Priority1
+	sc.announceP.GrandmasterPriority2 = sc.serverConfig.Priority2
+	sc.announceP.GrandmasterIdentity = sc.serverConfig.AnnounceGrandmasterIdentity()
+	sc.announceP.StepsRemoved = sc.serverConfig.StepsRemoved
 }
 
 // Announce returns ptp Announce packet
@@ -310,21 +369,7 @@ func (sc *SubscriptionClient) Announce() *ptp.Announce {
 
 func (sc *SubscriptionClient) initDelayResp() {
 	sc.delayRespP = &ptp.DelayResp{
-		Header: ptp.Header{
-			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageDelayResp, 0),
-			Version:         ptp.Version,
-			MessageLength:   uint16(binary.Size(ptp.DelayResp{})),
-			DomainNumber:    0,
-			FlagField:       ptp.FlagUnicast,
-			SequenceID:      0,
-			SourcePortIdentity: ptp.PortIdentity{
-				PortNumber:    1,
-				ClockIdentity: sc.serverConfig.clockIdentity,
-			},
-			LogMessageInterval: 0x7f,
-			ControlField:       3,
-			CorrectionField:    0,
-		},
+		Header:        sc.header(ptp.MessageDelayResp, ptp.FlagUnicast, binary.Size(ptp.DelayResp{}), 0x7f),
 		DelayRespBody: ptp.DelayRespBody{},
 	}
 }
@@ -339,6 +384,20 @@ func (sc *SubscriptionClient) UpdateDelayResp(h *ptp.Header, received time.Time)
 	}
 }
 
+// setDelayReqRead atomically sets the system time the last DelayReq was read off the socket
+func (sc *SubscriptionClient) setDelayReqRead(read time.Time) {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.delayReqRead = read
+}
+
+// delayReqReadTime atomically returns the system time the last DelayReq was read off the socket
+func (sc *SubscriptionClient) delayReqReadTime() time.Time {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.delayReqRead
+}
+
 // DelayResp returns ptp Delay Response packet
 func (sc *SubscriptionClient) DelayResp() *ptp.DelayResp {
 	return sc.delayRespP
@@ -347,33 +406,34 @@ func (sc *SubscriptionClient) DelayResp() *ptp.DelayResp {
 func (sc *SubscriptionClient) initSignaling() {
 	sc.signaling = &ptp.Signaling{
 		Header: ptp.Header{
-			Version:       ptp.Version,
-			MessageLength: uint16(binary.Size(ptp.Header{}) + binary.Size(ptp.PortIdentity{}) + binary.Size(ptp.GrantUnicastTransmissionTLV{})),
-			FlagField:     ptp.FlagUnicast,
-			SourcePortIdentity: ptp.PortIdentity{
-				PortNumber:    1,
-				ClockIdentity: sc.serverConfig.clockIdentity,
-			},
+			Version:            ptp.Version,
+			MessageLength:      uint16(binary.Size(ptp.Header{}) + binary.Size(ptp.PortIdentity{}) + binary.Size(ptp.GrantUnicastTransmissionTLV{})),
+			FlagField:          ptp.FlagUnicast,
+			SourcePortIdentity: sc.serverConfig.SourcePortIdentity(),
 		},
 		TargetPortIdentity: ptp.PortIdentity{},
 		TLVs:               []ptp.TLV{},
 	}
 }
 
-// UpdateSignalingGrant updates ptp Signaling packet granting the requested subscription
+// UpdateSignalingGrant updates ptp Signaling packet granting the requested subscription.
+// Packet is replaced rather than modified as the previous one may still be in the worker queue
 func (sc *SubscriptionClient) UpdateSignalingGrant(sg *ptp.Signaling, mt ptp.UnicastMsgTypeAndFlags, interval ptp.LogInterval, duration uint32) {
-	sc.signaling.Header.MessageLength = uint16(binary.Size(ptp.Header{}) + binary.Size(ptp.PortIdentity{}) + binary.Size(ptp.GrantUnicastTransmissionTLV{}))
-	sc.signaling.Header.SdoIDAndMsgType = sg.Header.SdoIDAndMsgType
-	sc.signaling.Header.DomainNumber = sg.Header.DomainNumber
-	sc.signaling.Header.MinorSdoID = sg.Header.MinorSdoID
-	sc.signaling.Header.CorrectionField = sg.Header.CorrectionField
-	sc.signaling.Header.MessageTypeSpecific = sg.Header.MessageTypeSpecific
-	sc.signaling.Header.SequenceID = sg.Header.SequenceID
-	sc.signaling.Header.ControlField = sg.Header.ControlField
-	sc.signaling.Header.LogMessageInterval = sg.Header.LogMessageInterval
-
-	sc.signaling.TargetPortIdentity = sg.SourcePortIdentity
-	sc.signaling.TLVs = []ptp.TLV{
+	sc.Lock()
+	defer sc.Unlock()
+	signaling := *sc.signaling
+	signaling.Header.MessageLength = uint16(binary.Size(ptp.Header{}) + binary.Size(ptp.PortIdentity{}) + binary.Size(ptp.GrantUnicastTransmissionTLV{}))
+	signaling.Header.SdoIDAndMsgType = sg.Header.SdoIDAndMsgType
+	signaling.Header.DomainNumber = sg.Header.DomainNumber
+	signaling.Header.MinorSdoID = sg.Header.MinorSdoID
+	signaling.Header.CorrectionField = sg.Header.CorrectionField
+	signaling.Header.MessageTypeSpecific = sg.Header.MessageTypeSpecific
+	signaling.Header.SequenceID = sg.Header.SequenceID
+	signaling.Header.ControlField = sg.Header.ControlField
+	signaling.Header.LogMessageInterval = sg.Header.LogMessageInterval
+
+	signaling.TargetPortIdentity = sg.SourcePortIdentity
+	signaling.TLVs = []ptp.TLV{
 		&ptp.GrantUnicastTransmissionTLV{
 			TLVHead:               ptp.TLVHead{TLVType: ptp.TLVGrantUnicastTransmission, LengthField: uint16(binary.Size(ptp.GrantUnicastTransmissionTLV{}) - binary.Size(ptp.TLVHead{}))},
 			Reserved:              0,
@@ -383,22 +443,30 @@ func (sc *SubscriptionClient) UpdateSignalingGrant(sg *ptp.Signaling, mt ptp.Uni
 			DurationField:         duration,
 		},
 	}
+	sc.signaling = &signaling
 }
 
-// UpdateSignalingCancel updates ptp Signaling packet canceling the requested subscription
+// UpdateSignalingCancel updates ptp Signaling packet canceling the requested subscription.
+// Packet is replaced rather than modified as the previous one may still be in the worker queue
 func (sc *SubscriptionClient) UpdateSignalingCancel() {
-	sc.signaling.Header.MessageLength = uint16(binary.Size(ptp.Header{}) + binary.Size(ptp.PortIdentity{}) + binary.Size(ptp.CancelUnicastTransmissionTLV{}))
-	sc.signaling.TLVs = []ptp.TLV{
+	sc.Lock()
+	defer sc.Unlock()
+	signaling := *sc.signaling
+	signaling.Header.MessageLength = uint16(binary.Size(ptp.Header{}) + binary.Size(ptp.PortIdentity{}) + binary.Size(ptp.CancelUnicastTransmissionTLV{}))
+	signaling.TLVs = []ptp.TLV{
 		&ptp.CancelUnicastTransmissionTLV{
 			TLVHead:         ptp.TLVHead{TLVType: ptp.TLVCancelUnicastTransmission, LengthField: uint16(binary.Size(ptp.CancelUnicastTransmissionTLV{}) - binary.Size(ptp.TLVHead{}))},
 			Reserved:        0,
 			MsgTypeAndFlags: ptp.NewUnicastMsgTypeAndFlags(sc.subscriptionType, 0),
 		},
 	}
+	sc.signaling = &signaling
 }
 
 // Grant returns ptp Signaling packet granting the requested subscription
 func (sc *SubscriptionClient) Signaling() *ptp.Signaling {
+	sc.Lock()
+	defer sc.Unlock()
 	return sc.signaling
 }
 
@@ -23,7 +23,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/facebook/time/leapsectz"
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
 	"github.com/facebook/time/timestamp"
 
 	"github.com/stretchr/testify/require"
@@ -142,7 +144,7 @@ func TestSubscriptionflags(t *testing.T) {
 	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
 
 	sc.UpdateSync()
-	sc.UpdateFollowup(time.Now())
+	sc.UpdateFollowup(sc.sequenceID, time.Now())
 	sc.UpdateAnnounce()
 	require.Equal(t, ptp.FlagUnicast|ptp.FlagTwoStep, sc.Sync().Header.FlagField)
 	require.Equal(t, ptp.FlagUnicast, sc.Followup().Header.FlagField)
@@ -159,12 +161,43 @@ func TestSyncPacket(t *testing.T) {
 	sc.sequenceID = sequenceID
 
 	sc.initSync()
+	sc.syncP.CorrectionField = ptp.NewCorrection(100500)
 	sc.IncSequenceID()
 	sc.UpdateSync()
+	require.Equal(t, ptp.Correction(0), sc.Sync().Header.CorrectionField)
 	require.Equal(t, uint16(44), sc.Sync().Header.MessageLength) // check packet length
 	require.Equal(t, sequenceID+1, sc.Sync().Header.SequenceID)
 }
 
+func TestSyncPacketTransportSpecific(t *testing.T) {
+	for _, transportSpecific := range []int{0, 1} {
+		c := &Config{clockIdentity: ptp.ClockIdentity(1234), StaticConfig: StaticConfig{TransportSpecific: transportSpecific}}
+		sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+		sc := NewSubscriptionClient(nil, nil, sa, sa, ptp.MessageSync, c, time.Second, time.Time{})
+		sc.initSync()
+		sc.initFollowup()
+		sc.UpdateSync()
+		sc.UpdateFollowup(0, time.Now())
+		buf := make([]byte, timestamp.PayloadSizeBytes)
+
+		n, err := ptp.BytesTo(sc.Sync(), buf)
+		require.NoError(t, err)
+		sync := buf[:n]
+		require.Equal(t, byte(transportSpecific), sync[0]>>4)
+		require.Equal(t, byte(ptp.MessageSync), sync[0]&0xf)
+		// we are a two-step clock, FollowUp carries the Sync TX timestamp
+		flags := binary.BigEndian.Uint16(sync[6:])
+		require.Equal(t, ptp.FlagTwoStep, flags&ptp.FlagTwoStep)
+
+		n, err = ptp.BytesTo(sc.Followup(), buf)
+		require.NoError(t, err)
+		followup := buf[:n]
+		require.Equal(t, byte(transportSpecific), followup[0]>>4)
+		require.Equal(t, byte(ptp.MessageFollowUp), followup[0]&0xf)
+		require.Equal(t, uint16(0), binary.BigEndian.Uint16(followup[6:])&ptp.FlagTwoStep)
+	}
+}
+
 func TestFollowupPacket(t *testing.T) {
 	sequenceID := uint16(42)
 	now := time.Now()
@@ -181,8 +214,10 @@ func TestFollowupPacket(t *testing.T) {
 	require.NoError(t, err)
 
 	sc.initFollowup()
+	sc.followupP.CorrectionField = ptp.NewCorrection(100500)
 	sc.IncSequenceID()
-	sc.UpdateFollowup(now)
+	sc.UpdateFollowup(sc.sequenceID, now)
+	require.Equal(t, ptp.Correction(0), sc.Followup().Header.CorrectionField)
 	require.Equal(t, uint16(44), sc.Followup().Header.MessageLength) // check packet length
 	require.Equal(t, sequenceID+1, sc.Followup().Header.SequenceID)
 	require.Equal(t, i, sc.Followup().Header.LogMessageInterval)
@@ -223,6 +258,221 @@ func TestAnnouncePacket(t *testing.T) {
 	require.Equal(t, int16(UTCOffset.Seconds()), sc.Announce().AnnounceBody.CurrentUTCOffset)
 }
 
+func TestSourcePortIdentityOverride(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{ClockIdentity: ptp.ClockIdentity(5678), PortNumber: 2}}
+	s := Server{Config: c}
+	require.NoError(t, s.setClockIdentity())
+	sp := ptp.PortIdentity{
+		PortNumber:    2,
+		ClockIdentity: ptp.ClockIdentity(5678),
+	}
+
+	w := &sendWorker{}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Time{})
+	sc.UpdateSync()
+	sc.UpdateFollowup(sc.sequenceID, time.Now())
+	sc.UpdateAnnounce()
+	sc.UpdateDelayResp(&ptp.Header{}, time.Now())
+	require.Equal(t, sp, sc.Sync().Header.SourcePortIdentity)
+	require.Equal(t, sp, sc.Followup().Header.SourcePortIdentity)
+	require.Equal(t, sp, sc.Announce().Header.SourcePortIdentity)
+	require.Equal(t, sp, sc.DelayResp().Header.SourcePortIdentity)
+	require.Equal(t, sp, sc.signaling.Header.SourcePortIdentity)
+	require.Equal(t, ptp.ClockIdentity(5678), sc.Announce().GrandmasterIdentity)
+}
+
+func TestAnnounceHoldoverClockClass(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2022, time.March, 1, 0, 0, 0, 0, time.UTC)}
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		Clock:         clock,
+		DynamicConfig: DynamicConfig{ClockClass: ptp.ClockClass6, HoldoverThreshold: 10 * time.Second},
+	}
+	s := &Server{Config: c}
+	w := &sendWorker{}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
+
+	s.SetHoldover(true)
+	clock.Advance(9 * time.Second)
+	sc.UpdateAnnounce()
+	require.Equal(t, ptp.ClockClass6, sc.Announce().GrandmasterClockQuality.ClockClass)
+
+	clock.Advance(time.Second)
+	sc.UpdateAnnounce()
+	require.Equal(t, ptp.ClockClass7, sc.Announce().GrandmasterClockQuality.ClockClass)
+
+	c.HoldoverClockClass = ptp.ClockClass52
+	sc.UpdateAnnounce()
+	require.Equal(t, ptp.ClockClass52, sc.Announce().GrandmasterClockQuality.ClockClass)
+
+	s.SetHoldover(false)
+	sc.UpdateAnnounce()
+	require.Equal(t, ptp.ClockClass6, sc.Announce().GrandmasterClockQuality.ClockClass)
+}
+
+func TestAnnounceUTCOffsetLeap(t *testing.T) {
+	leap := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234), DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second}}
+	c.setLeapSeconds([]leapsectz.LeapSecond{leapSecond(leap, 28)}, time.Time{})
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(nil, nil, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
+	sc.initAnnounce()
+
+	sc.updateAnnounceAt(leap.Add(-time.Nanosecond))
+	require.Equal(t, int16(37), sc.Announce().CurrentUTCOffset)
+	require.Equal(t, ptp.FlagCurrentUtcOffsetValid, sc.Announce().FlagField&ptp.FlagCurrentUtcOffsetValid)
+
+	sc.IncSequenceID()
+	sc.updateAnnounceAt(leap)
+	require.Equal(t, int16(38), sc.Announce().CurrentUTCOffset)
+	require.Equal(t, ptp.FlagCurrentUtcOffsetValid, sc.Announce().FlagField&ptp.FlagCurrentUtcOffsetValid)
+	require.Equal(t, uint16(1), sc.Announce().SequenceID)
+}
+
+func TestAnnounceUTCOffsetLeapSecondsMaxAge(t *testing.T) {
+	now := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234), DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second, LeapSecondsMaxAge: 24 * time.Hour}}
+	c.setLeapSeconds([]leapsectz.LeapSecond{leapSecond(time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC), 27)}, now.Add(-time.Hour))
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(nil, nil, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
+	sc.initAnnounce()
+
+	sc.updateAnnounceAt(now)
+	require.Equal(t, int16(37), sc.Announce().CurrentUTCOffset)
+	require.Equal(t, ptp.FlagCurrentUtcOffsetValid, sc.Announce().FlagField&ptp.FlagCurrentUtcOffsetValid)
+
+	// leap seconds table is too old to be trusted
+	sc.updateAnnounceAt(now.Add(24 * time.Hour))
+	require.Equal(t, int16(37), sc.Announce().CurrentUTCOffset)
+	require.Equal(t, uint16(0), sc.Announce().FlagField&ptp.FlagCurrentUtcOffsetValid)
+}
+
+func TestAnnounceUTCOffsetManualChange(t *testing.T) {
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234), DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second}}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(nil, nil, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
+	sc.initAnnounce()
+
+	sc.UpdateAnnounce()
+	require.Equal(t, int16(37), sc.Announce().CurrentUTCOffset)
+	require.Equal(t, ptp.FlagCurrentUtcOffsetValid, sc.Announce().FlagField&ptp.FlagCurrentUtcOffsetValid)
+
+	// operator reloads the config
+	c.UTCOffset = 38 * time.Second
+	sc.UpdateAnnounce()
+	require.Equal(t, int16(38), sc.Announce().CurrentUTCOffset)
+	require.Equal(t, ptp.FlagCurrentUtcOffsetValid, sc.Announce().FlagField&ptp.FlagCurrentUtcOffsetValid)
+
+	// insane offset is announced as invalid
+	c.UTCOffset = 3 * time.Second
+	sc.UpdateAnnounce()
+	require.Equal(t, int16(3), sc.Announce().CurrentUTCOffset)
+	require.Equal(t, uint16(0), sc.Announce().FlagField&ptp.FlagCurrentUtcOffsetValid)
+	require.Equal(t, ptp.FlagUnicast|ptp.FlagPTPTimescale, sc.Announce().FlagField)
+}
+
+func TestAnnouncePacketQuality(t *testing.T) {
+	w := &sendWorker{}
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		DynamicConfig: DynamicConfig{
+			ClockClass:              ptp.ClockClass13,
+			ClockAccuracy:           ptp.ClockAccuracyMicrosecond25,
+			OffsetScaledLogVariance: 0x4e5d,
+			Priority1:               1,
+			Priority2:               2,
+			UTCOffset:               37 * time.Second,
+		},
+	}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
+	sc.UpdateAnnounce()
+
+	b, err := ptp.Bytes(sc.Announce())
+	require.NoError(t, err)
+	// grandmaster fields start right after the header, origin timestamp and utc offset
+	n := 34 + 13
+	require.Equal(t, uint8(1), b[n])
+	require.Equal(t, byte(ptp.ClockClass13), b[n+1])
+	require.Equal(t, byte(ptp.ClockAccuracyMicrosecond25), b[n+2])
+	require.Equal(t, []byte{0x4e, 0x5d}, b[n+3:n+5])
+	require.Equal(t, uint8(2), b[n+5])
+
+	// degrade into holdover
+	c.ClockClass = ptp.ClockClass7
+	sc.UpdateAnnounce()
+	b, err = ptp.Bytes(sc.Announce())
+	require.NoError(t, err)
+	require.Equal(t, byte(ptp.ClockClass7), b[n+1])
+}
+
+func TestAnnounceBoundaryClock(t *testing.T) {
+	w := &sendWorker{}
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234), DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second}}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
+
+	// grandmaster announces itself
+	sc.UpdateAnnounce()
+	require.Equal(t, ptp.ClockIdentity(1234), sc.Announce().GrandmasterIdentity)
+	require.Equal(t, uint16(0), sc.Announce().StepsRemoved)
+	require.Equal(t, ptp.ClockIdentity(1234), sc.Announce().SourcePortIdentity.ClockIdentity)
+
+	// boundary clock announces the upstream grandmaster
+	c.GrandmasterIdentity = ptp.ClockIdentity(5678)
+	c.StepsRemoved = 2
+	c.Priority1 = 1
+	sc.UpdateAnnounce()
+	require.Equal(t, ptp.ClockIdentity(5678), sc.Announce().GrandmasterIdentity)
+	require.Equal(t, uint16(2), sc.Announce().StepsRemoved)
+	require.Equal(t, uint8(1), sc.Announce().GrandmasterPriority1)
+	require.Equal(t, ptp.ClockIdentity(1234), sc.Announce().SourcePortIdentity.ClockIdentity)
+}
+
+func TestPacketLogIntervals(t *testing.T) {
+	w := &sendWorker{}
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second},
+	}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second/4, time.Time{})
+
+	// logMessageInterval is the last byte of the header
+	n := 33
+	sc.UpdateSync()
+	sc.UpdateFollowup(0, time.Now())
+	sc.UpdateAnnounce()
+	b, err := ptp.Bytes(sc.Sync())
+	require.NoError(t, err)
+	require.Equal(t, byte(0x7f), b[n])
+	b, err = ptp.Bytes(sc.Followup())
+	require.NoError(t, err)
+	require.Equal(t, byte(0xfe), b[n])
+	b, err = ptp.Bytes(sc.Announce())
+	require.NoError(t, err)
+	require.Equal(t, byte(0xfe), b[n])
+
+	syncInterval := ptp.LogInterval(-4)
+	announceInterval := ptp.LogInterval(3)
+	c.LogSyncInterval = &syncInterval
+	c.LogAnnounceInterval = &announceInterval
+	sc.UpdateSync()
+	sc.UpdateFollowup(0, time.Now())
+	sc.UpdateAnnounce()
+	b, err = ptp.Bytes(sc.Sync())
+	require.NoError(t, err)
+	require.Equal(t, byte(0xfc), b[n])
+	b, err = ptp.Bytes(sc.Followup())
+	require.NoError(t, err)
+	require.Equal(t, byte(0xfc), b[n])
+	b, err = ptp.Bytes(sc.Announce())
+	require.NoError(t, err)
+	require.Equal(t, byte(0x03), b[n])
+}
+
 func TestDelayRespPacket(t *testing.T) {
 	sequenceID := uint16(42)
 	now := time.Now()
@@ -252,6 +502,71 @@ func TestDelayRespPacket(t *testing.T) {
 	require.Equal(t, ptp.FlagUnicast, sc.DelayResp().Header.FlagField)
 }
 
+func TestDelayReqRead(t *testing.T) {
+	w := &sendWorker{}
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234)}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageDelayResp, c, time.Second, time.Time{})
+	require.True(t, sc.delayReqReadTime().IsZero())
+
+	// listener sets it while the worker reads it
+	now := time.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			sc.setDelayReqRead(now)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = sc.delayReqReadTime()
+	}
+	<-done
+	require.Equal(t, now, sc.delayReqReadTime())
+}
+
+func TestPacketsMessageLengthControlField(t *testing.T) {
+	w := &sendWorker{}
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234)}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
+	sc.initSync()
+	sc.initFollowup()
+	sc.initAnnounce()
+	sc.initDelayResp()
+	sc.initSignaling()
+	sc.UpdateSync()
+	sc.UpdateFollowup(0, time.Now())
+	sc.UpdateAnnounce()
+	sc.UpdateDelayResp(&ptp.Header{SequenceID: 42}, time.Now())
+	sg := &ptp.Signaling{Header: ptp.Header{SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageSignaling, 0), ControlField: 0}}
+	sc.UpdateSignalingGrant(sg, ptp.NewUnicastMsgTypeAndFlags(ptp.MessageSync, 0), 0, 3)
+
+	tests := []struct {
+		name    string
+		packet  ptp.BinaryMarshalerTo
+		length  uint16
+		control byte
+	}{
+		{name: "sync", packet: sc.Sync(), length: 44, control: 0},
+		{name: "followup", packet: sc.Followup(), length: 44, control: 2},
+		{name: "announce", packet: sc.Announce(), length: 64, control: 5},
+		{name: "delay resp", packet: sc.DelayResp(), length: 54, control: 3},
+		{name: "signaling", packet: sc.Signaling(), length: 56, control: 5},
+	}
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := ptp.BytesTo(tt.packet, buf)
+			require.NoError(t, err)
+			// two trailing zero bytes are not part of the message
+			require.Equal(t, int(tt.length), n-2)
+			require.Equal(t, tt.length, binary.BigEndian.Uint16(buf[2:]))
+			require.Equal(t, tt.control, buf[32])
+		})
+	}
+}
+
 func TestSignalingGrantPacket(t *testing.T) {
 	interval := 3 * time.Second
 
@@ -350,3 +665,62 @@ func TestSendSignalingCancel(t *testing.T) {
 	require.Equal(t, ptp.TLVCancelUnicastTransmission, s.signaling.TLVs[0].(*ptp.CancelUnicastTransmissionTLV).TLVHead.TLVType)
 	require.Equal(t, uint16(binary.Size(ptp.Header{})+binary.Size(ptp.PortIdentity{})+binary.Size(ptp.CancelUnicastTransmissionTLV{})), s.signaling.Header.MessageLength)
 }
+
+// dropStats counts jobs dropped from the worker queue
+type dropStats struct {
+	*stats.JSONStats
+	dropped map[ptp.MessageType]int
+}
+
+func (s *dropStats) IncQueueDropped(t ptp.MessageType) {
+	s.dropped[t]++
+}
+
+func TestOnceQueuePolicy(t *testing.T) {
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	q := make(chan *SubscriptionClient, 1)
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			QueuePolicy: QueuePolicyDropNewest,
+			QueueSize:   1,
+		},
+	}
+	st := &dropStats{JSONStats: stats.NewJSONStats(), dropped: map[ptp.MessageType]int{}}
+	w := newSendWorker(0, c, st)
+	w.queue = q
+
+	scS := NewSubscriptionClient(q, nil, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	scA := NewSubscriptionClient(q, nil, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Now().Add(time.Minute))
+	require.True(t, w.RegisterSubscription(ptp.PortIdentity{PortNumber: 1}, ptp.MessageSync, scS))
+	require.True(t, w.RegisterSubscription(ptp.PortIdentity{PortNumber: 1}, ptp.MessageAnnounce, scA))
+
+	// saturated queue drops the newest job
+	scS.Once()
+	scS.Once()
+	scA.Once()
+	require.Equal(t, map[ptp.MessageType]int{ptp.MessageSync: 1, ptp.MessageAnnounce: 1}, st.dropped)
+	require.Equal(t, scS, <-q)
+
+	// saturated queue drops the oldest job
+	c.QueuePolicy = QueuePolicyDropOldest
+	st.dropped = map[ptp.MessageType]int{}
+	scS.Once()
+	scA.Once()
+	require.Equal(t, map[ptp.MessageType]int{ptp.MessageSync: 1}, st.dropped)
+	require.Equal(t, scA, <-q)
+
+	// blocking policy waits for the worker
+	c.QueuePolicy = QueuePolicyBlock
+	st.dropped = map[ptp.MessageType]int{}
+	scS.Once()
+	done := make(chan struct{})
+	go func() {
+		scA.Once()
+		close(done)
+	}()
+	require.Equal(t, scS, <-q)
+	<-done
+	require.Equal(t, scA, <-q)
+	require.Empty(t, st.dropped)
+}
@@ -20,11 +20,16 @@ Package server implements simple Unicast PTP UDP server.
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/eclesh/welford"
+	"github.com/facebook/time/dscp"
 	ptp "github.com/facebook/time/ptp/protocol"
 	"github.com/facebook/time/ptp/ptp4u/stats"
 	"github.com/facebook/time/timestamp"
@@ -32,17 +37,26 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-func enableDSCP(fd int, localAddr net.IP, dscp int) error {
-	if localAddr.To4() == nil {
-		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, dscp<<2); err != nil {
-			return err
-		}
-	} else {
-		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TOS, dscp<<2); err != nil {
-			return err
-		}
-	}
-	return nil
+// discardPort is the port of Discard Protocol (RFC 863) pre-warm Syncs are sent to
+const discardPort = 9
+
+// header sizes packets have to fit into the MTU with
+const (
+	ipv4HeaderSize = 20
+	ipv6HeaderSize = 40
+	udpHeaderSize  = 8
+)
+
+// sockopts sets socket options
+type sockopts interface {
+	setsockoptInt(fd, level, opt, value int) error
+}
+
+// unixSockopts sets socket options with setsockopt(2)
+type unixSockopts struct{}
+
+func (unixSockopts) setsockoptInt(fd, level, opt, value int) error {
+	return unix.SetsockoptInt(fd, level, opt, value)
 }
 
 // sendWorker monitors the queue of jobs
@@ -53,106 +67,494 @@ type sendWorker struct {
 	signalingQueue chan *SubscriptionClient
 	config         *Config
 	stats          stats.Stats
-
-	clients map[ptp.MessageType]map[ptp.PortIdentity]*SubscriptionClient
+	stop           chan struct{}
+	stopped        bool
+	// rebind asks the worker to re-create its sockets
+	rebind chan struct{}
+	// lastActive is a unix nano time of the last processed job
+	lastActive int64
+	// load is an estimated number of messages per hour of all subscriptions
+	load int64
+	// syncJitter tracks how far Sync send intervals stray from the subscription intervals
+	syncJitter jitter
+	// timestampingFailed is set while timestamps can't be enabled on the worker sockets
+	timestampingFailed int32
+	// txtsFailures is a number of consecutive TX timestamp read failures
+	txtsFailures int64
+
+	clients SubscriptionStore
+	// sockopts sets options of the worker sockets
+	sockopts sockopts
 }
 
 func newSendWorker(i int, c *Config, st stats.Stats) *sendWorker {
 	s := &sendWorker{
-		id:     i,
-		config: c,
-		stats:  st,
+		id:       i,
+		config:   c,
+		stats:    st,
+		sockopts: unixSockopts{},
 	}
-	s.clients = make(map[ptp.MessageType]map[ptp.PortIdentity]*SubscriptionClient)
+	s.clients = c.newSubscriptionStore()
 	s.queue = make(chan *SubscriptionClient, c.QueueSize)
 	s.signalingQueue = make(chan *SubscriptionClient, c.QueueSize)
+	s.stop = make(chan struct{})
+	s.rebind = make(chan struct{}, 1)
+	s.lastActive = c.clock().Now().UnixNano()
 	return s
 }
 
 func (s *sendWorker) listen() (eventFD, generalFD int, err error) {
+	efd, gfd := -1, -1
+	// sockets opened before a failure, e.g. while the link is down, are closed
+	defer func() {
+		if err == nil {
+			return
+		}
+		if efd != -1 {
+			unix.Close(efd)
+		}
+		if gfd != -1 {
+			unix.Close(gfd)
+		}
+	}()
 	// socket domain differs depending whether we are listening on ipv4 or ipv6
 	domain := unix.AF_INET6
 	if s.config.IP.To4() != nil {
 		domain = unix.AF_INET
 	}
 	// set up event connection
-	eventFD, err = unix.Socket(domain, unix.SOCK_DGRAM, unix.IPPROTO_UDP)
+	efd, err = unix.Socket(domain, unix.SOCK_DGRAM, unix.IPPROTO_UDP)
 	if err != nil {
 		return -1, -1, fmt.Errorf("creating event socket error: %w", err)
 	}
-	sockAddrAnyPort := timestamp.IPToSockaddr(s.config.IP, 0)
 
 	// set SO_REUSEPORT so we can potentially trace network path from same source port.
 	// needs to be set before we bind to a port.
-	if err = unix.SetsockoptInt(eventFD, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
-		return -1, -1, fmt.Errorf("failed to set SO_REUSEPORT on event socket: %w", err)
+	// Pinned ports are not shared, so workers can tell they are taken by another one
+	if s.config.EventPorts.Empty() {
+		if err = unix.SetsockoptInt(efd, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+			return -1, -1, fmt.Errorf("failed to set SO_REUSEPORT on event socket: %w", err)
+		}
 	}
-	// bind to any ephemeral port
-	if err = unix.Bind(eventFD, sockAddrAnyPort); err != nil {
+	sndbuf, rcvbuf, err := s.setBufferSizes(efd)
+	if err != nil {
+		return -1, -1, fmt.Errorf("setting buffer sizes on event socket: %w", err)
+	}
+	s.logger().Infof("Worker#%d event socket buffers: send %d bytes, receive %d bytes", s.id, sndbuf, rcvbuf)
+	s.stats.SetWorkerSendBuffer(s.id, int64(sndbuf))
+	s.stats.SetWorkerRecvBuffer(s.id, int64(rcvbuf))
+	if err = s.bind(efd, s.config.EventPorts); err != nil {
 		return -1, -1, fmt.Errorf("unable to bind event socket connection: %w", err)
 	}
 
 	// get local port we'll send packets from
-	localSockAddr, err := unix.Getsockname(eventFD)
+	localSockAddr, err := unix.Getsockname(efd)
 	if err != nil {
 		return -1, -1, fmt.Errorf("unable to find local ip: %w", err)
 	}
 	switch v := localSockAddr.(type) {
 	case *unix.SockaddrInet4:
-		log.Infof("Started worker#%d event on [%v]:%d", s.id, net.IP(v.Addr[:]), v.Port)
+		s.logger().Infof("Started worker#%d event on [%v]:%d", s.id, net.IP(v.Addr[:]), v.Port)
 	case *unix.SockaddrInet6:
-		log.Infof("Started worker#%d event on [%v]:%d", s.id, net.IP(v.Addr[:]), v.Port)
+		s.logger().Infof("Started worker#%d event on [%v]:%d", s.id, net.IP(v.Addr[:]), v.Port)
 	default:
-		log.Errorf("Unexpected local addr type %T", v)
+		s.logger().Errorf("Unexpected local addr type %T", v)
 	}
 
-	if err = enableDSCP(eventFD, s.config.IP, s.config.DSCP); err != nil {
+	if err = dscp.Enable(efd, s.config.IP, s.config.DSCP); err != nil {
 		return -1, -1, fmt.Errorf("setting DSCP on event socket: %w", err)
 	}
+	if v, err := dscp.Get(efd, s.config.IP); err != nil {
+		s.logger().Warningf("Failed to read back DSCP of worker#%d event socket: %v", s.id, err)
+	} else {
+		s.logger().Debugf("Worker#%d event socket DSCP is %d", s.id, v)
+	}
 
 	// Syncs sent from event port, so need to turn on timestamping here
 	switch s.config.TimestampType {
 	case timestamp.HWTIMESTAMP:
-		if err = timestamp.EnableHWTimestamps(eventFD, s.config.Interface); err != nil {
+		if err = timestamp.EnableHWTimestamps(efd, s.config.Interface); err != nil {
+			atomic.StoreInt32(&s.timestampingFailed, 1)
 			return -1, -1, fmt.Errorf("failed to enable RX hardware timestamps: %w", err)
 		}
 	case timestamp.SWTIMESTAMP:
-		if err = timestamp.EnableSWTimestamps(eventFD); err != nil {
+		if err = timestamp.EnableSWTimestamps(efd); err != nil {
+			atomic.StoreInt32(&s.timestampingFailed, 1)
 			return -1, -1, fmt.Errorf("unable to enable RX software timestamps: %w", err)
 		}
 	default:
 		return -1, -1, fmt.Errorf("unrecognized timestamp type: %s", s.config.TimestampType)
 	}
+	atomic.StoreInt32(&s.timestampingFailed, 0)
+	// Syncs sent at once are told apart by the counter of their TX timestamps
+	if s.config.SyncBatch > 1 {
+		if err = timestamp.EnableTXTimestampsID(efd); err != nil {
+			return -1, -1, fmt.Errorf("failed to enable TX timestamp IDs: %w", err)
+		}
+	}
 
 	// set up general connection
-	generalFD, err = unix.Socket(domain, unix.SOCK_DGRAM, unix.IPPROTO_UDP)
+	gfd, err = unix.Socket(domain, unix.SOCK_DGRAM, unix.IPPROTO_UDP)
 	if err != nil {
 		return -1, -1, fmt.Errorf("creating general socket error: %w", err)
 	}
 	// set SO_REUSEPORT so we can potentially trace network path from same source port.
 	// needs to be set before we bind to a port.
-	if err = unix.SetsockoptInt(generalFD, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
-		return -1, -1, fmt.Errorf("failed to set SO_REUSEPORT on general socket: %w", err)
+	if s.config.GeneralPorts.Empty() {
+		if err = unix.SetsockoptInt(gfd, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+			return -1, -1, fmt.Errorf("failed to set SO_REUSEPORT on general socket: %w", err)
+		}
 	}
-	// bind to any ephemeral port
-	if err = unix.Bind(generalFD, sockAddrAnyPort); err != nil {
+	if _, _, err = s.setBufferSizes(gfd); err != nil {
+		return -1, -1, fmt.Errorf("setting buffer sizes on general socket: %w", err)
+	}
+	if err = s.bind(gfd, s.config.GeneralPorts); err != nil {
 		return -1, -1, fmt.Errorf("binding event socket connection: %w", err)
 	}
 	// enable DSCP
-	if err = enableDSCP(generalFD, s.config.IP, s.config.DSCP); err != nil {
+	if err = dscp.Enable(gfd, s.config.IP, s.config.DSCP); err != nil {
 		return -1, -1, fmt.Errorf("setting DSCP on general socket: %w", err)
 	}
-	return
+	return efd, gfd, nil
+}
+
+// bind binds the socket to a port from the range, trying successive ports if taken, e.g. by another worker.
+// The search starts at the worker id, so workers don't all contend for the first port.
+// Any ephemeral port is used if the range is empty
+func (s *sendWorker) bind(fd int, ports PortRange) error {
+	if ports.Empty() {
+		return unix.Bind(fd, timestamp.IPToSockaddr(s.config.IP, 0))
+	}
+	size := ports.Last - ports.First + 1
+	var err error
+	for i := 0; i < size; i++ {
+		port := ports.First + (s.id+i)%size
+		if err = unix.Bind(fd, timestamp.IPToSockaddr(s.config.IP, port)); !errors.Is(err, unix.EADDRINUSE) {
+			return err
+		}
+	}
+	return fmt.Errorf("all ports %s are in use: %w", ports, err)
+}
+
+// logger returns the logger of the worker
+func (s *sendWorker) logger() log.FieldLogger {
+	return s.config.logger()
+}
+
+// sendSync sends Sync and the FollowUp carrying its TX timestamp to the subscription.
+// It returns the time it took to read the TX timestamp
+func (s *sendWorker) sendSync(eFd, gFd int, c *SubscriptionClient, buf, oob, toob []byte) (time.Duration, error) {
+	// send sync
+	c.UpdateSync()
+	// FollowUp must reference this Sync whatever happens while we wait for TX timestamp
+	syncSeq := c.Sync().SequenceID
+	n, err := ptp.BytesTo(c.Sync(), buf)
+	if err != nil {
+		s.logger().Errorf("Failed to generate the sync packet: %v", err)
+		return 0, err
+	}
+	s.logger().Debugf("Sending sync")
+
+	err = s.sendTo(eFd, buf[:n], c.eclisa)
+	// userspace timestamp is the last resort if kernel doesn't report TX timestamp
+	sent := s.config.clock().Now()
+	if err != nil {
+		s.logger().Errorf("Failed to send the sync packet: %v", err)
+		return 0, err
+	}
+	s.stats.IncTX(c.subscriptionType)
+
+	txTS, attempts, err := s.config.clock().ReadTXtimestamp(eFd, oob, toob)
+	latency := s.config.clock().Now().Sub(sent)
+	s.stats.SetMaxTXTSAttempts(s.id, int64(attempts))
+	fallback := false
+	if err != nil {
+		atomic.AddInt64(&s.txtsFailures, 1)
+		if !s.config.TXTimestampFallback {
+			s.logger().Warningf("Failed to read TX timestamp: %v", err)
+			return latency, err
+		}
+		s.logger().Warningf("Failed to read TX timestamp, falling back to userspace one: %v", err)
+		s.stats.IncTXTSFallback()
+		txTS = sent
+		fallback = true
+	} else {
+		atomic.StoreInt64(&s.txtsFailures, 0)
+	}
+	return latency, s.sendFollowup(gFd, c, syncSeq, txTS, fallback, buf)
+}
+
+// sendFollowup sends FollowUp of the Sync with the sequence and TX timestamp to the subscription.
+// fallback means the timestamp was taken in userspace
+func (s *sendWorker) sendFollowup(gFd int, c *SubscriptionClient, syncSeq uint16, txTS time.Time, fallback bool, buf []byte) error {
+	// system clock is in UTC, unlike PHC
+	if s.config.TimestampType != timestamp.HWTIMESTAMP || fallback {
+		utcOffset, _ := s.config.UTCOffsetAt(txTS)
+		txTS = txTS.Add(utcOffset)
+	}
+
+	s.recordSyncTX(c, txTS)
+
+	c.UpdateFollowup(syncSeq, txTS)
+	n, err := ptp.BytesTo(c.Followup(), buf)
+	if err != nil {
+		s.logger().Errorf("Failed to generate the followup packet: %v", err)
+		return err
+	}
+	s.logger().Debug("Sending followup")
+
+	err = s.sendTo(gFd, buf[:n], c.gclisa)
+	if err != nil {
+		s.logger().Errorf("Failed to send the followup packet: %v", err)
+		return err
+	}
+	s.stats.IncTX(ptp.MessageFollowUp)
+	return nil
+}
+
+// syncBatch holds Syncs sent with one sendmmsg call and buffers to do it
+type syncBatch struct {
+	size   int
+	sender *timestamp.BatchSender
+	reader *timestamp.TXTimestampReader
+	// nextID is the TX timestamp counter of the next packet sent over the event socket
+	nextID  uint32
+	clients []*SubscriptionClient
+	seqs    []uint16
+	bufs    [][]byte
+	packets [][]byte
+	addrs   []unix.Sockaddr
+	txTS    []time.Time
+	// others are jobs other than Sync taken off the queue while collecting the batch
+	others []*SubscriptionClient
+}
+
+// newSyncBatch creates a syncBatch of up to size Syncs
+func newSyncBatch(size int) *syncBatch {
+	b := &syncBatch{
+		size:    size,
+		sender:  timestamp.NewBatchSender(size),
+		reader:  timestamp.NewTXTimestampReader(size),
+		clients: make([]*SubscriptionClient, 0, size),
+		seqs:    make([]uint16, 0, size),
+		bufs:    make([][]byte, size),
+		packets: make([][]byte, 0, size),
+		addrs:   make([]unix.Sockaddr, 0, size),
+		txTS:    make([]time.Time, size),
+	}
+	for i := range b.bufs {
+		b.bufs[i] = make([]byte, timestamp.PayloadSizeBytes)
+	}
+	return b
+}
+
+// collect takes Syncs queued after the first one into the batch, as long as there are any without waiting
+func (b *syncBatch) collect(first *SubscriptionClient, queue chan *SubscriptionClient) {
+	b.clients = append(b.clients[:0], first)
+	b.others = b.others[:0]
+	for len(b.clients) < b.size {
+		select {
+		case c := <-queue:
+			if c.subscriptionType == ptp.MessageSync {
+				b.clients = append(b.clients, c)
+			} else {
+				b.others = append(b.others, c)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// resync restarts the TX timestamp counter, e.g. after a failed send which may have taken a number
+func (b *syncBatch) resync(eFd int) error {
+	b.nextID = 0
+	return timestamp.EnableTXTimestampsID(eFd)
+}
+
+// sendSyncBatch sends Syncs of the client and of ones queued right after it with one sendmmsg call,
+// reads their TX timestamps at once and sends FollowUps. Jobs other than Sync taken off the queue
+// are left in the batch for the caller
+func (s *sendWorker) sendSyncBatch(eFd, gFd int, b *syncBatch, first *SubscriptionClient, buf []byte) {
+	b.collect(first, s.queue)
+	b.seqs = b.seqs[:0]
+	b.packets = b.packets[:0]
+	b.addrs = b.addrs[:0]
+	// clients is compacted to the Syncs which are sent
+	sending := b.clients[:0]
+	for _, c := range b.clients {
+		c.UpdateSync()
+		seq := c.Sync().SequenceID
+		pkt := b.bufs[len(b.packets)]
+		n, err := ptp.BytesTo(c.Sync(), pkt)
+		// a client may be queued more than once, its next Sync in the batch needs the next sequence
+		c.IncSequenceID()
+		if err != nil {
+			s.logger().Errorf("Failed to generate the sync packet: %v", err)
+			continue
+		}
+		if err := s.checkSize(pkt[:n]); err != nil {
+			s.logger().Errorf("Failed to send the sync packet: %v", err)
+			continue
+		}
+		sending = append(sending, c)
+		b.seqs = append(b.seqs, seq)
+		b.packets = append(b.packets, pkt[:n])
+		b.addrs = append(b.addrs, c.eclisa)
+	}
+	b.clients = sending
+	if len(b.packets) == 0 {
+		return
+	}
+	s.logger().Debugf("Sending %d syncs", len(b.packets))
+
+	sent, err := b.sender.Send(eFd, b.packets, b.addrs)
+	// userspace timestamp is the last resort if kernel doesn't report TX timestamp
+	sentAt := s.config.clock().Now()
+	if err != nil {
+		s.logger().Errorf("Failed to send the sync packets: %v", err)
+		if err := b.resync(eFd); err != nil {
+			s.logger().Errorf("Failed to restart TX timestamp IDs: %v", err)
+		}
+		return
+	}
+	for i := 0; i < sent; i++ {
+		s.stats.IncTX(ptp.MessageSync)
+	}
+
+	txTS := b.txTS[:sent]
+	attempts, err := b.reader.ReadBatch(eFd, b.nextID, txTS)
+	b.nextID += uint32(sent)
+	s.stats.SetMaxTXTSAttempts(s.id, int64(attempts))
+	if err != nil {
+		s.logger().Warningf("Failed to read TX timestamps: %v", err)
+	}
+	if sent < len(b.packets) {
+		s.logger().Errorf("Failed to send %d of %d sync packets", len(b.packets)-sent, len(b.packets))
+		if err := b.resync(eFd); err != nil {
+			s.logger().Errorf("Failed to restart TX timestamp IDs: %v", err)
+		}
+	}
+
+	for i, c := range b.clients[:sent] {
+		fallback := false
+		if txTS[i].IsZero() {
+			atomic.AddInt64(&s.txtsFailures, 1)
+			if !s.config.TXTimestampFallback {
+				continue
+			}
+			s.stats.IncTXTSFallback()
+			txTS[i] = sentAt
+			fallback = true
+		} else {
+			atomic.StoreInt64(&s.txtsFailures, 0)
+		}
+		// errors are logged by sendFollowup
+		_ = s.sendFollowup(gFd, c, b.seqs[i], txTS[i], fallback, buf)
+	}
+}
+
+// checkSize checks the packet doesn't exceed the MTU, as fragmented PTP packets are often dropped on the way
+func (s *sendWorker) checkSize(b []byte) error {
+	if max := s.config.maxPayloadSize(); max > 0 && len(b) > max {
+		s.stats.IncTXOversized()
+		return fmt.Errorf("%d bytes packet exceeds %d bytes payload of %d MTU", len(b), max, s.config.mtu)
+	}
+	return nil
+}
+
+// sendTo sends the packet unless it exceeds the MTU
+func (s *sendWorker) sendTo(fd int, b []byte, sa unix.Sockaddr) error {
+	if err := s.checkSize(b); err != nil {
+		return err
+	}
+	return unix.Sendto(fd, b, 0, sa)
+}
+
+// prewarm sends a dummy Sync to the discard port of PrewarmIP and reads its TX timestamp,
+// so the first real client doesn't pay for the driver setting up TX timestamping on a fresh socket.
+// Nothing is accounted in stats
+func (s *sendWorker) prewarm(eFd int, buf, oob, toob []byte) error {
+	c := NewSubscriptionClient(nil, nil, timestamp.IPToSockaddr(s.config.PrewarmIP, discardPort), nil, ptp.MessageSync, s.config, time.Second, s.config.clock().Now())
+	c.UpdateSync()
+	n, err := ptp.BytesTo(c.Sync(), buf)
+	if err != nil {
+		return err
+	}
+	if err := unix.Sendto(eFd, buf[:n], 0, c.eclisa); err != nil {
+		return err
+	}
+	sent := s.config.clock().Now()
+	if _, _, err := s.config.clock().ReadTXtimestamp(eFd, oob, toob); err != nil {
+		return err
+	}
+	s.logger().Infof("Pre-warmed worker#%d TX timestamping in %v", s.id, s.config.clock().Now().Sub(sent))
+	return nil
+}
+
+// recordSyncTX accounts the interval between the Sync TX timestamp and the previous one of the client
+func (s *sendWorker) recordSyncTX(c *SubscriptionClient, txTS time.Time) {
+	if !c.lastSyncTX.IsZero() {
+		s.syncJitter.add(txTS.Sub(c.lastSyncTX) - c.Interval())
+		s.stats.SetWorkerSyncJitter(s.id, s.syncJitter.stddev())
+	}
+	c.lastSyncTX = txTS
+}
+
+// setBufferSizes applies configured SO_SNDBUF/SO_RCVBUF to the socket and returns the effective sizes.
+// Kernel doubles the requested values and clamps them by net.core.wmem_max/rmem_max
+func (s *sendWorker) setBufferSizes(fd int) (sndbuf, rcvbuf int, err error) {
+	if s.config.SendBufferBytes > 0 {
+		if err = s.sockopts.setsockoptInt(fd, unix.SOL_SOCKET, unix.SO_SNDBUF, s.config.SendBufferBytes); err != nil {
+			return 0, 0, fmt.Errorf("failed to set SO_SNDBUF: %w", err)
+		}
+	}
+	if s.config.RecvBufferBytes > 0 {
+		if err = s.sockopts.setsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, s.config.RecvBufferBytes); err != nil {
+			return 0, 0, fmt.Errorf("failed to set SO_RCVBUF: %w", err)
+		}
+	}
+	if sndbuf, err = unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_SNDBUF); err != nil {
+		return 0, 0, fmt.Errorf("failed to get SO_SNDBUF: %w", err)
+	}
+	if rcvbuf, err = unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF); err != nil {
+		return 0, 0, fmt.Errorf("failed to get SO_RCVBUF: %w", err)
+	}
+	return sndbuf, rcvbuf, nil
+}
+
+// setAffinity locks the worker to the OS thread and pins it to a CPU from CPUAffinity.
+// CPUs are assigned by worker id wrapping around the list
+func (s *sendWorker) setAffinity() error {
+	if len(s.config.CPUAffinity) == 0 {
+		return nil
+	}
+	cpu := s.config.CPUAffinity[s.id%len(s.config.CPUAffinity)]
+	runtime.LockOSThread()
+	var set unix.CPUSet
+	set.Set(cpu)
+	// pid 0 is the calling thread
+	if err := unix.SchedSetaffinity(0, &set); err != nil {
+		return fmt.Errorf("failed to pin worker#%d to CPU %d: %w", s.id, cpu, err)
+	}
+	s.logger().Infof("Pinned worker#%d to CPU %d", s.id, cpu)
+	return nil
 }
 
 // Start a SendWorker which will pull data from the queue and send Sync and Followup packets
 func (s *sendWorker) Start() {
+	if err := s.setAffinity(); err != nil {
+		s.logger().Fatal(err)
+	}
 	eFd, gFd, err := s.listen()
 	if err != nil {
-		log.Fatal(err)
+		s.logger().Fatal(err)
 	}
-	defer unix.Close(eFd)
-	defer unix.Close(gFd)
+	// sockets are re-created on rebind, close whatever is current
+	defer func() {
+		unix.Close(eFd)
+		unix.Close(gFd)
+	}()
 
 	// reusable buffers
 	buf := make([]byte, timestamp.PayloadSizeBytes)
@@ -161,111 +563,74 @@ func (s *sendWorker) Start() {
 	// TMP buffers
 	toob := make([]byte, timestamp.ControlSizeBytes)
 
+	var batch *syncBatch
+	if s.config.SyncBatch > 1 {
+		batch = newSyncBatch(s.config.SyncBatch)
+	}
+
+	if s.config.PrewarmIP != nil {
+		if err := s.prewarm(eFd, buf, oob, toob); err != nil {
+			s.logger().Warningf("Failed to pre-warm worker#%d TX timestamping: %v", s.id, err)
+		}
+		// pre-warm Sync took a TX timestamp counter number
+		if batch != nil {
+			if err := batch.resync(eFd); err != nil {
+				s.logger().Fatal(err)
+			}
+		}
+	}
+
 	var (
-		n        int
-		attempts int
-		txTS     time.Time
-		c        *SubscriptionClient
+		n int
+		c *SubscriptionClient
 	)
 
 	for {
 		select {
+		case <-s.stop:
+			s.logger().Infof("Stopped worker#%d", s.id)
+			return
+		case <-s.rebind:
+			// old sockets are kept until new ones are up, so with pinned ports they take a spare one from the range
+			newEFd, newGFd, err := s.listen()
+			if err != nil {
+				s.logger().Errorf("Failed to rebind worker#%d sockets: %v", s.id, err)
+				// retry later, old sockets are used meanwhile
+				time.AfterFunc(time.Second, s.Rebind)
+				continue
+			}
+			unix.Close(eFd)
+			unix.Close(gFd)
+			eFd, gFd = newEFd, newGFd
+			if batch != nil {
+				batch.nextID = 0
+			}
 		case c = <-s.queue:
-			switch c.subscriptionType {
-			case ptp.MessageSync:
-				// send sync
-				c.UpdateSync()
-				n, err = ptp.BytesTo(c.Sync(), buf)
-				if err != nil {
-					log.Errorf("Failed to generate the sync packet: %v", err)
-					continue
-				}
-				log.Debugf("Sending sync")
-
-				err = unix.Sendto(eFd, buf[:n], 0, c.eclisa)
-				if err != nil {
-					log.Errorf("Failed to send the sync packet: %v", err)
-					continue
-				}
-				s.stats.IncTX(c.subscriptionType)
-
-				txTS, attempts, err = timestamp.ReadTXtimestampBuf(eFd, oob, toob)
-				s.stats.SetMaxTXTSAttempts(s.id, int64(attempts))
-				if err != nil {
-					log.Warningf("Failed to read TX timestamp: %v", err)
-					continue
-				}
-				if s.config.TimestampType != timestamp.HWTIMESTAMP {
-					txTS = txTS.Add(s.config.UTCOffset)
-				}
-
-				// send followup
-				c.UpdateFollowup(txTS)
-				n, err = ptp.BytesTo(c.Followup(), buf)
-				if err != nil {
-					log.Errorf("Failed to generate the followup packet: %v", err)
-					continue
-				}
-				log.Debug("Sending followup")
-
-				err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
-				if err != nil {
-					log.Errorf("Failed to send the followup packet: %v", err)
-					continue
-				}
-				s.stats.IncTX(ptp.MessageFollowUp)
-			case ptp.MessageAnnounce:
-				// send announce
-				c.UpdateAnnounce()
-				n, err = ptp.BytesTo(c.Announce(), buf)
-				if err != nil {
-					log.Errorf("Failed to prepare the announce packet: %v", err)
-					continue
-				}
-				log.Debug("Sending announce")
-
-				err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
-				if err != nil {
-					log.Errorf("Failed to send the announce packet: %v", err)
-					continue
-				}
-				s.stats.IncTX(c.subscriptionType)
-
-			case ptp.MessageDelayResp:
-				// send delay response
-				n, err = ptp.BytesTo(c.DelayResp(), buf)
-				if err != nil {
-					log.Errorf("Failed to prepare the delay response packet: %v", err)
-					continue
-				}
-				log.Debug("Sending delay response")
-
-				err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
-				if err != nil {
-					log.Errorf("Failed to send the delay response: %v", err)
-					continue
-				}
-				s.stats.IncTX(c.subscriptionType)
-
-			default:
-				log.Errorf("Unknown subscription type: %v", c.subscriptionType)
+			atomic.StoreInt64(&s.lastActive, s.config.clock().Now().UnixNano())
+			if batch == nil || c.subscriptionType != ptp.MessageSync {
+				s.send(eFd, gFd, c, buf, oob, toob)
 				continue
 			}
-			c.IncSequenceID()
+			s.sendSyncBatch(eFd, gFd, batch, c, buf)
+			for _, o := range batch.others {
+				s.send(eFd, gFd, o, buf, oob, toob)
+			}
 			s.stats.SetMaxWorkerQueue(s.id, int64(len(s.queue)))
 		case c = <-s.signalingQueue:
-			n, err = ptp.BytesTo(c.Signaling(), buf)
+			atomic.StoreInt64(&s.lastActive, s.config.clock().Now().UnixNano())
+			signaling := c.Signaling()
+			n, err = ptp.BytesTo(signaling, buf)
 			if err != nil {
-				log.Errorf("Failed to prepare the unicast signaling: %v", err)
+				s.logger().Errorf("Failed to prepare the unicast signaling: %v", err)
 				continue
 			}
-			err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
+			err = s.sendTo(gFd, buf[:n], c.gclisa)
 			if err != nil {
-				log.Errorf("Failed to send the unicast signaling: %v", err)
+				s.logger().Errorf("Failed to send the unicast signaling: %v", err)
 				continue
 			}
-			log.Debug("Sent unicast signaling")
-			for _, tlv := range c.Signaling().TLVs {
+			s.logger().Debug("Sent unicast signaling")
+			for _, tlv := range signaling.TLVs {
 				switch tlv.(type) {
 				case *ptp.GrantUnicastTransmissionTLV:
 					s.stats.IncTXSignalingGrant(c.subscriptionType)
@@ -277,56 +642,251 @@ func (s *sendWorker) Start() {
 	}
 }
 
-// FindSubscription retrieves an existing client
-func (s *sendWorker) FindSubscription(clientID ptp.PortIdentity, st ptp.MessageType) *SubscriptionClient {
+// send sends the packet of the subscription job
+func (s *sendWorker) send(eFd, gFd int, c *SubscriptionClient, buf, oob, toob []byte) {
+	var (
+		n   int
+		err error
+	)
+	switch c.subscriptionType {
+	case ptp.MessageSync:
+		// errors are logged by sendSync
+		_, _ = s.sendSync(eFd, gFd, c, buf, oob, toob)
+	case ptp.MessageAnnounce:
+		// send announce
+		c.UpdateAnnounce()
+		n, err = ptp.BytesTo(c.Announce(), buf)
+		if err != nil {
+			s.logger().Errorf("Failed to prepare the announce packet: %v", err)
+			return
+		}
+		s.logger().Debug("Sending announce")
+
+		err = s.sendTo(gFd, buf[:n], c.gclisa)
+		if err != nil {
+			s.logger().Errorf("Failed to send the announce packet: %v", err)
+			return
+		}
+		s.stats.IncTX(c.subscriptionType)
+
+	case ptp.MessageDelayResp:
+		// send delay response
+		n, err = ptp.BytesTo(c.DelayResp(), buf)
+		if err != nil {
+			s.logger().Errorf("Failed to prepare the delay response packet: %v", err)
+			return
+		}
+		s.logger().Debug("Sending delay response")
+
+		err = s.sendTo(gFd, buf[:n], c.gclisa)
+		if err != nil {
+			s.logger().Errorf("Failed to send the delay response: %v", err)
+			return
+		}
+		s.stats.IncTX(c.subscriptionType)
+		if read := c.delayReqReadTime(); !read.IsZero() {
+			s.stats.SetMaxDelayRespLatency(s.id, s.config.clock().Now().Sub(read))
+		}
+
+	default:
+		s.logger().Errorf("Unknown subscription type: %v", c.subscriptionType)
+		return
+	}
+	c.IncSequenceID()
+	s.stats.SetMaxWorkerQueue(s.id, int64(len(s.queue)))
+}
+
+// Rebind asks the worker to close and re-create its sockets
+func (s *sendWorker) Rebind() {
+	select {
+	case s.rebind <- struct{}{}:
+	default:
+	}
+}
+
+// retire stops the worker if it has no clients and processed no jobs for the given time.
+// Returns true if the worker was stopped. Subscriptions can't be registered on it afterwards
+func (s *sendWorker) retire(timeout time.Duration) bool {
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	m, ok := s.clients[st]
-	if !ok {
-		return nil
+	if s.subscriptionCount() != 0 {
+		return false
 	}
-	sub, ok := m[clientID]
-	if !ok {
-		return nil
+	if len(s.queue) != 0 || len(s.signalingQueue) != 0 {
+		return false
+	}
+	if s.config.clock().Now().Sub(time.Unix(0, atomic.LoadInt64(&s.lastActive))) <= timeout {
+		return false
+	}
+	s.shutdown()
+	return true
+}
+
+// shutdown stops the worker. Must be called with mux held
+func (s *sendWorker) shutdown() {
+	if s.stopped {
+		return
 	}
-	return sub
+	s.stopped = true
+	close(s.stop)
+}
+
+// FindSubscription retrieves an existing client
+func (s *sendWorker) FindSubscription(clientID ptp.PortIdentity, st ptp.MessageType) *SubscriptionClient {
+	return s.clients.Get(clientID, st)
 }
 
 // FindClients retrieves all clients for a particular subscription type
 func (s *sendWorker) FindClients(st ptp.MessageType) map[ptp.PortIdentity]*SubscriptionClient {
+	var m map[ptp.PortIdentity]*SubscriptionClient
+	s.clients.Range(func(clientID ptp.PortIdentity, t ptp.MessageType, sc *SubscriptionClient) bool {
+		if t == st {
+			if m == nil {
+				m = map[ptp.PortIdentity]*SubscriptionClient{}
+			}
+			m[clientID] = sc
+		}
+		return true
+	})
+	return m
+}
+
+// subscriptionCount returns number of subscriptions on the worker, expired included
+func (s *sendWorker) subscriptionCount() int {
+	n := 0
+	s.clients.Range(func(ptp.PortIdentity, ptp.MessageType, *SubscriptionClient) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// subscriptions returns descriptions of worker subscriptions which haven't expired
+func (s *sendWorker) subscriptions() []SubscriptionInfo {
+	var res []SubscriptionInfo
+	s.clients.Range(func(clientID ptp.PortIdentity, _ ptp.MessageType, sc *SubscriptionClient) bool {
+		if !sc.Expired() {
+			res = append(res, sc.info(clientID))
+		}
+		return true
+	})
+	return res
+}
+
+// RegisterSubscription will overwrite an existing subscription, its load is accounted for.
+// Make sure you call findSubscription before this.
+// Returns false if the worker is retired and the subscription wasn't registered
+func (s *sendWorker) RegisterSubscription(clientID ptp.PortIdentity, st ptp.MessageType, sc *SubscriptionClient) bool {
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	m, ok := s.clients[st]
-	if !ok {
-		return nil
+	if s.stopped {
+		return false
 	}
-	return m
+	if old := s.clients.Get(clientID, st); old != nil {
+		atomic.AddInt64(&s.load, -subscriptionLoad(old.Interval()))
+	}
+	s.clients.Add(clientID, st, sc)
+	sc.stats = s.stats
+	atomic.AddInt64(&s.load, subscriptionLoad(sc.Interval()))
+	return true
 }
 
-// RegisterSubscription will overwrite an existing subscription.
-// Make sure you call findSubscription before this
-func (s *sendWorker) RegisterSubscription(clientID ptp.PortIdentity, st ptp.MessageType, sc *SubscriptionClient) {
+// setInterval changes the interval of the subscription registered on the worker, keeping its load accounted for
+func (s *sendWorker) setInterval(sc *SubscriptionClient, interval time.Duration) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	m, ok := s.clients[st]
-	if !ok {
-		s.clients[st] = map[ptp.PortIdentity]*SubscriptionClient{}
-		m = s.clients[st]
+	atomic.AddInt64(&s.load, subscriptionLoad(interval)-subscriptionLoad(sc.Interval()))
+	sc.SetInterval(interval)
+}
+
+// Load returns an estimated number of messages per hour the worker sends
+func (s *sendWorker) Load() int64 {
+	return atomic.LoadInt64(&s.load)
+}
+
+// hasClient checks if the client has any subscriptions on the worker
+func (s *sendWorker) hasClient(clientID ptp.PortIdentity) bool {
+	for _, st := range []ptp.MessageType{ptp.MessageAnnounce, ptp.MessageSync, ptp.MessageDelayResp} {
+		if s.clients.Get(clientID, st) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriptionLoad returns number of messages per hour sent with the interval
+func subscriptionLoad(interval time.Duration) int64 {
+	if interval <= 0 {
+		return 0
+	}
+	return int64(time.Hour / interval)
+}
+
+// sweepExpired stops and removes all expired subscriptions. Returns number of evicted subscriptions
+func (s *sendWorker) sweepExpired() int {
+	expired := s.clients.Expire(func(sc *SubscriptionClient) bool {
+		return sc.Expired()
+	})
+	for _, sc := range expired {
+		sc.Stop()
+		atomic.AddInt64(&s.load, -subscriptionLoad(sc.Interval()))
+		s.stats.IncSubscriptionExpired(sc.subscriptionType)
 	}
-	m[clientID] = sc
+	return len(expired)
 }
 
 func (s *sendWorker) inventoryClients() {
-	s.mux.Lock()
-	defer s.mux.Unlock()
-	for st, subs := range s.clients {
-		for k, sc := range subs {
-			if !sc.Running() {
-				delete(subs, k)
-				continue
-			}
-			s.stats.IncSubscription(st)
-			s.stats.IncWorkerSubs(s.id)
+	stopped := s.clients.Expire(func(sc *SubscriptionClient) bool {
+		return !sc.Running()
+	})
+	for _, sc := range stopped {
+		if sc.Expired() {
+			s.stats.IncSubscriptionExpired(sc.subscriptionType)
 		}
 	}
+	var load int64
+	s.clients.Range(func(_ ptp.PortIdentity, st ptp.MessageType, sc *SubscriptionClient) bool {
+		load += subscriptionLoad(sc.Interval())
+		s.stats.IncSubscription(st)
+		s.stats.IncWorkerSubs(s.id)
+		return true
+	})
+	// recalculate the load as intervals may change on renewal
+	atomic.StoreInt64(&s.load, load)
+}
+
+// jitterWindow is a number of samples in a window jitter is calculated over, so it follows recent behaviour
+const jitterWindow = 1024
+
+// jitter is a standard deviation of durations over a window of samples.
+// Samples are added to the current window while the previous complete one is reported,
+// so jitter doesn't start over from 0 each time the window is full
+type jitter struct {
+	// n is a number of samples in the current window
+	n        int
+	current  *welford.Stats
+	previous *welford.Stats
+}
+
+// add adds the sample to the current window, starting a new one once it's full
+func (j *jitter) add(d time.Duration) {
+	if j.current == nil || j.n == jitterWindow {
+		j.previous = j.current
+		j.current = welford.New()
+		j.n = 0
+	}
+	j.current.Add(float64(d))
+	j.n++
+}
+
+// stddev returns the standard deviation of the samples of the previous window,
+// or of the current one until it's complete
+func (j *jitter) stddev() time.Duration {
+	if j.previous != nil {
+		return time.Duration(j.previous.Stddev())
+	}
+	if j.current == nil || j.n < 2 {
+		return 0
+	}
+	return time.Duration(j.current.Stddev())
 }
@@ -17,15 +17,23 @@ limitations under the License.
 package server
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"os"
+	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
 	"github.com/facebook/time/ptp/ptp4u/stats"
 	"github.com/facebook/time/timestamp"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
 func TestWorkerQueue(t *testing.T) {
@@ -94,7 +102,7 @@ func TestFindSubscription(t *testing.T) {
 	w := &sendWorker{
 		id:      0,
 		queue:   make(chan *SubscriptionClient),
-		clients: make(map[ptp.MessageType]map[ptp.PortIdentity]*SubscriptionClient),
+		clients: NewMapSubscriptionStore(),
 	}
 
 	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
@@ -122,7 +130,7 @@ func TestFindClients(t *testing.T) {
 	w := &sendWorker{
 		id:      0,
 		queue:   make(chan *SubscriptionClient),
-		clients: make(map[ptp.MessageType]map[ptp.PortIdentity]*SubscriptionClient),
+		clients: NewMapSubscriptionStore(),
 	}
 
 	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
@@ -169,7 +177,7 @@ func TestInventoryClients(t *testing.T) {
 	time.Sleep(10 * time.Millisecond)
 
 	w.inventoryClients()
-	require.Equal(t, 1, len(w.clients))
+	require.Len(t, w.FindClients(ptp.MessageSync), 1)
 
 	scA1 := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, 10*time.Millisecond, time.Now().Add(time.Minute))
 	w.RegisterSubscription(clipi1, ptp.MessageAnnounce, scA1)
@@ -177,7 +185,7 @@ func TestInventoryClients(t *testing.T) {
 	time.Sleep(10 * time.Millisecond)
 
 	w.inventoryClients()
-	require.Equal(t, 2, len(w.clients))
+	require.Len(t, w.FindClients(ptp.MessageAnnounce), 1)
 
 	scS2 := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, 10*time.Millisecond, time.Now().Add(time.Minute))
 	w.RegisterSubscription(clipi2, ptp.MessageSync, scS2)
@@ -185,41 +193,771 @@ func TestInventoryClients(t *testing.T) {
 	time.Sleep(10 * time.Millisecond)
 
 	w.inventoryClients()
-	require.Equal(t, 2, len(w.clients[ptp.MessageSync]))
+	require.Equal(t, 2, len(w.FindClients(ptp.MessageSync)))
 
 	// Shutting down
 	scS1.SetExpire(time.Now())
 	time.Sleep(50 * time.Millisecond)
 	w.inventoryClients()
-	require.Equal(t, 1, len(w.clients[ptp.MessageSync]))
+	require.Equal(t, 1, len(w.FindClients(ptp.MessageSync)))
 
 	scA1.SetExpire(time.Now())
 	time.Sleep(50 * time.Millisecond)
 	w.inventoryClients()
-	require.Equal(t, 0, len(w.clients[ptp.MessageAnnounce]))
+	require.Equal(t, 0, len(w.FindClients(ptp.MessageAnnounce)))
 
 	scS2.Stop()
 	time.Sleep(50 * time.Millisecond)
 	w.inventoryClients()
-	require.Equal(t, 0, len(w.clients[ptp.MessageSync]))
+	require.Equal(t, 0, len(w.FindClients(ptp.MessageSync)))
 }
 
-func TestEnableDSCP(t *testing.T) {
-	conn4, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+func TestWorkerLoad(t *testing.T) {
+	clipi := ptp.PortIdentity{
+		PortNumber:    1,
+		ClockIdentity: ptp.ClockIdentity(1234),
+	}
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			QueueSize: 100,
+		},
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	require.True(t, w.RegisterSubscription(clipi, ptp.MessageSync, sc))
+	require.Equal(t, int64(3600), w.Load())
+
+	// Overwritten subscription doesn't count anymore
+	sc = NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, 2*time.Second, time.Now().Add(time.Minute))
+	require.True(t, w.RegisterSubscription(clipi, ptp.MessageSync, sc))
+	require.Equal(t, int64(1800), w.Load())
+
+	// Renewal with another interval
+	w.setInterval(sc, 500*time.Millisecond)
+	require.Equal(t, int64(7200), w.Load())
+}
+
+func TestSweepExpired(t *testing.T) {
+	clipi1 := ptp.PortIdentity{
+		PortNumber:    1,
+		ClockIdentity: ptp.ClockIdentity(1234),
+	}
+	clipi2 := ptp.PortIdentity{
+		PortNumber:    1,
+		ClockIdentity: ptp.ClockIdentity(5678),
+	}
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			QueueSize: 100,
+		},
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	scS1 := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(50*time.Millisecond))
+	w.RegisterSubscription(clipi1, ptp.MessageSync, scS1)
+	scS2 := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	w.RegisterSubscription(clipi2, ptp.MessageSync, scS2)
+
+	require.Equal(t, 0, w.sweepExpired())
+	require.Equal(t, 2, len(w.FindClients(ptp.MessageSync)))
+
+	// Subscription is not renewed
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, 1, w.sweepExpired())
+	require.Nil(t, w.FindSubscription(clipi1, ptp.MessageSync))
+	require.Equal(t, scS2, w.FindSubscription(clipi2, ptp.MessageSync))
+}
+
+func TestWorkerSetAffinity(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("CPU affinity is only supported on linux")
+	}
+	var allowed unix.CPUSet
+	require.NoError(t, unix.SchedGetaffinity(0, &allowed))
+	cpu := -1
+	for i := 0; i < 1024; i++ {
+		if allowed.IsSet(i) {
+			cpu = i
+		}
+	}
+	require.NotEqual(t, -1, cpu)
+
+	// worker 1 wraps around to the only CPU in the list
+	c := &Config{StaticConfig: StaticConfig{CPUAffinity: []int{cpu}}}
+	w := newSendWorker(1, c, stats.NewJSONStats())
+
+	errs := make(chan error)
+	sets := make(chan unix.CPUSet)
+	// thread stays locked and is thrown away once the goroutine exits
+	go func() {
+		if err := w.setAffinity(); err != nil {
+			errs <- err
+			return
+		}
+		var set unix.CPUSet
+		errs <- unix.SchedGetaffinity(0, &set)
+		sets <- set
+	}()
+	require.NoError(t, <-errs)
+	set := <-sets
+	require.Equal(t, 1, set.Count())
+	require.True(t, set.IsSet(cpu))
+}
+
+func TestWorkerSetAffinityEmpty(t *testing.T) {
+	w := newSendWorker(0, &Config{}, stats.NewJSONStats())
+	require.NoError(t, w.setAffinity())
+}
+
+func TestWorkerFollowupSequence(t *testing.T) {
+	eConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer eConn.Close()
+	gConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer gConn.Close()
+
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			IP:            net.ParseIP("127.0.0.1"),
+			TimestampType: timestamp.SWTIMESTAMP,
+		},
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+
+	esa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), eConn.LocalAddr().(*net.UDPAddr).Port)
+	gsa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), gConn.LocalAddr().(*net.UDPAddr).Port)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, esa, gsa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	sc.sequenceID = 42
+
+	// slow TX timestamp during which the client sequence moves on
+	called := make(chan struct{})
+	c.Clock = txtsClock{read: func(connFd int, oob, toob []byte) (time.Time, int, error) {
+		defer close(called)
+		sc.IncSequenceID()
+		time.Sleep(10 * time.Millisecond)
+		return timestamp.ReadTXtimestampBuf(connFd, oob, toob)
+	}}
+
+	go w.Start()
+	defer close(w.stop)
+	w.queue <- sc
+	<-called
+
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	require.NoError(t, eConn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := eConn.Read(buf)
+	require.NoError(t, err)
+	syncP := &ptp.SyncDelayReq{}
+	require.NoError(t, ptp.FromBytes(buf[:n], syncP))
+
+	require.NoError(t, gConn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err = gConn.Read(buf)
+	require.NoError(t, err)
+	followup := &ptp.FollowUp{}
+	require.NoError(t, ptp.FromBytes(buf[:n], followup))
+
+	require.Equal(t, uint16(42), syncP.SequenceID)
+	require.Equal(t, syncP.SequenceID, followup.SequenceID)
+}
+
+// recordingSockopts records requested socket options before setting them
+type recordingSockopts struct {
+	requested map[int]int
+}
+
+func (r *recordingSockopts) setsockoptInt(fd, level, opt, value int) error {
+	r.requested[opt] = value
+	return unix.SetsockoptInt(fd, level, opt, value)
+}
+
+func TestWorkerSetBufferSizes(t *testing.T) {
+	c := &Config{
+		StaticConfig: StaticConfig{
+			RecvBufferBytes: 65536,
+			SendBufferBytes: 32768,
+		},
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, unix.IPPROTO_UDP)
+	require.NoError(t, err)
+	defer unix.Close(fd)
+
+	so := &recordingSockopts{requested: map[int]int{}}
+	w.sockopts = so
+
+	sndbuf, rcvbuf, err := w.setBufferSizes(fd)
+	require.NoError(t, err)
+	require.Equal(t, map[int]int{unix.SO_SNDBUF: 32768, unix.SO_RCVBUF: 65536}, so.requested)
+	// kernel reports the doubled value, possibly clamped by wmem_max/rmem_max
+	require.Greater(t, sndbuf, 0)
+	require.Greater(t, rcvbuf, 0)
+
+	// nothing is requested unless configured
+	so.requested = map[int]int{}
+	c.SendBufferBytes = 0
+	c.RecvBufferBytes = 0
+	_, _, err = w.setBufferSizes(fd)
+	require.NoError(t, err)
+	require.Empty(t, so.requested)
+}
+
+func TestWorkerLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	c := &Config{
+		StaticConfig: StaticConfig{
+			IP:            net.ParseIP("127.0.0.1"),
+			TimestampType: timestamp.SWTIMESTAMP,
+		},
+		Logger: logger.WithField("server", "test"),
+	}
+	w := newSendWorker(3, c, stats.NewJSONStats())
+
+	eFd, gFd, err := w.listen()
+	require.NoError(t, err)
+	unix.Close(eFd)
+	unix.Close(gFd)
+	require.Contains(t, buf.String(), "Started worker#3 event on [127.0.0.1]")
+	require.Contains(t, buf.String(), "server=test")
+
+	// global logger is used by default
+	c.Logger = nil
+	require.Equal(t, logrus.StandardLogger(), w.logger())
+}
+
+// freePorts returns a port which is free on localhost along with the next one
+func freePorts(t *testing.T) int {
+	for i := 0; i < 10; i++ {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+		require.NoError(t, err)
+		port := conn.LocalAddr().(*net.UDPAddr).Port
+		next, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: port + 1})
+		conn.Close()
+		if err == nil {
+			next.Close()
+			return port
+		}
+	}
+	t.Fatal("no two consecutive free ports")
+	return 0
+}
+
+func localPort(t *testing.T, fd int) int {
+	sa, err := unix.Getsockname(fd)
+	require.NoError(t, err)
+	return sa.(*unix.SockaddrInet4).Port
+}
+
+func TestWorkerListenPorts(t *testing.T) {
+	eventPort := freePorts(t)
+	generalPort := freePorts(t)
+	for generalPort >= eventPort-1 && generalPort <= eventPort+1 {
+		generalPort = freePorts(t)
+	}
+	c := &Config{
+		StaticConfig: StaticConfig{
+			IP:            net.ParseIP("127.0.0.1"),
+			TimestampType: timestamp.SWTIMESTAMP,
+			EventPorts:    PortRange{First: eventPort, Last: eventPort + 1},
+			GeneralPorts:  PortRange{First: generalPort, Last: generalPort + 1},
+		},
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+	eFd, gFd, err := w.listen()
+	require.NoError(t, err)
+	defer unix.Close(eFd)
+	defer unix.Close(gFd)
+	require.Equal(t, eventPort, localPort(t, eFd))
+	require.Equal(t, generalPort, localPort(t, gFd))
+
+	// the first ports are taken, next ones are used
+	w2 := newSendWorker(0, c, stats.NewJSONStats())
+	eFd2, gFd2, err := w2.listen()
+	require.NoError(t, err)
+	defer unix.Close(eFd2)
+	defer unix.Close(gFd2)
+	require.Equal(t, eventPort+1, localPort(t, eFd2))
+	require.Equal(t, generalPort+1, localPort(t, gFd2))
+
+	// the range is exhausted
+	w3 := newSendWorker(0, c, stats.NewJSONStats())
+	_, _, err = w3.listen()
+	require.ErrorIs(t, err, unix.EADDRINUSE)
+}
+
+// openFDs returns the number of file descriptors open by the process
+func openFDs(t *testing.T) int {
+	fds, err := os.ReadDir("/proc/self/fd")
+	require.NoError(t, err)
+	return len(fds)
+}
+
+func TestWorkerListenFailureClosesSockets(t *testing.T) {
+	taken, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer taken.Close()
+	port := taken.LocalAddr().(*net.UDPAddr).Port
+
+	c := &Config{
+		StaticConfig: StaticConfig{
+			IP:            net.ParseIP("127.0.0.1"),
+			TimestampType: timestamp.SWTIMESTAMP,
+			GeneralPorts:  PortRange{First: port, Last: port},
+		},
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+	before := openFDs(t)
+	// event socket is up when binding general one fails
+	eFd, gFd, err := w.listen()
+	require.ErrorIs(t, err, unix.EADDRINUSE)
+	require.Equal(t, -1, eFd)
+	require.Equal(t, -1, gFd)
+	require.LessOrEqual(t, openFDs(t), before)
+
+	c.GeneralPorts = PortRange{}
+	c.TimestampType = "bogus"
+	_, _, err = w.listen()
+	require.Error(t, err)
+	require.LessOrEqual(t, openFDs(t), before)
+}
+
+func TestJitterStddev(t *testing.T) {
+	var j jitter
+	require.Equal(t, time.Duration(0), j.stddev())
+	j.add(-time.Microsecond)
+	require.Equal(t, time.Duration(0), j.stddev())
+	j.add(time.Microsecond)
+	j.add(-time.Microsecond)
+	j.add(time.Microsecond)
+	require.Equal(t, 1154*time.Nanosecond, j.stddev())
+
+	// complete window is reported while the next one fills up
+	for i := j.n; i < jitterWindow; i++ {
+		j.add(0)
+	}
+	require.Equal(t, 62*time.Nanosecond, j.stddev())
+	j.add(5 * time.Microsecond)
+	require.Equal(t, 1, j.n)
+	require.Equal(t, 62*time.Nanosecond, j.stddev())
+	for i := j.n; i < jitterWindow; i++ {
+		j.add(0)
+	}
+	j.add(0)
+	require.Equal(t, 156*time.Nanosecond, j.stddev())
+}
+
+type syncJitterStats struct {
+	*stats.JSONStats
+	jitter time.Duration
+}
+
+func (s *syncJitterStats) SetWorkerSyncJitter(workerid int, jitter time.Duration) {
+	s.jitter = jitter
+}
+
+func TestWorkerRecordSyncTX(t *testing.T) {
+	c := &Config{
+		StaticConfig: StaticConfig{
+			IP:            net.ParseIP("127.0.0.1"),
+			TimestampType: timestamp.SWTIMESTAMP,
+		},
+	}
+	st := &syncJitterStats{JSONStats: stats.NewJSONStats()}
+	w := newSendWorker(0, c, st)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, nil, nil, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+
+	now := time.Now()
+	w.recordSyncTX(sc, now)
+	require.Equal(t, now, sc.lastSyncTX)
+	require.Equal(t, 0, w.syncJitter.n)
+
+	// intervals of 1s+1us, 1s-1us, 1s+1us
+	for _, d := range []time.Duration{time.Second + time.Microsecond, time.Second - time.Microsecond, time.Second + time.Microsecond} {
+		now = now.Add(d)
+		w.recordSyncTX(sc, now)
+	}
+	require.Equal(t, 3, w.syncJitter.n)
+	require.Equal(t, 1154*time.Nanosecond, st.jitter)
+}
+
+func TestWorkerPrewarm(t *testing.T) {
+	eConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer eConn.Close()
+	gConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer gConn.Close()
+
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			IP:            net.ParseIP("127.0.0.1"),
+			PrewarmIP:     net.ParseIP("127.0.0.1"),
+			TimestampType: timestamp.SWTIMESTAMP,
+		},
+		Logger: logger,
+	}
+	var txts int64
+	c.Clock = txtsClock{read: func(connFd int, oob, toob []byte) (time.Time, int, error) {
+		atomic.AddInt64(&txts, 1)
+		return timestamp.ReadTXtimestampBuf(connFd, oob, toob)
+	}}
+
+	st := stats.NewJSONStats()
+	w := newSendWorker(0, c, st)
+	esa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), eConn.LocalAddr().(*net.UDPAddr).Port)
+	gsa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), gConn.LocalAddr().(*net.UDPAddr).Port)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, esa, gsa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	sc.sequenceID = 42
+
+	go w.Start()
+	defer close(w.stop)
+	w.queue <- sc
+
+	// real subscription is served as usual
+	pkt := make([]byte, timestamp.PayloadSizeBytes)
+	require.NoError(t, eConn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := eConn.Read(pkt)
+	require.NoError(t, err)
+	syncP := &ptp.SyncDelayReq{}
+	require.NoError(t, ptp.FromBytes(pkt[:n], syncP))
+	require.Equal(t, uint16(42), syncP.SequenceID)
+	require.NoError(t, gConn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = gConn.Read(pkt)
+	require.NoError(t, err)
+
+	// pre-warm read its own TX timestamp and isn't accounted
+	require.Equal(t, int64(2), atomic.LoadInt64(&txts))
+	require.Equal(t, int64(1), st.TX()[ptp.MessageSync])
+	require.Contains(t, buf.String(), "Pre-warmed worker#0 TX timestamping in")
+}
+
+type txtsFallbackStats struct {
+	*stats.JSONStats
+	fallbacks int64
+}
+
+func (s *txtsFallbackStats) IncTXTSFallback() {
+	atomic.AddInt64(&s.fallbacks, 1)
+}
+
+func TestWorkerTXTimestampFallback(t *testing.T) {
+	eConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer eConn.Close()
+	gConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer gConn.Close()
+
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			IP:            net.ParseIP("127.0.0.1"),
+			TimestampType: timestamp.HWTIMESTAMP,
+		},
+		DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second},
+	}
+	c.Clock = txtsClock{read: func(connFd int, oob, toob []byte) (time.Time, int, error) {
+		return time.Time{}, 100, errors.New("no TX timestamp")
+	}}
+
+	st := &txtsFallbackStats{JSONStats: stats.NewJSONStats()}
+	w := newSendWorker(0, c, st)
+	// hardware timestamping can't be enabled on loopback, sockets are the same otherwise
+	c.TimestampType = timestamp.SWTIMESTAMP
+	eFd, gFd, err := w.listen()
+	require.NoError(t, err)
+	defer unix.Close(eFd)
+	defer unix.Close(gFd)
+	c.TimestampType = timestamp.HWTIMESTAMP
+
+	esa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), eConn.LocalAddr().(*net.UDPAddr).Port)
+	gsa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), gConn.LocalAddr().(*net.UDPAddr).Port)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, esa, gsa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	toob := make([]byte, timestamp.ControlSizeBytes)
+
+	// FollowUp isn't sent unless fallback is enabled
+	_, err = w.sendSync(eFd, gFd, sc, buf, oob, toob)
+	require.Error(t, err)
+	require.Equal(t, int64(0), atomic.LoadInt64(&st.fallbacks))
+
+	c.TXTimestampFallback = true
+	before := time.Now()
+	_, err = w.sendSync(eFd, gFd, sc, buf, oob, toob)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), atomic.LoadInt64(&st.fallbacks))
+
+	require.NoError(t, gConn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := gConn.Read(buf)
+	require.NoError(t, err)
+	followup := &ptp.FollowUp{}
+	require.NoError(t, ptp.FromBytes(buf[:n], followup))
+	// userspace timestamp is converted to TAI
+	origin := followup.PreciseOriginTimestamp.Time()
+	require.InDelta(t, before.Add(37*time.Second).UnixNano(), origin.UnixNano(), float64(100*time.Millisecond))
+}
+
+func TestWorkerSendSyncFakeClock(t *testing.T) {
+	eConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer eConn.Close()
+	gConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer gConn.Close()
+
+	clock := &fakeClock{now: time.Date(2022, time.March, 1, 0, 0, 0, 0, time.UTC), txDelay: 3 * time.Microsecond}
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			IP:            net.ParseIP("127.0.0.1"),
+			TimestampType: timestamp.SWTIMESTAMP,
+		},
+		DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second},
+		Clock:         clock,
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+	eFd, gFd, err := w.listen()
 	require.NoError(t, err)
-	defer conn4.Close()
-	// get connection file descriptor
-	fd4, err := timestamp.ConnFd(conn4)
+	defer unix.Close(eFd)
+	defer unix.Close(gFd)
+
+	esa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), eConn.LocalAddr().(*net.UDPAddr).Port)
+	gsa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), gConn.LocalAddr().(*net.UDPAddr).Port)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, esa, gsa, ptp.MessageSync, c, time.Second, clock.Now().Add(time.Minute))
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	toob := make([]byte, timestamp.ControlSizeBytes)
+
+	for i := 0; i < 2; i++ {
+		sent := clock.Now()
+		latency, err := w.sendSync(eFd, gFd, sc, buf, oob, toob)
+		require.NoError(t, err)
+		require.Equal(t, 3*time.Microsecond, latency)
+
+		require.NoError(t, gConn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, err := gConn.Read(buf)
+		require.NoError(t, err)
+		followup := &ptp.FollowUp{}
+		require.NoError(t, ptp.FromBytes(buf[:n], followup))
+		// software timestamp is converted to TAI
+		require.True(t, sent.Add(37*time.Second).Equal(followup.PreciseOriginTimestamp.Time()))
+
+		sc.IncSequenceID()
+		clock.Advance(time.Second)
+	}
+	require.False(t, sc.Expired())
+	clock.Advance(time.Minute)
+	require.True(t, sc.Expired())
+}
+
+type oversizedStats struct {
+	*stats.JSONStats
+	oversized int64
+}
+
+func (s *oversizedStats) IncTXOversized() {
+	atomic.AddInt64(&s.oversized, 1)
+}
+
+func TestWorkerSendOversized(t *testing.T) {
+	eConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
 	require.NoError(t, err)
-	err = enableDSCP(fd4, net.ParseIP("127.0.0.1"), 42)
+	defer eConn.Close()
+	gConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
 	require.NoError(t, err)
+	defer gConn.Close()
 
-	conn6, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::"), Port: 0})
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			IP:            net.ParseIP("127.0.0.1"),
+			TimestampType: timestamp.SWTIMESTAMP,
+		},
+		DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second},
+		// 52 bytes of payload fit Sync, but not 64 bytes Announce
+		mtu: 80,
+	}
+	st := &oversizedStats{JSONStats: stats.NewJSONStats()}
+	w := newSendWorker(0, c, st)
+	esa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), eConn.LocalAddr().(*net.UDPAddr).Port)
+	gsa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), gConn.LocalAddr().(*net.UDPAddr).Port)
+	scA := NewSubscriptionClient(w.queue, w.signalingQueue, esa, gsa, ptp.MessageAnnounce, c, time.Second, time.Now().Add(time.Minute))
+	scS := NewSubscriptionClient(w.queue, w.signalingQueue, esa, gsa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+
+	go w.Start()
+	defer close(w.stop)
+	w.queue <- scA
+	w.queue <- scS
+
+	// only the Sync made it through
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	require.NoError(t, eConn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := eConn.Read(buf)
+	require.NoError(t, err)
+	msgType, err := ptp.ProbeMsgType(buf[:n])
+	require.NoError(t, err)
+	require.Equal(t, ptp.MessageSync, msgType)
+	require.NoError(t, gConn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err = gConn.Read(buf)
+	require.NoError(t, err)
+	msgType, err = ptp.ProbeMsgType(buf[:n])
+	require.NoError(t, err)
+	require.Equal(t, ptp.MessageFollowUp, msgType)
+
+	require.Equal(t, int64(1), atomic.LoadInt64(&st.oversized))
+	require.Equal(t, int64(0), st.TX()[ptp.MessageAnnounce])
+}
+
+func TestWorkerSendSyncBatch(t *testing.T) {
+	eConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer eConn.Close()
+	gConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
 	require.NoError(t, err)
-	defer conn6.Close()
-	// get connection file descriptor
-	fd6, err := timestamp.ConnFd(conn6)
+	defer gConn.Close()
+
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			IP:            net.ParseIP("127.0.0.1"),
+			QueueSize:     10,
+			SyncBatch:     4,
+			TimestampType: timestamp.SWTIMESTAMP,
+		},
+		DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second},
+	}
+	st := stats.NewJSONStats()
+	w := newSendWorker(0, c, st)
+
+	esa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), eConn.LocalAddr().(*net.UDPAddr).Port)
+	gsa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), gConn.LocalAddr().(*net.UDPAddr).Port)
+	sc1 := NewSubscriptionClient(w.queue, w.signalingQueue, esa, gsa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	sc1.sequenceID = 10
+	sc2 := NewSubscriptionClient(w.queue, w.signalingQueue, esa, gsa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	sc2.sequenceID = 20
+	scA := NewSubscriptionClient(w.queue, w.signalingQueue, esa, gsa, ptp.MessageAnnounce, c, time.Second, time.Now().Add(time.Minute))
+
+	// all of it is queued by the time worker takes the first job
+	w.queue <- sc1
+	w.queue <- sc2
+	w.queue <- scA
+	w.queue <- sc1
+	before := time.Now()
+	go w.Start()
+	defer close(w.stop)
+
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	require.NoError(t, eConn.SetReadDeadline(time.Now().Add(time.Second)))
+	var syncs []uint16
+	for i := 0; i < 3; i++ {
+		n, err := eConn.Read(buf)
+		require.NoError(t, err)
+		syncP := &ptp.SyncDelayReq{}
+		require.NoError(t, ptp.FromBytes(buf[:n], syncP))
+		syncs = append(syncs, syncP.SequenceID)
+	}
+	require.Equal(t, []uint16{10, 20, 11}, syncs)
+
+	// FollowUps of the batch go before the Announce taken off the queue along with it
+	require.NoError(t, gConn.SetReadDeadline(time.Now().Add(time.Second)))
+	var followups []uint16
+	for i := 0; i < 3; i++ {
+		n, err := gConn.Read(buf)
+		require.NoError(t, err)
+		followup := &ptp.FollowUp{}
+		require.NoError(t, ptp.FromBytes(buf[:n], followup))
+		followups = append(followups, followup.SequenceID)
+		// software timestamp is converted to TAI
+		require.False(t, followup.PreciseOriginTimestamp.Time().Before(before.Add(37*time.Second)))
+	}
+	require.Equal(t, syncs, followups)
+	n, err := gConn.Read(buf)
 	require.NoError(t, err)
-	err = enableDSCP(fd6, net.ParseIP("::"), 42)
+	msgType, err := ptp.ProbeMsgType(buf[:n])
 	require.NoError(t, err)
+	require.Equal(t, ptp.MessageAnnounce, msgType)
+
+	require.Equal(t, int64(3), st.TX()[ptp.MessageSync])
+	require.Equal(t, int64(0), atomic.LoadInt64(&w.txtsFailures))
+}
+
+// benchmarkWorkerSyncs is a number of Sync clients served at once by BenchmarkWorkerSendSyncs
+const benchmarkWorkerSyncs = 16
+
+// BenchmarkWorkerSendSyncs sends Syncs and FollowUps to clients one by one, reading TX timestamp after every Sync,
+// and in batches with one sendmmsg and one recvmmsg for TX timestamps
+func BenchmarkWorkerSendSyncs(b *testing.B) {
+	for _, batch := range []int{0, benchmarkWorkerSyncs} {
+		b.Run(fmt.Sprintf("batch-%d", batch), func(b *testing.B) {
+			benchmarkWorkerSendSyncs(b, batch)
+		})
+	}
+}
+
+func benchmarkWorkerSendSyncs(b *testing.B, batch int) {
+	eConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(b, err)
+	defer eConn.Close()
+	gConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(b, err)
+	defer gConn.Close()
+
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			IP:            net.ParseIP("127.0.0.1"),
+			QueueSize:     benchmarkWorkerSyncs,
+			SyncBatch:     batch,
+			TimestampType: timestamp.SWTIMESTAMP,
+		},
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+	eFd, gFd, err := w.listen()
+	require.NoError(b, err)
+	defer unix.Close(eFd)
+	defer unix.Close(gFd)
+
+	esa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), eConn.LocalAddr().(*net.UDPAddr).Port)
+	gsa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), gConn.LocalAddr().(*net.UDPAddr).Port)
+	clients := make([]*SubscriptionClient, benchmarkWorkerSyncs)
+	for i := range clients {
+		clients[i] = NewSubscriptionClient(w.queue, w.signalingQueue, esa, gsa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Hour))
+	}
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	toob := make([]byte, timestamp.ControlSizeBytes)
+	sb := newSyncBatch(benchmarkWorkerSyncs)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if batch == 0 {
+			for _, sc := range clients {
+				if _, err := w.sendSync(eFd, gFd, sc, buf, oob, toob); err != nil {
+					b.Fatal(err)
+				}
+			}
+			continue
+		}
+		for _, sc := range clients[1:] {
+			w.queue <- sc
+		}
+		w.sendSyncBatch(eFd, gFd, sb, clients[0], buf)
+		if failures := atomic.LoadInt64(&w.txtsFailures); failures != 0 {
+			b.Fatalf("%d TX timestamps not read", failures)
+		}
+	}
 }
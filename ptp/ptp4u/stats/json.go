@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net/http"
 	"sync/atomic"
+	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
 	log "github.com/sirupsen/logrus"
@@ -29,13 +30,14 @@ import (
 // JSONStats is what we want to report as stats via http
 type JSONStats struct {
 	report counters
+	mux    *http.ServeMux
 
 	counters
 }
 
 // NewJSONStats returns a new JSONStats
 func NewJSONStats() *JSONStats {
-	s := &JSONStats{}
+	s := &JSONStats{mux: http.NewServeMux()}
 
 	s.init()
 	s.report.init()
@@ -45,33 +47,56 @@ func NewJSONStats() *JSONStats {
 
 // Start runs http server and initializes maps
 func (s *JSONStats) Start(monitoringport int) {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", s.handleRequest)
+	s.mux.HandleFunc("/", s.handleRequest)
 	addr := fmt.Sprintf(":%d", monitoringport)
 	log.Infof("Starting http json server on %s", addr)
-	err := http.ListenAndServe(addr, mux)
+	err := http.ListenAndServe(addr, s.mux)
 	if err != nil {
 		log.Fatalf("Failed to start listener: %v", err)
 	}
 }
 
+// HandleFunc serves additional data on the monitoring port, e.g. admin endpoints
+func (s *JSONStats) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
 // Snapshot the values so they can be reported atomically
 func (s *JSONStats) Snapshot() {
 	s.subscriptions.copy(&s.report.subscriptions)
+	s.subsExpired.copy(&s.report.subsExpired)
+	s.subsRejected.copy(&s.report.subsRejected)
+	s.subsGranted.copy(&s.report.subsGranted)
+	s.subsRenewed.copy(&s.report.subsRenewed)
 	s.rx.copy(&s.report.rx)
 	s.tx.copy(&s.report.tx)
 	s.rxSignalingGrant.copy(&s.report.rxSignalingGrant)
 	s.rxSignalingCancel.copy(&s.report.rxSignalingCancel)
 	s.txSignalingGrant.copy(&s.report.txSignalingGrant)
 	s.txSignalingCancel.copy(&s.report.txSignalingCancel)
+	s.queueDropped.copy(&s.report.queueDropped)
 	s.workerQueue.copy(&s.report.workerQueue)
 	s.workerSubs.copy(&s.report.workerSubs)
+	s.workerSendBuffer.copy(&s.report.workerSendBuffer)
+	s.workerRecvBuffer.copy(&s.report.workerRecvBuffer)
+	s.workerSyncJitter.copy(&s.report.workerSyncJitter)
 	s.txtsattempts.copy(&s.report.txtsattempts)
-	s.report.utcoffsetSec = s.utcoffsetSec
-	s.report.clockaccuracy = s.clockaccuracy
-	s.report.clockclass = s.clockclass
-	s.report.drain = s.drain
-	s.report.reload = s.reload
+	s.delayRespLatency.copy(&s.report.delayRespLatency)
+	s.report.utcoffsetSec = atomic.LoadInt64(&s.utcoffsetSec)
+	s.report.clockaccuracy = atomic.LoadInt64(&s.clockaccuracy)
+	s.report.clockclass = atomic.LoadInt64(&s.clockclass)
+	s.report.drain = atomic.LoadInt64(&s.drain)
+	s.report.delayReqDropped = atomic.LoadInt64(&s.delayReqDropped)
+	s.report.delayReqRateLimited = atomic.LoadInt64(&s.delayReqRateLimited)
+	s.report.delayReqWrongDomain = atomic.LoadInt64(&s.delayReqWrongDomain)
+	s.report.txtsFallback = atomic.LoadInt64(&s.txtsFallback)
+	s.report.txOversized = atomic.LoadInt64(&s.txOversized)
+	s.report.mtu = atomic.LoadInt64(&s.mtu)
+	s.report.phcOffset = atomic.LoadInt64(&s.phcOffset)
+	s.report.maintenance = atomic.LoadInt64(&s.maintenance)
+	s.report.reload = atomic.LoadInt64(&s.reload)
+	s.report.socketRebind = atomic.LoadInt64(&s.socketRebind)
+	s.report.workers = atomic.LoadInt64(&s.workers)
 }
 
 // handleRequest is a handler used for all http monitoring requests
@@ -92,11 +117,40 @@ func (s *JSONStats) Reset() {
 	s.reset()
 }
 
+// TX atomically returns current per message type TX counters
+func (s *JSONStats) TX() map[ptp.MessageType]int64 {
+	res := make(map[ptp.MessageType]int64)
+	for t, c := range s.tx.snapshot() {
+		res[ptp.MessageType(t)] = c
+	}
+	return res
+}
+
 // IncSubscription atomically add 1 to the counter
 func (s *JSONStats) IncSubscription(t ptp.MessageType) {
 	s.subscriptions.inc(int(t))
 }
 
+// IncSubscriptionExpired atomically add 1 to the counter
+func (s *JSONStats) IncSubscriptionExpired(t ptp.MessageType) {
+	s.subsExpired.inc(int(t))
+}
+
+// IncSubscriptionRejected atomically add 1 to the counter
+func (s *JSONStats) IncSubscriptionRejected(t ptp.MessageType) {
+	s.subsRejected.inc(int(t))
+}
+
+// IncSubscriptionGranted atomically add 1 to the counter
+func (s *JSONStats) IncSubscriptionGranted(t ptp.MessageType) {
+	s.subsGranted.inc(int(t))
+}
+
+// IncSubscriptionRenewed atomically add 1 to the counter
+func (s *JSONStats) IncSubscriptionRenewed(t ptp.MessageType) {
+	s.subsRenewed.inc(int(t))
+}
+
 // IncRX atomically add 1 to the counter
 func (s *JSONStats) IncRX(t ptp.MessageType) {
 	s.rx.inc(int(t))
@@ -137,11 +191,46 @@ func (s *JSONStats) IncReload() {
 	atomic.StoreInt64(&s.reload, 1)
 }
 
+// IncDelayReqDropped atomically add 1 to the counter
+func (s *JSONStats) IncDelayReqDropped() {
+	atomic.AddInt64(&s.delayReqDropped, 1)
+}
+
+// IncDelayReqRateLimited atomically add 1 to the counter
+func (s *JSONStats) IncDelayReqRateLimited() {
+	atomic.AddInt64(&s.delayReqRateLimited, 1)
+}
+
+// IncDelayReqWrongDomain atomically add 1 to the counter
+func (s *JSONStats) IncDelayReqWrongDomain() {
+	atomic.AddInt64(&s.delayReqWrongDomain, 1)
+}
+
+// IncTXTSFallback atomically add 1 to the counter
+func (s *JSONStats) IncTXTSFallback() {
+	atomic.AddInt64(&s.txtsFallback, 1)
+}
+
+// IncQueueDropped atomically add 1 to the counter
+func (s *JSONStats) IncQueueDropped(t ptp.MessageType) {
+	s.queueDropped.inc(int(t))
+}
+
+// IncSocketRebind atomically add 1 to the counter
+func (s *JSONStats) IncSocketRebind() {
+	atomic.AddInt64(&s.socketRebind, 1)
+}
+
 // DecSubscription atomically removes 1 from the counter
 func (s *JSONStats) DecSubscription(t ptp.MessageType) {
 	s.subscriptions.dec(int(t))
 }
 
+// DecSubscriptionExpired atomically removes 1 from the counter
+func (s *JSONStats) DecSubscriptionExpired(t ptp.MessageType) {
+	s.subsExpired.dec(int(t))
+}
+
 // DecRX atomically removes 1 from the counter
 func (s *JSONStats) DecRX(t ptp.MessageType) {
 	s.rx.dec(int(t))
@@ -191,6 +280,28 @@ func (s *JSONStats) SetMaxTXTSAttempts(workerid int, attempts int64) {
 	}
 }
 
+// SetMaxDelayRespLatency atomically sets the max latency between reading DelayReq and sending DelayResp
+func (s *JSONStats) SetMaxDelayRespLatency(workerid int, latency time.Duration) {
+	if int64(latency) > s.delayRespLatency.load(workerid) {
+		s.delayRespLatency.store(workerid, int64(latency))
+	}
+}
+
+// SetWorkerSendBuffer atomically sets the effective socket send buffer size of the worker
+func (s *JSONStats) SetWorkerSendBuffer(workerid int, bytes int64) {
+	s.workerSendBuffer.store(workerid, bytes)
+}
+
+// SetWorkerRecvBuffer atomically sets the effective socket receive buffer size of the worker
+func (s *JSONStats) SetWorkerRecvBuffer(workerid int, bytes int64) {
+	s.workerRecvBuffer.store(workerid, bytes)
+}
+
+// SetWorkerSyncJitter atomically sets the standard deviation of Sync send intervals of the worker
+func (s *JSONStats) SetWorkerSyncJitter(workerid int, jitter time.Duration) {
+	s.workerSyncJitter.store(workerid, int64(jitter))
+}
+
 // SetUTCOffsetSec atomically sets the utcoffset
 func (s *JSONStats) SetUTCOffsetSec(utcoffsetSec int64) {
 	atomic.StoreInt64(&s.utcoffsetSec, utcoffsetSec)
@@ -210,3 +321,28 @@ func (s *JSONStats) SetClockClass(clockclass int64) {
 func (s *JSONStats) SetDrain(drain int64) {
 	atomic.StoreInt64(&s.drain, drain)
 }
+
+// SetMaintenance atomically sets the maintenance mode status
+func (s *JSONStats) SetMaintenance(maintenance int64) {
+	atomic.StoreInt64(&s.maintenance, maintenance)
+}
+
+// SetWorkers atomically sets the number of send workers
+func (s *JSONStats) SetWorkers(workers int64) {
+	atomic.StoreInt64(&s.workers, workers)
+}
+
+// IncTXOversized atomically add 1 to the counter
+func (s *JSONStats) IncTXOversized() {
+	atomic.AddInt64(&s.txOversized, 1)
+}
+
+// SetMTU atomically sets the MTU packets are checked against
+func (s *JSONStats) SetMTU(mtu int64) {
+	atomic.StoreInt64(&s.mtu, mtu)
+}
+
+// SetPHCOffset atomically sets the offset of the PHC from the system clock
+func (s *JSONStats) SetPHCOffset(offset time.Duration) {
+	atomic.StoreInt64(&s.phcOffset, int64(offset))
+}
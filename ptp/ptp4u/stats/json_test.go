@@ -20,6 +20,8 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
@@ -66,6 +68,36 @@ func TestJSONStatsSyncSubscription(t *testing.T) {
 	require.Equal(t, int64(0), stats.subscriptions.load(int(ptp.MessageSync)))
 }
 
+func TestJSONStatsSubscriptionExpired(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncSubscriptionExpired(ptp.MessageSync)
+	require.Equal(t, int64(1), stats.subsExpired.load(int(ptp.MessageSync)))
+
+	stats.DecSubscriptionExpired(ptp.MessageSync)
+	require.Equal(t, int64(0), stats.subsExpired.load(int(ptp.MessageSync)))
+}
+
+func TestJSONStatsSubscriptionRejected(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncSubscriptionRejected(ptp.MessageSync)
+	stats.IncSubscriptionRejected(ptp.MessageSync)
+	stats.IncSubscriptionRejected(ptp.MessageAnnounce)
+	require.Equal(t, int64(2), stats.subsRejected.load(int(ptp.MessageSync)))
+	require.Equal(t, int64(1), stats.subsRejected.load(int(ptp.MessageAnnounce)))
+}
+
+func TestJSONStatsSubscriptionGrantedRenewed(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncSubscriptionGranted(ptp.MessageSync)
+	stats.IncSubscriptionRenewed(ptp.MessageSync)
+	stats.IncSubscriptionRenewed(ptp.MessageSync)
+	require.Equal(t, int64(1), stats.subsGranted.load(int(ptp.MessageSync)))
+	require.Equal(t, int64(2), stats.subsRenewed.load(int(ptp.MessageSync)))
+}
+
 func TestJSONStatsRX(t *testing.T) {
 	stats := NewJSONStats()
 
@@ -86,6 +118,33 @@ func TestJSONStatsTX(t *testing.T) {
 	require.Equal(t, int64(0), stats.tx.load(int(ptp.MessageSync)))
 }
 
+func TestJSONStatsTXCounters(t *testing.T) {
+	stats := NewJSONStats()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				stats.IncTX(ptp.MessageSync)
+				stats.IncTX(ptp.MessageFollowUp)
+				_ = stats.TX()
+			}
+		}()
+	}
+	wg.Wait()
+
+	expected := map[ptp.MessageType]int64{
+		ptp.MessageSync:     1000,
+		ptp.MessageFollowUp: 1000,
+	}
+	require.Equal(t, expected, stats.TX())
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.TX()[ptp.MessageSync])
+}
+
 func TestJSONStatsRXSignaling(t *testing.T) {
 	stats := NewJSONStats()
 
@@ -138,6 +197,107 @@ func TestJSONStatsSetMaxTXTSAttempts(t *testing.T) {
 	require.Equal(t, int64(42), stats.txtsattempts.load(10))
 }
 
+func TestJSONStatsSetWorkerBuffers(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetWorkerSendBuffer(10, 212992)
+	stats.SetWorkerRecvBuffer(10, 425984)
+	require.Equal(t, int64(212992), stats.workerSendBuffer.load(10))
+	require.Equal(t, int64(425984), stats.workerRecvBuffer.load(10))
+
+	stats.Reset()
+	require.Equal(t, int64(212992), stats.workerSendBuffer.load(10))
+	require.Equal(t, int64(425984), stats.workerRecvBuffer.load(10))
+}
+
+func TestJSONStatsSetWorkerSyncJitter(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetWorkerSyncJitter(10, 1500*time.Nanosecond)
+	require.Equal(t, int64(1500), stats.workerSyncJitter.load(10))
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.workerSyncJitter.load(10))
+}
+
+func TestJSONStatsDelayReqDropped(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncDelayReqDropped()
+	stats.IncDelayReqDropped()
+	require.Equal(t, int64(2), stats.delayReqDropped)
+}
+
+func TestJSONStatsDelayReqRateLimited(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncDelayReqRateLimited()
+	stats.IncDelayReqRateLimited()
+	stats.IncDelayReqRateLimited()
+	require.Equal(t, int64(3), stats.delayReqRateLimited)
+}
+
+func TestJSONStatsDelayReqWrongDomain(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncDelayReqWrongDomain()
+	stats.IncDelayReqWrongDomain()
+	require.Equal(t, int64(2), stats.delayReqWrongDomain)
+}
+
+func TestJSONStatsTXTSFallback(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncTXTSFallback()
+	require.Equal(t, int64(1), stats.txtsFallback)
+}
+
+func TestJSONStatsTXOversized(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncTXOversized()
+	require.Equal(t, int64(1), stats.txOversized)
+}
+
+func TestJSONStatsMTU(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetMTU(1500)
+	require.Equal(t, int64(1500), stats.mtu)
+}
+
+func TestJSONStatsPHCOffset(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetPHCOffset(-42 * time.Nanosecond)
+	require.Equal(t, int64(-42), stats.phcOffset)
+}
+
+func TestJSONStatsQueueDropped(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncQueueDropped(ptp.MessageSync)
+	stats.IncQueueDropped(ptp.MessageSync)
+	stats.IncQueueDropped(ptp.MessageAnnounce)
+	require.Equal(t, int64(2), stats.queueDropped.load(int(ptp.MessageSync)))
+	require.Equal(t, int64(1), stats.queueDropped.load(int(ptp.MessageAnnounce)))
+}
+
+func TestJSONStatsSocketRebind(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncSocketRebind()
+	require.Equal(t, int64(1), stats.socketRebind)
+}
+
+func TestJSONStatsSetMaxDelayRespLatency(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetMaxDelayRespLatency(1, time.Millisecond)
+	stats.SetMaxDelayRespLatency(1, time.Microsecond)
+	require.Equal(t, int64(time.Millisecond), stats.delayRespLatency.load(1))
+}
+
 func TestJSONStatsSetUTCOffset(t *testing.T) {
 	stats := NewJSONStats()
 
@@ -166,6 +326,20 @@ func TestJSONStatsSetDrain(t *testing.T) {
 	require.Equal(t, int64(1), stats.drain)
 }
 
+func TestJSONStatsSetMaintenance(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetMaintenance(1)
+	require.Equal(t, int64(1), stats.maintenance)
+}
+
+func TestJSONStatsSetWorkers(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetWorkers(42)
+	require.Equal(t, int64(42), stats.workers)
+}
+
 func TestJSONStatsSnapshot(t *testing.T) {
 	stats := NewJSONStats()
 
@@ -249,7 +423,28 @@ func TestJSONExport(t *testing.T) {
 	expectedMap["clockaccuracy"] = 1
 	expectedMap["clockclass"] = 1
 	expectedMap["drain"] = 1
+	expectedMap["maintenance"] = 0
+	expectedMap["rx.delay_req.dropped"] = 0
+	expectedMap["rx.delay_req.rate_limited"] = 0
+	expectedMap["rx.delay_req.wrong_domain"] = 0
+	expectedMap["tx.follow_up.ts_fallback"] = 0
 	expectedMap["reload"] = 1
+	expectedMap["socket_rebind"] = 0
+	expectedMap["tx.oversized"] = 0
+	expectedMap["mtu"] = 0
+	expectedMap["phc.offset_ns"] = 0
+	expectedMap["workers"] = 0
 
 	require.Equal(t, expectedMap, data)
 }
+
+func TestJSONStatsHandleFunc(t *testing.T) {
+	stats := NewJSONStats()
+	stats.HandleFunc("/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("[]"))
+	})
+
+	rec := httptest.NewRecorder()
+	stats.mux.ServeHTTP(rec, httptest.NewRequest("GET", "/subscriptions", nil))
+	require.Equal(t, "[]", rec.Body.String())
+}
@@ -25,6 +25,8 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
 )
@@ -41,9 +43,25 @@ type Stats interface {
 	// Reset atomically sets all the counters to 0
 	Reset()
 
+	// TX atomically returns current per message type TX counters.
+	// Counters are accumulated since the last Reset
+	TX() map[ptp.MessageType]int64
+
 	// IncSubscription atomically add 1 to the counter
 	IncSubscription(t ptp.MessageType)
 
+	// IncSubscriptionExpired atomically add 1 to the counter
+	IncSubscriptionExpired(t ptp.MessageType)
+
+	// IncSubscriptionRejected atomically add 1 to the counter
+	IncSubscriptionRejected(t ptp.MessageType)
+
+	// IncSubscriptionGranted atomically add 1 to the counter
+	IncSubscriptionGranted(t ptp.MessageType)
+
+	// IncSubscriptionRenewed atomically add 1 to the counter
+	IncSubscriptionRenewed(t ptp.MessageType)
+
 	// IncRX atomically add 1 to the counter
 	IncRX(t ptp.MessageType)
 
@@ -68,9 +86,33 @@ type Stats interface {
 	// IncReload atomically add 1 to the counter
 	IncReload()
 
+	// IncDelayReqDropped atomically add 1 to the counter
+	IncDelayReqDropped()
+
+	// IncDelayReqRateLimited atomically add 1 to the counter
+	IncDelayReqRateLimited()
+
+	// IncDelayReqWrongDomain atomically add 1 to the counter
+	IncDelayReqWrongDomain()
+
+	// IncSocketRebind atomically add 1 to the counter
+	IncSocketRebind()
+
+	// IncTXTSFallback atomically add 1 to the counter
+	IncTXTSFallback()
+
+	// IncTXOversized atomically add 1 to the counter
+	IncTXOversized()
+
+	// IncQueueDropped atomically add 1 to the counter
+	IncQueueDropped(t ptp.MessageType)
+
 	// DecSubscription atomically removes 1 from the counter
 	DecSubscription(t ptp.MessageType)
 
+	// DecSubscriptionExpired atomically removes 1 from the counter
+	DecSubscriptionExpired(t ptp.MessageType)
+
 	// DecRX atomically removes 1 from the counter
 	DecRX(t ptp.MessageType)
 
@@ -98,6 +140,18 @@ type Stats interface {
 	// SetMaxTXTSAttempts atomically sets number of retries for get latest TX timestamp
 	SetMaxTXTSAttempts(workerid int, retries int64)
 
+	// SetMaxDelayRespLatency atomically sets the max latency between reading DelayReq and sending DelayResp
+	SetMaxDelayRespLatency(workerid int, latency time.Duration)
+
+	// SetWorkerSendBuffer atomically sets the effective socket send buffer size of the worker
+	SetWorkerSendBuffer(workerid int, bytes int64)
+
+	// SetWorkerRecvBuffer atomically sets the effective socket receive buffer size of the worker
+	SetWorkerRecvBuffer(workerid int, bytes int64)
+
+	// SetWorkerSyncJitter atomically sets the standard deviation of Sync send intervals of the worker
+	SetWorkerSyncJitter(workerid int, jitter time.Duration)
+
 	// SetUTCOffsetSec atomically sets the utcoffset
 	SetUTCOffsetSec(utcoffsetSec int64)
 
@@ -109,6 +163,18 @@ type Stats interface {
 
 	// SetDrain atomically sets the drain status
 	SetDrain(drain int64)
+
+	// SetMaintenance atomically sets the maintenance mode status
+	SetMaintenance(maintenance int64)
+
+	// SetWorkers atomically sets the number of send workers
+	SetWorkers(workers int64)
+
+	// SetMTU atomically sets the MTU packets are checked against
+	SetMTU(mtu int64)
+
+	// SetPHCOffset atomically sets the offset of the PHC from the system clock
+	SetPHCOffset(offset time.Duration)
 }
 
 // syncMapInt64 sync map of PTP messages
@@ -161,6 +227,17 @@ func (s *syncMapInt64) store(key int, value int64) {
 	s.Unlock()
 }
 
+// snapshot returns a copy of the underlying map
+func (s *syncMapInt64) snapshot() map[int]int64 {
+	s.Lock()
+	defer s.Unlock()
+	res := make(map[int]int64, len(s.m))
+	for k, v := range s.m {
+		res[k] = v
+	}
+	return res
+}
+
 // copy all key-values between maps
 func (s *syncMapInt64) copy(dst *syncMapInt64) {
 	for _, t := range s.keys() {
@@ -179,52 +256,98 @@ func (s *syncMapInt64) reset() {
 }
 
 type counters struct {
-	rx                syncMapInt64
-	rxSignalingGrant  syncMapInt64
-	rxSignalingCancel syncMapInt64
-	subscriptions     syncMapInt64
-	tx                syncMapInt64
-	txSignalingGrant  syncMapInt64
-	txSignalingCancel syncMapInt64
-	txtsattempts      syncMapInt64
-	workerQueue       syncMapInt64
-	workerSubs        syncMapInt64
-	utcoffsetSec      int64
-	clockaccuracy     int64
-	clockclass        int64
-	drain             int64
-	reload            int64
+	rx                  syncMapInt64
+	rxSignalingGrant    syncMapInt64
+	rxSignalingCancel   syncMapInt64
+	subscriptions       syncMapInt64
+	subsExpired         syncMapInt64
+	subsRejected        syncMapInt64
+	subsGranted         syncMapInt64
+	subsRenewed         syncMapInt64
+	tx                  syncMapInt64
+	txSignalingGrant    syncMapInt64
+	txSignalingCancel   syncMapInt64
+	queueDropped        syncMapInt64
+	txtsattempts        syncMapInt64
+	delayRespLatency    syncMapInt64
+	workerQueue         syncMapInt64
+	workerSubs          syncMapInt64
+	workerSendBuffer    syncMapInt64
+	workerRecvBuffer    syncMapInt64
+	workerSyncJitter    syncMapInt64
+	utcoffsetSec        int64
+	clockaccuracy       int64
+	clockclass          int64
+	drain               int64
+	delayReqDropped     int64
+	delayReqRateLimited int64
+	delayReqWrongDomain int64
+	txtsFallback        int64
+	txOversized         int64
+	mtu                 int64
+	phcOffset           int64
+	maintenance         int64
+	reload              int64
+	socketRebind        int64
+	workers             int64
 }
 
 func (c *counters) init() {
 	c.subscriptions.init()
+	c.subsExpired.init()
+	c.subsRejected.init()
+	c.subsGranted.init()
+	c.subsRenewed.init()
 	c.rx.init()
 	c.tx.init()
 	c.rxSignalingGrant.init()
 	c.rxSignalingCancel.init()
 	c.txSignalingGrant.init()
 	c.txSignalingCancel.init()
+	c.queueDropped.init()
 	c.workerQueue.init()
 	c.workerSubs.init()
+	c.workerSendBuffer.init()
+	c.workerRecvBuffer.init()
+	c.workerSyncJitter.init()
 	c.txtsattempts.init()
+	c.delayRespLatency.init()
 }
 
 func (c *counters) reset() {
 	c.subscriptions.reset()
+	c.subsExpired.reset()
+	c.subsRejected.reset()
+	c.subsGranted.reset()
+	c.subsRenewed.reset()
 	c.rx.reset()
 	c.tx.reset()
 	c.rxSignalingGrant.reset()
 	c.rxSignalingCancel.reset()
 	c.txSignalingGrant.reset()
 	c.txSignalingCancel.reset()
+	c.queueDropped.reset()
 	c.workerQueue.reset()
 	c.workerSubs.reset()
+	// socket buffer sizes only change on (re)bind, so they are not reset
+	c.workerSyncJitter.reset()
 	c.txtsattempts.reset()
-	c.utcoffsetSec = 0
-	c.clockaccuracy = 0
-	c.clockclass = 0
-	c.drain = 0
-	c.reload = 0
+	c.delayRespLatency.reset()
+	atomic.StoreInt64(&c.utcoffsetSec, 0)
+	atomic.StoreInt64(&c.clockaccuracy, 0)
+	atomic.StoreInt64(&c.clockclass, 0)
+	atomic.StoreInt64(&c.drain, 0)
+	atomic.StoreInt64(&c.delayReqDropped, 0)
+	atomic.StoreInt64(&c.delayReqRateLimited, 0)
+	atomic.StoreInt64(&c.delayReqWrongDomain, 0)
+	atomic.StoreInt64(&c.txtsFallback, 0)
+	atomic.StoreInt64(&c.txOversized, 0)
+	atomic.StoreInt64(&c.mtu, 0)
+	atomic.StoreInt64(&c.phcOffset, 0)
+	atomic.StoreInt64(&c.maintenance, 0)
+	atomic.StoreInt64(&c.reload, 0)
+	atomic.StoreInt64(&c.socketRebind, 0)
+	atomic.StoreInt64(&c.workers, 0)
 }
 
 // toMap converts counters to a map
@@ -237,6 +360,30 @@ func (c *counters) toMap() (export map[string]int64) {
 		res[fmt.Sprintf("subscriptions.%s", mt)] = c
 	}
 
+	for _, t := range c.subsExpired.keys() {
+		c := c.subsExpired.load(t)
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("subscriptions.expired.%s", mt)] = c
+	}
+
+	for _, t := range c.subsRejected.keys() {
+		c := c.subsRejected.load(t)
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("subscriptions.rejected.%s", mt)] = c
+	}
+
+	for _, t := range c.subsGranted.keys() {
+		c := c.subsGranted.load(t)
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("subscriptions.granted.%s", mt)] = c
+	}
+
+	for _, t := range c.subsRenewed.keys() {
+		c := c.subsRenewed.load(t)
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("subscriptions.renewed.%s", mt)] = c
+	}
+
 	for _, t := range c.rx.keys() {
 		c := c.rx.load(t)
 		mt := strings.ToLower(ptp.MessageType(t).String())
@@ -273,6 +420,12 @@ func (c *counters) toMap() (export map[string]int64) {
 		res[fmt.Sprintf("tx.signaling.cancel.%s", mt)] = c
 	}
 
+	for _, t := range c.queueDropped.keys() {
+		c := c.queueDropped.load(t)
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("queue.dropped.%s", mt)] = c
+	}
+
 	for _, t := range c.workerQueue.keys() {
 		c := c.workerQueue.load(t)
 		res[fmt.Sprintf("worker.%d.queue", t)] = c
@@ -283,16 +436,46 @@ func (c *counters) toMap() (export map[string]int64) {
 		res[fmt.Sprintf("worker.%d.subscriptions", t)] = c
 	}
 
+	for _, t := range c.workerSendBuffer.keys() {
+		c := c.workerSendBuffer.load(t)
+		res[fmt.Sprintf("worker.%d.sndbuf_bytes", t)] = c
+	}
+
+	for _, t := range c.workerRecvBuffer.keys() {
+		c := c.workerRecvBuffer.load(t)
+		res[fmt.Sprintf("worker.%d.rcvbuf_bytes", t)] = c
+	}
+
+	for _, t := range c.workerSyncJitter.keys() {
+		c := c.workerSyncJitter.load(t)
+		res[fmt.Sprintf("worker.%d.sync_jitter_ns", t)] = c
+	}
+
 	for _, t := range c.txtsattempts.keys() {
 		c := c.txtsattempts.load(t)
 		res[fmt.Sprintf("worker.%d.txtsattempts", t)] = c
 	}
 
+	for _, t := range c.delayRespLatency.keys() {
+		c := c.delayRespLatency.load(t)
+		res[fmt.Sprintf("worker.%d.delay_resp_latency_ns", t)] = c
+	}
+
+	res["rx.delay_req.dropped"] = c.delayReqDropped
+	res["rx.delay_req.rate_limited"] = c.delayReqRateLimited
+	res["rx.delay_req.wrong_domain"] = c.delayReqWrongDomain
+	res["tx.follow_up.ts_fallback"] = c.txtsFallback
+	res["tx.oversized"] = c.txOversized
+	res["mtu"] = c.mtu
+	res["phc.offset_ns"] = c.phcOffset
 	res["utcoffset_sec"] = c.utcoffsetSec
 	res["clockaccuracy"] = c.clockaccuracy
 	res["clockclass"] = c.clockclass
 	res["drain"] = c.drain
+	res["maintenance"] = c.maintenance
 	res["reload"] = c.reload
+	res["socket_rebind"] = c.socketRebind
+	res["workers"] = c.workers
 
 	return res
 }
@@ -69,20 +69,40 @@ func TestSyncMapInt64Counters(t *testing.T) {
 	c.tx.store(1, 1)
 	c.rxSignalingGrant.store(1, 1)
 	c.txSignalingCancel.store(1, 1)
+	c.queueDropped.store(1, 1)
+	c.subsRejected.store(1, 1)
+	c.subsGranted.store(1, 1)
+	c.subsRenewed.store(1, 1)
 	c.workerQueue.store(1, 1)
 	c.workerSubs.store(1, 1)
 	c.txtsattempts.store(1, 1)
+	c.workerSendBuffer.store(1, 1)
+	c.workerRecvBuffer.store(1, 1)
+	c.workerSyncJitter.store(1, 1)
 	c.utcoffsetSec = 1
 	c.clockaccuracy = 1
 	c.clockclass = 1
 	c.drain = 1
+	c.maintenance = 1
 	c.reload = 1
+	c.socketRebind = 1
+	c.delayReqRateLimited = 1
+	c.delayReqWrongDomain = 1
+	c.txtsFallback = 1
+	c.txOversized = 1
+	c.mtu = 1
+	c.phcOffset = 1
+	c.workers = 1
 
 	require.Equal(t, int64(1), c.subscriptions.load(1))
 	require.Equal(t, int64(1), c.rx.load(1))
 	require.Equal(t, int64(1), c.tx.load(1))
 	require.Equal(t, int64(1), c.rxSignalingGrant.load(1))
 	require.Equal(t, int64(1), c.txSignalingCancel.load(1))
+	require.Equal(t, int64(1), c.queueDropped.load(1))
+	require.Equal(t, int64(1), c.subsRejected.load(1))
+	require.Equal(t, int64(1), c.subsGranted.load(1))
+	require.Equal(t, int64(1), c.subsRenewed.load(1))
 	require.Equal(t, int64(1), c.workerQueue.load(1))
 	require.Equal(t, int64(1), c.workerSubs.load(1))
 	require.Equal(t, int64(1), c.txtsattempts.load(1))
@@ -90,7 +110,16 @@ func TestSyncMapInt64Counters(t *testing.T) {
 	require.Equal(t, int64(1), c.clockaccuracy)
 	require.Equal(t, int64(1), c.clockclass)
 	require.Equal(t, int64(1), c.drain)
+	require.Equal(t, int64(1), c.maintenance)
 	require.Equal(t, int64(1), c.reload)
+	require.Equal(t, int64(1), c.socketRebind)
+	require.Equal(t, int64(1), c.delayReqRateLimited)
+	require.Equal(t, int64(1), c.delayReqWrongDomain)
+	require.Equal(t, int64(1), c.txtsFallback)
+	require.Equal(t, int64(1), c.txOversized)
+	require.Equal(t, int64(1), c.mtu)
+	require.Equal(t, int64(1), c.phcOffset)
+	require.Equal(t, int64(1), c.workers)
 
 	c.reset()
 
@@ -99,14 +128,30 @@ func TestSyncMapInt64Counters(t *testing.T) {
 	require.Equal(t, int64(0), c.tx.load(1))
 	require.Equal(t, int64(0), c.rxSignalingGrant.load(1))
 	require.Equal(t, int64(0), c.txSignalingCancel.load(1))
+	require.Equal(t, int64(0), c.queueDropped.load(1))
+	require.Equal(t, int64(0), c.subsRejected.load(1))
+	require.Equal(t, int64(0), c.subsGranted.load(1))
+	require.Equal(t, int64(0), c.subsRenewed.load(1))
 	require.Equal(t, int64(0), c.workerQueue.load(1))
 	require.Equal(t, int64(0), c.workerSubs.load(1))
 	require.Equal(t, int64(0), c.txtsattempts.load(1))
+	require.Equal(t, int64(1), c.workerSendBuffer.load(1))
+	require.Equal(t, int64(1), c.workerRecvBuffer.load(1))
+	require.Equal(t, int64(0), c.workerSyncJitter.load(1))
 	require.Equal(t, int64(0), c.utcoffsetSec)
 	require.Equal(t, int64(0), c.clockaccuracy)
 	require.Equal(t, int64(0), c.clockclass)
 	require.Equal(t, int64(0), c.drain)
+	require.Equal(t, int64(0), c.maintenance)
 	require.Equal(t, int64(0), c.reload)
+	require.Equal(t, int64(0), c.socketRebind)
+	require.Equal(t, int64(0), c.delayReqRateLimited)
+	require.Equal(t, int64(0), c.delayReqWrongDomain)
+	require.Equal(t, int64(0), c.txtsFallback)
+	require.Equal(t, int64(0), c.txOversized)
+	require.Equal(t, int64(0), c.mtu)
+	require.Equal(t, int64(0), c.phcOffset)
+	require.Equal(t, int64(0), c.workers)
 }
 
 func TestCountersToMap(t *testing.T) {
@@ -117,11 +162,30 @@ func TestCountersToMap(t *testing.T) {
 	c.tx.store(int(ptp.MessageSync), 2)
 	c.rxSignalingGrant.store(int(ptp.MessageDelayResp), 3)
 	c.rxSignalingCancel.store(int(ptp.MessageSync), 1)
+	c.subsExpired.store(int(ptp.MessageSync), 4)
+	c.queueDropped.store(int(ptp.MessageSync), 7)
+	c.subsRejected.store(int(ptp.MessageAnnounce), 9)
+	c.subsGranted.store(int(ptp.MessageSync), 11)
+	c.subsRenewed.store(int(ptp.MessageSync), 12)
 	c.utcoffsetSec = 1
 	c.clockaccuracy = 42
 	c.clockclass = 6
 	c.drain = 1
+	c.maintenance = 1
+	c.delayReqDropped = 5
+	c.delayReqRateLimited = 8
+	c.delayReqWrongDomain = 14
+	c.txtsFallback = 10
+	c.txOversized = 13
+	c.mtu = 1500
+	c.phcOffset = -42
+	c.delayRespLatency.store(1, 1000)
+	c.workerSendBuffer.store(1, 212992)
+	c.workerRecvBuffer.store(1, 425984)
+	c.workerSyncJitter.store(1, 1500)
 	c.reload = 2
+	c.socketRebind = 2
+	c.workers = 3
 
 	result := c.toMap()
 
@@ -130,11 +194,30 @@ func TestCountersToMap(t *testing.T) {
 	expectedMap["tx.sync"] = 2
 	expectedMap["rx.signaling.grant.delay_resp"] = 3
 	expectedMap["rx.signaling.cancel.sync"] = 1
+	expectedMap["subscriptions.expired.sync"] = 4
+	expectedMap["queue.dropped.sync"] = 7
+	expectedMap["subscriptions.rejected.announce"] = 9
+	expectedMap["subscriptions.granted.sync"] = 11
+	expectedMap["subscriptions.renewed.sync"] = 12
 	expectedMap["utcoffset_sec"] = 1
 	expectedMap["clockaccuracy"] = 42
 	expectedMap["clockclass"] = 6
 	expectedMap["drain"] = 1
+	expectedMap["maintenance"] = 1
+	expectedMap["rx.delay_req.dropped"] = 5
+	expectedMap["rx.delay_req.rate_limited"] = 8
+	expectedMap["rx.delay_req.wrong_domain"] = 14
+	expectedMap["tx.follow_up.ts_fallback"] = 10
+	expectedMap["worker.1.delay_resp_latency_ns"] = 1000
+	expectedMap["worker.1.sndbuf_bytes"] = 212992
+	expectedMap["worker.1.rcvbuf_bytes"] = 425984
+	expectedMap["worker.1.sync_jitter_ns"] = 1500
 	expectedMap["reload"] = 2
+	expectedMap["socket_rebind"] = 2
+	expectedMap["tx.oversized"] = 13
+	expectedMap["mtu"] = 1500
+	expectedMap["phc.offset_ns"] = -42
+	expectedMap["workers"] = 3
 
 	require.Equal(t, expectedMap, result)
 }
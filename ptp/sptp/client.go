@@ -0,0 +1,378 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sptp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+)
+
+// re-export timestamping
+const (
+	// HWTIMESTAMP is a hardware timestamp
+	HWTIMESTAMP = timestamp.HWTIMESTAMP
+	// SWTIMESTAMP is a software timestamp
+	SWTIMESTAMP = timestamp.SWTIMESTAMP
+)
+
+// requestInterval is an interval of repeating unanswered unicast transmission requests
+const requestInterval = time.Second
+
+// subscriptions are message types the client requests unicast transmission of
+var subscriptions = []ptp.MessageType{ptp.MessageAnnounce, ptp.MessageSync, ptp.MessageDelayResp}
+
+// Config specifies Client options
+type Config struct {
+	// ClockIdentity of the client. Derived from the Iface MAC address if not set
+	ClockIdentity ptp.ClockIdentity
+	// Duration of the unicast transmission to request
+	Duration time.Duration
+	// Iface is an interface to derive clock identity from and to enable hardware timestamps on
+	Iface string
+	// Interval of Announce and Sync messages to request
+	Interval time.Duration
+	// LocalAddr is an IP to send and receive packets from. Defaults to any.
+	// Servers send event messages to the PTP event port, so it must be free on this IP
+	LocalAddr net.IP
+	// Timestamping is a type of timestamps to use. Hardware with fallback to software if not set
+	Timestamping string
+	// NegotiationTimeout is how long to wait for all unicast grants. 5s if not set
+	NegotiationTimeout time.Duration
+	// SyncTimeout is how long to wait for Announce and Sync once granted.
+	// 5s or 3 intervals, whichever is longer, if not set
+	SyncTimeout time.Duration
+	// DelayRespTimeout is how long to wait for DelayResp. 5s if not set
+	DelayRespTimeout time.Duration
+}
+
+type inPacket struct {
+	data []byte
+	ts   time.Time
+}
+
+// Client is a simple PTPv2 two-step unicast client
+type Client struct {
+	cfg     *Config
+	clockID ptp.ClockIdentity
+	// sw is set when software timestamps are used
+	sw bool
+
+	genConn   *net.UDPConn
+	eventConn *net.UDPConn
+	eventFd   int
+	genAddr   *net.UDPAddr
+	eventAddr *net.UDPAddr
+
+	genSequence   uint16
+	eventSequence uint16
+}
+
+// New initializes new PTPv2 unicast client
+func New(cfg *Config) *Client {
+	return &Client{cfg: cfg}
+}
+
+// Run negotiates unicast transmission with the server, performs a single Sync/FollowUp and
+// DelayReq/DelayResp exchange and cancels the transmission.
+// Returns offset of the client clock from the server one and mean path delay.
+// If the server doesn't progress through a phase of the exchange in time, *TimeoutError is returned
+func (c *Client) Run(ctx context.Context, serverAddr string) (offset, delay time.Duration, err error) {
+	if err := c.setup(serverAddr); err != nil {
+		return 0, 0, err
+	}
+	defer c.close()
+
+	// readers exit once the connections are closed
+	done := make(chan struct{})
+	defer close(done)
+	packets := make(chan *inPacket, 10)
+	errs := make(chan error, 2)
+	go func() { errs <- c.readGeneral(packets, done) }()
+	go func() { errs <- c.readEvent(packets, done) }()
+
+	e := newExchange(c.sw)
+	defer c.cancelUnicast(e)
+	if err := c.requestUnicast(e); err != nil {
+		return 0, 0, err
+	}
+	// requests may get lost, repeat them until granted
+	ticker := time.NewTicker(requestInterval)
+	defer ticker.Stop()
+	phase := e.phase()
+	timer := time.NewTimer(c.timeout(phase))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, 0, ctx.Err()
+		case err := <-errs:
+			return 0, 0, err
+		case <-timer.C:
+			return 0, 0, &TimeoutError{Phase: phase, Timeout: c.timeout(phase)}
+		case <-ticker.C:
+			if err := c.requestUnicast(e); err != nil {
+				return 0, 0, err
+			}
+		case p := <-packets:
+			if err := e.handle(p); err != nil {
+				return 0, 0, err
+			}
+			if e.readyForDelayReq() {
+				seq, t3, err := c.sendEventMsg(ptp.NewDelayReq(sourcePort(c.clockID), 0))
+				if err != nil {
+					return 0, 0, fmt.Errorf("sending delay request: %w", err)
+				}
+				log.Debugf("Sent delay request, seq=%d, T3=%v", seq, t3)
+				e.delayReqSent(seq, t3)
+			}
+			if e.done() {
+				offset, delay = e.measure()
+				return offset, delay, nil
+			}
+			if next := e.phase(); next != phase {
+				log.Debugf("Entering %s phase", next)
+				phase = next
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(c.timeout(phase))
+			}
+		}
+	}
+}
+
+// requestUnicast requests unicast transmissions which are not granted yet
+func (c *Client) requestUnicast(e *exchange) error {
+	for _, t := range subscriptions {
+		if e.granted[t] {
+			continue
+		}
+		seq, err := c.sendGeneralMsg(reqUnicast(c.clockID, c.cfg.Duration, c.interval(t), t))
+		if err != nil {
+			return fmt.Errorf("requesting unicast %s: %w", t, err)
+		}
+		log.Debugf("Requested unicast %s, seq=%d", t, seq)
+	}
+	return nil
+}
+
+// interval returns interval to request for the message type
+func (c *Client) interval(t ptp.MessageType) ptp.LogInterval {
+	// delay responses are sent on demand
+	if t == ptp.MessageDelayResp || c.cfg.Interval == 0 {
+		return 0
+	}
+	i, err := ptp.NewLogInterval(c.cfg.Interval)
+	if err != nil {
+		log.Warningf("Invalid interval %v, requesting 1s: %v", c.cfg.Interval, err)
+		return 0
+	}
+	return i
+}
+
+// setup resolves the server, binds to the ports and enables timestamping
+func (c *Client) setup(serverAddr string) error {
+	c.clockID = c.cfg.ClockIdentity
+	if c.clockID == 0 {
+		iface, err := net.InterfaceByName(c.cfg.Iface)
+		if err != nil {
+			return err
+		}
+		if c.clockID, err = ptp.NewClockIdentity(iface.HardwareAddr); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if c.genAddr, err = net.ResolveUDPAddr("udp", net.JoinHostPort(serverAddr, fmt.Sprintf("%d", ptp.PortGeneral))); err != nil {
+		return err
+	}
+	if c.eventAddr, err = net.ResolveUDPAddr("udp", net.JoinHostPort(serverAddr, fmt.Sprintf("%d", ptp.PortEvent))); err != nil {
+		return err
+	}
+
+	localAddr := c.cfg.LocalAddr
+	if localAddr == nil {
+		localAddr = net.IPv6unspecified
+	}
+	// servers reply with general messages to the port they came from
+	if c.genConn, err = net.ListenUDP("udp", &net.UDPAddr{IP: localAddr}); err != nil {
+		return err
+	}
+	// but event messages always go to the event port
+	if c.eventConn, err = net.ListenUDP("udp", &net.UDPAddr{IP: localAddr, Port: ptp.PortEvent}); err != nil {
+		c.close()
+		return err
+	}
+	if c.eventFd, err = timestamp.ConnFd(c.eventConn); err != nil {
+		c.close()
+		return err
+	}
+	if err = c.enableTimestamps(); err != nil {
+		c.close()
+		return err
+	}
+	return nil
+}
+
+// enableTimestamps enables timestamps on the event port
+func (c *Client) enableTimestamps() error {
+	switch c.cfg.Timestamping {
+	case "": // auto-detection
+		if err := timestamp.EnableHWTimestamps(c.eventFd, c.cfg.Iface); err != nil {
+			if err := timestamp.EnableSWTimestamps(c.eventFd); err != nil {
+				return fmt.Errorf("failed to enable timestamps on port %d: %w", ptp.PortEvent, err)
+			}
+			log.Warningf("Failed to enable hardware timestamps on port %d, falling back to software timestamps", ptp.PortEvent)
+			c.sw = true
+		}
+	case HWTIMESTAMP:
+		if err := timestamp.EnableHWTimestamps(c.eventFd, c.cfg.Iface); err != nil {
+			return fmt.Errorf("failed to enable hardware timestamps on port %d: %w", ptp.PortEvent, err)
+		}
+	case SWTIMESTAMP:
+		if err := timestamp.EnableSWTimestamps(c.eventFd); err != nil {
+			return fmt.Errorf("failed to enable software timestamps on port %d: %w", ptp.PortEvent, err)
+		}
+		c.sw = true
+	default:
+		return fmt.Errorf("unknown type of typestamping: %q", c.cfg.Timestamping)
+	}
+	return nil
+}
+
+// close closes the connections
+func (c *Client) close() {
+	if c.eventConn != nil {
+		c.eventConn.Close()
+	}
+	if c.genConn != nil {
+		c.genConn.Close()
+	}
+}
+
+// cancelUnicast cancels granted unicast transmissions
+func (c *Client) cancelUnicast(e *exchange) {
+	for _, t := range subscriptions {
+		if !e.granted[t] {
+			continue
+		}
+		if _, err := c.sendGeneralMsg(reqCancelUnicast(c.clockID, t)); err != nil {
+			log.Warningf("Failed to cancel unicast %s: %v", t, err)
+		}
+	}
+}
+
+func (c *Client) sendGeneralMsg(p ptp.Packet) (uint16, error) {
+	seq := c.genSequence
+	p.SetSequence(seq)
+	b, err := ptp.Bytes(p)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = c.genConn.WriteTo(b, c.genAddr); err != nil {
+		return 0, err
+	}
+	c.genSequence++
+	return seq, nil
+}
+
+func (c *Client) sendEventMsg(p ptp.Packet) (uint16, time.Time, error) {
+	seq := c.eventSequence
+	p.SetSequence(seq)
+	b, err := ptp.Bytes(p)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if _, err = c.eventConn.WriteTo(b, c.eventAddr); err != nil {
+		return 0, time.Time{}, err
+	}
+	c.eventSequence++
+	ts, _, err := timestamp.ReadTXtimestamp(c.eventFd)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to get timestamp of last packet: %w", err)
+	}
+	return seq, ts, nil
+}
+
+// readGeneral reads packets from the general port until the connection is closed
+func (c *Client) readGeneral(packets chan<- *inPacket, done <-chan struct{}) error {
+	for {
+		buf := make([]byte, timestamp.PayloadSizeBytes)
+		n, addr, err := c.genConn.ReadFromUDP(buf)
+		if err != nil {
+			return err
+		}
+		if !addr.IP.Equal(c.genAddr.IP) {
+			log.Warningf("Ignoring packet from %v", addr)
+			continue
+		}
+		select {
+		case packets <- &inPacket{data: buf[:n]}:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// readEvent reads packets with RX timestamps from the event port until the connection is closed
+func (c *Client) readEvent(packets chan<- *inPacket, done <-chan struct{}) error {
+	rc, err := c.eventConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	for {
+		var (
+			n    int
+			sa   unix.Sockaddr
+			ts   time.Time
+			rerr error
+		)
+		buf := make([]byte, timestamp.PayloadSizeBytes)
+		// read via the runtime poller so closing the connection unblocks us
+		err = rc.Read(func(fd uintptr) bool {
+			n, sa, ts, rerr = timestamp.ReadPacketWithRXTimestampBuf(int(fd), buf, oob)
+			return !errors.Is(rerr, unix.EAGAIN)
+		})
+		if err != nil {
+			return err
+		}
+		if rerr != nil {
+			return rerr
+		}
+		if !timestamp.SockaddrToIP(sa).Equal(c.eventAddr.IP) {
+			log.Warningf("Ignoring packet from %v", timestamp.SockaddrToIP(sa))
+			continue
+		}
+		select {
+		case packets <- &inPacket{data: buf[:n], ts: ts}:
+		case <-done:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sptp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/server"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+// requirePort skips the test if the port can't be bound on the IPs
+func requirePort(t *testing.T, port int, ips ...net.IP) {
+	for _, ip := range ips {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: port})
+		if err != nil {
+			t.Skipf("Can't bind to the port %d: %v", port, err)
+		}
+		conn.Close()
+	}
+}
+
+// requireEventPort skips the test if the PTP event port can't be bound on the IPs
+func requireEventPort(t *testing.T, ips ...net.IP) {
+	requirePort(t, ptp.PortEvent, ips...)
+}
+
+// stubServer grants every unicast request and sends an Announce, but never sends Sync
+func stubServer(t *testing.T, ip net.IP) {
+	requirePort(t, ptp.PortGeneral, ip)
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: ptp.PortGeneral})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, timestamp.PayloadSizeBytes)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			signaling := &ptp.Signaling{}
+			if err := ptp.FromBytes(buf[:n], signaling); err != nil {
+				continue
+			}
+			for _, tlv := range signaling.TLVs {
+				req, ok := tlv.(*ptp.RequestUnicastTransmissionTLV)
+				if !ok {
+					continue
+				}
+				mt := req.MsgTypeAndReserved.MsgType()
+				_, _ = conn.WriteToUDP(grantPacket(t, mt, req.DurationField).data, addr)
+				if mt == ptp.MessageAnnounce {
+					_, _ = conn.WriteToUDP(announcePacket(t, 37).data, addr)
+				}
+			}
+		}
+	}()
+}
+
+// TestRunPTP4U runs the client against ptp4u on the loopback
+func TestRunPTP4U(t *testing.T) {
+	serverIP := net.ParseIP("127.0.0.1")
+	clientIP := net.ParseIP("127.0.0.2")
+	// both need the PTP event port
+	requireEventPort(t, serverIP, clientIP)
+
+	c := &server.Config{
+		StaticConfig: server.StaticConfig{
+			ClockIdentity: ptp.ClockIdentity(1234),
+			Interface:     "lo",
+			IP:            serverIP,
+			PidFile:       filepath.Join(t.TempDir(), "ptp4u.pid"),
+			QueueSize:     10,
+			RecvWorkers:   1,
+			SendWorkers:   1,
+			TimestampType: timestamp.SWTIMESTAMP,
+		},
+	}
+	require.NoError(t, c.ApplyProfile())
+	s := server.Server{Config: c, Stats: stats.NewJSONStats()}
+	go func() {
+		if err := s.Start(); err != nil {
+			t.Logf("ptp4u failed: %v", err)
+		}
+	}()
+	// ptp4u stops on SIGTERM, nothing else to clean up
+	t.Cleanup(func() { os.Remove(c.PidFile) })
+
+	client := New(&Config{
+		ClockIdentity: ptp.ClockIdentity(5678),
+		Duration:      time.Minute,
+		Interval:      time.Second,
+		LocalAddr:     clientIP,
+		Timestamping:  SWTIMESTAMP,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	offset, delay, err := client.Run(ctx, serverIP.String())
+	require.NoError(t, err)
+	// same clock on both ends
+	require.Less(t, offset, 10*time.Millisecond)
+	require.Greater(t, offset, -10*time.Millisecond)
+	require.Greater(t, delay, time.Duration(0))
+	require.Less(t, delay, 10*time.Millisecond)
+}
+
+func TestRunNoServer(t *testing.T) {
+	requireEventPort(t, net.ParseIP("127.0.0.3"))
+	client := New(&Config{
+		ClockIdentity: ptp.ClockIdentity(5678),
+		Duration:      time.Minute,
+		LocalAddr:     net.ParseIP("127.0.0.3"),
+		Timestamping:  SWTIMESTAMP,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, _, err := client.Run(ctx, "127.0.0.4")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRunNegotiationTimeout(t *testing.T) {
+	requireEventPort(t, net.ParseIP("127.0.0.3"))
+	client := New(&Config{
+		ClockIdentity:      ptp.ClockIdentity(5678),
+		Duration:           time.Minute,
+		LocalAddr:          net.ParseIP("127.0.0.3"),
+		Timestamping:       SWTIMESTAMP,
+		NegotiationTimeout: 100 * time.Millisecond,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _, err := client.Run(ctx, "127.0.0.4")
+	var timeoutErr *TimeoutError
+	require.True(t, errors.As(err, &timeoutErr), "expected timeout error, got %v", err)
+	require.Equal(t, PhaseNegotiation, timeoutErr.Phase)
+	require.Equal(t, 100*time.Millisecond, timeoutErr.Timeout)
+}
+
+// TestRunSyncTimeout checks that server granting but never sending Sync is reported
+func TestRunSyncTimeout(t *testing.T) {
+	serverIP := net.ParseIP("127.0.0.5")
+	clientIP := net.ParseIP("127.0.0.6")
+	requireEventPort(t, clientIP)
+	stubServer(t, serverIP)
+
+	client := New(&Config{
+		ClockIdentity:      ptp.ClockIdentity(5678),
+		Duration:           time.Minute,
+		LocalAddr:          clientIP,
+		Timestamping:       SWTIMESTAMP,
+		NegotiationTimeout: 2 * time.Second,
+		SyncTimeout:        200 * time.Millisecond,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _, err := client.Run(ctx, serverIP.String())
+	var timeoutErr *TimeoutError
+	require.True(t, errors.As(err, &timeoutErr), "expected timeout error, got %v", err)
+	require.Equal(t, PhaseSync, timeoutErr.Phase)
+	require.Equal(t, "timed out after 200ms in sync phase", err.Error())
+}
+
+func TestClientTimeout(t *testing.T) {
+	c := New(&Config{})
+	require.Equal(t, defaultPhaseTimeout, c.timeout(PhaseNegotiation))
+	require.Equal(t, defaultPhaseTimeout, c.timeout(PhaseSync))
+	require.Equal(t, defaultPhaseTimeout, c.timeout(PhaseDelayResp))
+
+	c = New(&Config{Interval: 4 * time.Second, DelayRespTimeout: time.Second})
+	require.Equal(t, 12*time.Second, c.timeout(PhaseSync))
+	require.Equal(t, time.Second, c.timeout(PhaseDelayResp))
+}
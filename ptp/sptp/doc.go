@@ -0,0 +1,24 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package sptp implements a simple PTPv2 unicast client.
+
+Client performs a single Sync/FollowUp and DelayReq/DelayResp exchange with the server
+and reports measured offset and mean path delay. It's meant for end-to-end checks of PTP servers
+such as ptp4u rather than for disciplining the clock.
+*/
+package sptp
@@ -0,0 +1,195 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sptp
+
+import (
+	"fmt"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// sample is a pair of Sync and FollowUp
+type sample struct {
+	sync *ptp.SyncDelayReq
+	// t2 is a client receive timestamp of Sync
+	t2       time.Time
+	followUp *ptp.FollowUp
+}
+
+func (s *sample) complete() bool {
+	return s.sync != nil && s.followUp != nil
+}
+
+// exchange tracks a single measurement with the server
+type exchange struct {
+	// sw is set with software timestamps, which are UTC while the server ones are TAI
+	sw        bool
+	granted   map[ptp.MessageType]bool
+	announced bool
+	utcOffset time.Duration
+
+	samples map[uint16]*sample
+	sync    *sample
+
+	sent bool
+	seq  uint16
+	// t3 is a client transmission timestamp of DelayReq
+	t3        time.Time
+	delayResp *ptp.DelayResp
+}
+
+func newExchange(sw bool) *exchange {
+	return &exchange{
+		sw:      sw,
+		granted: map[ptp.MessageType]bool{},
+		samples: map[uint16]*sample{},
+	}
+}
+
+// handle records data from the packet
+func (e *exchange) handle(p *inPacket) error {
+	msgType, err := ptp.ProbeMsgType(p.data)
+	if err != nil {
+		return err
+	}
+	switch msgType {
+	case ptp.MessageSignaling:
+		signaling := &ptp.Signaling{}
+		if err := ptp.FromBytes(p.data, signaling); err != nil {
+			return fmt.Errorf("reading signaling msg: %w", err)
+		}
+		for _, tlv := range signaling.TLVs {
+			switch v := tlv.(type) {
+			case *ptp.GrantUnicastTransmissionTLV:
+				t := v.MsgTypeAndReserved.MsgType()
+				if v.DurationField == 0 {
+					return fmt.Errorf("server denied us grant for %s", t)
+				}
+				e.granted[t] = true
+			case *ptp.CancelUnicastTransmissionTLV:
+				t := v.MsgTypeAndFlags.MsgType()
+				e.granted[t] = false
+				return fmt.Errorf("server cancelled unicast %s", t)
+			}
+		}
+	case ptp.MessageAnnounce:
+		announce := &ptp.Announce{}
+		if err := ptp.FromBytes(p.data, announce); err != nil {
+			return fmt.Errorf("reading announce msg: %w", err)
+		}
+		e.utcOffset = time.Duration(announce.CurrentUTCOffset) * time.Second
+		e.announced = true
+	case ptp.MessageSync:
+		b := &ptp.SyncDelayReq{}
+		if err := ptp.FromBytes(p.data, b); err != nil {
+			return fmt.Errorf("reading sync msg: %w", err)
+		}
+		s := e.sample(b.SequenceID)
+		s.sync = b
+		s.t2 = p.ts
+		e.track(b.SequenceID)
+	case ptp.MessageFollowUp:
+		b := &ptp.FollowUp{}
+		if err := ptp.FromBytes(p.data, b); err != nil {
+			return fmt.Errorf("reading follow_up msg: %w", err)
+		}
+		s := e.sample(b.SequenceID)
+		s.followUp = b
+		e.track(b.SequenceID)
+	case ptp.MessageDelayResp:
+		b := &ptp.DelayResp{}
+		if err := ptp.FromBytes(p.data, b); err != nil {
+			return fmt.Errorf("reading delay_resp msg: %w", err)
+		}
+		if !e.sent || b.SequenceID != e.seq {
+			return nil
+		}
+		e.delayResp = b
+	}
+	return nil
+}
+
+// sample returns the Sync/FollowUp pair with the sequence id
+func (e *exchange) sample(seq uint16) *sample {
+	s, ok := e.samples[seq]
+	if !ok {
+		s = &sample{}
+		e.samples[seq] = s
+	}
+	return s
+}
+
+// track makes the Sync/FollowUp pair with the sequence id the latest one once it's complete
+func (e *exchange) track(seq uint16) {
+	if s := e.samples[seq]; s.complete() {
+		e.sync = s
+		delete(e.samples, seq)
+	}
+}
+
+// readyForDelayReq reports if everything is in place to send DelayReq
+func (e *exchange) readyForDelayReq() bool {
+	if e.sent || e.sync == nil || !e.announced {
+		return false
+	}
+	return e.grantedAll()
+}
+
+// grantedAll reports if all subscriptions are granted
+func (e *exchange) grantedAll() bool {
+	for _, t := range subscriptions {
+		if !e.granted[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// phase returns the current phase of the exchange
+func (e *exchange) phase() Phase {
+	if e.sent {
+		return PhaseDelayResp
+	}
+	if e.grantedAll() {
+		return PhaseSync
+	}
+	return PhaseNegotiation
+}
+
+// delayReqSent records sent DelayReq
+func (e *exchange) delayReqSent(seq uint16, t3 time.Time) {
+	e.sent = true
+	e.seq = seq
+	e.t3 = t3
+}
+
+// done reports if all timestamps are collected
+func (e *exchange) done() bool {
+	return e.sync != nil && e.sent && e.delayResp != nil
+}
+
+// measure calculates offset and mean path delay from the collected timestamps
+func (e *exchange) measure() (offset, delay time.Duration) {
+	t2 := e.sync.t2
+	t3 := e.t3
+	if e.sw {
+		t2 = t2.Add(e.utcOffset)
+		t3 = t3.Add(e.utcOffset)
+	}
+	return ptp.TwoStepOffset(e.sync.sync, t2, e.sync.followUp, t3, e.delayResp)
+}
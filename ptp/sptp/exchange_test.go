@@ -0,0 +1,221 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sptp
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+// serverHeader builds the header of a message from the server
+func serverHeader(what ptp.MessageType, length uint16) ptp.Header {
+	h := ptp.NewHeader(what, 0, 0, ptp.FlagUnicast, 0, sourcePort(1))
+	h.MessageLength = length
+	return h
+}
+
+func packetBytes(t *testing.T, p ptp.Packet) []byte {
+	b, err := ptp.Bytes(p)
+	require.NoError(t, err)
+	return b
+}
+
+func grantPacket(t *testing.T, what ptp.MessageType, duration uint32) *inPacket {
+	s := &ptp.Signaling{
+		Header: serverHeader(ptp.MessageSignaling, uint16(binary.Size(ptp.Header{})+binary.Size(ptp.PortIdentity{})+binary.Size(ptp.GrantUnicastTransmissionTLV{}))),
+		TLVs: []ptp.TLV{
+			&ptp.GrantUnicastTransmissionTLV{
+				TLVHead: ptp.TLVHead{
+					TLVType:     ptp.TLVGrantUnicastTransmission,
+					LengthField: uint16(binary.Size(ptp.GrantUnicastTransmissionTLV{}) - binary.Size(ptp.TLVHead{})),
+				},
+				MsgTypeAndReserved: ptp.NewUnicastMsgTypeAndFlags(what, 0),
+				DurationField:      duration,
+			},
+		},
+	}
+	return &inPacket{data: packetBytes(t, s)}
+}
+
+func announcePacket(t *testing.T, utcOffset int16) *inPacket {
+	a := &ptp.Announce{
+		Header: serverHeader(ptp.MessageAnnounce, uint16(binary.Size(ptp.Header{})+binary.Size(ptp.AnnounceBody{}))),
+		AnnounceBody: ptp.AnnounceBody{
+			CurrentUTCOffset: utcOffset,
+		},
+	}
+	return &inPacket{data: packetBytes(t, a)}
+}
+
+func syncPacket(t *testing.T, seq uint16, t2 time.Time) *inPacket {
+	s := &ptp.SyncDelayReq{Header: serverHeader(ptp.MessageSync, uint16(binary.Size(ptp.SyncDelayReq{})))}
+	s.SequenceID = seq
+	return &inPacket{data: packetBytes(t, s), ts: t2}
+}
+
+func followUpPacket(t *testing.T, seq uint16, t1 time.Time) *inPacket {
+	f := &ptp.FollowUp{
+		Header: serverHeader(ptp.MessageFollowUp, uint16(binary.Size(ptp.FollowUp{}))),
+		FollowUpBody: ptp.FollowUpBody{
+			PreciseOriginTimestamp: ptp.NewTimestamp(t1),
+		},
+	}
+	f.SequenceID = seq
+	return &inPacket{data: packetBytes(t, f)}
+}
+
+func delayRespPacket(t *testing.T, seq uint16, t4 time.Time) *inPacket {
+	d := &ptp.DelayResp{
+		Header: serverHeader(ptp.MessageDelayResp, uint16(binary.Size(ptp.DelayResp{}))),
+		DelayRespBody: ptp.DelayRespBody{
+			ReceiveTimestamp: ptp.NewTimestamp(t4),
+		},
+	}
+	d.SequenceID = seq
+	return &inPacket{data: packetBytes(t, d)}
+}
+
+func grantAll(t *testing.T, e *exchange) {
+	for _, what := range subscriptions {
+		require.NoError(t, e.handle(grantPacket(t, what, 60)))
+	}
+}
+
+func TestExchange(t *testing.T) {
+	// client is 10us ahead of the server, path delay is 5us
+	server := time.Unix(1653574589, 0)
+	offset := 10 * time.Microsecond
+	delay := 5 * time.Microsecond
+
+	e := newExchange(false)
+	require.False(t, e.readyForDelayReq())
+	grantAll(t, e)
+	require.NoError(t, e.handle(announcePacket(t, 37)))
+	require.False(t, e.readyForDelayReq())
+
+	// FollowUp comes before Sync
+	require.NoError(t, e.handle(followUpPacket(t, 1, server)))
+	require.False(t, e.readyForDelayReq())
+	require.NoError(t, e.handle(syncPacket(t, 1, server.Add(delay+offset))))
+	require.True(t, e.readyForDelayReq())
+
+	t3 := server.Add(time.Millisecond + offset)
+	e.delayReqSent(42, t3)
+	require.False(t, e.readyForDelayReq())
+	require.False(t, e.done())
+
+	// DelayResp to somebody else's DelayReq
+	require.NoError(t, e.handle(delayRespPacket(t, 41, server)))
+	require.False(t, e.done())
+
+	require.NoError(t, e.handle(delayRespPacket(t, 42, server.Add(time.Millisecond+delay))))
+	require.True(t, e.done())
+	gotOffset, gotDelay := e.measure()
+	require.Equal(t, offset, gotOffset)
+	require.Equal(t, delay, gotDelay)
+}
+
+func TestExchangeSoftwareTimestamps(t *testing.T) {
+	// server timestamps are TAI, software timestamps are UTC
+	tai := time.Unix(1653574589, 0)
+	utc := tai.Add(-37 * time.Second)
+	delay := 5 * time.Microsecond
+
+	e := newExchange(true)
+	grantAll(t, e)
+	require.NoError(t, e.handle(syncPacket(t, 1, utc.Add(delay))))
+	require.NoError(t, e.handle(followUpPacket(t, 1, tai)))
+	// UTC offset is unknown until announce
+	require.False(t, e.readyForDelayReq())
+	require.NoError(t, e.handle(announcePacket(t, 37)))
+	require.True(t, e.readyForDelayReq())
+
+	e.delayReqSent(0, utc.Add(time.Millisecond))
+	require.NoError(t, e.handle(delayRespPacket(t, 0, tai.Add(time.Millisecond+delay))))
+	require.True(t, e.done())
+	gotOffset, gotDelay := e.measure()
+	require.Equal(t, time.Duration(0), gotOffset)
+	require.Equal(t, delay, gotDelay)
+}
+
+func TestExchangeCorrection(t *testing.T) {
+	// transparent clocks add 1us to Sync, 2us to FollowUp and 4us to DelayReq residence time
+	server := time.Unix(1653574589, 0)
+	delay := 5 * time.Microsecond
+
+	e := newExchange(false)
+	grantAll(t, e)
+	require.NoError(t, e.handle(announcePacket(t, 37)))
+
+	s := &ptp.SyncDelayReq{Header: serverHeader(ptp.MessageSync, uint16(binary.Size(ptp.SyncDelayReq{})))}
+	s.SequenceID = 1
+	s.CorrectionField = ptp.NewCorrection(1000)
+	require.NoError(t, e.handle(&inPacket{data: packetBytes(t, s), ts: server.Add(delay + 3*time.Microsecond)}))
+	f := &ptp.FollowUp{
+		Header:       serverHeader(ptp.MessageFollowUp, uint16(binary.Size(ptp.FollowUp{}))),
+		FollowUpBody: ptp.FollowUpBody{PreciseOriginTimestamp: ptp.NewTimestamp(server)},
+	}
+	f.SequenceID = 1
+	f.CorrectionField = ptp.NewCorrection(2000)
+	require.NoError(t, e.handle(&inPacket{data: packetBytes(t, f)}))
+
+	e.delayReqSent(0, server.Add(time.Millisecond))
+	d := &ptp.DelayResp{
+		Header:        serverHeader(ptp.MessageDelayResp, uint16(binary.Size(ptp.DelayResp{}))),
+		DelayRespBody: ptp.DelayRespBody{ReceiveTimestamp: ptp.NewTimestamp(server.Add(time.Millisecond + delay + 4*time.Microsecond))},
+	}
+	d.CorrectionField = ptp.NewCorrection(4000)
+	require.NoError(t, e.handle(&inPacket{data: packetBytes(t, d)}))
+	require.True(t, e.done())
+	gotOffset, gotDelay := e.measure()
+	require.Equal(t, time.Duration(0), gotOffset)
+	require.Equal(t, delay, gotDelay)
+}
+
+func TestExchangeDenied(t *testing.T) {
+	e := newExchange(false)
+	require.NoError(t, e.handle(grantPacket(t, ptp.MessageAnnounce, 60)))
+	require.Error(t, e.handle(grantPacket(t, ptp.MessageSync, 0)))
+	require.False(t, e.granted[ptp.MessageSync])
+}
+
+func TestExchangeCancelled(t *testing.T) {
+	e := newExchange(false)
+	grantAll(t, e)
+	c := reqCancelUnicast(1, ptp.MessageSync)
+	require.Error(t, e.handle(&inPacket{data: packetBytes(t, c)}))
+	require.False(t, e.granted[ptp.MessageSync])
+	require.True(t, e.granted[ptp.MessageAnnounce])
+}
+
+func TestExchangePhase(t *testing.T) {
+	e := newExchange(false)
+	require.Equal(t, PhaseNegotiation, e.phase())
+
+	require.NoError(t, e.handle(grantPacket(t, ptp.MessageSync, 60)))
+	require.Equal(t, PhaseNegotiation, e.phase())
+
+	grantAll(t, e)
+	require.Equal(t, PhaseSync, e.phase())
+
+	e.delayReqSent(1, time.Now())
+	require.Equal(t, PhaseDelayResp, e.phase())
+}
@@ -0,0 +1,72 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sptp
+
+import (
+	"encoding/binary"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// sourcePort is the port identity requests originate from
+func sourcePort(clockID ptp.ClockIdentity) ptp.PortIdentity {
+	return ptp.PortIdentity{
+		PortNumber:    1,
+		ClockIdentity: clockID,
+	}
+}
+
+// signaling builds ptp.Signaling to all ports carrying the TLV of tlvSize bytes
+func signaling(clockID ptp.ClockIdentity, tlv ptp.TLV, tlvSize int) *ptp.Signaling {
+	// sequence will be populated on sending
+	s := &ptp.Signaling{
+		Header: ptp.NewHeader(ptp.MessageSignaling, 0, 0, ptp.FlagUnicast, 0, sourcePort(clockID)),
+		TargetPortIdentity: ptp.PortIdentity{
+			PortNumber:    0xffff,
+			ClockIdentity: 0xffffffffffffffff,
+		},
+		TLVs: []ptp.TLV{tlv},
+	}
+	s.MessageLength = uint16(binary.Size(ptp.Header{}) + binary.Size(ptp.PortIdentity{}) + tlvSize)
+	s.LogMessageInterval = 0x7f
+	return s
+}
+
+// reqUnicast is a helper to build ptp.RequestUnicastTransmission
+func reqUnicast(clockID ptp.ClockIdentity, duration time.Duration, interval ptp.LogInterval, what ptp.MessageType) *ptp.Signaling {
+	return signaling(clockID, &ptp.RequestUnicastTransmissionTLV{
+		TLVHead: ptp.TLVHead{
+			TLVType:     ptp.TLVRequestUnicastTransmission,
+			LengthField: uint16(binary.Size(ptp.RequestUnicastTransmissionTLV{}) - binary.Size(ptp.TLVHead{})),
+		},
+		MsgTypeAndReserved:    ptp.NewUnicastMsgTypeAndFlags(what, 0),
+		LogInterMessagePeriod: interval,
+		DurationField:         uint32(duration.Seconds()), // seconds
+	}, binary.Size(ptp.RequestUnicastTransmissionTLV{}))
+}
+
+// reqCancelUnicast is a helper to build ptp.CancelUnicastTransmission
+func reqCancelUnicast(clockID ptp.ClockIdentity, what ptp.MessageType) *ptp.Signaling {
+	return signaling(clockID, &ptp.CancelUnicastTransmissionTLV{
+		TLVHead: ptp.TLVHead{
+			TLVType:     ptp.TLVCancelUnicastTransmission,
+			LengthField: uint16(binary.Size(ptp.CancelUnicastTransmissionTLV{}) - binary.Size(ptp.TLVHead{})),
+		},
+		MsgTypeAndFlags: ptp.NewUnicastMsgTypeAndFlags(what, 0),
+	}, binary.Size(ptp.CancelUnicastTransmissionTLV{}))
+}
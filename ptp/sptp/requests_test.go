@@ -0,0 +1,52 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sptp
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqUnicast(t *testing.T) {
+	b := packetBytes(t, reqUnicast(1234, time.Minute, 1, ptp.MessageSync))
+	s := &ptp.Signaling{}
+	require.NoError(t, ptp.FromBytes(b, s))
+	require.Equal(t, ptp.MessageSignaling, s.MessageType())
+	require.Equal(t, uint16(binary.Size(ptp.Header{})+binary.Size(ptp.PortIdentity{})+binary.Size(ptp.RequestUnicastTransmissionTLV{})), s.MessageLength)
+	require.Equal(t, uint8(5), s.ControlField)
+	require.Equal(t, ptp.PortIdentity{PortNumber: 1, ClockIdentity: 1234}, s.SourcePortIdentity)
+	require.Len(t, s.TLVs, 1)
+	tlv, ok := s.TLVs[0].(*ptp.RequestUnicastTransmissionTLV)
+	require.True(t, ok)
+	require.Equal(t, ptp.MessageSync, tlv.MsgTypeAndReserved.MsgType())
+	require.Equal(t, uint32(60), tlv.DurationField)
+}
+
+func TestReqCancelUnicast(t *testing.T) {
+	b := packetBytes(t, reqCancelUnicast(1234, ptp.MessageAnnounce))
+	s := &ptp.Signaling{}
+	require.NoError(t, ptp.FromBytes(b, s))
+	require.Equal(t, uint16(binary.Size(ptp.Header{})+binary.Size(ptp.PortIdentity{})+binary.Size(ptp.CancelUnicastTransmissionTLV{})), s.MessageLength)
+	require.Len(t, s.TLVs, 1)
+	tlv, ok := s.TLVs[0].(*ptp.CancelUnicastTransmissionTLV)
+	require.True(t, ok)
+	require.Equal(t, ptp.MessageAnnounce, tlv.MsgTypeAndFlags.MsgType())
+}
@@ -0,0 +1,83 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sptp
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultPhaseTimeout is used for phases without configured timeout
+const defaultPhaseTimeout = 5 * time.Second
+
+// syncTimeoutIntervals is how many Sync intervals we wait for Sync by default
+const syncTimeoutIntervals = 3
+
+// Phase is a stage of the exchange with the server
+type Phase int
+
+// Exchange phases
+const (
+	// PhaseNegotiation is waiting for unicast transmission grants
+	PhaseNegotiation Phase = iota
+	// PhaseSync is waiting for Announce and Sync/FollowUp after everything is granted
+	PhaseSync
+	// PhaseDelayResp is waiting for DelayResp to our DelayReq
+	PhaseDelayResp
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseNegotiation:
+		return "negotiation"
+	case PhaseSync:
+		return "sync"
+	case PhaseDelayResp:
+		return "delay_resp"
+	}
+	return fmt.Sprintf("Phase(%d)", int(p))
+}
+
+// TimeoutError is returned by Run when the server didn't complete a phase in time
+type TimeoutError struct {
+	Phase   Phase
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %v in %s phase", e.Timeout, e.Phase)
+}
+
+// timeout returns configured timeout of the phase
+func (c *Client) timeout(p Phase) time.Duration {
+	var t time.Duration
+	switch p {
+	case PhaseNegotiation:
+		t = c.cfg.NegotiationTimeout
+	case PhaseSync:
+		t = c.cfg.SyncTimeout
+		if t == 0 && syncTimeoutIntervals*c.cfg.Interval > defaultPhaseTimeout {
+			t = syncTimeoutIntervals * c.cfg.Interval
+		}
+	case PhaseDelayResp:
+		t = c.cfg.DelayRespTimeout
+	}
+	if t == 0 {
+		t = defaultPhaseTimeout
+	}
+	return t
+}
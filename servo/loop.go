@@ -0,0 +1,122 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/facebook/time/servo/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+// Clock is a clock disciplined by the Loop, e.g. PHC following the system clock or the other way around
+type Clock interface {
+	// Offset measures the offset of the clock from the reference, along with local time of the measurement
+	Offset() (time.Duration, time.Time, error)
+	// AdjFreqPPB sets the frequency adjustment of the clock
+	AdjFreqPPB(freqPPB float64) error
+	// Step steps the clock by delta
+	Step(delta time.Duration) error
+}
+
+// Loop periodically measures the clock offset, feeds it to the servo, applies frequency adjustments
+// and records the result into stats
+type Loop struct {
+	Clock    Clock
+	Servo    *PiServo
+	Stats    stats.Stats
+	Interval time.Duration
+
+	// now returns local time when there is no measurement, time.Now if nil
+	now func() time.Time
+}
+
+// NewLoop creates a new Loop disciplining the clock every interval
+func NewLoop(clock Clock, servo *PiServo, st stats.Stats, interval time.Duration) *Loop {
+	return &Loop{
+		Clock:    clock,
+		Servo:    servo,
+		Stats:    st,
+		Interval: interval,
+	}
+}
+
+// Tick runs a single iteration of the loop
+func (l *Loop) Tick() (State, error) {
+	defer l.Stats.Snapshot()
+	offset, localTs, err := l.Clock.Offset()
+	if err != nil {
+		l.Stats.IncMeasurementError()
+		state := StateInit
+		if l.Servo.IsHoldover(uint64(l.localNow().UnixNano())) {
+			// the clock coasts with the last frequency adjustment
+			state = StateHoldover
+			l.Stats.SetState(int64(state))
+		}
+		return state, fmt.Errorf("measuring offset: %w", err)
+	}
+	l.Stats.ResetMeasurementError()
+	l.Stats.SetOffsetNS(offset.Nanoseconds())
+
+	ppb, state := l.Servo.Sample(offset.Nanoseconds(), uint64(localTs.UnixNano()))
+	l.Stats.SetState(int64(state))
+	l.Stats.SetSaturations(int64(l.Servo.Saturations()))
+	switch state {
+	case StateJump:
+		log.Infof("servo: stepping the clock by %v", -offset)
+		if err := l.Clock.Step(-offset); err != nil {
+			return state, fmt.Errorf("stepping the clock: %w", err)
+		}
+		fallthrough
+	case StateLocked:
+		// as in linuxptp, the clock frequency is set to the negated servo output
+		if err := l.Clock.AdjFreqPPB(-ppb); err != nil {
+			return state, fmt.Errorf("adjusting the clock frequency: %w", err)
+		}
+		l.Stats.SetFreqPPB(int64(-ppb))
+	}
+	return state, nil
+}
+
+// localNow returns local time
+func (l *Loop) localNow() time.Time {
+	if l.now == nil {
+		return time.Now()
+	}
+	return l.now()
+}
+
+// Run runs the loop every Interval until ctx is done. Failed iterations are logged and skipped
+func (l *Loop) Run(ctx context.Context) error {
+	ticker := time.NewTicker(l.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			state, err := l.Tick()
+			if err != nil {
+				log.Errorf("servo: state %s: %v", state, err)
+				continue
+			}
+			log.Debugf("servo: state %s", state)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/servo/stats"
+	"github.com/stretchr/testify/require"
+)
+
+// simClock is a simulated free running clock with a constant frequency error
+type simClock struct {
+	now     time.Time
+	offset  float64 // ns
+	freqErr float64 // PPB
+	adj     float64 // PPB
+	steps   int
+	err     error
+}
+
+func (c *simClock) Offset() (time.Duration, time.Time, error) {
+	if c.err != nil {
+		return 0, time.Time{}, c.err
+	}
+	return time.Duration(c.offset), c.now, nil
+}
+
+func (c *simClock) AdjFreqPPB(freqPPB float64) error {
+	c.adj = freqPPB
+	return nil
+}
+
+func (c *simClock) Step(delta time.Duration) error {
+	c.offset += float64(delta)
+	c.steps++
+	return nil
+}
+
+func (c *simClock) advance(d time.Duration) {
+	c.offset += (c.freqErr + c.adj) * d.Seconds()
+	c.now = c.now.Add(d)
+}
+
+func TestLoopConverges(t *testing.T) {
+	clock := &simClock{now: time.Unix(1653574589, 0), offset: 5000, freqErr: 10000}
+	st := stats.NewJSONStats()
+	l := NewLoop(clock, NewPiServo(DefaultPiServoCfg(), 0), st, time.Second)
+
+	for i := 0; i < 60; i++ {
+		_, err := l.Tick()
+		require.NoError(t, err)
+		clock.advance(time.Second)
+	}
+	require.Less(t, math.Abs(clock.offset), 10.0)
+	require.InDelta(t, -clock.freqErr, clock.adj, 1)
+	require.Equal(t, 0, clock.steps)
+
+	report := st.Report()
+	require.Equal(t, int64(StateLocked), report["state"])
+	require.Equal(t, int64(-10000), report["freq_ppb"])
+	require.Less(t, math.Abs(float64(report["offset_ns"])), 10.0)
+	require.Equal(t, int64(0), report["saturations"])
+}
+
+func TestLoopStep(t *testing.T) {
+	clock := &simClock{now: time.Unix(1653574589, 0), offset: float64(time.Second), freqErr: 100}
+	cfg := DefaultPiServoCfg()
+	cfg.StepThreshold = time.Millisecond
+	l := NewLoop(clock, NewPiServo(cfg, 0), stats.NewJSONStats(), time.Second)
+
+	state, err := l.Tick()
+	require.NoError(t, err)
+	require.Equal(t, StateInit, state)
+	clock.advance(time.Second)
+	state, err = l.Tick()
+	require.NoError(t, err)
+	require.Equal(t, StateJump, state)
+	require.Equal(t, 1, clock.steps)
+	require.Less(t, math.Abs(clock.offset), 1.0)
+	require.InDelta(t, -100, clock.adj, 0.001)
+}
+
+func TestLoopMeasurementError(t *testing.T) {
+	clock := &simClock{err: fmt.Errorf("no PHC")}
+	st := stats.NewJSONStats()
+	l := NewLoop(clock, NewPiServo(DefaultPiServoCfg(), 0), st, time.Second)
+
+	_, err := l.Tick()
+	require.Error(t, err)
+	_, err = l.Tick()
+	require.Error(t, err)
+	require.Equal(t, int64(2), st.Report()["measurementerror"])
+
+	clock.err = nil
+	_, err = l.Tick()
+	require.NoError(t, err)
+	require.Equal(t, int64(0), st.Report()["measurementerror"])
+}
+
+func TestLoopHoldover(t *testing.T) {
+	clock := &simClock{now: time.Unix(1653574589, 0)}
+	st := stats.NewJSONStats()
+	l := NewLoop(clock, NewPiServo(DefaultPiServoCfg(), 0), st, time.Second)
+	l.now = func() time.Time { return clock.now }
+	var state State
+	var err error
+	for i := 0; i < 3; i++ {
+		state, err = l.Tick()
+		require.NoError(t, err)
+		clock.advance(time.Second)
+	}
+	require.Equal(t, StateLocked, state)
+	adj := clock.adj
+
+	// samples stop, short gaps are not holdover yet
+	clock.err = fmt.Errorf("no PHC")
+	state, err = l.Tick()
+	require.Error(t, err)
+	require.Equal(t, StateInit, state)
+
+	clock.advance(DefaultPiServoCfg().HoldoverTimeout)
+	state, err = l.Tick()
+	require.Error(t, err)
+	require.Equal(t, StateHoldover, state)
+	require.Equal(t, int64(StateHoldover), st.Report()["state"])
+	// frequency is left as is
+	require.Equal(t, adj, clock.adj)
+
+	clock.err = nil
+	state, err = l.Tick()
+	require.NoError(t, err)
+	require.Equal(t, StateLocked, state)
+}
+
+func TestLoopRun(t *testing.T) {
+	clock := &simClock{now: time.Unix(1653574589, 0)}
+	l := NewLoop(clock, NewPiServo(DefaultPiServoCfg(), 0), stats.NewJSONStats(), time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, l.Run(ctx), context.DeadlineExceeded)
+}
@@ -0,0 +1,258 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// number of frequency values used to estimate frequency stability
+const stabilityWindow = 16
+
+// stateVersion is the version of the servo state blob, see MarshalState
+const stateVersion = 1
+
+// stateSize is the size of the servo state blob: version followed by the frequency estimate
+const stateSize = 1 + 8
+
+// PiServoCfg is a PI servo configuration
+type PiServoCfg struct {
+	// KP is a proportional constant
+	KP float64
+	// KI is an integral constant
+	KI float64
+	// MaxFreq is a maximum frequency adjustment in PPB. It should not exceed the one of the clock, see phc.MaxAdjPPB
+	MaxFreq float64
+	// StepThreshold is an offset above which servo requests a clock step. 0 disables stepping
+	StepThreshold time.Duration
+	// HoldoverTimeout is a time without samples after which servo enters holdover
+	HoldoverTimeout time.Duration
+}
+
+// DefaultPiServoCfg returns PI servo config with the linuxptp defaults
+func DefaultPiServoCfg() PiServoCfg {
+	return PiServoCfg{
+		KP:              0.7,
+		KI:              0.3,
+		MaxFreq:         900000000,
+		StepThreshold:   0,
+		HoldoverTimeout: 5 * time.Second,
+	}
+}
+
+// PiServo is a proportional-integral servo
+type PiServo struct {
+	cfg PiServoCfg
+
+	offset [2]int64
+	local  [2]uint64
+	drift  float64
+	count  int
+
+	lastSample uint64
+	freqs      []float64
+
+	saturated   bool
+	saturations uint64
+}
+
+// NewPiServo creates new PI servo. freq is the current frequency adjustment of the clock in PPB
+func NewPiServo(cfg PiServoCfg, freq float64) *PiServo {
+	return &PiServo{
+		cfg:   cfg,
+		drift: freq,
+		freqs: make([]float64, 0, stabilityWindow),
+	}
+}
+
+// ServoFromState creates new PI servo resuming from the state saved by MarshalState,
+// so it starts near the correct frequency instead of re-converging from 0 PPB.
+// The clock frequency should be set to the negated MeanFreq before the first sample
+func ServoFromState(cfg PiServoCfg, state []byte) (*PiServo, error) {
+	if len(state) != stateSize {
+		return nil, fmt.Errorf("servo state size %d, expected %d", len(state), stateSize)
+	}
+	if state[0] != stateVersion {
+		return nil, fmt.Errorf("unsupported servo state version %d", state[0])
+	}
+	freq := math.Float64frombits(binary.BigEndian.Uint64(state[1:]))
+	if math.IsNaN(freq) || math.IsInf(freq, 0) {
+		return nil, fmt.Errorf("invalid frequency in servo state: %v", freq)
+	}
+	s := NewPiServo(cfg, 0)
+	s.drift = s.clamp(freq)
+	return s, nil
+}
+
+// MarshalState returns the servo state to be persisted by the caller and restored with ServoFromState
+func (s *PiServo) MarshalState() []byte {
+	b := make([]byte, stateSize)
+	b[0] = stateVersion
+	binary.BigEndian.PutUint64(b[1:], math.Float64bits(s.drift))
+	return b
+}
+
+// SetMaxFreq limits frequency adjustments to maxFreq PPB, e.g. to the max adjustment of the clock
+func (s *PiServo) SetMaxFreq(maxFreq float64) {
+	s.cfg.MaxFreq = maxFreq
+}
+
+func (s *PiServo) clamp(ppb float64) float64 {
+	if ppb > s.cfg.MaxFreq {
+		return s.cfg.MaxFreq
+	}
+	if ppb < -s.cfg.MaxFreq {
+		return -s.cfg.MaxFreq
+	}
+	return ppb
+}
+
+// saturate clamps ppb to MaxFreq keeping track of saturation, which often means a broken reference
+func (s *PiServo) saturate(ppb float64) float64 {
+	clamped := s.clamp(ppb)
+	if clamped == ppb {
+		s.saturated = false
+		return ppb
+	}
+	if !s.saturated {
+		log.Warningf("servo: frequency adjustment of %.3f PPB saturated at %.3f PPB", ppb, clamped)
+	}
+	s.saturated = true
+	s.saturations++
+	return clamped
+}
+
+// Sample takes an offset (in ns) measured at local time localTs (in ns) and returns frequency
+// adjustment (in PPB) along with the servo state.
+// As in linuxptp, the clock frequency should be set to the negated returned value.
+func (s *PiServo) Sample(offset int64, localTs uint64) (float64, State) {
+	var ppb float64
+	state := StateInit
+	s.lastSample = localTs
+
+	switch s.count {
+	case 0:
+		s.offset[0] = offset
+		s.local[0] = localTs
+		s.count = 1
+	case 1:
+		s.offset[1] = offset
+		s.local[1] = localTs
+
+		// make sure the first sample is older than the second
+		if s.local[0] >= s.local[1] {
+			s.count = 0
+			break
+		}
+
+		// estimate the frequency offset from the first two samples
+		s.drift = s.saturate(s.drift + float64(s.offset[1]-s.offset[0])*1e9/float64(s.local[1]-s.local[0]))
+
+		if s.cfg.StepThreshold != 0 && abs(s.offset[1]) > int64(s.cfg.StepThreshold) {
+			state = StateJump
+		} else {
+			state = StateLocked
+		}
+		ppb = s.drift
+		s.count = 2
+	case 2:
+		if s.cfg.StepThreshold != 0 && abs(offset) > int64(s.cfg.StepThreshold) {
+			s.count = 0
+			break
+		}
+
+		interval := float64(localTs-s.local[1]) / 1e9
+		s.local[1] = localTs
+		kiTerm := s.cfg.KI * float64(offset) * interval
+		ppb = s.saturate(s.cfg.KP*float64(offset) + s.drift + kiTerm)
+		if !s.saturated {
+			s.drift += kiTerm
+		}
+		state = StateLocked
+		s.trackFreq(s.drift)
+	}
+
+	return ppb, state
+}
+
+// trackFreq records frequency estimates to compute frequency stability
+func (s *PiServo) trackFreq(freq float64) {
+	if len(s.freqs) == stabilityWindow {
+		copy(s.freqs, s.freqs[1:])
+		s.freqs = s.freqs[:stabilityWindow-1]
+	}
+	s.freqs = append(s.freqs, freq)
+}
+
+// MeanFreq returns last good frequency estimate (in PPB) the clock should coast with in holdover
+func (s *PiServo) MeanFreq() float64 {
+	return s.drift
+}
+
+// Stability returns Allan-deviation-like frequency stability (in PPB) estimated over recent samples.
+// It can be used as a drift estimate for fbclock.ClockState
+func (s *PiServo) Stability() float64 {
+	if len(s.freqs) < 2 {
+		return 0
+	}
+	var sum float64
+	for i := 1; i < len(s.freqs); i++ {
+		d := s.freqs[i] - s.freqs[i-1]
+		sum += d * d
+	}
+	return math.Sqrt(sum / float64(2*(len(s.freqs)-1)))
+}
+
+// Saturated reports if the last frequency adjustment was clamped to MaxFreq
+func (s *PiServo) Saturated() bool {
+	return s.saturated
+}
+
+// Saturations returns the number of frequency adjustments clamped to MaxFreq
+func (s *PiServo) Saturations() uint64 {
+	return s.saturations
+}
+
+// IsHoldover checks if servo didn't get any samples within HoldoverTimeout as of localTs (in ns).
+// Loop reports StateHoldover then
+func (s *PiServo) IsHoldover(localTs uint64) bool {
+	if s.count < 2 || localTs < s.lastSample {
+		return false
+	}
+	return time.Duration(localTs-s.lastSample) > s.cfg.HoldoverTimeout
+}
+
+// Holdover returns the error bound accumulated after elapsed time in holdover.
+// It grows linearly with elapsed time at the rate of estimated frequency stability
+func (s *PiServo) Holdover(elapsed time.Duration) time.Duration {
+	if elapsed <= 0 {
+		return 0
+	}
+	return time.Duration(float64(elapsed) * s.Stability() / 1e9)
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,191 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servo
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPiServoSample(t *testing.T) {
+	s := NewPiServo(DefaultPiServoCfg(), 0)
+
+	ppb, state := s.Sample(1000, uint64(time.Second))
+	require.Equal(t, StateInit, state)
+	require.Equal(t, 0.0, ppb)
+
+	// 100ns drift over a second is 100 PPB
+	ppb, state = s.Sample(1100, uint64(2*time.Second))
+	require.Equal(t, StateLocked, state)
+	require.InDelta(t, 100.0, ppb, 0.001)
+
+	ppb, state = s.Sample(100, uint64(3*time.Second))
+	require.Equal(t, StateLocked, state)
+	// kp * offset + drift + ki * offset * interval
+	require.InDelta(t, 0.7*100+100+0.3*100, ppb, 0.001)
+	require.InDelta(t, 130.0, s.MeanFreq(), 0.001)
+}
+
+func TestPiServoSampleStep(t *testing.T) {
+	cfg := DefaultPiServoCfg()
+	cfg.StepThreshold = time.Millisecond
+	s := NewPiServo(cfg, 0)
+
+	_, state := s.Sample(int64(time.Second), uint64(time.Second))
+	require.Equal(t, StateInit, state)
+	_, state = s.Sample(int64(time.Second), uint64(2*time.Second))
+	require.Equal(t, StateJump, state)
+}
+
+func TestPiServoSampleOutOfOrder(t *testing.T) {
+	s := NewPiServo(DefaultPiServoCfg(), 0)
+
+	_, state := s.Sample(1000, uint64(2*time.Second))
+	require.Equal(t, StateInit, state)
+	// older sample resets the servo
+	_, state = s.Sample(1000, uint64(time.Second))
+	require.Equal(t, StateInit, state)
+	require.Equal(t, 0, s.count)
+}
+
+func TestPiServoClamp(t *testing.T) {
+	cfg := DefaultPiServoCfg()
+	cfg.MaxFreq = 500
+	s := NewPiServo(cfg, 0)
+
+	s.Sample(0, uint64(time.Second))
+	ppb, _ := s.Sample(int64(time.Millisecond), uint64(2*time.Second))
+	require.Equal(t, 500.0, ppb)
+}
+
+func TestPiServoSaturation(t *testing.T) {
+	s := NewPiServo(DefaultPiServoCfg(), 0)
+	// max adjustment of the clock, as phc.MaxAdjPPB would return
+	maxAdj := 1000.0
+	s.SetMaxFreq(maxAdj)
+
+	s.Sample(0, uint64(time.Second))
+	ppb, state := s.Sample(int64(time.Millisecond), uint64(2*time.Second))
+	require.Equal(t, StateLocked, state)
+	require.Equal(t, maxAdj, ppb)
+	require.True(t, s.Saturated())
+	require.Equal(t, uint64(1), s.Saturations())
+
+	ppb, _ = s.Sample(-int64(time.Millisecond), uint64(3*time.Second))
+	require.Equal(t, -maxAdj, ppb)
+	require.True(t, s.Saturated())
+	require.Equal(t, uint64(2), s.Saturations())
+	// integral term doesn't wind up while saturated
+	require.Equal(t, maxAdj, s.MeanFreq())
+
+	ppb, _ = s.Sample(-1000, uint64(4*time.Second))
+	require.InDelta(t, 0.7*-1000+maxAdj+0.3*-1000, ppb, 0.001)
+	require.False(t, s.Saturated())
+	require.Equal(t, uint64(2), s.Saturations())
+}
+
+func TestPiServoStability(t *testing.T) {
+	s := NewPiServo(DefaultPiServoCfg(), 0)
+	require.Equal(t, 0.0, s.Stability())
+
+	s.trackFreq(10)
+	s.trackFreq(12)
+	s.trackFreq(10)
+	// sqrt((4 + 4) / (2 * 2))
+	require.InDelta(t, 1.4142, s.Stability(), 0.0001)
+
+	for i := 0; i < 2*stabilityWindow; i++ {
+		s.trackFreq(5)
+	}
+	require.Equal(t, stabilityWindow, len(s.freqs))
+	require.Equal(t, 0.0, s.Stability())
+}
+
+func TestPiServoIsHoldover(t *testing.T) {
+	s := NewPiServo(DefaultPiServoCfg(), 0)
+	s.Sample(0, uint64(time.Second))
+	// not locked yet
+	require.False(t, s.IsHoldover(uint64(time.Minute)))
+
+	s.Sample(10, uint64(2*time.Second))
+	require.False(t, s.IsHoldover(uint64(3*time.Second)))
+	require.True(t, s.IsHoldover(uint64(2*time.Second+DefaultPiServoCfg().HoldoverTimeout+1)))
+}
+
+func TestPiServoHoldoverLinear(t *testing.T) {
+	s := NewPiServo(DefaultPiServoCfg(), 0)
+	s.trackFreq(100)
+	s.trackFreq(110)
+	s.trackFreq(100)
+	s.trackFreq(110)
+
+	require.Equal(t, time.Duration(0), s.Holdover(0))
+	require.Equal(t, time.Duration(0), s.Holdover(-time.Second))
+
+	b := s.Holdover(time.Second)
+	require.Greater(t, b, time.Duration(0))
+	for i := 2; i < 10; i++ {
+		require.InDelta(t, float64(b)*float64(i), float64(s.Holdover(time.Duration(i)*time.Second)), float64(i))
+	}
+}
+
+func TestPiServoStateRoundTrip(t *testing.T) {
+	s := NewPiServo(DefaultPiServoCfg(), 0)
+	s.Sample(0, 1000000000)
+	s.Sample(10000, 2000000000)
+	require.InDelta(t, 10000.0, s.MeanFreq(), 0.001)
+
+	restored, err := ServoFromState(DefaultPiServoCfg(), s.MarshalState())
+	require.NoError(t, err)
+	require.Equal(t, s.MeanFreq(), restored.MeanFreq())
+	// restored servo still has to collect samples before producing adjustments
+	_, state := restored.Sample(0, 3000000000)
+	require.Equal(t, StateInit, state)
+}
+
+func TestServoFromStateClamp(t *testing.T) {
+	s := NewPiServo(DefaultPiServoCfg(), 5000)
+	cfg := DefaultPiServoCfg()
+	cfg.MaxFreq = 1000
+	restored, err := ServoFromState(cfg, s.MarshalState())
+	require.NoError(t, err)
+	require.Equal(t, 1000.0, restored.MeanFreq())
+}
+
+func TestServoFromStateInvalid(t *testing.T) {
+	_, err := ServoFromState(DefaultPiServoCfg(), nil)
+	require.Error(t, err)
+
+	b := NewPiServo(DefaultPiServoCfg(), 0).MarshalState()
+	b[0] = 42
+	_, err = ServoFromState(DefaultPiServoCfg(), b)
+	require.Error(t, err)
+
+	b = NewPiServo(DefaultPiServoCfg(), math.NaN()).MarshalState()
+	_, err = ServoFromState(DefaultPiServoCfg(), b)
+	require.Error(t, err)
+}
+
+func TestStateString(t *testing.T) {
+	require.Equal(t, "INIT", StateInit.String())
+	require.Equal(t, "JUMP", StateJump.String())
+	require.Equal(t, "LOCKED", StateLocked.String())
+	require.Equal(t, "HOLDOVER", StateHoldover.String())
+}
@@ -0,0 +1,52 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package servo implements clock servo which calculates frequency adjustments
+of the disciplined clock based on measured offsets.
+
+PI servo is loosely based on pi.c from linuxptp.
+Loop runs the servo against a Clock and reports the result via stats package.
+Simulate runs the servo against a simulated clock to tune its constants without the hardware.
+*/
+package servo
+
+// State is a state of the servo
+type State uint8
+
+// All the states servo can be in
+const (
+	// StateInit means servo is collecting first samples
+	StateInit State = iota
+	// StateJump means clock needs to be stepped
+	StateJump
+	// StateLocked means servo is locked and produces frequency adjustments
+	StateLocked
+	// StateHoldover means servo didn't get samples within HoldoverTimeout and the clock is coasting
+	// with the last frequency adjustment. Reported by Loop when measuring the offset fails
+	StateHoldover
+)
+
+var stateToString = map[State]string{
+	StateInit:     "INIT",
+	StateJump:     "JUMP",
+	StateLocked:   "LOCKED",
+	StateHoldover: "HOLDOVER",
+}
+
+func (s State) String() string {
+	return stateToString[s]
+}
@@ -0,0 +1,152 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servo
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/facebook/time/servo/stats"
+)
+
+// Scenario describes the clock a servo is simulated against
+type Scenario struct {
+	// Duration is the simulated time
+	Duration time.Duration
+	// Interval is the time between offset measurements. Defaults to 1 second
+	Interval time.Duration
+	// InitialOffset is the offset of the clock from the reference when simulation starts
+	InitialOffset time.Duration
+	// Drift is the frequency error of the free running clock in PPB
+	Drift float64
+	// Wander is the standard deviation of the frequency error random walk in PPB per interval
+	Wander float64
+	// Noise is the standard deviation of the white noise added to each offset measurement
+	Noise time.Duration
+	// SettleThreshold is the offset the clock has to stay within to be considered settled
+	SettleThreshold time.Duration
+	// Seed makes noise and wander reproducible
+	Seed int64
+}
+
+// Result is the outcome of a servo simulation
+type Result struct {
+	// Settled reports if the clock stayed within SettleThreshold until the end of simulation
+	Settled bool
+	// SettlingTime is the time it took the clock to settle. It equals Duration if it never did
+	SettlingTime time.Duration
+	// RMS is the root mean square of the offset once settled, or over the whole simulation otherwise
+	RMS time.Duration
+	// MaxOffset is the largest absolute offset once settled, or over the whole simulation otherwise
+	MaxOffset time.Duration
+	// Steps is the number of times the clock was stepped
+	Steps int
+}
+
+// plant is a simulated clock with a wandering frequency error and noisy offset measurements
+type plant struct {
+	rand   *rand.Rand
+	now    time.Time
+	offset float64 // ns
+	drift  float64 // PPB
+	adj    float64 // PPB
+	wander float64
+	noise  float64
+	steps  int
+}
+
+func (p *plant) Offset() (time.Duration, time.Time, error) {
+	return time.Duration(p.offset + p.rand.NormFloat64()*p.noise), p.now, nil
+}
+
+func (p *plant) AdjFreqPPB(freqPPB float64) error {
+	p.adj = freqPPB
+	return nil
+}
+
+func (p *plant) Step(delta time.Duration) error {
+	p.offset += float64(delta)
+	p.steps++
+	return nil
+}
+
+func (p *plant) advance(d time.Duration) {
+	p.offset += (p.drift + p.adj) * d.Seconds()
+	p.drift += p.rand.NormFloat64() * p.wander
+	p.now = p.now.Add(d)
+}
+
+// Simulate runs PI servo with the given parameters through the Loop against a simulated clock.
+// It allows tuning servo constants against drift and jitter without the hardware
+func Simulate(params PiServoCfg, scenario Scenario) Result {
+	return SimulateServo(NewPiServo(params, 0), scenario)
+}
+
+// SimulateServo is like Simulate, but runs the provided servo, e.g. the one restored with ServoFromState.
+// The simulated clock starts with the frequency adjustment of the servo applied
+func SimulateServo(servo *PiServo, scenario Scenario) Result {
+	interval := scenario.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	p := &plant{
+		rand:   rand.New(rand.NewSource(scenario.Seed)),
+		now:    time.Unix(0, 0),
+		offset: float64(scenario.InitialOffset),
+		drift:  scenario.Drift,
+		wander: scenario.Wander,
+		noise:  float64(scenario.Noise),
+		adj:    -servo.MeanFreq(),
+	}
+	l := NewLoop(p, servo, stats.NewJSONStats(), interval)
+
+	var offsets []float64
+	settledAt := -1
+	for elapsed := time.Duration(0); elapsed < scenario.Duration; elapsed += interval {
+		// measurement errors are impossible with the simulated clock
+		_, _ = l.Tick()
+		p.advance(interval)
+		offsets = append(offsets, p.offset)
+		if math.Abs(p.offset) > float64(scenario.SettleThreshold) {
+			settledAt = -1
+		} else if settledAt < 0 {
+			settledAt = len(offsets) - 1
+		}
+	}
+
+	res := Result{
+		Settled:      settledAt >= 0,
+		SettlingTime: scenario.Duration,
+		Steps:        p.steps,
+	}
+	if res.Settled {
+		res.SettlingTime = time.Duration(settledAt+1) * interval
+		offsets = offsets[settledAt:]
+	}
+	if len(offsets) == 0 {
+		return res
+	}
+	var sum, maxOffset float64
+	for _, o := range offsets {
+		sum += o * o
+		maxOffset = math.Max(maxOffset, math.Abs(o))
+	}
+	res.RMS = time.Duration(math.Sqrt(sum / float64(len(offsets))))
+	res.MaxOffset = time.Duration(maxOffset)
+	return res
+}
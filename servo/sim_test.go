@@ -0,0 +1,83 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testScenario = Scenario{
+	Duration:        10 * time.Minute,
+	Interval:        time.Second,
+	InitialOffset:   5 * time.Microsecond,
+	Drift:           10000,
+	Wander:          0.5,
+	Noise:           50 * time.Nanosecond,
+	SettleThreshold: time.Microsecond,
+	Seed:            42,
+}
+
+func TestSimulateDefaults(t *testing.T) {
+	res := Simulate(DefaultPiServoCfg(), testScenario)
+	require.True(t, res.Settled)
+	require.Less(t, res.SettlingTime, 30*time.Second)
+	require.Less(t, res.RMS, 100*time.Nanosecond)
+	require.Equal(t, 0, res.Steps)
+}
+
+func TestSimulateReproducible(t *testing.T) {
+	require.Equal(t, Simulate(DefaultPiServoCfg(), testScenario), Simulate(DefaultPiServoCfg(), testScenario))
+}
+
+func TestSimulateNotSettled(t *testing.T) {
+	cfg := DefaultPiServoCfg()
+	// saturated servo can't compensate for the drift
+	cfg.MaxFreq = 1000
+	res := Simulate(cfg, testScenario)
+	require.False(t, res.Settled)
+	require.Equal(t, testScenario.Duration, res.SettlingTime)
+	require.Greater(t, res.RMS, time.Millisecond)
+}
+
+func TestSimulateStep(t *testing.T) {
+	cfg := DefaultPiServoCfg()
+	cfg.StepThreshold = time.Millisecond
+	scenario := testScenario
+	scenario.InitialOffset = time.Second
+	res := Simulate(cfg, scenario)
+	require.True(t, res.Settled)
+	require.Equal(t, 1, res.Steps)
+	require.Less(t, res.RMS, 100*time.Nanosecond)
+}
+
+func TestSimulateFromState(t *testing.T) {
+	// the clock was in sync before restart, only the frequency estimate is lost
+	scenario := testScenario
+	scenario.InitialOffset = 0
+	cold := Simulate(DefaultPiServoCfg(), scenario)
+	require.True(t, cold.Settled)
+
+	last := NewPiServo(DefaultPiServoCfg(), scenario.Drift)
+	restored, err := ServoFromState(DefaultPiServoCfg(), last.MarshalState())
+	require.NoError(t, err)
+	warm := SimulateServo(restored, scenario)
+	require.True(t, warm.Settled)
+	require.Less(t, warm.SettlingTime, cold.SettlingTime)
+}
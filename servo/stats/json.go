@@ -0,0 +1,107 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// JSONStats is what we want to report as stats via http
+type JSONStats struct {
+	report counters
+	counters
+}
+
+// NewJSONStats returns a new JSONStats
+func NewJSONStats() *JSONStats {
+	s := &JSONStats{}
+	return s
+}
+
+// Start runs http server and initializes maps
+func (s *JSONStats) Start(monitoringport int) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleRequest)
+	addr := fmt.Sprintf(":%d", monitoringport)
+	log.Infof("Starting http json server on %s", addr)
+	err := http.ListenAndServe(addr, mux)
+	if err != nil {
+		log.Fatalf("Failed to start listener: %v", err)
+	}
+}
+
+// Snapshot the values so they can be reported atomically
+func (s *JSONStats) Snapshot() {
+	s.report.offsetNS = atomic.LoadInt64(&s.offsetNS)
+	s.report.freqPPB = atomic.LoadInt64(&s.freqPPB)
+	s.report.state = atomic.LoadInt64(&s.state)
+	s.report.saturations = atomic.LoadInt64(&s.saturations)
+	s.report.measurementError = atomic.LoadInt64(&s.measurementError)
+}
+
+// Report returns a copy of the values as of the last Snapshot
+func (s *JSONStats) Report() map[string]int64 {
+	return s.report.toMap()
+}
+
+// handleRequest is a handler used for all http monitoring requests
+func (s *JSONStats) handleRequest(w http.ResponseWriter, r *http.Request) {
+	js, err := json.Marshal(s.report.toMap())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(js); err != nil {
+		log.Errorf("Failed to reply: %v", err)
+	}
+}
+
+// SetOffsetNS atomically sets the offset
+func (s *JSONStats) SetOffsetNS(offsetNS int64) {
+	atomic.StoreInt64(&s.offsetNS, offsetNS)
+}
+
+// SetFreqPPB atomically sets the frequency adjustment
+func (s *JSONStats) SetFreqPPB(freqPPB int64) {
+	atomic.StoreInt64(&s.freqPPB, freqPPB)
+}
+
+// SetState atomically sets the servo state
+func (s *JSONStats) SetState(state int64) {
+	atomic.StoreInt64(&s.state, state)
+}
+
+// SetSaturations atomically sets the number of saturations
+func (s *JSONStats) SetSaturations(saturations int64) {
+	atomic.StoreInt64(&s.saturations, saturations)
+}
+
+// IncMeasurementError atomically add 1 to the counter
+func (s *JSONStats) IncMeasurementError() {
+	atomic.AddInt64(&s.measurementError, 1)
+}
+
+// ResetMeasurementError atomically sets the counter to 0
+func (s *JSONStats) ResetMeasurementError() {
+	atomic.StoreInt64(&s.measurementError, 0)
+}
@@ -0,0 +1,85 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONStatsReset(t *testing.T) {
+	stats := JSONStats{}
+
+	stats.IncMeasurementError()
+	stats.ResetMeasurementError()
+	require.Equal(t, int64(0), stats.measurementError)
+}
+
+func TestJSONStatsSnapshot(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetOffsetNS(-42)
+	stats.SetFreqPPB(1000)
+	stats.SetState(2)
+	stats.SetSaturations(3)
+	stats.IncMeasurementError()
+	require.Equal(t, int64(0), stats.Report()["offset_ns"])
+
+	stats.Snapshot()
+
+	expectedMap := map[string]int64{
+		"offset_ns":        -42,
+		"freq_ppb":         1000,
+		"state":            2,
+		"saturations":      3,
+		"measurementerror": 1,
+	}
+	require.Equal(t, expectedMap, stats.Report())
+}
+
+func TestJSONExport(t *testing.T) {
+	stats := NewJSONStats()
+	stats.SetOffsetNS(1)
+	stats.SetState(2)
+	stats.Snapshot()
+
+	w := httptest.NewRecorder()
+	stats.handleRequest(w, httptest.NewRequest("GET", "/", nil))
+	resp := w.Result()
+	defer resp.Body.Close()
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	var data map[string]int64
+	err = json.Unmarshal(body, &data)
+	require.NoError(t, err)
+
+	expectedMap := map[string]int64{
+		"offset_ns":        1,
+		"freq_ppb":         0,
+		"state":            2,
+		"saturations":      0,
+		"measurementerror": 0,
+	}
+	require.Equal(t, expectedMap, data)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package stats implements statistics collection and reporting.
+It is used by servo loop to report the state of the disciplined clock, such as
+the offset, frequency adjustment and servo state.
+*/
+package stats
+
+// Stats is a metric collection interface
+type Stats interface {
+	// Start starts a stat reporter
+	// Use this for passive reporters
+	Start(monitoringport int)
+
+	// Snapshot the values so they can be reported atomically
+	Snapshot()
+
+	// SetOffsetNS atomically sets the offset of the clock from the reference
+	SetOffsetNS(offsetNS int64)
+
+	// SetFreqPPB atomically sets the frequency adjustment of the clock
+	SetFreqPPB(freqPPB int64)
+
+	// SetState atomically sets the servo state
+	SetState(state int64)
+
+	// SetSaturations atomically sets the number of frequency adjustments clamped by the servo
+	SetSaturations(saturations int64)
+
+	// IncMeasurementError atomically add 1 to the counter
+	IncMeasurementError()
+
+	// ResetMeasurementError atomically sets counter to 0
+	ResetMeasurementError()
+}
+
+type counters struct {
+	offsetNS         int64
+	freqPPB          int64
+	state            int64
+	saturations      int64
+	measurementError int64
+}
+
+// toMap converts counters to a map
+func (c *counters) toMap() (export map[string]int64) {
+	res := make(map[string]int64)
+	res["offset_ns"] = c.offsetNS
+	res["freq_ppb"] = c.freqPPB
+	res["state"] = c.state
+	res["saturations"] = c.saturations
+	res["measurementerror"] = c.measurementError
+
+	return res
+}
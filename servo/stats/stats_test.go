@@ -0,0 +1,43 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountersToMap(t *testing.T) {
+	c := counters{
+		offsetNS:         -1,
+		freqPPB:          2,
+		state:            3,
+		saturations:      4,
+		measurementError: 5,
+	}
+	result := c.toMap()
+
+	expectedMap := make(map[string]int64)
+	expectedMap["offset_ns"] = -1
+	expectedMap["freq_ppb"] = 2
+	expectedMap["state"] = 3
+	expectedMap["saturations"] = 4
+	expectedMap["measurementerror"] = 5
+
+	require.Equal(t, expectedMap, result)
+}
@@ -0,0 +1,55 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timesource
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/facebook/time/ntp/chrony"
+)
+
+// ChronySource reports offset of the system clock as tracked by chronyd
+type ChronySource struct {
+	Client *chrony.Client
+}
+
+// Offset requests tracking data from chronyd
+func (s *ChronySource) Offset(ctx context.Context) (offset, errorBound time.Duration, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	packet, err := s.Client.Communicate(chrony.NewTrackingPacket())
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get 'tracking' response: %w", err)
+	}
+	tracking, ok := packet.(*chrony.ReplyTracking)
+	if !ok {
+		return 0, 0, fmt.Errorf("got wrong 'tracking' response %+v", packet)
+	}
+	offset, errorBound = trackingOffset(&tracking.Tracking)
+	return offset, errorBound, nil
+}
+
+// trackingOffset derives offset and error bound from chrony tracking.
+// Error bound is the same as chronyc's "maximum error": root dispersion + root delay / 2
+func trackingOffset(t *chrony.Tracking) (offset, errorBound time.Duration) {
+	offset = t.EstimatedSystemOffset()
+	errorBound = secondsToDuration(t.RootDispersion + t.RootDelay/2)
+	return offset, errorBound
+}
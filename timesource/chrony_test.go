@@ -0,0 +1,36 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timesource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/facebook/time/ntp/chrony"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackingOffset(t *testing.T) {
+	tracking := &chrony.Tracking{
+		CurrentCorrection: 0.000002, // 2us slow
+		RootDelay:         0.0001,
+		RootDispersion:    0.00005,
+	}
+	offset, errorBound := trackingOffset(tracking)
+	require.Equal(t, -2*time.Microsecond, offset)
+	require.Equal(t, 100*time.Microsecond, errorBound)
+}
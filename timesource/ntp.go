@@ -0,0 +1,163 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timesource
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	ntp "github.com/facebook/time/ntp/protocol"
+)
+
+// defaultNTPTimeout is used when neither NTPSource.Timeout nor context deadline is set
+const defaultNTPTimeout = time.Second
+
+// NTPSource queries an NTP server with a single SNTP exchange
+type NTPSource struct {
+	// Server is host:port of the NTP server
+	Server  string
+	Timeout time.Duration
+	// Interleaved enables client/server interleaved mode, see Offset
+	Interleaved bool
+
+	mux  sync.Mutex
+	prev *ntpExchange
+}
+
+// ntpExchange holds timestamps of the last completed exchange needed for the interleaved mode
+type ntpExchange struct {
+	clientTx time.Time
+	clientRx time.Time
+	// raw timestamps as they go on the wire, to match them exactly
+	serverRxSec  uint32
+	serverRxFrac uint32
+	clientRxSec  uint32
+	clientRxFrac uint32
+	rootDistance time.Duration
+}
+
+// Offset performs an SNTP exchange with the server.
+// Kiss-o'-Death response is reported as *ntp.KissError.
+// In interleaved mode the request carries server receive and client receive timestamps of the previous exchange.
+// Capable server then responds with the transmit timestamp of its previous response, captured after it was sent,
+// and the offset is calculated from the previous exchange. The first exchange, or one with a server which
+// doesn't support interleaved mode, falls back to the basic mode.
+func (s *NTPSource) Offset(ctx context.Context) (offset, errorBound time.Duration, err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = defaultNTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", s.Server)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return 0, 0, err
+	}
+
+	originTime := time.Now()
+	sec, frac := ntp.Time(originTime)
+	request := &ntp.Packet{Settings: 0x1B, TxTimeSec: sec, TxTimeFrac: frac}
+	prev := s.prev
+	if !s.Interleaved {
+		prev = nil
+	}
+	if prev != nil {
+		request.OrigTimeSec, request.OrigTimeFrac = prev.serverRxSec, prev.serverRxFrac
+		request.RxTimeSec, request.RxTimeFrac = prev.clientRxSec, prev.clientRxFrac
+	}
+	b, err := request.Bytes()
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := conn.Write(b); err != nil {
+		return 0, 0, fmt.Errorf("sending request: %w", err)
+	}
+
+	buf := make([]byte, ntp.PacketSizeBytes)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return 0, 0, fmt.Errorf("reading response: %w", err)
+		}
+		clientReceiveTime := time.Now()
+		response, err := ntp.BytesToPacket(buf[:n])
+		if err != nil {
+			return 0, 0, fmt.Errorf("parsing response: %w", err)
+		}
+		basic := response.OrigTimeSec == sec && response.OrigTimeFrac == frac
+		interleaved := prev != nil && response.OrigTimeSec == prev.clientRxSec && response.OrigTimeFrac == prev.clientRxFrac
+		// skip stale responses to other requests
+		if !basic && !interleaved {
+			continue
+		}
+		// server asks us to back off, caller must honor it
+		if code, ok := response.KissCode(); ok {
+			s.prev = nil
+			return 0, 0, &ntp.KissError{Code: code}
+		}
+		if interleaved {
+			offset, errorBound = interleavedOffset(response, prev)
+		} else {
+			offset, errorBound = sntpOffset(response, originTime, clientReceiveTime)
+		}
+		s.prev = &ntpExchange{
+			clientTx:     originTime,
+			clientRx:     clientReceiveTime,
+			serverRxSec:  response.RxTimeSec,
+			serverRxFrac: response.RxTimeFrac,
+			rootDistance: response.RootDistance(),
+		}
+		s.prev.clientRxSec, s.prev.clientRxFrac = ntp.Time(clientReceiveTime)
+		return offset, errorBound, nil
+	}
+}
+
+// interleavedOffset calculates offset and error bound of the previous exchange
+// using the server transmit timestamp from the interleaved response
+func interleavedOffset(response *ntp.Packet, prev *ntpExchange) (offset, errorBound time.Duration) {
+	serverReceiveTime := ntp.Unix(prev.serverRxSec, prev.serverRxFrac)
+	serverTransmitTime := ntp.Unix(response.TxTimeSec, response.TxTimeFrac)
+	return exchangeOffset(prev.clientTx, serverReceiveTime, serverTransmitTime, prev.clientRx, prev.rootDistance)
+}
+
+// sntpOffset calculates offset and error bound of the exchange.
+// Error bound includes half of round trip delay and server's distance to the reference
+func sntpOffset(response *ntp.Packet, originTime, clientReceiveTime time.Time) (offset, errorBound time.Duration) {
+	serverReceiveTime := ntp.Unix(response.RxTimeSec, response.RxTimeFrac)
+	serverTransmitTime := ntp.Unix(response.TxTimeSec, response.TxTimeFrac)
+	return exchangeOffset(originTime, serverReceiveTime, serverTransmitTime, clientReceiveTime, response.RootDistance())
+}
+
+// exchangeOffset calculates offset and error bound from the four timestamps of the exchange
+func exchangeOffset(originTime, serverReceiveTime, serverTransmitTime, clientReceiveTime time.Time, rootDistance time.Duration) (offset, errorBound time.Duration) {
+	offset = -time.Duration(ntp.Offset(originTime, serverReceiveTime, serverTransmitTime, clientReceiveTime))
+	delay := time.Duration(ntp.RoundTripDelay(originTime, serverReceiveTime, serverTransmitTime, clientReceiveTime))
+	errorBound = abs(delay)/2 + rootDistance
+	return offset, errorBound
+}
@@ -0,0 +1,199 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timesource
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	ntp "github.com/facebook/time/ntp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSNTPOffset(t *testing.T) {
+	origin := time.Unix(1647359186, 0)
+	response := &ntp.Packet{RootDelay: 1 << 10, RootDispersion: 1 << 8}
+	// server is 10ms behind, network delay is 1ms each way, server took 1ms to respond
+	response.RxTimeSec, response.RxTimeFrac = ntp.Time(origin.Add(-9 * time.Millisecond))
+	response.TxTimeSec, response.TxTimeFrac = ntp.Time(origin.Add(-8 * time.Millisecond))
+	offset, errorBound := sntpOffset(response, origin, origin.Add(3*time.Millisecond))
+	require.InDelta(t, 10*time.Millisecond, offset, float64(time.Microsecond))
+	// 2ms / 2 + 15.625ms / 2 + 3.90625ms
+	require.InDelta(t, 12718750*time.Nanosecond, errorBound, float64(time.Microsecond))
+}
+
+func TestInterleavedOffset(t *testing.T) {
+	origin := time.Unix(1647359186, 0)
+	prev := &ntpExchange{
+		clientTx:     origin,
+		clientRx:     origin.Add(3 * time.Millisecond),
+		rootDistance: 2 * time.Millisecond,
+	}
+	prev.serverRxSec, prev.serverRxFrac = ntp.Time(origin.Add(-9 * time.Millisecond))
+	// transmit timestamp of the previous response arrives with the next one
+	response := &ntp.Packet{}
+	response.TxTimeSec, response.TxTimeFrac = ntp.Time(origin.Add(-8 * time.Millisecond))
+	offset, errorBound := interleavedOffset(response, prev)
+	require.InDelta(t, 10*time.Millisecond, offset, float64(time.Microsecond))
+	require.InDelta(t, 3*time.Millisecond, errorBound, float64(time.Microsecond))
+}
+
+// serveInterleavedNTP replies to count requests, in interleaved mode when the client asks for it.
+// It reports whether each response was interleaved
+func serveInterleavedNTP(t *testing.T, conn *net.UDPConn, offset time.Duration, count int) []bool {
+	var interleaved []bool
+	var lastRxSec, lastRxFrac, lastTxSec, lastTxFrac uint32
+	buf := make([]byte, ntp.PacketSizeBytes)
+	for i := 0; i < count; i++ {
+		n, addr, err := conn.ReadFromUDP(buf)
+		require.NoError(t, err)
+		rxSec, rxFrac := ntp.Time(time.Now().Add(offset))
+		request, err := ntp.BytesToPacket(buf[:n])
+		require.NoError(t, err)
+		response := &ntp.Packet{Settings: 0x1C, Stratum: 1, RxTimeSec: rxSec, RxTimeFrac: rxFrac}
+		isInterleaved := i > 0 && request.OrigTimeSec == lastRxSec && request.OrigTimeFrac == lastRxFrac
+		if isInterleaved {
+			response.OrigTimeSec, response.OrigTimeFrac = request.RxTimeSec, request.RxTimeFrac
+			response.TxTimeSec, response.TxTimeFrac = lastTxSec, lastTxFrac
+		} else {
+			response.OrigTimeSec, response.OrigTimeFrac = request.TxTimeSec, request.TxTimeFrac
+			response.TxTimeSec, response.TxTimeFrac = ntp.Time(time.Now().Add(offset))
+		}
+		interleaved = append(interleaved, isInterleaved)
+		b, err := response.Bytes()
+		require.NoError(t, err)
+		_, err = conn.WriteToUDP(b, addr)
+		require.NoError(t, err)
+		lastRxSec, lastRxFrac = rxSec, rxFrac
+		// timestamp taken after the response is sent, as with kernel or hardware timestamping
+		lastTxSec, lastTxFrac = ntp.Time(time.Now().Add(offset))
+	}
+	return interleaved
+}
+
+// serveNTP replies to a single request with the server clock shifted by offset
+func serveNTP(t *testing.T, conn *net.UDPConn, offset time.Duration) {
+	serveNTPPacket(t, conn, offset, &ntp.Packet{Settings: 0x1C, Stratum: 1})
+}
+
+// serveNTPPacket replies to a single request with the response template, filling its timestamps
+func serveNTPPacket(t *testing.T, conn *net.UDPConn, offset time.Duration, response *ntp.Packet) {
+	buf := make([]byte, ntp.PacketSizeBytes)
+	n, addr, err := conn.ReadFromUDP(buf)
+	require.NoError(t, err)
+	rx := time.Now().Add(offset)
+	request, err := ntp.BytesToPacket(buf[:n])
+	require.NoError(t, err)
+	response.OrigTimeSec, response.OrigTimeFrac = request.TxTimeSec, request.TxTimeFrac
+	response.RxTimeSec, response.RxTimeFrac = ntp.Time(rx)
+	response.TxTimeSec, response.TxTimeFrac = ntp.Time(time.Now().Add(offset))
+	b, err := response.Bytes()
+	require.NoError(t, err)
+	_, err = conn.WriteToUDP(b, addr)
+	require.NoError(t, err)
+}
+
+func TestNTPSource(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+	go serveNTP(t, conn, time.Second)
+
+	s := &NTPSource{Server: conn.LocalAddr().String()}
+	offset, errorBound, err := s.Offset(context.Background())
+	require.NoError(t, err)
+	require.InDelta(t, -time.Second, offset, float64(100*time.Millisecond))
+	require.Less(t, errorBound, 100*time.Millisecond)
+}
+
+func TestNTPSourceTimeout(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	s := &NTPSource{Server: conn.LocalAddr().String(), Timeout: 10 * time.Millisecond}
+	_, _, err = s.Offset(context.Background())
+	require.Error(t, err)
+}
+
+func TestNTPSourceKissOfDeath(t *testing.T) {
+	for code, refid := range map[string]uint32{ntp.KissRate: 0x52415445, ntp.KissDeny: 0x44454e59} {
+		t.Run(code, func(t *testing.T) {
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			require.NoError(t, err)
+			defer conn.Close()
+			go serveNTPPacket(t, conn, 0, &ntp.Packet{Settings: 0x24, Stratum: 0, ReferenceID: refid})
+
+			s := &NTPSource{Server: conn.LocalAddr().String()}
+			_, _, err = s.Offset(context.Background())
+			var kissErr *ntp.KissError
+			require.True(t, errors.As(err, &kissErr))
+			require.Equal(t, code, kissErr.Code)
+		})
+	}
+}
+
+func TestNTPSourceInterleaved(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+	done := make(chan []bool)
+	go func() { done <- serveInterleavedNTP(t, conn, time.Second, 3) }()
+
+	s := &NTPSource{Server: conn.LocalAddr().String(), Interleaved: true}
+	for i := 0; i < 3; i++ {
+		offset, errorBound, err := s.Offset(context.Background())
+		require.NoError(t, err)
+		require.InDelta(t, -time.Second, offset, float64(100*time.Millisecond))
+		require.Less(t, errorBound, 100*time.Millisecond)
+	}
+	// first exchange is basic, the following ones are interleaved
+	require.Equal(t, []bool{false, true, true}, <-done)
+}
+
+func TestNTPSourceInterleavedFallback(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// server without interleaved mode support always responds in basic mode
+	s := &NTPSource{Server: conn.LocalAddr().String(), Interleaved: true}
+	for i := 0; i < 2; i++ {
+		go serveNTP(t, conn, time.Second)
+		offset, _, err := s.Offset(context.Background())
+		require.NoError(t, err)
+		require.InDelta(t, -time.Second, offset, float64(100*time.Millisecond))
+	}
+}
+
+func TestNTPSourceBasic(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+	done := make(chan []bool)
+	go func() { done <- serveInterleavedNTP(t, conn, time.Second, 2) }()
+
+	s := &NTPSource{Server: conn.LocalAddr().String()}
+	for i := 0; i < 2; i++ {
+		_, _, err := s.Offset(context.Background())
+		require.NoError(t, err)
+	}
+	require.Equal(t, []bool{false, false}, <-done)
+}
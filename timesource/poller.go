@@ -0,0 +1,133 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timesource
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	ntp "github.com/facebook/time/ntp/protocol"
+)
+
+// Poll exponents (log2 seconds) bounds from RFC 5905
+const (
+	MinPoll = 4
+	MaxPoll = 17
+)
+
+const (
+	// pollLimit is the hysteresis of poll-adjust counter
+	pollLimit = 30
+	// pollGate is how many jitters offset may change by to be considered stable
+	pollGate = 4
+	// jitterAvg is the averaging constant of jitter
+	jitterAvg = 4
+)
+
+// Poller schedules polls of an NTP server, following RFC 5905 poll-adjust algorithm.
+// Interval grows while offset is stable, shrinks when it's not and backs off on Kiss-o'-Death.
+type Poller struct {
+	// MinPoll and MaxPoll bound the poll exponent, interval is 2^poll seconds
+	MinPoll int8
+	MaxPoll int8
+
+	poll       int8
+	count      int
+	jitter     float64
+	lastOffset time.Duration
+	hasOffset  bool
+	last       time.Time
+}
+
+// NewPoller creates a Poller starting at minPoll
+func NewPoller(minPoll, maxPoll int8) *Poller {
+	return &Poller{MinPoll: minPoll, MaxPoll: maxPoll, poll: minPoll}
+}
+
+// Poll returns current poll exponent
+func (p *Poller) Poll() int8 {
+	return p.poll
+}
+
+// Interval returns current poll interval
+func (p *Poller) Interval() time.Duration {
+	return time.Duration(1<<uint(p.poll)) * time.Second
+}
+
+// Next returns time of the next poll, zero time means poll now
+func (p *Poller) Next() time.Time {
+	if p.last.IsZero() {
+		return time.Time{}
+	}
+	return p.last.Add(p.Interval())
+}
+
+// Update accounts result of the poll made at now and adjusts the interval.
+// RATE kiss increases the interval, DENY and RSTR ones set it to MaxPoll.
+// Other errors leave the interval as is.
+func (p *Poller) Update(now time.Time, offset time.Duration, err error) {
+	p.last = now
+	if err != nil {
+		var kissErr *ntp.KissError
+		if !errors.As(err, &kissErr) {
+			return
+		}
+		p.count = 0
+		switch kissErr.Code {
+		case ntp.KissRate:
+			p.setPoll(p.poll + 1)
+		case ntp.KissDeny, ntp.KissRestrict:
+			p.setPoll(p.MaxPoll)
+		}
+		return
+	}
+	if !p.hasOffset {
+		p.lastOffset = offset
+		p.hasOffset = true
+		return
+	}
+	diff := float64(offset - p.lastOffset)
+	p.lastOffset = offset
+	stable := math.Abs(diff) <= pollGate*p.jitter
+	p.jitter = math.Sqrt(p.jitter*p.jitter + (diff*diff-p.jitter*p.jitter)/jitterAvg)
+
+	if stable {
+		p.count += int(p.poll)
+		if p.count > pollLimit {
+			p.count = 0
+			p.setPoll(p.poll + 1)
+		}
+		return
+	}
+	p.count -= 2 * int(p.poll)
+	if p.count < -pollLimit {
+		p.count = 0
+		p.setPoll(p.poll - 1)
+	}
+}
+
+// setPoll sets poll exponent clamped to [MinPoll, MaxPoll]
+func (p *Poller) setPoll(poll int8) {
+	if poll < p.MinPoll {
+		poll = p.MinPoll
+	}
+	if poll > p.MaxPoll {
+		poll = p.MaxPoll
+	}
+	p.poll = poll
+}
@@ -0,0 +1,83 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timesource
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ntp "github.com/facebook/time/ntp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollerInterval(t *testing.T) {
+	p := NewPoller(MinPoll, MaxPoll)
+	require.Equal(t, int8(MinPoll), p.Poll())
+	require.Equal(t, 16*time.Second, p.Interval())
+	require.True(t, p.Next().IsZero())
+
+	now := time.Unix(1647359186, 0)
+	p.Update(now, 0, nil)
+	require.Equal(t, now.Add(16*time.Second), p.Next())
+}
+
+func TestPollerStable(t *testing.T) {
+	p := NewPoller(4, 6)
+	now := time.Unix(1647359186, 0)
+	for i := 0; i < 100; i++ {
+		p.Update(now, time.Millisecond, nil)
+		now = p.Next()
+	}
+	require.Equal(t, int8(6), p.Poll())
+	require.Equal(t, 64*time.Second, p.Interval())
+}
+
+func TestPollerUnstable(t *testing.T) {
+	p := NewPoller(4, 10)
+	p.poll = 8
+	now := time.Unix(1647359186, 0)
+	offset := time.Microsecond
+	for i := 0; i < 4; i++ {
+		p.Update(now, offset, nil)
+		offset *= 10
+	}
+	require.Less(t, p.Poll(), int8(8))
+
+	for i := 0; i < 10; i++ {
+		p.Update(now, offset, nil)
+		offset *= 10
+	}
+	require.Equal(t, int8(4), p.Poll())
+}
+
+func TestPollerKissOfDeath(t *testing.T) {
+	p := NewPoller(4, 10)
+	now := time.Unix(1647359186, 0)
+	p.Update(now, 0, &ntp.KissError{Code: ntp.KissRate})
+	require.Equal(t, int8(5), p.Poll())
+	require.Equal(t, now.Add(32*time.Second), p.Next())
+
+	// other errors don't change the interval
+	p.Update(now, 0, errors.New("timeout"))
+	require.Equal(t, int8(5), p.Poll())
+
+	p.Update(now, 0, &ntp.KissError{Code: ntp.KissDeny})
+	require.Equal(t, int8(10), p.Poll())
+	p.Update(now, 0, &ntp.KissError{Code: ntp.KissRate})
+	require.Equal(t, int8(10), p.Poll())
+}
@@ -0,0 +1,110 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timesource
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Measurement is a result of a single source poll
+type Measurement struct {
+	// Index of the source in Selector.Sources
+	Index      int
+	Source     Source
+	Offset     time.Duration
+	ErrorBound time.Duration
+	Err        error
+}
+
+// Selector polls several sources and picks the one with the lowest error bound.
+// Selected source is kept until another one is better by more than Hysteresis or it fails,
+// so measurements don't jump between sources of similar quality.
+type Selector struct {
+	Sources    []Source
+	Hysteresis time.Duration
+
+	current  int
+	selected bool
+}
+
+// NewSelector creates a Selector over the sources
+func NewSelector(hysteresis time.Duration, sources ...Source) *Selector {
+	return &Selector{
+		Sources:    sources,
+		Hysteresis: hysteresis,
+	}
+}
+
+// Poll measures all sources concurrently
+func (s *Selector) Poll(ctx context.Context) []*Measurement {
+	results := make([]*Measurement, len(s.Sources))
+	var wg sync.WaitGroup
+	for i, src := range s.Sources {
+		wg.Add(1)
+		go func(i int, src Source) {
+			defer wg.Done()
+			m := &Measurement{Index: i, Source: src}
+			m.Offset, m.ErrorBound, m.Err = src.Offset(ctx)
+			results[i] = m
+		}(i, src)
+	}
+	wg.Wait()
+	return results
+}
+
+// Select polls all sources and returns the best measurement
+func (s *Selector) Select(ctx context.Context) (*Measurement, error) {
+	return s.pick(s.Poll(ctx))
+}
+
+// pick chooses the best measurement applying hysteresis to the currently selected source
+func (s *Selector) pick(results []*Measurement) (*Measurement, error) {
+	var best *Measurement
+	var errs []string
+	for _, m := range results {
+		if m.Err != nil {
+			log.Debugf("[timesource] source %d failed: %v", m.Index, m.Err)
+			errs = append(errs, fmt.Sprintf("source %d: %v", m.Index, m.Err))
+			continue
+		}
+		if best == nil || m.ErrorBound < best.ErrorBound {
+			best = m
+		}
+	}
+	if best == nil {
+		s.selected = false
+		return nil, fmt.Errorf("no usable sources: %s", strings.Join(errs, "; "))
+	}
+	if s.selected && s.current < len(results) && best.Index != s.current {
+		cur := results[s.current]
+		if cur.Err == nil && cur.ErrorBound-best.ErrorBound <= s.Hysteresis {
+			return cur, nil
+		}
+	}
+	if !s.selected || best.Index != s.current {
+		log.Infof("[timesource] selected source %d, error bound %v", best.Index, best.ErrorBound)
+	}
+	s.current = best.Index
+	s.selected = true
+	return best, nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timesource
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource struct {
+	offset     time.Duration
+	errorBound time.Duration
+	err        error
+}
+
+func (f *fakeSource) Offset(_ context.Context) (time.Duration, time.Duration, error) {
+	return f.offset, f.errorBound, f.err
+}
+
+func TestSelectorSelect(t *testing.T) {
+	a := &fakeSource{offset: time.Millisecond, errorBound: 100 * time.Microsecond}
+	b := &fakeSource{offset: time.Microsecond, errorBound: time.Microsecond}
+	s := NewSelector(0, a, b)
+
+	m, err := s.Select(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, m.Index)
+	require.Equal(t, b, m.Source)
+	require.Equal(t, time.Microsecond, m.Offset)
+	require.Equal(t, time.Microsecond, m.ErrorBound)
+}
+
+func TestSelectorHysteresis(t *testing.T) {
+	a := &fakeSource{errorBound: 100 * time.Microsecond}
+	b := &fakeSource{errorBound: 200 * time.Microsecond}
+	s := NewSelector(50*time.Microsecond, a, b)
+
+	m, err := s.Select(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, m.Index)
+
+	// b is better, but not by more than hysteresis
+	b.errorBound = 60 * time.Microsecond
+	m, err = s.Select(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, m.Index)
+
+	// now it's good enough to switch
+	b.errorBound = 40 * time.Microsecond
+	m, err = s.Select(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, m.Index)
+}
+
+func TestSelectorFailover(t *testing.T) {
+	a := &fakeSource{errorBound: time.Microsecond}
+	b := &fakeSource{errorBound: time.Millisecond}
+	s := &Selector{Sources: []Source{a, b}, Hysteresis: time.Second}
+
+	m, err := s.Select(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, m.Index)
+
+	a.err = fmt.Errorf("timeout")
+	m, err = s.Select(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, m.Index)
+
+	// a recovered but b is selected and within hysteresis
+	a.err = nil
+	m, err = s.Select(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, m.Index)
+}
+
+func TestSelectorNoSources(t *testing.T) {
+	a := &fakeSource{err: fmt.Errorf("timeout")}
+	s := NewSelector(0, a)
+	_, err := s.Select(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "source 0: timeout")
+
+	_, err = NewSelector(0).Select(context.Background())
+	require.Error(t, err)
+}
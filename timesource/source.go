@@ -0,0 +1,46 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package timesource provides a common interface over chrony, NTP and PTP time sources
+and a selector picking the best of them.
+*/
+package timesource
+
+import (
+	"context"
+	"time"
+)
+
+// Source is a time source we can measure local clock offset against
+type Source interface {
+	// Offset returns offset of the local clock from the source (local - source)
+	// and an upper bound of the measurement error
+	Offset(ctx context.Context) (offset, errorBound time.Duration, err error)
+}
+
+// abs returns absolute value of the duration
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// secondsToDuration converts float seconds to time.Duration
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
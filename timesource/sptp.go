@@ -0,0 +1,41 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timesource
+
+import (
+	"context"
+	"time"
+
+	"github.com/facebook/time/ptp/sptp"
+)
+
+// SPTPSource measures offset to a PTP server with a simple unicast PTP client
+type SPTPSource struct {
+	Client *sptp.Client
+	// Server is an address of the PTP server
+	Server string
+}
+
+// Offset performs a single PTP exchange with the server.
+// Error bound is the mean path delay, as path asymmetry can't be measured
+func (s *SPTPSource) Offset(ctx context.Context) (offset, errorBound time.Duration, err error) {
+	offset, delay, err := s.Client.Run(ctx, s.Server)
+	if err != nil {
+		return 0, 0, err
+	}
+	return offset, abs(delay), nil
+}
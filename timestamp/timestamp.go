@@ -119,6 +119,19 @@ func IPToSockaddr(ip net.IP, port int) unix.Sockaddr {
 	return sa
 }
 
+// SockaddrWithPort returns a copy of the socket address with the port replaced.
+// Unlike IPToSockaddr(SockaddrToIP(sa), port) it preserves the zone of IPv6 link-local addresses,
+// so packets go out the interface the address belongs to
+func SockaddrWithPort(sa unix.Sockaddr, port int) unix.Sockaddr {
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		return &unix.SockaddrInet4{Port: port, Addr: sa.Addr}
+	case *unix.SockaddrInet6:
+		return &unix.SockaddrInet6{Port: port, ZoneId: sa.ZoneId, Addr: sa.Addr}
+	}
+	return nil
+}
+
 // SockaddrToIP converts socket address to an IP
 // Somewhat copy from https://github.com/golang/go/blob/658b5e66ecbc41a49e6fb5aa63c5d9c804cf305f/src/net/udpsock_posix.go#L15
 func SockaddrToIP(sa unix.Sockaddr) net.IP {
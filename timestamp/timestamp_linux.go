@@ -242,6 +242,234 @@ func ReadTXtimestamp(connFd int) (time.Time, int, error) {
 	return ReadTXtimestampBuf(connFd, oob, toob)
 }
 
+// EnableTXTimestampsID makes the kernel tag TX timestamps of the socket with a counter of sent packets
+// (SOF_TIMESTAMPING_OPT_ID), so TXTimestampReader can tell which packet each one belongs to.
+// The counter (re)starts with 0 for the next packet. TX timestamps have to be enabled first
+func EnableTXTimestampsID(connFd int) error {
+	// SO_TIMESTAMPING_NEW isn't supported by getsockopt, flags are the same
+	flags, err := unix.GetsockoptInt(connFd, unix.SOL_SOCKET, unix.SO_TIMESTAMPING)
+	if err != nil {
+		return err
+	}
+	// kernel only resets the counter when the flag is turned on
+	if flags&unix.SOF_TIMESTAMPING_OPT_ID != 0 {
+		if err := unix.SetsockoptInt(connFd, unix.SOL_SOCKET, timestamping, flags&^unix.SOF_TIMESTAMPING_OPT_ID); err != nil {
+			return err
+		}
+	}
+	return unix.SetsockoptInt(connFd, unix.SOL_SOCKET, timestamping, flags|unix.SOF_TIMESTAMPING_OPT_ID)
+}
+
+// TXTimestamp is a TX timestamp read from the socket error queue
+type TXTimestamp struct {
+	Time time.Time
+	// ID is the counter of the packet the timestamp belongs to, set if EnableTXTimestampsID was called
+	ID uint32
+}
+
+// mmsghdr is struct mmsghdr of recvmmsg
+type mmsghdr struct {
+	hdr unix.Msghdr
+	len uint32
+}
+
+// TXTimestampReader drains several TX timestamps from the socket error queue in one recvmmsg call,
+// unlike ReadTXtimestampBuf which needs a syscall per timestamp. It's meant for batched sends, see BatchSender.
+//
+// Timestamps are told apart by the SOF_TIMESTAMPING_OPT_ID counter rather than by the sequenceId of the packet.
+// Sockets use SOF_TIMESTAMPING_OPT_TSONLY (which the kernel forces anyway for unprivileged processes
+// unless net.core.tstamp_allow_data is set), so the error queue carries no packet to parse. Without it
+// the packet comes back with the headers of the layer it was timestamped at, e.g. from the MAC header for hardware timestamps.
+// The counter is an equivalent key: the kernel assigns it to every datagram when it's sent,
+// in the order of send calls, so the sender knows the counter of each packet, e.g. the Sync of a client.
+// Buffers are allocated once, so it's not safe for concurrent use
+type TXTimestampReader struct {
+	msgs []mmsghdr
+	oob  []byte
+	ts   []TXTimestamp
+}
+
+// NewTXTimestampReader creates a TXTimestampReader draining up to n timestamps at once
+func NewTXTimestampReader(n int) *TXTimestampReader {
+	r := &TXTimestampReader{
+		msgs: make([]mmsghdr, n),
+		oob:  make([]byte, n*ControlSizeBytes),
+		ts:   make([]TXTimestamp, n),
+	}
+	for i := range r.msgs {
+		r.msgs[i].hdr.Control = &r.oob[i*ControlSizeBytes]
+	}
+	return r
+}
+
+// Read waits for TX timestamps of the socket and returns all of them which are queued, up to the reader size.
+// Timestamps are in the order packets were sent. The result is only valid until the next Read
+func (r *TXTimestampReader) Read(connFd int) ([]TXTimestamp, error) {
+	for i := range r.msgs {
+		r.msgs[i].hdr.SetControllen(ControlSizeBytes)
+	}
+	// Wait for the poll event, ignore the error
+	_ = waitForHWTS(connFd)
+	n, _, e1 := unix.Syscall6(unix.SYS_RECVMMSG, uintptr(connFd), uintptr(unsafe.Pointer(&r.msgs[0])), uintptr(len(r.msgs)), uintptr(unix.MSG_ERRQUEUE), 0, 0)
+	if e1 != 0 {
+		return nil, fmt.Errorf("no TX timestamp found: %w", e1)
+	}
+	for i := 0; i < int(n); i++ {
+		oob := r.oob[i*ControlSizeBytes : i*ControlSizeBytes+int(r.msgs[i].hdr.Controllen)]
+		ts, err := socketControlMessageTXTimestamp(oob)
+		if err != nil {
+			return nil, err
+		}
+		r.ts[i] = ts
+	}
+	return r.ts[:n], nil
+}
+
+// ReadBatch reads TX timestamps of len(ts) packets sent one after another into ts, in the order the packets were sent.
+// first is the EnableTXTimestampsID counter of the first packet. Timestamps of other packets,
+// e.g. which came too late for the previous batch, are dropped. It tries as many times as ReadTXtimestampBuf
+// and returns the number of attempts. Timestamps which weren't found are zero
+func (r *TXTimestampReader) ReadBatch(connFd int, first uint32, ts []time.Time) (int, error) {
+	for i := range ts {
+		ts[i] = time.Time{}
+	}
+	found := 0
+	attempts := 0
+	for ; found < len(ts) && attempts < maxTXTS; attempts++ {
+		read, err := r.Read(connFd)
+		if err != nil {
+			continue
+		}
+		for _, t := range read {
+			// counter wraps around
+			i := t.ID - first
+			if i < uint32(len(ts)) && ts[i].IsZero() {
+				ts[i] = t.Time
+				found++
+			}
+		}
+	}
+	if found < len(ts) {
+		return attempts, fmt.Errorf("%d of %d TX timestamps not found after %d tries", len(ts)-found, len(ts), attempts)
+	}
+	return attempts, nil
+}
+
+// BatchSender sends several packets in one sendmmsg call, the write side of TXTimestampReader.
+// Buffers are allocated once, so it's not safe for concurrent use
+type BatchSender struct {
+	msgs  []mmsghdr
+	iovs  []unix.Iovec
+	addrs []unix.RawSockaddrAny
+}
+
+// NewBatchSender creates a BatchSender sending up to n packets at once
+func NewBatchSender(n int) *BatchSender {
+	b := &BatchSender{
+		msgs:  make([]mmsghdr, n),
+		iovs:  make([]unix.Iovec, n),
+		addrs: make([]unix.RawSockaddrAny, n),
+	}
+	for i := range b.msgs {
+		b.msgs[i].hdr.Iov = &b.iovs[i]
+		b.msgs[i].hdr.SetIovlen(1)
+		b.msgs[i].hdr.Name = (*byte)(unsafe.Pointer(&b.addrs[i]))
+	}
+	return b
+}
+
+// Send sends packets to the respective addresses and returns how many were sent.
+// Packets past the sender size are not sent. Only IPv4 and IPv6 addresses are supported
+func (b *BatchSender) Send(connFd int, packets [][]byte, addrs []unix.Sockaddr) (int, error) {
+	if len(packets) != len(addrs) {
+		return 0, fmt.Errorf("%d packets for %d addresses", len(packets), len(addrs))
+	}
+	n := len(packets)
+	if n > len(b.msgs) {
+		n = len(b.msgs)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	for i := 0; i < n; i++ {
+		l, err := rawSockaddr(addrs[i], &b.addrs[i])
+		if err != nil {
+			return 0, err
+		}
+		b.msgs[i].hdr.Namelen = l
+		b.iovs[i].Base = &packets[i][0]
+		b.iovs[i].SetLen(len(packets[i]))
+	}
+	sent, _, e1 := unix.Syscall6(unix.SYS_SENDMMSG, uintptr(connFd), uintptr(unsafe.Pointer(&b.msgs[0])), uintptr(n), 0, 0, 0)
+	if e1 != 0 {
+		return 0, e1
+	}
+	return int(sent), nil
+}
+
+// rawSockaddr converts the address to its sendmmsg form and returns its size
+func rawSockaddr(sa unix.Sockaddr, raw *unix.RawSockaddrAny) (uint32, error) {
+	switch v := sa.(type) {
+	case *unix.SockaddrInet4:
+		r := (*unix.RawSockaddrInet4)(unsafe.Pointer(raw))
+		r.Family = unix.AF_INET
+		// port is in network byte order
+		p := (*[2]byte)(unsafe.Pointer(&r.Port))
+		p[0], p[1] = byte(v.Port>>8), byte(v.Port)
+		r.Addr = v.Addr
+		return unix.SizeofSockaddrInet4, nil
+	case *unix.SockaddrInet6:
+		r := (*unix.RawSockaddrInet6)(unsafe.Pointer(raw))
+		r.Family = unix.AF_INET6
+		p := (*[2]byte)(unsafe.Pointer(&r.Port))
+		p[0], p[1] = byte(v.Port>>8), byte(v.Port)
+		r.Flowinfo = 0
+		r.Addr = v.Addr
+		r.Scope_id = v.ZoneId
+		return unix.SizeofSockaddrInet6, nil
+	default:
+		return 0, fmt.Errorf("unsupported address type %T", sa)
+	}
+}
+
+// socketControlMessageTXTimestamp parses TX timestamp and its ID out of socket control messages
+// read from the error queue
+func socketControlMessageTXTimestamp(b []byte) (TXTimestamp, error) {
+	var res TXTimestamp
+	found := false
+	for i := 0; i+socketControlMessageHeaderOffset <= len(b); {
+		h := (*unix.Cmsghdr)(unsafe.Pointer(&b[i]))
+		mlen := int(h.Len)
+		if mlen < socketControlMessageHeaderOffset || i+mlen > len(b) {
+			break
+		}
+		data := b[i+socketControlMessageHeaderOffset : i+mlen]
+		switch {
+		case h.Level == unix.SOL_SOCKET && (int(h.Type) == unix.SO_TIMESTAMPING_NEW || int(h.Type) == unix.SO_TIMESTAMPING):
+			ts, err := scmDataToTime(data)
+			if err != nil {
+				return res, err
+			}
+			res.Time = ts
+			found = true
+		case h.Level == unix.SOL_IP && h.Type == unix.IP_RECVERR, h.Level == unix.SOL_IPV6 && h.Type == unix.IPV6_RECVERR:
+			if len(data) < int(unsafe.Sizeof(unix.SockExtendedErr{})) {
+				break
+			}
+			ee := (*unix.SockExtendedErr)(unsafe.Pointer(&data[0]))
+			if ee.Origin == unix.SO_EE_ORIGIN_TIMESTAMPING {
+				res.ID = ee.Data
+			}
+		}
+		// control messages are aligned to the word size
+		i += (mlen + int(unsafe.Sizeof(uintptr(0))) - 1) &^ (int(unsafe.Sizeof(uintptr(0))) - 1)
+	}
+	if !found {
+		return res, fmt.Errorf("failed to find timestamp in socket control message")
+	}
+	return res, nil
+}
+
 // socketControlMessageTimestamp is a very optimised version of ParseSocketControlMessage
 // https://github.com/golang/go/blob/2ebe77a2fda1ee9ff6fd9a3e08933ad1ebaea039/src/syscall/sockcmsg_unix.go#L40
 // which only parses the timestamp message type.
@@ -277,3 +277,231 @@ func TestReadPacketWithRXTXTimestamp(t *testing.T) {
 	require.Equal(t, 1, attempts)
 	require.Nil(t, err)
 }
+
+func TestEnableTXTimestampsID(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	connFd, err := ConnFd(conn)
+	require.NoError(t, err)
+	require.NoError(t, EnableSWTimestamps(connFd))
+	require.NoError(t, EnableTXTimestampsID(connFd))
+
+	flags, err := unix.GetsockoptInt(connFd, unix.SOL_SOCKET, unix.SO_TIMESTAMPING)
+	require.NoError(t, err)
+	require.Equal(t, unix.SOF_TIMESTAMPING_OPT_ID, flags&unix.SOF_TIMESTAMPING_OPT_ID)
+	require.Equal(t, unix.SOF_TIMESTAMPING_TX_SOFTWARE, flags&unix.SOF_TIMESTAMPING_TX_SOFTWARE)
+}
+
+func TestTXTimestampReader(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer conn.Close()
+	dst, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer dst.Close()
+
+	connFd, err := ConnFd(conn)
+	require.NoError(t, err)
+	require.NoError(t, EnableSWTimestamps(connFd))
+	require.NoError(t, EnableTXTimestampsID(connFd))
+
+	r := NewTXTimestampReader(4)
+	_, err = r.Read(connFd)
+	require.Error(t, err)
+
+	sa := IPToSockaddr(net.ParseIP("127.0.0.1"), dst.LocalAddr().(*net.UDPAddr).Port)
+	before := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, unix.Sendto(connFd, []byte{byte(i)}, 0, sa))
+	}
+	ts, err := r.Read(connFd)
+	require.NoError(t, err)
+	require.Len(t, ts, 3)
+	for i, tx := range ts {
+		require.Equal(t, uint32(i), tx.ID)
+		require.False(t, tx.Time.Before(before))
+	}
+	require.False(t, ts[1].Time.Before(ts[0].Time))
+
+	// more than the reader size is drained over several reads
+	for i := 0; i < 6; i++ {
+		require.NoError(t, unix.Sendto(connFd, []byte{byte(i)}, 0, sa))
+	}
+	ts, err = r.Read(connFd)
+	require.NoError(t, err)
+	require.Len(t, ts, 4)
+	require.Equal(t, uint32(3), ts[0].ID)
+	ts, err = r.Read(connFd)
+	require.NoError(t, err)
+	require.Len(t, ts, 2)
+	require.Equal(t, uint32(8), ts[1].ID)
+
+	// enabling again restarts the counter
+	require.NoError(t, EnableTXTimestampsID(connFd))
+	require.NoError(t, unix.Sendto(connFd, []byte{0}, 0, sa))
+	ts, err = r.Read(connFd)
+	require.NoError(t, err)
+	require.Len(t, ts, 1)
+	require.Equal(t, uint32(0), ts[0].ID)
+}
+
+func TestTXTimestampReaderReadBatch(t *testing.T) {
+	connFd, sa, done := testTXTimestampConn(t)
+	defer done()
+
+	r := NewTXTimestampReader(2)
+	// a late timestamp of an earlier packet is dropped
+	require.NoError(t, unix.Sendto(connFd, []byte{0}, 0, sa))
+	before := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, unix.Sendto(connFd, []byte{byte(i)}, 0, sa))
+	}
+	ts := make([]time.Time, 3)
+	attempts, err := r.ReadBatch(connFd, 1, ts)
+	require.NoError(t, err)
+	// reader takes 2 timestamps at once
+	require.Equal(t, 2, attempts)
+	for _, tx := range ts {
+		require.False(t, tx.Before(before))
+	}
+
+	// packet which was never sent
+	require.NoError(t, unix.Sendto(connFd, []byte{0}, 0, sa))
+	_, err = r.ReadBatch(connFd, 4, make([]time.Time, 2))
+	require.Error(t, err)
+}
+
+func TestBatchSender(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer conn.Close()
+	dst, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer dst.Close()
+
+	connFd, err := ConnFd(conn)
+	require.NoError(t, err)
+	require.NoError(t, EnableSWTimestamps(connFd))
+	require.NoError(t, EnableTXTimestampsID(connFd))
+
+	sa := IPToSockaddr(net.ParseIP("127.0.0.1"), dst.LocalAddr().(*net.UDPAddr).Port)
+	b := NewBatchSender(2)
+	_, err = b.Send(connFd, [][]byte{{1}}, nil)
+	require.Error(t, err)
+	_, err = b.Send(connFd, [][]byte{{1}}, []unix.Sockaddr{&unix.SockaddrUnix{Name: "/tmp/nope"}})
+	require.Error(t, err)
+
+	// packets past the sender size are left out
+	n, err := b.Send(connFd, [][]byte{{1}, {2, 2}, {3}}, []unix.Sockaddr{sa, sa, sa})
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	buf := make([]byte, PayloadSizeBytes)
+	require.NoError(t, dst.SetReadDeadline(time.Now().Add(time.Second)))
+	for i := 1; i <= 2; i++ {
+		read, err := dst.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, i, read)
+		require.Equal(t, byte(i), buf[0])
+	}
+
+	r := NewTXTimestampReader(4)
+	ts, err := r.Read(connFd)
+	require.NoError(t, err)
+	require.Len(t, ts, 2)
+	require.Equal(t, uint32(1), ts[1].ID)
+}
+
+func TestBatchSenderIPv6(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv6loopback, Port: 0})
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+	defer conn.Close()
+	dst, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv6loopback, Port: 0})
+	require.NoError(t, err)
+	defer dst.Close()
+
+	connFd, err := ConnFd(conn)
+	require.NoError(t, err)
+	sa := IPToSockaddr(net.IPv6loopback, dst.LocalAddr().(*net.UDPAddr).Port)
+	n, err := NewBatchSender(1).Send(connFd, [][]byte{{42}}, []unix.Sockaddr{sa})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	buf := make([]byte, PayloadSizeBytes)
+	require.NoError(t, dst.SetReadDeadline(time.Now().Add(time.Second)))
+	read, err := dst.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte{42}, buf[:read])
+}
+
+func TestSocketControlMessageTXTimestamp(t *testing.T) {
+	_, err := socketControlMessageTXTimestamp(make([]byte, ControlSizeBytes))
+	require.Error(t, err)
+}
+
+// txTimestampBatch is a number of packets sent at once by the batched TX timestamp benchmarks
+const txTimestampBatch = 16
+
+// testTXTimestampConn returns a socket with software TX timestamps tagged with EnableTXTimestampsID,
+// an address to send to and a cleanup func
+func testTXTimestampConn(t testing.TB) (int, unix.Sockaddr, func()) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	dst, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	connFd, err := ConnFd(conn)
+	require.NoError(t, err)
+	require.NoError(t, EnableSWTimestamps(connFd))
+	require.NoError(t, EnableTXTimestampsID(connFd))
+	sa := IPToSockaddr(net.ParseIP("127.0.0.1"), dst.LocalAddr().(*net.UDPAddr).Port)
+	return connFd, sa, func() {
+		conn.Close()
+		dst.Close()
+	}
+}
+
+// BenchmarkReadTXtimestampBuf reads TX timestamp after every packet: poll and at least 2 recvmsg each
+func BenchmarkReadTXtimestampBuf(b *testing.B) {
+	connFd, sa, done := testTXTimestampConn(b)
+	defer done()
+	oob := make([]byte, ControlSizeBytes)
+	toob := make([]byte, ControlSizeBytes)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < txTimestampBatch; i++ {
+			_ = unix.Sendto(connFd, []byte{byte(i)}, 0, sa)
+			if _, _, err := ReadTXtimestampBuf(connFd, oob, toob); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkTXTimestampReader sends the whole batch with one sendmmsg and reads its TX timestamps: poll and one recvmmsg
+func BenchmarkTXTimestampReader(b *testing.B) {
+	connFd, sa, done := testTXTimestampConn(b)
+	defer done()
+	r := NewTXTimestampReader(txTimestampBatch)
+	s := NewBatchSender(txTimestampBatch)
+	packets := make([][]byte, txTimestampBatch)
+	addrs := make([]unix.Sockaddr, txTimestampBatch)
+	for i := range packets {
+		packets[i] = []byte{byte(i)}
+		addrs[i] = sa
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := s.Send(connFd, packets, addrs); err != nil {
+			b.Fatal(err)
+		}
+		ts, err := r.Read(connFd)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(ts) != txTimestampBatch {
+			b.Fatalf("got %d TX timestamps, want %d", len(ts), txTimestampBatch)
+		}
+	}
+}
@@ -65,6 +65,20 @@ func TestIPToSockaddr(t *testing.T) {
 	require.Equal(t, expectedSA6, sa6)
 }
 
+func TestSockaddrWithPort(t *testing.T) {
+	sa4 := IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	require.Equal(t, IPToSockaddr(net.ParseIP("127.0.0.1"), 319), SockaddrWithPort(sa4, 319))
+
+	sa6 := &unix.SockaddrInet6{Port: 123, ZoneId: 2}
+	copy(sa6.Addr[:], net.ParseIP("fe80::1").To16())
+	expected := &unix.SockaddrInet6{Port: 319, ZoneId: 2, Addr: sa6.Addr}
+	require.Equal(t, expected, SockaddrWithPort(sa6, 319))
+	// original is untouched
+	require.Equal(t, 123, sa6.Port)
+
+	require.Nil(t, SockaddrWithPort(&unix.SockaddrUnix{}, 319))
+}
+
 func TestSockaddrToIP(t *testing.T) {
 	ip4 := net.ParseIP("127.0.0.1")
 	ip6 := net.ParseIP("::1")